@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+var detectADS bool
+
+// scanStreams 计算文件所有备用数据流的哈希，并与基线比较生成事件
+func scanStreams(path string, stored map[string]string) ([]Event, error) {
+	current, err := hashStreams(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var events []Event
+	for _, name := range names {
+		old, ok := stored[name]
+		switch {
+		case !ok:
+			events = append(events, Event{Type: "stream_new", Path: path, Stream: name, NewHash: current[name]})
+		case !sameContent(path+":"+name, old, current[name]):
+			events = append(events, Event{Type: "stream_modified", Path: path, Stream: name, OldHash: old, NewHash: current[name]})
+		}
+	}
+	var gone []string
+	for name := range stored {
+		if _, ok := current[name]; !ok {
+			gone = append(gone, name)
+		}
+	}
+	sort.Strings(gone)
+	for _, name := range gone {
+		events = append(events, Event{Type: "stream_deleted", Path: path, Stream: name, OldHash: stored[name]})
+	}
+	return events, nil
+}
+
+// hashStreams 返回文件各备用数据流的哈希，没有备用数据流时返回 nil
+func hashStreams(path string) (map[string]string, error) {
+	names, err := listStreams(path)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	current := make(map[string]string, len(names))
+	for _, name := range names {
+		hash, err := calculateFileHash(path + ":" + name)
+		if err != nil {
+			return nil, fmt.Errorf("读取数据流 %s 错误: %v", name, err)
+		}
+		current[name] = hash
+	}
+	return current, nil
+}
+
+// applyStreamEvent 把数据流变动写入基线记录，调用方需持有 dbMu
+func applyStreamEvent(ev Event) {
+	e := hashDB[ev.Path]
+	if e == nil {
+		e = &Entry{FirstSeen: ev.Time}
+		hashDB[ev.Path] = e
+	}
+	if e.Streams == nil {
+		e.Streams = make(map[string]string)
+	}
+	if ev.Type == "stream_deleted" {
+		delete(e.Streams, ev.Stream)
+	} else {
+		e.Streams[ev.Stream] = ev.NewHash
+	}
+	e.LastChanged = ev.Time
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+// 备用数据流只存在于 NTFS，其他系统上不做检测
+const adsSupported = false
+
+func listStreams(path string) ([]string, error) {
+	return nil, nil
+}
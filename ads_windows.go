@@ -0,0 +1,61 @@
+//go:build windows
+
+package main
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const adsSupported = true
+
+var (
+	modkernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+	procFindClose        = modkernel32.NewProc("FindClose")
+)
+
+// win32FindStreamData 对应 WIN32_FIND_STREAM_DATA
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+// listStreams 返回文件的备用数据流名称（不含默认的 ::$DATA 流）
+func listStreams(path string) ([]string, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data win32FindStreamData
+	h, _, callErr := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		if callErr == syscall.ERROR_HANDLE_EOF {
+			return nil, nil
+		}
+		return nil, callErr
+	}
+	defer procFindClose.Call(h)
+
+	var names []string
+	for {
+		// 流名称形如 :name:$DATA，默认数据流为 ::$DATA
+		name := syscall.UTF16ToString(data.StreamName[:])
+		name = strings.TrimSuffix(strings.TrimPrefix(name, ":"), ":$DATA")
+		if name != "" {
+			names = append(names, name)
+		}
+
+		r, _, callErr := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if r == 0 {
+			if callErr == syscall.ERROR_HANDLE_EOF {
+				break
+			}
+			return names, callErr
+		}
+	}
+	return names, nil
+}
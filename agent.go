@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AgentConfig 配置向远程收集端报告事件（gRPC，协议见 proto/webmonitor.proto）
+type AgentConfig struct {
+	Collector string `json:"collector"`           // 例如 https://collector.example.com:9443，http:// 表示明文 HTTP/2
+	Token     string `json:"token" secret:"true"` // 以 authorization: Bearer 元数据发送
+	CAFile    string `json:"ca_file"`
+	Insecure  bool   `json:"insecure_skip_verify"`
+	AgentID   string `json:"agent_id"` // 默认使用主机名
+	Timeout   string `json:"timeout"`
+}
+
+const (
+	collectorReportPath = "/webmonitor.v1.Collector/Report"
+	maxAgentQueue       = 5000
+)
+
+var (
+	agentCfg     AgentConfig
+	agentClient  *http.Client
+	agentTimeout = 30 * time.Second
+
+	// agentQueue 保存尚未成功报告的事件，失败后在下次扫描结束时重试
+	agentMu      sync.Mutex
+	agentQueue   []Event
+	agentSending sync.Mutex
+)
+
+type agentSummary struct {
+	Time          time.Time
+	Duration      time.Duration
+	Files         int
+	BaselineFiles int
+	Events        int
+	Errors        int
+	Pending       int
+	Coverage      float64
+}
+
+func configureAgent(c AgentConfig) error {
+	agentCfg = c
+	if c.Collector == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Collector)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("collector 应为 http:// 或 https:// 地址: %s", c.Collector)
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return fmt.Errorf("无效的 timeout: %v", err)
+		}
+		agentTimeout = d
+	}
+	if agentCfg.AgentID == "" {
+		agentCfg.AgentID = hostname()
+	}
+
+	// gRPC 要求 HTTP/2，明文地址使用 h2c
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(u.Scheme == "https")
+	protocols.SetUnencryptedHTTP2(u.Scheme == "http")
+	tr := &http.Transport{Protocols: protocols, TLSClientConfig: &tls.Config{InsecureSkipVerify: c.Insecure}}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return fmt.Errorf("读取 ca_file 失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("ca_file 中没有有效的证书: %s", c.CAFile)
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+	agentClient = &http.Client{Transport: tr, Timeout: agentTimeout}
+	return nil
+}
+
+// agentQueueEvent 把一次变动放入待报告队列，队列满时丢弃最早的事件
+func agentQueueEvent(ev Event) {
+	if agentClient == nil {
+		return
+	}
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	agentQueue = append(agentQueue, ev)
+	if len(agentQueue) > maxAgentQueue {
+		log.Printf("收集端报告队列已满，丢弃最早的 %d 条事件", len(agentQueue)-maxAgentQueue)
+		agentQueue = agentQueue[len(agentQueue)-maxAgentQueue:]
+	}
+}
+
+// agentFlushQueue 在程序退出前同步报告尚未发送的事件
+func agentFlushQueue() {
+	if agentClient == nil {
+		return
+	}
+	agentSending.Lock()
+	defer agentSending.Unlock()
+	agentMu.Lock()
+	events := agentQueue
+	agentQueue = nil
+	agentMu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+	err := agentSend(events, nil)
+	reportChannel("collector", err)
+	if err != nil {
+		log.Printf("退出前向收集端报告 %d 条事件失败: %v", len(events), err)
+	}
+}
+
+// agentReportScan 在每次扫描结束后异步报告排队的事件和扫描摘要
+func agentReportScan(sum agentSummary) {
+	if agentClient == nil {
+		return
+	}
+	sendWG.Add(1)
+	go func() {
+		defer sendWG.Done()
+		// 同一时间只有一个报告在发送，保证事件顺序
+		agentSending.Lock()
+		defer agentSending.Unlock()
+
+		agentMu.Lock()
+		events := agentQueue
+		agentQueue = nil
+		agentMu.Unlock()
+
+		err := agentSend(events, &sum)
+		reportChannel("collector", err)
+		if err != nil {
+			log.Printf("向收集端报告失败: %v", err)
+			agentMu.Lock()
+			agentQueue = append(events, agentQueue...)
+			if len(agentQueue) > maxAgentQueue {
+				agentQueue = agentQueue[len(agentQueue)-maxAgentQueue:]
+			}
+			agentMu.Unlock()
+		}
+	}()
+}
+
+func agentSend(events []Event, sum *agentSummary) error {
+	var body bytes.Buffer
+	body.Write(grpcFrame(agentMessage(1, encodeHello())))
+	for _, ev := range events {
+		body.Write(grpcFrame(agentMessage(2, encodeChangeEvent(ev))))
+	}
+	if sum != nil {
+		body.Write(grpcFrame(agentMessage(3, encodeScanSummary(*sum))))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(agentCfg.Collector, "/")+collectorReportPath, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", agentTimeout.Milliseconds()))
+	req.Header.Set("User-Agent", "webmonitor-agent")
+	if agentCfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+agentCfg.Token)
+	}
+
+	resp, err := agentClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("收集端返回 %s", resp.Status)
+	}
+
+	var received int64 = -1
+	for {
+		msg, err := readGRPCMessage(resp.Body, 1<<20)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取收集端响应失败: %v", err)
+		}
+		fields, err := pbParse(msg)
+		if err != nil {
+			return err
+		}
+		received = 0
+		for _, f := range fields {
+			if f.Num == 1 {
+				received = int64(f.Int)
+			}
+		}
+	}
+	if err := grpcStatus(resp); err != nil {
+		return err
+	}
+	if received < 0 {
+		return errors.New("收集端没有返回确认")
+	}
+	if len(events) > 0 {
+		log.Printf("已向收集端报告 %d 条事件", len(events))
+	}
+	return nil
+}
+
+// grpcStatus 检查 gRPC 状态码，只有头部没有正文的响应会把状态放在头部
+func grpcStatus(resp *http.Response) error {
+	code := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	if code == "" || code == "0" {
+		return nil
+	}
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+	return fmt.Errorf("收集端返回 gRPC 状态 %s: %s", code, msg)
+}
+
+func agentMessage(field int, body []byte) []byte {
+	var w pbWriter
+	w.bytes(field, body)
+	return w.buf
+}
+
+func encodeHello() []byte {
+	dbMu.Lock()
+	dirs := monitorDirs
+	dbMu.Unlock()
+
+	var w pbWriter
+	w.string(1, agentCfg.AgentID)
+	w.string(2, hostname())
+	w.string(3, appversion)
+	w.strings(4, dirs)
+	return w.buf
+}
+
+func encodeChangeEvent(ev Event) []byte {
+	var w pbWriter
+	w.string(1, ev.Type)
+	w.string(2, ev.Path)
+	w.string(3, ev.OldPath)
+	w.string(4, ev.Stream)
+	w.int(5, ev.Size)
+	w.string(6, ev.OldHash)
+	w.string(7, ev.NewHash)
+	if !ev.Time.IsZero() {
+		w.int(8, ev.Time.UnixMilli())
+	}
+	w.string(9, ev.Severity)
+	w.string(10, ev.Mount)
+	w.int(11, int64(ev.Risk))
+	w.strings(12, ev.Signals)
+	w.strings(13, ev.Findings)
+	w.string(14, ev.Diff)
+	return w.buf
+}
+
+func encodeScanSummary(s agentSummary) []byte {
+	var w pbWriter
+	w.int(1, s.Time.UnixMilli())
+	w.int(2, s.Duration.Milliseconds())
+	w.int(3, int64(s.Files))
+	w.int(4, int64(s.BaselineFiles))
+	w.int(5, int64(s.Events))
+	w.int(6, int64(s.Errors))
+	w.int(7, int64(s.Pending))
+	w.double(8, s.Coverage)
+	return w.buf
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// aggregate 子命令：把多台服务器导出的事件和基线文件合并成一份汇总报告，
+// 适合还没有部署收集端（server 子命令）的团队。支持的输入文件：
+//   - JSON 接口 /events 的输出（事件数组）
+//   - -verify 或 -diff 的 -output json 输出
+//   - baseline export 导出的基线
+//   - 哈希数据库文件或 -ctl export 的输出
+// 主机名取文件名第一个 "." 之前的部分（web1.events.json 和 web1.baseline.json 都属于 web1），
+// 也可以写成 主机名=文件
+
+type aggregateHost struct {
+	Name         string     `json:"name"`
+	Sources      []string   `json:"sources"`
+	Files        int        `json:"files"` // 基线中的文件数，没有提供基线时为 0
+	Changes      int        `json:"changes"`
+	New          int        `json:"new"`
+	Modified     int        `json:"modified"`
+	Deleted      int        `json:"deleted"`
+	Renamed      int        `json:"renamed"`
+	Other        int        `json:"other"`
+	LastVerified *time.Time `json:"last_verified,omitempty"` // 基线中最近一次校验的时间
+	Stale        bool       `json:"stale"`
+
+	baseline map[string]string // 用于比较的路径 -> 哈希
+	events   map[string]bool   // 去重，同一事件可能出现在多个导出文件中
+}
+
+type aggregateDiff struct {
+	Path   string            `json:"path"`
+	Hashes map[string]string `json:"hashes"` // 主机 -> 哈希，空字符串表示该主机没有这个文件
+}
+
+type aggregateOutput struct {
+	Command    string          `json:"command"`
+	Status     string          `json:"status"` // clean, changes, error
+	Hosts      []aggregateHost `json:"hosts"`
+	Differing  []aggregateDiff `json:"differing"`
+	StaleHosts []string        `json:"stale_hosts"`
+	StaleAfter string          `json:"stale_after"`
+	Errors     []string        `json:"errors"`
+}
+
+var aggregateLimit int
+
+// runAggregate 汇总多台主机的导出文件。退出码 0 表示没有变动、差异和过期基线，1 表示有，2 表示出错
+func runAggregate(args []string) int {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	fs.StringVar(&outputFormat, "output", "text", "Output format: text or json")
+	fs.DurationVar(&staleAfter, "stale-after", 24*time.Hour, "Report hosts whose newest baseline verification is older than this")
+	fs.IntVar(&aggregateLimit, "limit", 100, "Maximum number of differing files to list in text output (0 for all)")
+	fs.Parse(args)
+
+	out := aggregateOutput{Command: "aggregate", Hosts: []aggregateHost{}, Differing: []aggregateDiff{},
+		StaleHosts: []string{}, StaleAfter: staleAfter.String(), Errors: []string{}}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "用法: aggregate [选项] [主机名=]文件...")
+		return exitError
+	}
+
+	hosts := make(map[string]*aggregateHost)
+	getHost := func(name string) *aggregateHost {
+		h, ok := hosts[name]
+		if !ok {
+			h = &aggregateHost{Name: name, Sources: []string{}, events: make(map[string]bool)}
+			hosts[name] = h
+		}
+		return h
+	}
+	for _, arg := range fs.Args() {
+		name, file := "", arg
+		if i := strings.Index(arg, "="); i > 0 {
+			name, file = arg[:i], arg[i+1:]
+		}
+		if err := aggregateFile(file, name, getHost); err != nil {
+			out.Errors = append(out.Errors, fmt.Sprintf("%s: %v", file, err))
+		}
+	}
+
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// 比较提供了基线的主机之间的差异
+	var withBaseline []*aggregateHost
+	paths := make(map[string]bool)
+	for _, name := range names {
+		h := hosts[name]
+		if h.baseline == nil {
+			continue
+		}
+		withBaseline = append(withBaseline, h)
+		for p := range h.baseline {
+			paths[p] = true
+		}
+	}
+	if len(withBaseline) > 1 {
+		for p := range paths {
+			d := aggregateDiff{Path: p, Hashes: make(map[string]string)}
+			same := true
+			for _, h := range withBaseline {
+				d.Hashes[h.Name] = h.baseline[p]
+				if h.baseline[p] != withBaseline[0].baseline[p] {
+					same = false
+				}
+			}
+			if !same {
+				out.Differing = append(out.Differing, d)
+			}
+		}
+		sort.Slice(out.Differing, func(i, j int) bool { return out.Differing[i].Path < out.Differing[j].Path })
+	}
+
+	for _, name := range names {
+		h := hosts[name]
+		if h.LastVerified != nil && now().Sub(*h.LastVerified) > staleAfter {
+			h.Stale = true
+			out.StaleHosts = append(out.StaleHosts, name)
+		}
+		out.Hosts = append(out.Hosts, *h)
+	}
+
+	changes := len(out.Differing) + len(out.StaleHosts)
+	for _, h := range out.Hosts {
+		changes += h.Changes
+	}
+	switch {
+	case len(out.Errors) > 0:
+		out.Status = "error"
+	case changes > 0:
+		out.Status = "changes"
+	default:
+		out.Status = "clean"
+	}
+
+	writeOutput(out, func(w io.Writer) { formatAggregate(w, out) })
+	for _, e := range out.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	switch out.Status {
+	case "error":
+		return exitError
+	case "changes":
+		return exitChanges
+	}
+	return exitClean
+}
+
+// aggregateFile 识别文件类型并把内容计入对应主机
+func aggregateFile(file, name string, getHost func(string) *aggregateHost) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = aggregateStem(file)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var events []Event
+		if err := json.Unmarshal(trimmed, &events); err != nil {
+			return fmt.Errorf("解析事件列表错误: %v", err)
+		}
+		h := getHost(name)
+		h.Sources = append(h.Sources, file)
+		h.addEvents(events)
+		return nil
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return fmt.Errorf("无法识别的文件格式: %v", err)
+	}
+	_, hasRoots := probe["roots"]
+	_, hasVersion := probe["version"]
+	_, hasChanges := probe["changes"]
+	_, hasCommand := probe["command"]
+	switch {
+	case hasRoots && hasVersion:
+		var exp baselineExport
+		if err := json.Unmarshal(trimmed, &exp); err != nil {
+			return fmt.Errorf("解析基线导出文件错误: %v", err)
+		}
+		// 导出文件中的路径相对于监控目录，多个监控目录时以目录名区分
+		db := make(map[string]*Entry)
+		for _, r := range exp.Roots {
+			for rel, e := range r.Files {
+				if len(exp.Roots) > 1 {
+					rel = filepath.Base(r.Dir) + "/" + rel
+				}
+				db[rel] = e
+			}
+		}
+		for p, e := range exp.Extra {
+			db[p] = e
+		}
+		h := getHost(name)
+		h.Sources = append(h.Sources, file)
+		h.addBaseline(db)
+	case hasChanges && hasCommand:
+		var v verifyOutput
+		if err := json.Unmarshal(trimmed, &v); err != nil {
+			return fmt.Errorf("解析 -verify 输出错误: %v", err)
+		}
+		h := getHost(name)
+		h.Sources = append(h.Sources, file)
+		h.addEvents(v.Changes)
+	default:
+		db, err := parseBaselineJSON(trimmed)
+		if err != nil {
+			return err
+		}
+		h := getHost(name)
+		h.Sources = append(h.Sources, file)
+		h.addBaseline(db)
+	}
+	return nil
+}
+
+func aggregateStem(file string) string {
+	name := filepath.Base(file)
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func (h *aggregateHost) addEvents(events []Event) {
+	for _, ev := range events {
+		key := ev.Type + "\x00" + ev.Path + "\x00" + ev.Stream + "\x00" + ev.Time.Format(time.RFC3339Nano)
+		if h.events[key] {
+			continue
+		}
+		h.events[key] = true
+		h.Changes++
+		switch ev.Type {
+		case "new":
+			h.New++
+		case "modified":
+			h.Modified++
+		case "deleted":
+			h.Deleted++
+		case "renamed":
+			h.Renamed++
+		default:
+			h.Other++
+		}
+	}
+}
+
+func (h *aggregateHost) addBaseline(db map[string]*Entry) {
+	if h.baseline == nil {
+		h.baseline = make(map[string]string)
+	}
+	for p, e := range db {
+		h.baseline[filepath.ToSlash(p)] = e.Hash
+		if h.LastVerified == nil || e.LastVerified.After(*h.LastVerified) {
+			t := e.LastVerified
+			h.LastVerified = &t
+		}
+	}
+	h.Files = len(h.baseline)
+}
+
+func formatAggregate(w io.Writer, out aggregateOutput) {
+	// 中文标题每个字占两列
+	fmt.Fprintf(w, "%-18s %6s %6s %4s %4s %4s %4s  %s\n", "主机", "文件", "变动", "新增", "修改", "删除", "移动", "最近校验")
+	for _, h := range out.Hosts {
+		last := "-"
+		if h.LastVerified != nil {
+			last = formatTime(*h.LastVerified)
+			if h.Stale {
+				last += "（已过期）"
+			}
+		}
+		fmt.Fprintf(w, "%-20s %8d %8d %6d %6d %6d %6d  %s\n", h.Name, h.Files, h.Changes, h.New, h.Modified, h.Deleted, h.Renamed, last)
+	}
+
+	if len(out.Differing) > 0 {
+		fmt.Fprintf(w, "\n各主机不一致的文件（%d 个）:\n", len(out.Differing))
+		for i, d := range out.Differing {
+			if aggregateLimit > 0 && i >= aggregateLimit {
+				fmt.Fprintf(w, "  ……另外 %d 个，使用 -output json 查看全部\n", len(out.Differing)-i)
+				break
+			}
+			hosts := make([]string, 0, len(d.Hashes))
+			for name := range d.Hashes {
+				hosts = append(hosts, name)
+			}
+			sort.Strings(hosts)
+			parts := make([]string, 0, len(hosts))
+			for _, name := range hosts {
+				hash := shortHash(d.Hashes[name])
+				if hash == "" {
+					hash = "缺失"
+				}
+				parts = append(parts, name+"="+hash)
+			}
+			fmt.Fprintf(w, "  %s  %s\n", d.Path, strings.Join(parts, " "))
+		}
+	}
+	if len(out.StaleHosts) > 0 {
+		fmt.Fprintf(w, "\n超过 %s 未校验基线的主机: %s\n", out.StaleAfter, strings.Join(out.StaleHosts, ", "))
+	}
+}
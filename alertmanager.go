@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertmanagerConfig 配置直接发送到 Prometheus Alertmanager（API v2）。
+// 每个文件变动是一条带 path、type、severity 标签的警报，由 Alertmanager 负责路由、分组和静默；
+// 警报在文件恢复原状（或人工确认模式下被确认）后自动解除
+type AlertmanagerConfig struct {
+	URLs         []string          `json:"urls"`          // 例如 ["http://alertmanager:9093"]，集群时列出所有实例
+	AlertName    string            `json:"alertname"`     // 默认 WebFileTampering
+	Labels       map[string]string `json:"labels"`        // 附加到每条警报的标签，例如 {"team": "web"}
+	GeneratorURL string            `json:"generator_url"` // 警报中的来源链接，例如控制台地址
+	BearerToken  string            `json:"bearer_token" secret:"true"`
+	Username     string            `json:"username"`
+	Password     string            `json:"password" secret:"true"`
+
+	ResendInterval string `json:"resend_interval"` // 未解除的警报重新发送的间隔，默认 1m
+	Hold           string `json:"hold"`            // 文件一直未恢复时警报保持多久，默认 24h
+	NoticeTTL      string `json:"notice_ttl"`      // 目录不可用等非文件警报的持续时间，默认 1h
+	Timeout        string `json:"timeout"`         // 默认 10s
+}
+
+// amAlert 是 Alertmanager API v2 的 postableAlert
+type amAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// amActive 是尚未解除的文件警报
+type amActive struct {
+	alert    amAlert
+	key      string // 与 pending 相同的键：路径或 路径:数据流
+	baseHash string // 变动前的哈希，文件恢复成该内容时解除；为空表示原来不存在，文件再次消失时解除
+	since    time.Time
+}
+
+var (
+	amMu       sync.Mutex
+	amAlerts   = make(map[string]*amActive)
+	amLoopOnce sync.Once
+
+	amLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+type alertmanagerNotifier struct {
+	cfg       AlertmanagerConfig
+	client    *http.Client
+	resend    time.Duration
+	hold      time.Duration
+	noticeTTL time.Duration
+}
+
+func newAlertmanagerNotifier(cfg AlertmanagerConfig) (*alertmanagerNotifier, error) {
+	an := &alertmanagerNotifier{cfg: cfg, resend: time.Minute, hold: 24 * time.Hour, noticeTTL: time.Hour}
+	if an.cfg.AlertName == "" {
+		an.cfg.AlertName = "WebFileTampering"
+	}
+	for name := range cfg.Labels {
+		if !amLabelName.MatchString(name) {
+			return nil, fmt.Errorf("标签名 %q 不合法", name)
+		}
+	}
+	for _, d := range []struct {
+		value string
+		dst   *time.Duration
+		name  string
+	}{{cfg.ResendInterval, &an.resend, "resend_interval"}, {cfg.Hold, &an.hold, "hold"}, {cfg.NoticeTTL, &an.noticeTTL, "notice_ttl"}} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("%s 格式错误: %s", d.name, d.value)
+		}
+		*d.dst = v
+	}
+	timeout := 10 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	an.client = &http.Client{Timeout: timeout}
+	amLoopOnce.Do(func() { go alertmanagerLoop() })
+	return an, nil
+}
+
+func (an *alertmanagerNotifier) labels(severity string) map[string]string {
+	labels := map[string]string{"alertname": an.cfg.AlertName, "instance": hostname(), "severity": severity}
+	for k, v := range an.cfg.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// endsAt 让 Alertmanager 在几次重发都未收到时自行解除警报，进程退出后警报不会一直挂着
+func (an *alertmanagerNotifier) endsAt(t time.Time) time.Time {
+	return t.Add(3 * an.resend)
+}
+
+func (an *alertmanagerNotifier) eventAlert(ev Event, t time.Time) amAlert {
+	labels := an.labels(ev.Severity)
+	labels["type"], labels["path"] = ev.Type, ev.Path
+	if ev.Stream != "" {
+		labels["stream"] = ev.Stream
+	}
+	text := describeEvent(ev)
+	annotations := map[string]string{
+		"summary":     strings.SplitN(text, "\n", 2)[0],
+		"description": formatEvent(ev),
+	}
+	if ev.OldHash != "" {
+		annotations["old_hash"] = ev.OldHash
+	}
+	if ev.NewHash != "" {
+		annotations["new_hash"] = ev.NewHash
+	}
+	if ev.Risk > 0 {
+		annotations["risk"] = strconv.Itoa(ev.Risk)
+		annotations["signals"] = strings.Join(ev.Signals, ",")
+	}
+	return amAlert{Labels: labels, Annotations: annotations, StartsAt: ev.Time, EndsAt: an.endsAt(t), GeneratorURL: an.cfg.GeneratorURL}
+}
+
+// trackedEvent 判断事件是否按文件跟踪并在恢复后解除
+func trackedEvent(ev Event) bool {
+	switch ev.Type {
+	case "new", "modified", "deleted", "renamed", "stream_new", "stream_modified", "stream_deleted":
+		return true
+	}
+	return false
+}
+
+func (an *alertmanagerNotifier) Send(n Notification) error {
+	t := now()
+	var alerts []amAlert
+	if len(n.Events) == 0 {
+		summary := strings.SplitN(n.Text, "\n", 2)[0]
+		labels := an.labels(n.Severity)
+		labels["type"], labels["reason"] = "notice", summary
+		alerts = append(alerts, amAlert{Labels: labels, Annotations: map[string]string{"summary": summary, "description": n.Text},
+			StartsAt: n.Time, EndsAt: t.Add(an.noticeTTL), GeneratorURL: an.cfg.GeneratorURL})
+	}
+
+	amMu.Lock()
+	for _, ev := range n.Events {
+		a := an.eventAlert(ev, t)
+		if !trackedEvent(ev) {
+			a.EndsAt = t.Add(an.noticeTTL)
+			alerts = append(alerts, a)
+			continue
+		}
+		key := pendingKey(ev)
+		base := ev.OldHash
+		if ev.Type == "renamed" {
+			base = ""
+		}
+		if prev, ok := amAlerts[key]; ok {
+			// 同一文件再次变动时沿用最初的哈希，恢复到变动前的内容才算解除
+			base = prev.baseHash
+			if sameStringMap(prev.alert.Labels, a.Labels) {
+				a.StartsAt = prev.alert.StartsAt
+			} else {
+				prev.alert.EndsAt = t
+				alerts = append(alerts, prev.alert)
+			}
+		}
+		amAlerts[key] = &amActive{alert: a, key: key, baseHash: base, since: t}
+		alerts = append(alerts, a)
+	}
+	amMu.Unlock()
+	return an.post(alerts)
+}
+
+func sameStringMap(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// alertmanagerLoop 定时重发未解除的警报，并解除已恢复的文件的警报
+func alertmanagerLoop() {
+	for {
+		registered, _ := currentNotifiers()
+		an, ok := registered["alertmanager"].(*alertmanagerNotifier)
+		if !ok {
+			time.Sleep(time.Minute)
+			continue
+		}
+		time.Sleep(an.resend)
+		if err := an.refresh(); err != nil {
+			log.Printf("通知渠道 alertmanager 发送失败: %v", err)
+			reportChannel("alertmanager", err)
+		}
+	}
+}
+
+func (an *alertmanagerNotifier) refresh() error {
+	amMu.Lock()
+	active := make([]*amActive, 0, len(amAlerts))
+	for _, a := range amAlerts {
+		active = append(active, a)
+	}
+	amMu.Unlock()
+
+	t := now()
+	var alerts []amAlert
+	for _, a := range active {
+		resolution := amResolution(a)
+		amMu.Lock()
+		if amAlerts[a.key] != a {
+			// 期间又有新的变动，下次再处理
+			amMu.Unlock()
+			continue
+		}
+		switch {
+		case resolution != "":
+			a.alert.EndsAt = t
+			a.alert.Annotations = copyStringMap(a.alert.Annotations)
+			a.alert.Annotations["resolution"] = resolution
+			alerts = append(alerts, a.alert)
+			delete(amAlerts, a.key)
+		case t.Sub(a.since) > an.hold:
+			// 不再重发，由 Alertmanager 在 endsAt 到期后解除
+			delete(amAlerts, a.key)
+		default:
+			a.alert.EndsAt = an.endsAt(t)
+			alerts = append(alerts, a.alert)
+		}
+		amMu.Unlock()
+	}
+	return an.post(alerts)
+}
+
+// amResolution 判断文件警报是否可以解除：人工确认模式下变动已不在待确认列表中（已确认或已恢复），
+// 自动模式下文件已恢复成变动前的内容
+func amResolution(a *amActive) string {
+	if manualAccept || readOnly {
+		dbMu.Lock()
+		_, waiting := pending[a.key]
+		dbMu.Unlock()
+		if !waiting {
+			return "accepted_or_restored"
+		}
+		return ""
+	}
+	info, err := os.Lstat(a.key)
+	if a.baseHash == "" {
+		if os.IsNotExist(err) {
+			return "restored"
+		}
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+	if h, ok := specialHash(info); ok {
+		if h == a.baseHash {
+			return "restored"
+		}
+		return ""
+	}
+	if !info.Mode().IsRegular() {
+		return ""
+	}
+	h, err := calculateFileHash(a.key)
+	if err == nil && sameContent(a.key, a.baseHash, h) {
+		return "restored"
+	}
+	return ""
+}
+
+func (an *alertmanagerNotifier) post(alerts []amAlert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	// 与 Prometheus 一样发送到集群中的每个实例，只要有一个实例收到就算成功
+	var errs []string
+	for _, u := range an.cfg.URLs {
+		if err := an.postTo(u, body); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", u, err))
+		}
+	}
+	if len(errs) == len(an.cfg.URLs) {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	for _, e := range errs {
+		log.Printf("发送到 Alertmanager 失败 %s", e)
+	}
+	return nil
+}
+
+func (an *alertmanagerNotifier) postTo(base string, body []byte) error {
+	url := strings.TrimRight(base, "/")
+	if !strings.HasSuffix(url, "/api/v2/alerts") {
+		url += "/api/v2/alerts"
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if an.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+an.cfg.BearerToken)
+	} else if an.cfg.Username != "" {
+		req.SetBasicAuth(an.cfg.Username, an.cfg.Password)
+	}
+	resp, err := an.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("返回 %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
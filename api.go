@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIConfig 配置供外部工具使用的只读 JSON 接口
+type APIConfig struct {
+	Listen  string `json:"listen"`              // 例如 127.0.0.1:8081，留空不启用
+	Token   string `json:"token" secret:"true"` // 配置后请求需带 Authorization: Bearer <token>
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+
+	// VerifyTokens 只能调用 /verify 的令牌，分发给 Web 应用，不能读取事件和基线
+	VerifyTokens []string `json:"verify_tokens" secret:"true"`
+}
+
+const (
+	maxRecentEvents = 1000
+	defaultAPILimit = 100
+)
+
+var (
+	apiConfig APIConfig
+
+	eventsMu     sync.Mutex
+	recentEvents []Event
+)
+
+// rememberEvent 保存最近的变动事件，供 /events 查询
+func rememberEvent(ev Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	recentEvents = append(recentEvents, ev)
+	if len(recentEvents) > maxRecentEvents {
+		recentEvents = recentEvents[len(recentEvents)-maxRecentEvents:]
+	}
+}
+
+type apiBaselineEntry struct {
+	Path string `json:"path"`
+	*Entry
+	Pending *Event `json:"pending,omitempty"`
+}
+
+func startAPIServer() {
+	if apiConfig.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", apiGet(ctlHandleStatus))
+	mux.HandleFunc("/events", apiGet(apiHandleEvents))
+	mux.HandleFunc("/baseline", apiGet(apiHandleBaseline))
+	mux.HandleFunc("/verify", apiGet(apiHandleVerify))
+
+	srv := &http.Server{Addr: apiConfig.Listen, Handler: apiAuth(mux)}
+	go func() {
+		var err error
+		if apiConfig.TLSCert != "" && apiConfig.TLSKey != "" {
+			log.Printf("JSON 接口监听于 https://%s", apiConfig.Listen)
+			err = srv.ListenAndServeTLS(apiConfig.TLSCert, apiConfig.TLSKey)
+		} else {
+			log.Printf("JSON 接口监听于 http://%s", apiConfig.Listen)
+			err = srv.ListenAndServe()
+		}
+		log.Printf("JSON 接口服务退出: %v", err)
+	}()
+}
+
+func apiAuth(next http.Handler) http.Handler {
+	if apiConfig.Token == "" && len(apiConfig.VerifyTokens) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		allowed := apiConfig.Token == "" && r.URL.Path != "/verify"
+		if apiConfig.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiConfig.Token)) == 1 {
+			allowed = true
+		}
+		if r.URL.Path == "/verify" {
+			for _, t := range apiConfig.VerifyTokens {
+				if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					allowed = true
+				}
+			}
+		}
+		if !allowed {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="webmonitor"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiGet 限制接口只接受 GET 请求
+func apiGet(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// apiHandleEvents 返回最近的变动事件，最新的在前
+// 参数: since=RFC3339 时间, path=路径或目录前缀, type=事件类型, limit=条数
+func apiHandleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultAPILimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit 无效", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "since 应为 RFC3339 时间", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	path := cleanAPIPath(q.Get("path"))
+	typ := q.Get("type")
+
+	eventsMu.Lock()
+	all := append([]Event(nil), recentEvents...)
+	eventsMu.Unlock()
+
+	out := []Event{}
+	for i := len(all) - 1; i >= 0 && len(out) < limit; i-- {
+		ev := all[i]
+		if !since.IsZero() && ev.Time.Before(since) {
+			continue
+		}
+		if typ != "" && ev.Type != typ {
+			continue
+		}
+		if path != "" && ev.Path != path && !underDir(ev.Path, path) && ev.OldPath != path {
+			continue
+		}
+		out = append(out, ev)
+	}
+	ctlWriteJSON(w, out)
+}
+
+// apiHandleBaseline 查询哈希数据库，path 为文件时返回该文件的基线，为目录时返回目录下所有文件
+func apiHandleBaseline(w http.ResponseWriter, r *http.Request) {
+	path := cleanAPIPath(r.URL.Query().Get("path"))
+	if path == "" {
+		http.Error(w, "缺少 path 参数", http.StatusBadRequest)
+		return
+	}
+
+	dbMu.Lock()
+	var out []apiBaselineEntry
+	if e, ok := hashDB[path]; ok {
+		out = append(out, baselineEntry(path, e))
+	} else {
+		for p, e := range hashDB {
+			if underDir(p, path) {
+				out = append(out, baselineEntry(p, e))
+			}
+		}
+	}
+	dbMu.Unlock()
+
+	if len(out) == 0 {
+		http.Error(w, "基线中没有该路径: "+path, http.StatusNotFound)
+		return
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	ctlWriteJSON(w, out)
+}
+
+// baselineEntry 复制一条基线记录，调用方需持有 dbMu
+func baselineEntry(path string, e *Entry) apiBaselineEntry {
+	be := apiBaselineEntry{Path: path, Entry: copyEntry(e)}
+	if ev, ok := pending[path]; ok {
+		be.Pending = &ev
+	}
+	return be
+}
+
+func cleanAPIPath(p string) string {
+	if p == "" {
+		return ""
+	}
+	return filepath.Clean(p)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// 属性策略（wenjian.attributes）：按目录声明哪些变化需要报警，例如 /etc/nginx 关注权限和属主，
+// /var/www/html 只关注内容。未声明的变化不报警，直接写入基线；没有匹配任何目录的文件对所有变化报警
+
+const (
+	watchContent     = "content"     // 新增、修改、删除、移动，以及备用数据流
+	watchPermissions = "permissions" // 权限位
+	watchOwnership   = "ownership"   // 属主和属组
+	watchTimestamps  = "timestamps"  // 修改时间
+)
+
+var watchNames = []string{watchContent, watchPermissions, watchOwnership, watchTimestamps}
+
+// 各属性对应的策略项
+var attrWatch = map[string]string{
+	attrMode:  watchPermissions,
+	attrOwner: watchOwnership,
+	attrGroup: watchOwnership,
+	attrMTime: watchTimestamps,
+	attrSize:  watchContent,
+}
+
+type attrPolicy struct {
+	dir   string
+	watch map[string]bool
+}
+
+var attrPolicies []attrPolicy // 按目录从深到浅排序，先匹配的生效
+
+func applyAttributePolicy(c map[string][]string) error {
+	attrPolicies = nil
+	for dir, names := range c {
+		if len(names) == 0 {
+			return fmt.Errorf("属性策略 %s 至少需要一项（可选 content、permissions、ownership、timestamps），不需要监控请使用 exclude", dir)
+		}
+		p := attrPolicy{dir: filepath.Clean(dir), watch: make(map[string]bool)}
+		for _, n := range names {
+			if !containsString(watchNames, n) {
+				return fmt.Errorf("属性策略 %s 中的 %s 无效（可选 content、permissions、ownership、timestamps）", dir, n)
+			}
+			p.watch[n] = true
+		}
+		attrPolicies = append(attrPolicies, p)
+	}
+	sort.Slice(attrPolicies, func(i, j int) bool { return len(attrPolicies[i].dir) > len(attrPolicies[j].dir) })
+	return nil
+}
+
+// watched 判断文件的某项变化是否需要报警
+func watched(path, item string) bool {
+	for _, p := range attrPolicies {
+		if path == p.dir || underDir(path, p.dir) {
+			return p.watch[item]
+		}
+	}
+	return true
+}
+
+// watchedAttributes 返回属性变化中需要报警的部分
+func watchedAttributes(path string, attrs []string) []string {
+	var out []string
+	for _, a := range attrs {
+		if watched(path, attrWatch[a]) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// filterByAttributePolicy 把按策略不需要报警的变动分离出来。内容变化不报警、但权限或属主变化需要报警时，
+// 事件改为 attributes 事件，基线仍会更新为新内容。获得 setuid/setgid 或可执行位的变动总是报警
+func filterByAttributePolicy(events []Event) (alerted, silent []Event) {
+	if len(attrPolicies) == 0 {
+		return events, nil
+	}
+	for _, ev := range events {
+		switch ev.Type {
+		case "attributes":
+			attrs := watchedAttributes(ev.Path, ev.Attributes)
+			if suid, exec := privilegeGains(ev.OldMeta, ev.NewMeta); (suid || exec) && !containsString(attrs, attrMode) {
+				attrs = append(attrs, attrMode)
+			}
+			if len(attrs) == 0 {
+				silent = append(silent, ev)
+				continue
+			}
+			ev.Attributes = attrs
+		case "policy_violation":
+		default:
+			if watched(ev.Path, watchContent) || (ev.OldPath != "" && watched(ev.OldPath, watchContent)) {
+				break
+			}
+			if ev.Type == "modified" {
+				attrs := watchedAttributes(ev.Path, metaChanges(ev.OldMeta, ev.NewMeta))
+				if suid, exec := privilegeGains(ev.OldMeta, ev.NewMeta); (suid || exec) && !containsString(attrs, attrMode) {
+					attrs = append(attrs, attrMode)
+				}
+				if len(attrs) > 0 {
+					ev.Type, ev.Attributes = "attributes", attrs
+					break
+				}
+			}
+			silent = append(silent, ev)
+			continue
+		}
+		alerted = append(alerted, ev)
+	}
+	return alerted, silent
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 防篡改审计日志（audit_log）：每条警报追加一行 JSON 记录，记录中包含上一条记录的哈希，
+// 修改或删除中间任何一条都会使之后的链断开。配置 key 后每条记录另有 HMAC，没有密钥的攻击者
+// 不能重新计算整条链；心跳消息中附带链的最新位置，截掉末尾的记录也能与已发出的心跳对照发现。
+// 用 -verify-audit-log 校验整个日志
+
+// AuditLogConfig 配置防篡改审计日志
+type AuditLogConfig struct {
+	Path string `json:"path"`              // 日志文件，留空不记录
+	Key  string `json:"key" secret:"true"` // HMAC-SHA256 密钥，默认使用 hash_db_key
+}
+
+// auditEntry 是审计日志的一条记录，hash 为 hash、mac 置空时整条记录 JSON 的 SHA-256
+type auditEntry struct {
+	Seq      int64    `json:"seq"`
+	Time     string   `json:"time"`
+	Host     string   `json:"host"`
+	Severity string   `json:"severity"`
+	Text     string   `json:"text"`
+	Paths    []string `json:"paths,omitempty"`
+	Silenced bool     `json:"silenced,omitempty"`
+	Prev     string   `json:"prev"` // 上一条记录的 hash，第一条为空
+	Hash     string   `json:"hash"`
+	MAC      string   `json:"mac,omitempty"`
+}
+
+var (
+	auditLog   AuditLogConfig
+	auditLogMu sync.Mutex
+	// 已打开的日志及链的最新位置
+	auditLogPath string
+	auditLogSeq  int64
+	auditLogHead string
+
+	verifyAuditLogPath string
+)
+
+func applyAuditLogConfig(c AuditLogConfig) error {
+	if c.Key != "" && len(c.Key) < 16 {
+		return fmt.Errorf("audit_log.key 至少需要 16 个字符")
+	}
+	if c.Path != "" {
+		c.Path = filepath.Clean(c.Path)
+	}
+	auditLogMu.Lock()
+	auditLog = c
+	auditLogMu.Unlock()
+	return nil
+}
+
+func auditLogKey() []byte {
+	if auditLog.Key != "" {
+		return []byte(auditLog.Key)
+	}
+	return dbKey()
+}
+
+// entryHash 计算记录的哈希和 HMAC
+func entryHash(e auditEntry, key []byte) (string, string) {
+	e.Hash, e.MAC = "", ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	h := hex.EncodeToString(sum[:])
+	if len(key) == 0 {
+		return h, ""
+	}
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(h))
+	return h, hex.EncodeToString(m.Sum(nil))
+}
+
+// auditLogResult 是校验审计日志的结果
+type auditLogResult struct {
+	Records int64
+	Head    string
+	Problem string // 第一处问题，为空表示完整
+}
+
+// verifyAuditLogFile 逐条校验序号、哈希链和 HMAC；文件不存在视为空日志
+func verifyAuditLogFile(path string, key []byte) (auditLogResult, error) {
+	var res auditLogResult
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			res.Problem = fmt.Sprintf("第 %d 行无法解析: %v", line, err)
+			return res, nil
+		}
+		h, mac := entryHash(e, key)
+		switch {
+		case e.Seq != res.Records+1:
+			res.Problem = fmt.Sprintf("第 %d 行的序号为 %d，应为 %d，中间的记录被删除或插入", line, e.Seq, res.Records+1)
+		case e.Prev != res.Head:
+			res.Problem = fmt.Sprintf("第 %d 条记录的 prev 与上一条记录的哈希不符，链已断开", e.Seq)
+		case e.Hash != h:
+			res.Problem = fmt.Sprintf("第 %d 条记录的内容与哈希不符，记录被修改", e.Seq)
+		case len(key) > 0 && !hmac.Equal([]byte(e.MAC), []byte(mac)):
+			res.Problem = fmt.Sprintf("第 %d 条记录的 HMAC 不符，记录被修改或密钥不对", e.Seq)
+		}
+		// 出现问题后仍从这条记录接着往下链，使新记录可以追加
+		res.Records, res.Head = e.Seq, e.Hash
+		if res.Problem != "" {
+			return res, nil
+		}
+	}
+	return res, sc.Err()
+}
+
+// openAuditLog 在启动时校验审计日志并取得链的最新位置，日志已被破坏时报警，之后的记录接在最后一条之后
+func openAuditLog() {
+	auditLogMu.Lock()
+	path := auditLog.Path
+	auditLogMu.Unlock()
+	if path == "" || readOnly {
+		return
+	}
+	res, err := verifyAuditLogFile(path, auditLogKey())
+	if err != nil {
+		log.Printf("读取审计日志错误: %v", err)
+	}
+	auditLogMu.Lock()
+	auditLogPath, auditLogSeq, auditLogHead = path, res.Records, res.Head
+	auditLogMu.Unlock()
+	if res.Problem != "" {
+		alert(Notification{Severity: sevCritical, Text: fmt.Sprintf("审计日志 %s 校验失败，日志可能被篡改: %s", path, res.Problem)})
+		return
+	}
+	log.Printf("审计日志: %s，已有 %d 条记录", path, res.Records)
+}
+
+// appendAuditLog 把一条警报追加到审计日志并同步到磁盘
+func appendAuditLog(n Notification, silenced bool) {
+	if oneShot || readOnly {
+		return
+	}
+	auditLogMu.Lock()
+	defer auditLogMu.Unlock()
+	if auditLog.Path == "" {
+		return
+	}
+	if auditLog.Path != auditLogPath {
+		// 重新加载配置后换了文件
+		res, _ := verifyAuditLogFile(auditLog.Path, auditLogKey())
+		auditLogPath, auditLogSeq, auditLogHead = auditLog.Path, res.Records, res.Head
+	}
+
+	e := auditEntry{Seq: auditLogSeq + 1, Time: n.Time.Format(time.RFC3339Nano), Host: hostname(),
+		Severity: n.Severity, Text: n.Text, Silenced: silenced, Prev: auditLogHead}
+	for _, ev := range n.Events {
+		e.Paths = append(e.Paths, ev.Path)
+	}
+	e.Hash, e.MAC = entryHash(e, auditLogKey())
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = appendSync(auditLogPath, append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("写入审计日志错误: %v", err)
+		return
+	}
+	auditLogSeq, auditLogHead = e.Seq, e.Hash
+}
+
+func appendSync(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditLogAnchor 返回链的最新位置，附在心跳中供日后对照
+func auditLogAnchor() string {
+	auditLogMu.Lock()
+	defer auditLogMu.Unlock()
+	if auditLogPath == "" {
+		return ""
+	}
+	head := auditLogHead
+	if len(head) > 16 {
+		head = head[:16]
+	}
+	return fmt.Sprintf("第 %d 条 %s", auditLogSeq, head)
+}
+
+// runVerifyAuditLog 校验审计日志（0 完整，1 被篡改，2 出错）
+func runVerifyAuditLog() int {
+	if configFile != "" {
+		oneShot = true
+		log.SetFlags(0)
+		log.SetOutput(timestampWriter{os.Stderr})
+		loadConfigFromFile()
+	}
+	if _, err := os.Stat(verifyAuditLogPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	key := auditLogKey()
+	res, err := verifyAuditLogFile(verifyAuditLogPath, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if res.Problem != "" {
+		fmt.Printf("审计日志已被篡改: %s\n", res.Problem)
+		return exitChanges
+	}
+	head := res.Head
+	if head == "" {
+		head = "-"
+	}
+	fmt.Printf("审计日志完整: %d 条记录，最新哈希 %s\n", res.Records, head)
+	if len(key) == 0 {
+		fmt.Println("注意：未配置 audit_log.key 或 hash_db_key，只校验了哈希链，能写入文件的人可以重新计算整条链；请与心跳中记录的位置对照")
+	}
+	return exitClean
+}
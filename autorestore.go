@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 自动恢复（auto_restore）：文件被修改或删除时，从可信备份（本地目录、rsync 目标或按哈希存放的内容库）
+// 取回与基线哈希一致的原内容，恢复权限、属主和修改时间后替换回去，再次校验一致才算成功。
+// 恢复成功的变动仍然报警，但基线保持原样；所有来源都取不到一致的内容时按正常流程处理
+
+const (
+	restoreSourceDir   = "dir"
+	restoreSourceRsync = "rsync"
+	restoreSourceStore = "store"
+)
+
+// AutoRestoreConfig 配置自动恢复，sources 为空表示不恢复
+type AutoRestoreConfig struct {
+	Types   []string        `json:"types"` // modified、deleted，默认两者
+	Dirs    []string        `json:"dirs"`  // 只恢复这些目录下的文件，留空表示所有监控目录
+	Sources []RestoreSource `json:"sources"`
+}
+
+// RestoreSource 是一个备份来源，按顺序尝试
+type RestoreSource struct {
+	Type   string   `json:"type"`   // dir、rsync 或 store
+	Path   string   `json:"path"`   // dir：与监控目录结构相同的备份目录；store：按哈希存放的内容库 <path>/<前两位>/<哈希>，留空表示 snapshots 的目录
+	Target string   `json:"target"` // rsync：远程备份位置，例如 backup@10.0.0.5:/srv/www
+	Root   string   `json:"root"`   // dir、rsync 对应的监控目录，留空表示文件所在的监控目录
+	Rsync  string   `json:"rsync"`  // rsync 命令，默认 rsync
+	Args   []string `json:"args"`   // rsync 的附加参数，例如 ["-e", "ssh -i /root/.ssh/backup"]
+}
+
+var autoRestore AutoRestoreConfig
+
+func applyAutoRestoreConfig(c AutoRestoreConfig) error {
+	for _, t := range c.Types {
+		if t != "modified" && t != "deleted" {
+			return fmt.Errorf("auto_restore.types 中的 %q 无效（可选 modified、deleted）", t)
+		}
+	}
+	for i, dir := range c.Dirs {
+		c.Dirs[i] = filepath.Clean(dir)
+	}
+	for i := range c.Sources {
+		s := &c.Sources[i]
+		switch s.Type {
+		case restoreSourceStore:
+			if s.Path != "" {
+				s.Path = filepath.Clean(s.Path)
+			}
+		case restoreSourceDir:
+			if s.Path == "" {
+				return fmt.Errorf("第 %d 个恢复来源缺少 path", i+1)
+			}
+			s.Path = filepath.Clean(s.Path)
+		case restoreSourceRsync:
+			if s.Target == "" {
+				return fmt.Errorf("第 %d 个恢复来源缺少 target", i+1)
+			}
+			if s.Rsync == "" {
+				s.Rsync = "rsync"
+			}
+		default:
+			return fmt.Errorf("第 %d 个恢复来源的类型 %q 无效（可选 dir、rsync、store）", i+1, s.Type)
+		}
+		if s.Root != "" {
+			s.Root = filepath.Clean(s.Root)
+		}
+	}
+	autoRestore = c
+	return nil
+}
+
+// autoRestoreEvent 尝试从备份恢复被修改或删除的文件，返回 true 表示已恢复并校验一致
+func autoRestoreEvent(ev *Event) bool {
+	if readOnly || oneShot || len(autoRestore.Sources) == 0 || ev.Stream != "" || ev.OldHash == "" {
+		return false
+	}
+	if ev.Type != "modified" && ev.Type != "deleted" {
+		return false
+	}
+	if len(autoRestore.Types) > 0 && !containsString(autoRestore.Types, ev.Type) {
+		return false
+	}
+	if len(autoRestore.Dirs) > 0 && !withinAny(ev.Path, autoRestore.Dirs) {
+		return false
+	}
+	if specialKind(ev.OldHash) != "" {
+		return false
+	}
+
+	dbMu.Lock()
+	var meta *FileMeta
+	if e := hashDB[ev.Path]; e != nil {
+		meta = e.Meta
+	}
+	dbMu.Unlock()
+
+	var errs []string
+	for _, src := range autoRestore.Sources {
+		name, err := restoreFrom(src, ev.Path, ev.OldHash, meta)
+		if err == nil {
+			ev.Findings = append(ev.Findings, fmt.Sprintf("已从 %s 恢复原内容，并校验与基线一致", name))
+			log.Printf("已从 %s 恢复 %s", name, ev.Path)
+			return true
+		}
+		errs = append(errs, err.Error())
+	}
+	log.Printf("自动恢复 %s 失败: %s", ev.Path, strings.Join(errs, "; "))
+	ev.Findings = append(ev.Findings, "自动恢复失败: "+strings.Join(errs, "; "))
+	return false
+}
+
+// restoreFrom 从一个来源取回文件，校验后替换到原路径，返回来源的描述
+func restoreFrom(src RestoreSource, path, hash string, meta *FileMeta) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".webmonitor-restore-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	name, err := fetchBackup(src, path, hash, tmp)
+	tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	mode := os.FileMode(0644)
+	if meta != nil {
+		mode = meta.Mode.Perm()
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return "", err
+	}
+	if meta != nil {
+		if meta.UID >= 0 {
+			os.Lchown(tmpName, meta.UID, meta.GID)
+		}
+		os.Chtimes(tmpName, meta.MTime, meta.MTime)
+	}
+	if !restoredMatches(tmpName, hash) {
+		return "", fmt.Errorf("%s 中的内容与基线不一致", name)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return "", err
+	}
+	if !restoredMatches(path, hash) {
+		return "", fmt.Errorf("从 %s 恢复后再次校验不一致，文件可能仍在被改写", name)
+	}
+	return name, nil
+}
+
+func restoredMatches(path, stored string) bool {
+	h, err := calculateFileHash(path)
+	return err == nil && sameContent(path, stored, h)
+}
+
+// fetchBackup 把备份内容写入 dst
+func fetchBackup(src RestoreSource, path, hash string, dst *os.File) (string, error) {
+	switch src.Type {
+	case restoreSourceStore:
+		dir := src.Path
+		if dir == "" {
+			dir = snapshotDir()
+		}
+		file := snapshotObject(dir, hash)
+		if file == "" {
+			return "", fmt.Errorf("内容库不支持哈希 %s", hash)
+		}
+		return "内容库 " + dir, copyInto(dst, file)
+	case restoreSourceDir:
+		rel, err := backupRel(src, path)
+		if err != nil {
+			return "", err
+		}
+		return "备份目录 " + src.Path, copyInto(dst, filepath.Join(src.Path, rel))
+	case restoreSourceRsync:
+		rel, err := backupRel(src, path)
+		if err != nil {
+			return "", err
+		}
+		remote := strings.TrimSuffix(src.Target, "/") + "/" + filepath.ToSlash(rel)
+		args := append(append([]string{}, src.Args...), "--", remote, dst.Name())
+		if out, err := exec.Command(src.Rsync, args...).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("rsync %s 失败: %v %s", remote, err, strings.TrimSpace(string(out)))
+		}
+		return "rsync " + src.Target, nil
+	}
+	return "", fmt.Errorf("未知的恢复来源 %s", src.Type)
+}
+
+// backupRel 返回文件相对于备份对应的监控目录的路径
+func backupRel(src RestoreSource, path string) (string, error) {
+	root := src.Root
+	if root == "" {
+		var ok bool
+		if root, ok = rootFor(path, monitorDirs); !ok {
+			return "", fmt.Errorf("%s 不在监控目录中", path)
+		}
+	}
+	if !underDir(path, root) {
+		return "", fmt.Errorf("%s 不在 %s 中", path, root)
+	}
+	return filepath.Rel(root, path)
+}
+
+// hashDigest 去掉哈希记录中的算法前缀
+func hashDigest(h string) string {
+	if i := strings.LastIndex(h, ":"); i >= 0 {
+		return h[i+1:]
+	}
+	return h
+}
+
+func copyInto(dst *os.File, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(dst, in)
+	return err
+}
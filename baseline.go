@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// baseline 子命令：在干净的构建机上导出基线并用 GPG 生成分离签名，
+// 生产服务器导入前校验签名，避免基线在传输途中或在生产环境中被替换
+
+const baselineExportVersion = 1
+
+// baselineExport 是导出文件的格式，路径相对于各监控目录保存，
+// 构建机与生产服务器上的目录位置可以不同
+type baselineExport struct {
+	Version int               `json:"version"`
+	Created time.Time         `json:"created"`
+	Host    string            `json:"host"`
+	Roots   []baselineRoot    `json:"roots"`
+	Extra   map[string]*Entry `json:"extra,omitempty"` // 不在任何监控目录下的记录，按原路径导入
+}
+
+type baselineRoot struct {
+	Dir   string            `json:"dir"`
+	Files map[string]*Entry `json:"files"`
+}
+
+var baselineOpt struct {
+	sign    bool
+	verify  bool
+	key     string
+	keyring string
+	trusted string
+	gpg     string
+	output  string
+}
+
+// runBaselineCommand 处理 baseline export 和 baseline import
+func runBaselineCommand(args []string) int {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		fmt.Fprintln(os.Stderr, "用法: baseline export [-sign] <文件> | baseline import [-verify] <文件>")
+		return exitError
+	}
+	sub := args[0]
+	fs := flag.NewFlagSet("baseline "+sub, flag.ExitOnError)
+	fs.StringVar(&configFile, "config", defaultConfigFile, "Path to configuration file (JSON, or YAML/TOML by .yaml/.yml/.toml extension)")
+	fs.StringVar(&hashDBFile, "db", "data/hashdb.json", "Path to hash database file")
+	fs.StringVar(&outputFormat, "output", "text", "Output format: text or json")
+	fs.StringVar(&baselineOpt.gpg, "gpg", "gpg", "gpg executable")
+	if sub == "export" {
+		fs.BoolVar(&baselineOpt.sign, "sign", false, "Write a detached ASCII-armored GPG signature next to the export (<file>.asc)")
+		fs.StringVar(&baselineOpt.key, "key", "", "GPG key to sign with (default: gpg's default key)")
+	} else {
+		fs.BoolVar(&baselineOpt.verify, "verify", false, "Refuse to import unless <file>.asc is a valid GPG signature over the export")
+		fs.StringVar(&baselineOpt.keyring, "keyring", "", "Verify against only the public keys in this keyring file")
+		fs.StringVar(&baselineOpt.trusted, "trusted-key", "", "Comma-separated fingerprints allowed to sign baselines")
+	}
+	fs.Parse(args[1:])
+	if err := applyEnvFlags(fs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "用法: baseline %s [选项] <文件>\n", sub)
+		return exitError
+	}
+	baselineOpt.output = fs.Arg(0)
+
+	if err := prepareOneShotConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if sub == "export" {
+		return runBaselineExport()
+	}
+	return runBaselineImport()
+}
+
+func runBaselineExport() int {
+	n, err := loadHashDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if n == 0 {
+		// 构建机上还没有基线时直接建立
+		initHashDB()
+	}
+
+	exp := baselineExport{Version: baselineExportVersion, Created: now(), Host: hostname()}
+	dbMu.Lock()
+	roots := make(map[string]map[string]*Entry)
+	for _, d := range monitorDirs {
+		roots[d] = make(map[string]*Entry)
+		exp.Roots = append(exp.Roots, baselineRoot{Dir: d, Files: roots[d]})
+	}
+	for path, e := range hashDB {
+		root, ok := rootFor(path, monitorDirs)
+		if !ok {
+			if exp.Extra == nil {
+				exp.Extra = make(map[string]*Entry)
+			}
+			exp.Extra[path] = copyEntry(e)
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		roots[root][filepath.ToSlash(rel)] = copyEntry(e)
+	}
+	dbMu.Unlock()
+
+	data, err := json.MarshalIndent(exp, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "序列化基线错误: %v\n", err)
+		return exitError
+	}
+	if err := os.WriteFile(baselineOpt.output, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "写入导出文件错误: %v\n", err)
+		return exitError
+	}
+	files := 0
+	for _, r := range exp.Roots {
+		files += len(r.Files)
+	}
+	files += len(exp.Extra)
+
+	sig := ""
+	if baselineOpt.sign {
+		sig = baselineOpt.output + ".asc"
+		gpgArgs := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", sig}
+		if baselineOpt.key != "" {
+			gpgArgs = append(gpgArgs, "--local-user", baselineOpt.key)
+		}
+		if out, err := exec.Command(baselineOpt.gpg, append(gpgArgs, baselineOpt.output)...).CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "GPG 签名失败: %v\n%s", err, out)
+			return exitError
+		}
+	}
+
+	result := struct {
+		Command   string `json:"command"`
+		Status    string `json:"status"`
+		File      string `json:"file"`
+		Signature string `json:"signature,omitempty"`
+		Files     int    `json:"files"`
+	}{"baseline export", "ok", baselineOpt.output, sig, files}
+	writeOutput(result, func(w io.Writer) {
+		fmt.Fprintf(w, "已导出 %d 个文件的基线到 %s\n", files, baselineOpt.output)
+		if sig != "" {
+			fmt.Fprintf(w, "签名: %s\n", sig)
+		}
+	})
+	return exitClean
+}
+
+func runBaselineImport() int {
+	data, err := os.ReadFile(baselineOpt.output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法读取导出文件: %v\n", err)
+		return exitError
+	}
+
+	signer := ""
+	if baselineOpt.verify {
+		if signer, err = verifyBaselineExport(baselineOpt.output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	} else {
+		log.Printf("警告：未使用 -verify，基线导入前没有校验签名")
+	}
+
+	var exp baselineExport
+	if err := json.Unmarshal(data, &exp); err != nil {
+		fmt.Fprintf(os.Stderr, "解析导出文件错误: %v\n", err)
+		return exitError
+	}
+	if exp.Version != baselineExportVersion {
+		fmt.Fprintf(os.Stderr, "不支持的导出文件版本: %d\n", exp.Version)
+		return exitError
+	}
+	db, err := mapBaselineRoots(exp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if _, err := loadHashDB(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if _, err := createRestorePoint("before-import", "导入 "+filepath.Base(baselineOpt.output)+" 之前的基线"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	dbMu.Lock()
+	hashDB = db
+	pending = make(map[string]Event)
+	dbMu.Unlock()
+	if err := saveHashDB(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	log.Printf("已从 %s 导入 %d 个文件的基线（%s 于 %s 导出）", baselineOpt.output, len(db), exp.Host, formatTime(exp.Created))
+
+	result := struct {
+		Command string    `json:"command"`
+		Status  string    `json:"status"`
+		File    string    `json:"file"`
+		Signer  string    `json:"signer,omitempty"`
+		Host    string    `json:"host"`
+		Created time.Time `json:"created"`
+		Files   int       `json:"files"`
+	}{"baseline import", "ok", baselineOpt.output, signer, exp.Host, exp.Created, len(db)}
+	writeOutput(result, func(w io.Writer) {
+		fmt.Fprintf(w, "已导入 %d 个文件的基线（%s 于 %s 导出）\n", len(db), exp.Host, formatTime(exp.Created))
+		if signer != "" {
+			fmt.Fprintf(w, "签名者: %s\n", signer)
+		}
+	})
+	return exitClean
+}
+
+// mapBaselineRoots 把导出文件中的监控目录对应到本机的监控目录：路径相同的直接对应，
+// 其余按配置中的顺序依次对应
+func mapBaselineRoots(exp baselineExport) (map[string]*Entry, error) {
+	if len(exp.Roots) != len(monitorDirs) {
+		return nil, fmt.Errorf("导出文件包含 %d 个监控目录，本机配置了 %d 个", len(exp.Roots), len(monitorDirs))
+	}
+	target := make([]string, len(exp.Roots))
+	used := make(map[string]bool)
+	for i, r := range exp.Roots {
+		for _, d := range monitorDirs {
+			if d == r.Dir && !used[d] {
+				target[i], used[d] = d, true
+				break
+			}
+		}
+	}
+	free := 0
+	for i := range target {
+		for target[i] == "" {
+			if d := monitorDirs[free]; !used[d] {
+				target[i], used[d] = d, true
+			}
+			free++
+		}
+	}
+
+	db := make(map[string]*Entry)
+	for i, r := range exp.Roots {
+		if target[i] != r.Dir {
+			log.Printf("导出文件中的 %s 对应本机的 %s", r.Dir, target[i])
+		}
+		for rel, e := range r.Files {
+			db[filepath.Join(target[i], filepath.FromSlash(rel))] = e
+		}
+	}
+	for path, e := range exp.Extra {
+		db[path] = e
+	}
+	// 属主和时间戳与导出的主机有关，导入后在下一次扫描时按本机的文件补齐
+	for _, e := range db {
+		e.Meta = nil
+	}
+	return db, nil
+}
+
+// verifyBaselineExport 用 gpg 校验 <文件>.asc，返回签名密钥的指纹
+func verifyBaselineExport(file string) (string, error) {
+	sig := file + ".asc"
+	if _, err := os.Stat(sig); err != nil {
+		return "", fmt.Errorf("缺少签名文件: %v", err)
+	}
+	args := []string{"--batch", "--status-fd", "1"}
+	if baselineOpt.keyring != "" {
+		keyring, err := filepath.Abs(baselineOpt.keyring)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--no-default-keyring", "--keyring", keyring)
+	}
+	args = append(args, "--verify", sig, file)
+	cmd := exec.Command(baselineOpt.gpg, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, runErr := cmd.Output()
+
+	// 只以状态输出为准：必须有 VALIDSIG，且不能有 BADSIG、过期或吊销的密钥
+	var fpr, subkey string
+	var problems []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 || f[0] != "[GNUPG:]" {
+			continue
+		}
+		switch f[1] {
+		case "VALIDSIG":
+			if len(f) > 2 {
+				subkey, fpr = f[2], f[len(f)-1] // 签名所用子密钥和主密钥的指纹
+			}
+		case "BADSIG", "ERRSIG", "EXPSIG", "EXPKEYSIG", "REVKEYSIG", "NO_PUBKEY":
+			problems = append(problems, f[1])
+		}
+	}
+	if runErr != nil || fpr == "" || len(problems) > 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if len(problems) > 0 {
+			msg = strings.Join(problems, ", ") + ": " + msg
+		}
+		return "", fmt.Errorf("基线签名校验失败: %s", msg)
+	}
+
+	if baselineOpt.trusted != "" {
+		var allowed []string
+		for _, k := range strings.Split(baselineOpt.trusted, ",") {
+			k = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(k), " ", ""))
+			if k == "" {
+				continue
+			}
+			allowed = append(allowed, k)
+			if k == fpr || k == subkey {
+				return fpr, nil
+			}
+		}
+		sort.Strings(allowed)
+		return "", fmt.Errorf("基线由 %s 签名，不在 -trusted-key 列表中（%s）", fpr, strings.Join(allowed, ", "))
+	}
+	return fpr, nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+// 变动统计：记录每个文件在事件历史中的变动次数（保存在哈希数据库旁的 .churn.json），
+// 从中找出持续发生合法变动的目录和文件（缓存、会话、自动生成的 sitemap 等），建议加入排除规则
+
+const (
+	churnRetention = 30 * 24 * time.Hour // 超过该时间没有变动的记录会被丢弃
+	maxChurnPaths  = 20000
+
+	churnDirMin   = 10             // 目录中至少有多少个文件变动过
+	churnFileMin  = 5              // 单个文件至少修改过多少次
+	churnMinSpan  = 24 * time.Hour // 变动至少持续多长时间，一次部署产生的变动不算
+	churnDirShare = 0.5            // 目录中变动过的文件至少占多少比例
+)
+
+// 命中这些信号的变动不会被建议排除：脚本、可疑内容和上传目录正是需要监控的地方
+var churnBlockSignals = map[string]bool{
+	sigExecutable: true, sigWebshell: true, sigUploadDir: true,
+	sigScriptContent: true, sigSEOFile: true, sigJSSkimmer: true, sigSpecialFile: true,
+	sigSetuid: true, sigExecBit: true, sigYara: true, sigNewExecutable: true,
+}
+
+type churnStat struct {
+	Events   int       `json:"events"`
+	Modified int       `json:"modified"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+	Blocked  bool      `json:"blocked,omitempty"` // 出现过脚本或可疑内容，不建议排除
+}
+
+type excludeSuggestion struct {
+	Pattern string   `json:"pattern"`
+	Kind    string   `json:"kind"` // dir, path
+	Files   int      `json:"files"`
+	Events  int      `json:"events"`
+	Since   string   `json:"since"`
+	Reason  string   `json:"reason"`
+	Samples []string `json:"samples,omitempty"`
+}
+
+var (
+	churnStats map[string]*churnStat // 由 dbMu 保护
+	churnDirty bool
+
+	suggestMode  bool
+	applySuggest bool
+)
+
+func churnFile() string {
+	return hashDBFile + ".churn.json"
+}
+
+func loadChurnStats() map[string]*churnStat {
+	stats := make(map[string]*churnStat)
+	data, err := os.ReadFile(churnFile())
+	if err != nil {
+		return stats
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		log.Printf("解析变动统计错误: %v", err)
+		return make(map[string]*churnStat)
+	}
+	return stats
+}
+
+// recordChurn 记录一次变动，调用方需持有 dbMu
+func recordChurn(ev Event) {
+	if churnStats == nil {
+		churnStats = loadChurnStats()
+	}
+	st, ok := churnStats[ev.Path]
+	if !ok {
+		st = &churnStat{First: ev.Time}
+		churnStats[ev.Path] = st
+	}
+	st.Events++
+	if ev.Type == "modified" {
+		st.Modified++
+	}
+	st.Last = ev.Time
+	if len(ev.Findings) > 0 {
+		st.Blocked = true
+	}
+	for _, s := range ev.Signals {
+		if churnBlockSignals[s] {
+			st.Blocked = true
+		}
+	}
+	churnDirty = true
+}
+
+// saveChurnStats 在扫描结束后保存变动统计，丢弃过期的记录
+func saveChurnStats() {
+	dbMu.Lock()
+	if !churnDirty {
+		dbMu.Unlock()
+		return
+	}
+	cutoff := now().Add(-churnRetention)
+	for path, st := range churnStats {
+		if st.Last.Before(cutoff) {
+			delete(churnStats, path)
+		}
+	}
+	if len(churnStats) > maxChurnPaths {
+		paths := make([]string, 0, len(churnStats))
+		for p := range churnStats {
+			paths = append(paths, p)
+		}
+		sort.Slice(paths, func(i, j int) bool { return churnStats[paths[i]].Last.After(churnStats[paths[j]].Last) })
+		for _, p := range paths[maxChurnPaths:] {
+			delete(churnStats, p)
+		}
+	}
+	data, err := json.Marshal(churnStats)
+	churnDirty = false
+	dbMu.Unlock()
+
+	if err == nil {
+		err = writeStateFile(churnFile(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("保存变动统计错误: %v", err)
+	}
+}
+
+// suggestExcludes 根据变动统计给出排除规则建议：
+// 监控目录下最浅的、大部分文件都在反复变动的目录建议整体排除，其余反复修改的文件按路径排除
+func suggestExcludes(stats map[string]*churnStat, db map[string]*Entry, dirs []string) []excludeSuggestion {
+	type dirStat struct {
+		churned, baseline, events int
+		first, last               time.Time
+		blocked                   bool
+		samples                   []string
+	}
+	byDir := make(map[string]*dirStat)
+	var paths []string
+	for path, st := range stats {
+		root, ok := rootFor(path, dirs)
+		if !ok || matcher.Matches(path, excludesFor(path)) || !included(path) || ignoredPath(path) {
+			continue
+		}
+		paths = append(paths, path)
+		for dir := filepath.Dir(path); underDir(dir, root); dir = filepath.Dir(dir) {
+			d, ok := byDir[dir]
+			if !ok {
+				d = &dirStat{first: st.First, last: st.Last}
+				byDir[dir] = d
+			}
+			d.churned++
+			d.events += st.Events
+			if _, inDB := db[path]; inDB {
+				d.baseline++
+			}
+			d.blocked = d.blocked || st.Blocked
+			if st.First.Before(d.first) {
+				d.first = st.First
+			}
+			if st.Last.After(d.last) {
+				d.last = st.Last
+			}
+			if len(d.samples) < 3 {
+				d.samples = append(d.samples, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	// 目录中的文件总数按基线和变动统计合并计算（已删除的文件不在基线中）
+	total := make(map[string]int, len(byDir))
+	for path := range db {
+		root, ok := rootFor(path, dirs)
+		if !ok {
+			continue
+		}
+		for dir := filepath.Dir(path); underDir(dir, root); dir = filepath.Dir(dir) {
+			if byDir[dir] != nil {
+				total[dir]++
+			}
+		}
+	}
+
+	candidates := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		candidates = append(candidates, dir)
+	}
+	// 先考虑浅的目录，选中后不再建议其子目录
+	sort.Slice(candidates, func(i, j int) bool {
+		di, dj := strings.Count(candidates[i], string(filepath.Separator)), strings.Count(candidates[j], string(filepath.Separator))
+		if di != dj {
+			return di < dj
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	var out []excludeSuggestion
+	var chosen []string
+	for _, dir := range candidates {
+		d := byDir[dir]
+		files := total[dir] + d.churned - d.baseline
+		if d.blocked || d.churned < churnDirMin || d.last.Sub(d.first) < churnMinSpan ||
+			d.events < 2*d.churned || float64(d.churned) < churnDirShare*float64(files) {
+			continue
+		}
+		if withinAny(dir, chosen) {
+			continue
+		}
+		chosen = append(chosen, dir)
+		out = append(out, excludeSuggestion{
+			Pattern: filepath.ToSlash(dir) + "/", Kind: matcher.KindDir, Files: d.churned, Events: d.events,
+			Since:   formatTime(d.first),
+			Reason:  fmt.Sprintf("%d 个文件中有 %d 个在 %s内反复变动", files, d.churned, formatChurnSpan(d.last.Sub(d.first))),
+			Samples: d.samples,
+		})
+	}
+
+	for _, path := range paths {
+		st := stats[path]
+		if st.Blocked || st.Modified < churnFileMin || st.Last.Sub(st.First) < churnMinSpan || withinAny(path, chosen) {
+			continue
+		}
+		out = append(out, excludeSuggestion{
+			Pattern: filepath.ToSlash(path), Kind: matcher.KindPath, Files: 1, Events: st.Events,
+			Since:  formatTime(st.First),
+			Reason: fmt.Sprintf("在 %s内修改了 %d 次", formatChurnSpan(st.Last.Sub(st.First)), st.Modified),
+		})
+	}
+	return out
+}
+
+func formatChurnSpan(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d 天", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%d 小时", int(d/time.Hour))
+}
+
+// runSuggestExcludes 输出排除规则建议，-apply 时把建议的规则加入配置文件
+func runSuggestExcludes() int {
+	if err := prepareOneShot(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	suggestions := suggestExcludes(loadChurnStats(), hashDB, monitorDirs)
+	out := struct {
+		Command     string              `json:"command"`
+		Status      string              `json:"status"`
+		Suggestions []excludeSuggestion `json:"suggestions"`
+		Applied     bool                `json:"applied"`
+	}{Command: "suggest-excludes", Status: "ok", Suggestions: suggestions}
+	if out.Suggestions == nil {
+		out.Suggestions = []excludeSuggestion{}
+	}
+
+	if applySuggest && len(suggestions) > 0 {
+		patterns := make([]string, len(suggestions))
+		for i, s := range suggestions {
+			patterns[i] = s.Pattern
+		}
+		if err := addConfigExcludes(configFile, patterns); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		out.Applied = true
+	}
+
+	writeOutput(out, func(w io.Writer) {
+		if len(suggestions) == 0 {
+			fmt.Fprintln(w, "没有发现持续变动、适合排除的路径")
+			return
+		}
+		fmt.Fprintln(w, "建议的排除规则:")
+		formatSuggestions(w, suggestions)
+		if out.Applied {
+			fmt.Fprintf(w, "已加入 %s 的 wenjian.exclude（原文件备份为 %s.bak），执行 -ctl reload 或向守护进程发送 SIGHUP 后生效\n", configFile, configFile)
+		} else {
+			fmt.Fprintln(w, "确认无误后运行 -suggest-excludes -apply 写入配置文件")
+		}
+	})
+	return exitClean
+}
+
+func formatSuggestions(w io.Writer, suggestions []excludeSuggestion) {
+	for _, s := range suggestions {
+		fmt.Fprintf(w, "  %-50s %s，%s 起共 %d 次变动\n", s.Pattern, s.Reason, s.Since, s.Events)
+		for _, p := range s.Samples {
+			fmt.Fprintf(w, "      例如 %s\n", p)
+		}
+	}
+}
+
+// addConfigExcludes 把规则追加到配置文件的 wenjian.exclude，其他配置项原样保留
+func addConfigExcludes(file string, patterns []string) error {
+	if file == "" {
+		return fmt.Errorf("未指定配置文件")
+	}
+	if configFormat(file) != "json" {
+		return fmt.Errorf("只能自动修改 JSON 配置文件，请把建议的规则手动加入 %s 的 wenjian.exclude", file)
+	}
+	if err := validateExcludes(patterns); err != nil {
+		return err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("无法读取配置文件: %v", err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("无法读取配置文件: %v", err)
+	}
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("解析配置文件错误: %v", err)
+	}
+	wenjian := make(map[string]json.RawMessage)
+	if raw, ok := cfg["wenjian"]; ok {
+		if err := json.Unmarshal(raw, &wenjian); err != nil {
+			return fmt.Errorf("解析配置文件错误: %v", err)
+		}
+	}
+	var current []string
+	if raw, ok := wenjian["exclude"]; ok {
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return fmt.Errorf("解析配置文件错误: %v", err)
+		}
+	}
+	for _, p := range patterns {
+		if !containsString(current, p) {
+			current = append(current, p)
+		}
+	}
+	if wenjian["exclude"], err = json.Marshal(current); err != nil {
+		return err
+	}
+	if cfg["wenjian"], err = json.Marshal(wenjian); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+".bak", data, 0600); err != nil {
+		return fmt.Errorf("备份配置文件错误: %v", err)
+	}
+	if err := os.WriteFile(file, append(out, '\n'), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("写入配置文件错误: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 收集端模式（webmonitor server）：接收多台主机上监控实例通过 gRPC 发来的报告，
+// 汇总所有主机的事件并提供统一的网页和 JSON 接口
+
+type collectorSummary struct {
+	Time          time.Time `json:"time"`
+	DurationMs    int64     `json:"duration_ms"`
+	Files         int64     `json:"files"`
+	BaselineFiles int64     `json:"baseline_files"`
+	Events        int64     `json:"events"`
+	Errors        int64     `json:"errors"`
+	Pending       int64     `json:"pending"`
+	Coverage      float64   `json:"coverage_percent"`
+}
+
+type collectorAgent struct {
+	ID          string            `json:"id"`
+	Host        string            `json:"host"`
+	Version     string            `json:"version"`
+	Directories []string          `json:"directories"`
+	Remote      string            `json:"remote"`
+	LastSeen    time.Time         `json:"last_seen"`
+	LastScan    *collectorSummary `json:"last_scan,omitempty"`
+	Events      int               `json:"events"` // 累计收到的事件数
+	Stale       bool              `json:"stale"`  // 超过 -stale 时间没有报告
+}
+
+type collectorEvent struct {
+	Agent string `json:"agent"`
+	Host  string `json:"host"`
+	Event
+}
+
+type collectorState struct {
+	Agents map[string]*collectorAgent `json:"agents"`
+	Events []collectorEvent           `json:"events"`
+}
+
+var (
+	collectorMu  sync.Mutex
+	collector    = collectorState{Agents: make(map[string]*collectorAgent)}
+	collectorOpt struct {
+		listen, state, token string
+		username, password   string
+		tlsCert, tlsKey      string
+		retain               int
+		stale                time.Duration
+	}
+)
+
+// runCollectorServer 处理 server 子命令
+func runCollectorServer(args []string) int {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	fs.StringVar(&collectorOpt.listen, "listen", ":9443", "Address to accept agent reports and serve the consolidated view on")
+	fs.StringVar(&collectorOpt.state, "state", "data/collector.json", "File to persist agents and events in")
+	fs.StringVar(&collectorOpt.token, "token", "", "Bearer token agents must present (agent.token in their config)")
+	fs.StringVar(&collectorOpt.username, "username", "", "Username for the web view and JSON API")
+	fs.StringVar(&collectorOpt.password, "password", "", "Password for the web view and JSON API (HTTP Basic auth)")
+	fs.StringVar(&collectorOpt.tlsCert, "tls-cert", "", "TLS certificate file")
+	fs.StringVar(&collectorOpt.tlsKey, "tls-key", "", "TLS key file")
+	fs.IntVar(&collectorOpt.retain, "retain", 10000, "Number of recent events to keep across all agents")
+	fs.DurationVar(&collectorOpt.stale, "stale", time.Hour, "Mark an agent as stale when it has not reported for this long")
+	fs.Parse(args)
+
+	log.SetFlags(0)
+	log.SetOutput(timestampWriter{os.Stderr})
+	if err := applyTimeConfig("", ""); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadCollectorState(); err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(collectorReportPath, collectorHandleReport)
+	mux.Handle("/", collectorAuth(http.HandlerFunc(collectorHandleIndex)))
+	mux.Handle("/api/agents", collectorAuth(http.HandlerFunc(collectorHandleAgents)))
+	mux.Handle("/api/events", collectorAuth(http.HandlerFunc(collectorHandleEvents)))
+
+	// 同一端口同时提供 HTTP/1.1（网页）和 HTTP/2（gRPC），明文时使用 h2c
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{Addr: collectorOpt.listen, Handler: mux, Protocols: protocols}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		srv.Close()
+	}()
+
+	var err error
+	if collectorOpt.tlsCert != "" && collectorOpt.tlsKey != "" {
+		log.Printf("收集端监听于 https://%s", collectorOpt.listen)
+		err = srv.ListenAndServeTLS(collectorOpt.tlsCert, collectorOpt.tlsKey)
+	} else {
+		log.Printf("收集端监听于 http://%s", collectorOpt.listen)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("收集端服务退出: %v", err)
+		return 1
+	}
+	if err := saveCollectorState(); err != nil {
+		log.Print(err)
+	}
+	return 0
+}
+
+func loadCollectorState() error {
+	data, err := os.ReadFile(collectorOpt.state)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("无法读取收集端状态文件: %v", err)
+	}
+	if err := json.Unmarshal(data, &collector); err != nil {
+		return fmt.Errorf("解析收集端状态文件错误: %v", err)
+	}
+	if collector.Agents == nil {
+		collector.Agents = make(map[string]*collectorAgent)
+	}
+	log.Printf("加载了 %d 台主机、%d 条事件", len(collector.Agents), len(collector.Events))
+	return nil
+}
+
+func saveCollectorState() error {
+	if err := os.MkdirAll(filepath.Dir(collectorOpt.state), 0755); err != nil {
+		return fmt.Errorf("无法创建收集端状态目录: %v", err)
+	}
+	collectorMu.Lock()
+	data, err := json.MarshalIndent(collector, "", "  ")
+	collectorMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("序列化收集端状态错误: %v", err)
+	}
+	if err := os.WriteFile(collectorOpt.state, data, 0644); err != nil {
+		return fmt.Errorf("写入收集端状态文件错误: %v", err)
+	}
+	return nil
+}
+
+// collectorHandleReport 实现 webmonitor.v1.Collector/Report
+func collectorHandleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "expected gRPC request", http.StatusUnsupportedMediaType)
+		return
+	}
+	if collectorOpt.token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(collectorOpt.token)) != 1 {
+			grpcFail(w, 16, "invalid token")
+			return
+		}
+	}
+
+	var (
+		hello   *collectorAgent
+		events  []Event
+		summary *collectorSummary
+	)
+	for {
+		msg, err := readGRPCMessage(r.Body, 16<<20)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			grpcFail(w, 3, err.Error())
+			return
+		}
+		fields, err := pbParse(msg)
+		if err != nil {
+			grpcFail(w, 3, err.Error())
+			return
+		}
+		for _, f := range fields {
+			switch f.Num {
+			case 1:
+				hello, err = decodeHello(f.Data)
+			case 2:
+				var ev Event
+				ev, err = decodeChangeEvent(f.Data)
+				events = append(events, ev)
+			case 3:
+				summary, err = decodeScanSummary(f.Data)
+			}
+			if err != nil {
+				grpcFail(w, 3, err.Error())
+				return
+			}
+		}
+	}
+	if hello == nil || hello.ID == "" {
+		grpcFail(w, 3, "missing hello")
+		return
+	}
+
+	collectorMu.Lock()
+	a, ok := collector.Agents[hello.ID]
+	if !ok {
+		a = &collectorAgent{ID: hello.ID}
+		collector.Agents[hello.ID] = a
+		log.Printf("新主机接入: %s (%s, %s)", hello.ID, hello.Host, r.RemoteAddr)
+	}
+	a.Host, a.Version, a.Directories = hello.Host, hello.Version, hello.Directories
+	a.Remote = r.RemoteAddr
+	a.LastSeen = time.Now()
+	if summary != nil {
+		a.LastScan = summary
+	}
+	a.Events += len(events)
+	for _, ev := range events {
+		collector.Events = append(collector.Events, collectorEvent{Agent: a.ID, Host: a.Host, Event: ev})
+	}
+	if n := len(collector.Events) - collectorOpt.retain; n > 0 {
+		collector.Events = collector.Events[n:]
+	}
+	collectorMu.Unlock()
+
+	if len(events) > 0 {
+		log.Printf("收到 %s 的 %d 条事件", hello.ID, len(events))
+	}
+	if len(events) > 0 || !ok {
+		if err := saveCollectorState(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	var ack pbWriter
+	ack.int(1, int64(len(events)))
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	w.Write(grpcFrame(ack.buf))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+// grpcFail 返回只有头部的 gRPC 错误响应
+func grpcFail(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", msg)
+	w.WriteHeader(http.StatusOK)
+}
+
+func decodeHello(b []byte) (*collectorAgent, error) {
+	fields, err := pbParse(b)
+	if err != nil {
+		return nil, err
+	}
+	a := &collectorAgent{}
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			a.ID = string(f.Data)
+		case 2:
+			a.Host = string(f.Data)
+		case 3:
+			a.Version = string(f.Data)
+		case 4:
+			a.Directories = append(a.Directories, string(f.Data))
+		}
+	}
+	return a, nil
+}
+
+func decodeChangeEvent(b []byte) (Event, error) {
+	fields, err := pbParse(b)
+	if err != nil {
+		return Event{}, err
+	}
+	var ev Event
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			ev.Type = string(f.Data)
+		case 2:
+			ev.Path = string(f.Data)
+		case 3:
+			ev.OldPath = string(f.Data)
+		case 4:
+			ev.Stream = string(f.Data)
+		case 5:
+			ev.Size = int64(f.Int)
+		case 6:
+			ev.OldHash = string(f.Data)
+		case 7:
+			ev.NewHash = string(f.Data)
+		case 8:
+			ev.Time = time.UnixMilli(int64(f.Int))
+		case 9:
+			ev.Severity = string(f.Data)
+		case 10:
+			ev.Mount = string(f.Data)
+		case 11:
+			ev.Risk = int(int32(f.Int))
+		case 12:
+			ev.Signals = append(ev.Signals, string(f.Data))
+		case 13:
+			ev.Findings = append(ev.Findings, string(f.Data))
+		case 14:
+			ev.Diff = string(f.Data)
+		}
+	}
+	return ev, nil
+}
+
+func decodeScanSummary(b []byte) (*collectorSummary, error) {
+	fields, err := pbParse(b)
+	if err != nil {
+		return nil, err
+	}
+	s := &collectorSummary{}
+	for _, f := range fields {
+		v := int64(f.Int)
+		switch f.Num {
+		case 1:
+			s.Time = time.UnixMilli(v)
+		case 2:
+			s.DurationMs = v
+		case 3:
+			s.Files = v
+		case 4:
+			s.BaselineFiles = v
+		case 5:
+			s.Events = v
+		case 6:
+			s.Errors = v
+		case 7:
+			s.Pending = v
+		case 8:
+			s.Coverage = math.Float64frombits(f.Int)
+		}
+	}
+	return s, nil
+}
+
+func collectorAuth(next http.Handler) http.Handler {
+	if collectorOpt.password == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(collectorOpt.username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(collectorOpt.password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="webmonitor"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// snapshotAgents 返回按主机名排序的主机列表
+func snapshotAgents() []collectorAgent {
+	collectorMu.Lock()
+	defer collectorMu.Unlock()
+	out := make([]collectorAgent, 0, len(collector.Agents))
+	for _, a := range collector.Agents {
+		cp := *a
+		cp.Stale = time.Since(a.LastSeen) > collectorOpt.stale
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host+out[i].ID < out[j].Host+out[j].ID })
+	return out
+}
+
+// filterCollectorEvents 返回最新的在前的事件，参数与守护进程的 /events 接口一致，另外支持 agent
+func filterCollectorEvents(r *http.Request, limit int) ([]collectorEvent, error) {
+	q := r.URL.Query()
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, errors.New("limit 无效")
+		}
+		limit = n
+	}
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, errors.New("since 应为 RFC3339 时间")
+		}
+		since = t
+	}
+	agent, typ, severity := q.Get("agent"), q.Get("type"), q.Get("severity")
+
+	collectorMu.Lock()
+	defer collectorMu.Unlock()
+	out := []collectorEvent{}
+	for i := len(collector.Events) - 1; i >= 0 && len(out) < limit; i-- {
+		ev := collector.Events[i]
+		switch {
+		case agent != "" && ev.Agent != agent && ev.Host != agent:
+		case typ != "" && ev.Type != typ:
+		case severity != "" && !severityAtLeast(ev.Severity, severity):
+		case !since.IsZero() && ev.Time.Before(since):
+		default:
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func collectorHandleAgents(w http.ResponseWriter, r *http.Request) {
+	ctlWriteJSON(w, snapshotAgents())
+}
+
+func collectorHandleEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := filterCollectorEvents(r, defaultAPILimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctlWriteJSON(w, events)
+}
+
+type collectorPage struct {
+	Now    string
+	Agents []collectorAgent
+	Events []collectorEvent
+	Stale  int
+}
+
+var collectorTemplate = template.Must(template.New("collector").Funcs(dashboardFuncs).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>文件防篡改监控 - 收集端</title>
+<style>
+body { font-family: -apple-system, "Microsoft YaHei", sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; } h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; min-width: 50%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 12px 4px 0; text-align: left; vertical-align: top; }
+.bad { color: #c00; } .ok { color: #080; } .warn { color: #b60; } .muted { color: #888; }
+</style>
+</head>
+<body>
+<h1>文件防篡改监控 - 收集端</h1>
+<p class="muted">{{.Now}} · {{len .Agents}} 台主机{{if .Stale}}，<span class="bad">{{.Stale}} 台失联</span>{{end}} · 每 30 秒刷新</p>
+
+<h2>主机</h2>
+<table>
+<tr><th>主机</th><th>状态</th><th>最近报告</th><th>基线文件</th><th>待确认</th><th>覆盖率</th><th>累计事件</th><th>版本</th></tr>
+{{range .Agents}}<tr><td>{{.Host}}{{if ne .Host .ID}} <span class="muted">({{.ID}})</span>{{end}}</td>
+<td>{{if .Stale}}<span class="bad">失联</span>{{else}}<span class="ok">正常</span>{{end}}</td>
+<td>{{fmtTime .LastSeen}}</td>
+{{with .LastScan}}<td>{{.BaselineFiles}}</td><td>{{if .Pending}}<span class="warn">{{.Pending}}</span>{{else}}0{{end}}</td><td>{{printf "%.1f" .Coverage}}%</td>{{else}}<td>-</td><td>-</td><td>-</td>{{end}}
+<td>{{.Events}}</td><td class="muted">{{.Version}}</td></tr>
+{{else}}<tr><td class="muted">还没有主机报告</td></tr>
+{{end}}</table>
+
+<h2>最近事件</h2>
+<table>
+<tr><th>时间</th><th>主机</th><th>级别</th><th>类型</th><th>路径</th></tr>
+{{range .Events}}<tr><td>{{fmtTime .Time}}</td><td>{{.Host}}</td><td>{{.Severity}}</td><td>{{.Type}}</td><td>{{.Path}}</td></tr>
+{{else}}<tr><td class="muted">暂无事件</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func collectorHandleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	events, err := filterCollectorEvents(r, 200)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page := collectorPage{Now: formatTime(time.Now()), Agents: snapshotAgents(), Events: events}
+	for _, a := range page.Agents {
+		if a.Stale {
+			page.Stale++
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := collectorTemplate.Execute(w, page); err != nil {
+		log.Printf("渲染收集端页面失败: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// 子命令：init 建立基线，scan 扫描一次（更新基线并报警）后退出，verify 只与基线比较、不更新基线，
+// serve 持续监控。不写子命令时与 serve 相同，原有的 -verify、-build-baseline 等参数照常可用。
+// 子命令之后可以使用全部命令行参数，例如 webmonitor scan -config /etc/webmonitor.json
+
+var mainCommands = []struct{ name, usage string }{
+	{"init", "Build the baseline from the monitored directories, then exit (refuses to replace an existing baseline without -force)"},
+	{"scan", "Scan once against the baseline, record and alert on changes like the daemon, then exit (0 clean, 1 changes, 2 errors)"},
+	{"verify", "Compare the tree against the baseline without updating it, then exit (0 clean, 1 changes, 2 errors); -diff prints hashes"},
+	{"serve", "Run the long-lived monitor (the default when no command is given)"},
+}
+
+var (
+	// command 为本次运行的子命令
+	command = "serve"
+	// forceInit 允许 init 替换已有的基线
+	forceInit bool
+	// lastScanEvents 为最近一次扫描发现的变动数，scan 据此决定退出码
+	lastScanEvents int
+)
+
+func init() {
+	flag.BoolVar(&forceInit, "force", false, "With init, replace an existing baseline")
+	flag.Usage = func() {
+		w := flag.CommandLine.Output()
+		fmt.Fprintf(w, "Usage: %s [command] [flags] [directories...]\n\nCommands:\n", os.Args[0])
+		for _, c := range mainCommands {
+			fmt.Fprintf(w, "  %-8s %s\n", c.name, c.usage)
+		}
+		fmt.Fprintln(w, "\nOther commands: server, baseline, aggregate, install-service, uninstall-service, start-service, stop-service")
+		fmt.Fprintln(w, "\nFlags:")
+		flag.PrintDefaults()
+	}
+}
+
+func isMainCommand(name string) bool {
+	for _, c := range mainCommands {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCommandLine 取出子命令并解析其后的命令行参数。
+// 子命令也可以写在参数之后，例如 webmonitor -config cfg.json init；
+// 出现在监控目录之间或之后时报错退出，避免被当作目录而以 serve 模式一直运行
+func parseCommandLine() {
+	args := os.Args[1:]
+	explicit := len(args) > 0 && isMainCommand(args[0])
+	if explicit {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if args = flag.Args(); len(args) > 0 && isMainCommand(args[0]) {
+		if explicit {
+			fmt.Fprintf(os.Stderr, "只能指定一个子命令，已指定 %s: %s\n", command, args[0])
+			os.Exit(exitError)
+		}
+		command = args[0]
+		flag.CommandLine.Parse(args[1:])
+	}
+	for _, arg := range flag.Args() {
+		if isMainCommand(arg) {
+			fmt.Fprintf(os.Stderr, "子命令 %s 必须写在监控目录之前；监控当前目录下名为 %s 的目录请写成 ./%s\n", arg, arg, arg)
+			os.Exit(exitError)
+		}
+	}
+}
+
+// runScanOnce 在守护进程的初始化完成后执行一次扫描，保存基线后返回退出码
+func runScanOnce() int {
+	checkFiles(true)
+	code := exitClean
+	dbMu.Lock()
+	switch {
+	case shuttingDown() || lastScanErrs > 0:
+		code = exitError
+	case lastScanEvents > 0:
+		code = exitChanges
+	}
+	dbMu.Unlock()
+	if c := shutdown(); c != exitClean {
+		code = c
+	}
+	return code
+}
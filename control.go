@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ControlConfig struct {
+	Socket      string `json:"socket"`              // unix socket 路径，依靠文件权限控制访问
+	SocketMode  string `json:"socket_mode"`         // unix socket 的权限，默认 0600
+	SocketGroup string `json:"socket_group"`        // unix socket 的属组，配合 0660 允许该组成员使用
+	Listen      string `json:"listen"`              // HTTPS 监听地址，例如 127.0.0.1:8443
+	TLSCert     string `json:"tls_cert"`            // HTTPS 证书
+	TLSKey      string `json:"tls_key"`             // HTTPS 私钥
+	Token       string `json:"token" secret:"true"` // HTTPS 访问令牌
+	TLSCA       string `json:"tls_ca"`              // 客户端校验自签名证书用的 CA
+}
+
+type ctlStatus struct {
+	Version        string         `json:"version"`
+	Directories    []string       `json:"directories"`
+	DirectoryFiles map[string]int `json:"directory_files"` // 各监控目录的基线文件数
+	Files          int            `json:"files"`
+	Pending        int            `json:"pending"`
+	ManualAccept   bool           `json:"manual_accept"`
+	LastScan       time.Time      `json:"last_scan"`
+	SilencedUntil  time.Time      `json:"silenced_until,omitempty"`
+	Paused         bool           `json:"paused,omitempty"`
+	PausedUntil    time.Time      `json:"paused_until,omitempty"`
+
+	Progress       scanProgress   `json:"progress"`
+	Coverage       *coverageStats `json:"coverage,omitempty"`
+	ExcludeStats   []excludeStat  `json:"exclude_stats,omitempty"`
+	Unavailable    []string       `json:"unavailable_dirs,omitempty"`
+	PendingChanges []Event        `json:"pending_changes,omitempty"`
+	RecentAlerts   []alertRecord  `json:"recent_alerts,omitempty"`
+	Channels       []channelState `json:"channels"`
+}
+
+func startControlServer() {
+	if control.Socket == "" && control.Listen == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ctl/status", ctlHandleStatus)
+	mux.HandleFunc("/ctl/rescan", ctlHandleRescan)
+	mux.HandleFunc("/ctl/accept", ctlMutating(ctlHandleAccept))
+	mux.HandleFunc("/ctl/silence", ctlHandleSilence)
+	mux.HandleFunc("/ctl/export", ctlHandleExport)
+	mux.HandleFunc("/ctl/check", ctlHandleCheck)
+	mux.HandleFunc("/ctl/restore-points", ctlHandleRestorePoints)
+	mux.HandleFunc("/ctl/restore-point", ctlMutating(ctlHandleCreateRestorePoint))
+	mux.HandleFunc("/ctl/rollback", ctlMutating(ctlHandleRollback))
+	mux.HandleFunc("/ctl/simulate", ctlMutating(ctlHandleSimulate))
+	mux.HandleFunc("/ctl/pause", ctlHandlePause)
+	mux.HandleFunc("/ctl/resume", ctlHandleResume)
+	mux.HandleFunc("/ctl/reload", ctlHandleReload)
+
+	if control.Socket != "" {
+		mode := os.FileMode(0600)
+		if control.SocketMode != "" {
+			m, err := strconv.ParseUint(control.SocketMode, 8, 32)
+			if err != nil || m&^0777 != 0 {
+				log.Fatalf("无效的 socket_mode: %s", control.SocketMode)
+			}
+			mode = os.FileMode(m)
+		}
+		if mode&0007 != 0 {
+			log.Printf("警告：socket_mode %#o 允许所有本地用户使用控制接口", mode)
+		}
+		if err := os.MkdirAll(filepath.Dir(control.Socket), 0750); err != nil {
+			log.Fatalf("无法创建控制 socket 目录: %v", err)
+		}
+		// 清理上次异常退出残留的 socket 文件
+		os.Remove(control.Socket)
+		ln, err := net.Listen("unix", control.Socket)
+		if err != nil {
+			log.Fatalf("无法监听控制 socket %s: %v", control.Socket, err)
+		}
+		if control.SocketGroup != "" {
+			gid, err := lookupGID(control.SocketGroup)
+			if err == nil {
+				err = os.Chown(control.Socket, -1, gid)
+			}
+			if err != nil {
+				log.Fatalf("设置控制 socket 属组 %s 错误: %v", control.SocketGroup, err)
+			}
+		}
+		if err := os.Chmod(control.Socket, mode); err != nil {
+			log.Fatalf("设置控制 socket 权限错误: %v", err)
+		}
+		log.Printf("控制接口监听于 unix:%s", control.Socket)
+		go func() {
+			if err := http.Serve(ln, mux); err != nil {
+				log.Printf("控制 socket 服务退出: %v", err)
+			}
+		}()
+	}
+
+	if control.Listen != "" {
+		if control.TLSCert == "" || control.TLSKey == "" || control.Token == "" {
+			log.Fatal("控制接口使用 HTTPS 时必须配置 tls_cert、tls_key 和 token")
+		}
+		srv := &http.Server{Addr: control.Listen, Handler: ctlRequireToken(mux)}
+		log.Printf("控制接口监听于 https://%s", control.Listen)
+		go func() {
+			if err := srv.ListenAndServeTLS(control.TLSCert, control.TLSKey); err != nil {
+				log.Printf("控制 HTTPS 服务退出: %v", err)
+			}
+		}()
+	}
+}
+
+func ctlRequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(control.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ctlWriteJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func ctlHandleStatus(w http.ResponseWriter, r *http.Request) {
+	ctlWriteJSON(w, buildStatus())
+}
+
+// buildStatus 汇总守护进程的当前状态，供控制接口和网页面板使用
+func buildStatus() ctlStatus {
+	dbMu.Lock()
+	st := ctlStatus{
+		Version:        appversion,
+		Directories:    monitorDirs,
+		DirectoryFiles: make(map[string]int, len(monitorDirs)),
+		Files:          len(hashDB),
+		Pending:        len(pending),
+		ManualAccept:   manualAccept,
+		LastScan:       lastScan,
+		SilencedUntil:  silencedUntil,
+		Paused:         scanPaused,
+		PausedUntil:    pausedUntil,
+		Progress:       progress,
+		Coverage:       lastCoverage,
+		ExcludeStats:   lastExcludeStats,
+	}
+	for _, ev := range pending {
+		st.PendingChanges = append(st.PendingChanges, ev)
+	}
+	for path := range hashDB {
+		for _, dir := range monitorDirs {
+			if underDir(path, dir) {
+				st.DirectoryFiles[dir]++
+				break
+			}
+		}
+	}
+	dbMu.Unlock()
+
+	sort.Slice(st.PendingChanges, func(i, j int) bool {
+		return st.PendingChanges[i].Time.Before(st.PendingChanges[j].Time)
+	})
+	st.Unavailable = unavailableRoots()
+	st.RecentAlerts = snapshotAlerts()
+	st.Channels = snapshotChannels()
+	return st
+}
+
+func ctlHandleRescan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.FormValue("full") != "" {
+		dbMu.Lock()
+		fullScanRequested = true
+		dbMu.Unlock()
+	}
+	select {
+	case rescanCh <- struct{}{}:
+	default:
+		// 已有扫描请求在排队
+	}
+	ctlWriteJSON(w, map[string]string{"result": "rescan scheduled"})
+}
+
+func ctlHandleAccept(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	paths := r.Form["path"]
+
+	// 批量确认前保存基线还原点
+	dbMu.Lock()
+	count := 0
+	for key, ev := range pending {
+		if len(paths) == 0 || containsString(paths, ev.Path) || containsString(paths, key) {
+			count++
+		}
+	}
+	dbMu.Unlock()
+	snapshotBeforeBulk(count, "通过控制接口")
+
+	dbMu.Lock()
+	var accepted []string
+	for key, ev := range pending {
+		if len(paths) > 0 && !containsString(paths, ev.Path) && !containsString(paths, key) {
+			continue
+		}
+		applyEvent(ev)
+		delete(pending, key)
+		accepted = append(accepted, key)
+	}
+	dbMu.Unlock()
+	accepted = append(accepted, acceptHTTPBaseline(paths)...)
+
+	if len(accepted) > 0 {
+		if err := saveHashDB(); err != nil {
+			log.Printf("保存哈希数据库错误: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("通过控制接口确认了 %d 个变动", len(accepted))
+	}
+	ctlWriteJSON(w, map[string]interface{}{"accepted": accepted})
+}
+
+func ctlHandleSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d, err := time.ParseDuration(r.FormValue("for"))
+	if err != nil {
+		http.Error(w, "invalid duration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbMu.Lock()
+	silencedUntil = now().Add(d)
+	until := silencedUntil
+	dbMu.Unlock()
+
+	log.Printf("警报已通过控制接口静默至 %s", formatTime(until))
+	ctlWriteJSON(w, map[string]time.Time{"silenced_until": until})
+}
+
+// ctlHandleReload 重新加载配置文件；正在扫描时最多等待 25 秒，之后在扫描结束时加载
+func ctlHandleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reply := requestReload()
+	if reply == nil {
+		http.Error(w, "已有重新加载请求在排队", http.StatusConflict)
+		return
+	}
+	select {
+	case res := <-reply:
+		if !res.Reloaded {
+			http.Error(w, res.Error, http.StatusBadRequest)
+			return
+		}
+		ctlWriteJSON(w, res)
+	case <-time.After(25 * time.Second):
+		ctlWriteJSON(w, map[string]string{"result": "reload scheduled"})
+	}
+}
+
+// ctlHandlePause 暂停定时扫描，for 为空时直到 resume
+func ctlHandlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var d time.Duration
+	if v := r.FormValue("for"); v != "" {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil || d <= 0 {
+			http.Error(w, "invalid duration: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+
+	dbMu.Lock()
+	scanPaused = true
+	pausedUntil = time.Time{}
+	if d > 0 {
+		pausedUntil = now().Add(d)
+	}
+	until := pausedUntil
+	dbMu.Unlock()
+
+	if until.IsZero() {
+		log.Println("定时扫描已通过控制接口暂停，直到 resume")
+	} else {
+		log.Printf("定时扫描已通过控制接口暂停至 %s", formatTime(until))
+	}
+	ctlWriteJSON(w, map[string]interface{}{"paused": true, "paused_until": until})
+}
+
+// pauseText 返回扫描暂停状态的说明，未暂停时为空
+func pauseText(st ctlStatus) string {
+	switch {
+	case !st.Paused:
+		return ""
+	case st.PausedUntil.IsZero():
+		return "定时扫描已暂停，直到 resume"
+	}
+	return "定时扫描暂停至 " + formatTime(st.PausedUntil)
+}
+
+// ctlHandleResume 恢复定时扫描并立即扫描一次，检查暂停期间的变动
+func ctlHandleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dbMu.Lock()
+	was := scanPaused
+	scanPaused = false
+	pausedUntil = time.Time{}
+	dbMu.Unlock()
+
+	if was {
+		log.Println("定时扫描已通过控制接口恢复")
+		select {
+		case rescanCh <- struct{}{}:
+		default:
+		}
+	}
+	ctlWriteJSON(w, map[string]bool{"paused": false})
+}
+
+func ctlHandleExport(w http.ResponseWriter, r *http.Request) {
+	// 在 dbMu 下复制记录，编码和写出响应时不持有锁，客户端读得慢也不会阻塞扫描
+	dbMu.Lock()
+	db := make(map[string]*Entry, len(hashDB))
+	for path, e := range hashDB {
+		db[path] = copyEntry(e)
+	}
+	dbMu.Unlock()
+	ctlWriteJSON(w, db)
+}
+
+func ctlHandleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v, err := checkPath(r.FormValue("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctlWriteJSON(w, v)
+}
+
+func ctlHandleRestorePoints(w http.ResponseWriter, r *http.Request) {
+	points, err := listRestorePoints()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctlWriteJSON(w, points)
+}
+
+func ctlHandleCreateRestorePoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "通过控制接口创建"
+	}
+	rp, err := createRestorePoint(r.FormValue("name"), reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rp.DB = nil
+	ctlWriteJSON(w, rp)
+}
+
+func ctlHandleRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	scanMu.Lock()
+	rp, err := rollbackBaseline(r.FormValue("id"))
+	scanMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctlWriteJSON(w, map[string]interface{}{"rolled_back_to": rp})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCtlAddr 优先使用 -ctl-addr，否则从配置文件读取控制地址
+func resolveCtlAddr() string {
+	addr := ctlAddr
+	if addr == "" && configFile != "" {
+		c, err := readCtlConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		control = c
+		if control.Socket != "" {
+			addr = control.Socket
+		} else if control.Listen != "" {
+			addr = "https://" + control.Listen
+		}
+	}
+	return addr
+}
+
+// readCtlConfig 只解析配置文件中的 control 部分，客户端不需要加载其他配置和凭据。
+// 只有通过 HTTPS 访问时才解析 control.token 的引用
+func readCtlConfig() (ControlConfig, error) {
+	var section struct {
+		Control ControlConfig `json:"control"`
+	}
+	file, err := os.ReadFile(configFile)
+	if err != nil {
+		return section.Control, fmt.Errorf("无法读取配置文件: %v", err)
+	}
+	switch configFormat(configFile) {
+	case "yaml":
+		file, err = yamlToJSON(file, reflect.TypeOf(Config{}))
+	case "toml":
+		file, err = tomlToJSON(file)
+	}
+	if err == nil {
+		err = json.Unmarshal(file, &section)
+	}
+	if err != nil {
+		return section.Control, fmt.Errorf("解析配置文件错误: %v", err)
+	}
+	c := section.Control
+	if c.Socket == "" && c.Listen != "" && os.Getenv("WEBMON_CTL_TOKEN") == "" {
+		r := &secretResolver{}
+		if c.Token, err = r.resolve(c.Token); err != nil {
+			return c, fmt.Errorf("control.token: %v", err)
+		}
+	}
+	return c, nil
+}
+
+func ctlRequest(addr, method, path string, form url.Values) (*http.Response, error) {
+	client, base := ctlClient(addr)
+	var body io.Reader
+	if method == http.MethodPost {
+		body = bytes.NewBufferString(form.Encode())
+	}
+	req, err := http.NewRequest(method, base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	token := control.Token
+	if env := os.Getenv("WEBMON_CTL_TOKEN"); env != "" {
+		token = env
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return client.Do(req)
+}
+
+// runCtl 以客户端身份向守护进程发送命令，返回进程退出码
+func runCtl(cmd string, args []string) int {
+	addr := resolveCtlAddr()
+	if addr == "" {
+		fmt.Fprintln(os.Stderr, "错误：未指定控制地址，请使用 -ctl-addr 或在配置文件中设置 control")
+		return 2
+	}
+
+	method, path := http.MethodGet, ""
+	form := url.Values{}
+	switch cmd {
+	case "status":
+		path = "/ctl/status"
+	case "export":
+		path = "/ctl/export"
+	case "rescan":
+		method, path = http.MethodPost, "/ctl/rescan"
+		if len(args) > 0 && args[0] == "full" {
+			form.Set("full", "1")
+		}
+	case "accept":
+		method, path = http.MethodPost, "/ctl/accept"
+		for _, p := range args {
+			form.Add("path", p)
+		}
+	case "check":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "用法: -ctl check <文件或子目录>")
+			return 2
+		}
+		method, path = http.MethodPost, "/ctl/check"
+		form.Set("path", args[0])
+	case "restore-point":
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "用法: -ctl restore-point <名称> [说明]")
+			return 2
+		}
+		method, path = http.MethodPost, "/ctl/restore-point"
+		form.Set("name", args[0])
+		form.Set("reason", strings.Join(args[1:], " "))
+	case "restore-points":
+		path = "/ctl/restore-points"
+	case "rollback":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "用法: -ctl rollback <还原点 ID 或名称>")
+			return 2
+		}
+		method, path = http.MethodPost, "/ctl/rollback"
+		form.Set("id", args[0])
+	case "pause":
+		if len(args) > 1 {
+			fmt.Fprintln(os.Stderr, "用法: -ctl pause [时长，例如 2h，不填则直到 resume]")
+			return 2
+		}
+		method, path = http.MethodPost, "/ctl/pause"
+		if len(args) == 1 {
+			form.Set("for", args[0])
+		}
+	case "resume":
+		method, path = http.MethodPost, "/ctl/resume"
+	case "reload":
+		method, path = http.MethodPost, "/ctl/reload"
+	case "simulate":
+		if len(args) > 1 {
+			fmt.Fprintln(os.Stderr, "用法: -ctl simulate [监控目录]")
+			return 2
+		}
+		method, path = http.MethodPost, "/ctl/simulate"
+		if len(args) == 1 {
+			form.Set("dir", args[0])
+		}
+	case "silence":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "用法: -ctl silence <时长，例如 30m，0 表示取消静默>")
+			return 2
+		}
+		method, path = http.MethodPost, "/ctl/silence"
+		form.Set("for", args[0])
+	default:
+		fmt.Fprintf(os.Stderr, "未知的控制命令: %s\n", cmd)
+		return 2
+	}
+
+	resp, err := ctlRequest(addr, method, path, form)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法连接守护进程: %v\n", err)
+		return 2
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	os.Stdout.Write(body)
+	if resp.StatusCode != http.StatusOK {
+		return 2
+	}
+
+	// simulate 命令自检失败时返回 1
+	if cmd == "simulate" {
+		var res simulateResult
+		if err := json.Unmarshal(body, &res); err != nil {
+			return exitError
+		}
+		if res.Status != "pass" {
+			return exitChanges
+		}
+	}
+
+	// check 命令的退出码与 -verify 一致
+	if cmd == "check" {
+		var v checkVerdict
+		if err := json.Unmarshal(body, &v); err != nil {
+			return exitError
+		}
+		switch v.Status {
+		case "changes":
+			return exitChanges
+		case "error":
+			return exitError
+		}
+	}
+	return 0
+}
+
+func ctlClient(addr string) (*http.Client, string) {
+	if strings.HasPrefix(addr, "https://") {
+		tlsConfig := &tls.Config{}
+		if control.TLSCA != "" {
+			pem, err := os.ReadFile(control.TLSCA)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "无法读取 CA 证书: %v\n", err)
+			} else {
+				tlsConfig.RootCAs = x509.NewCertPool()
+				tlsConfig.RootCAs.AppendCertsFromPEM(pem)
+			}
+		}
+		return &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}, strings.TrimSuffix(addr, "/")
+	}
+
+	socket := strings.TrimPrefix(addr, "unix:")
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}, "http://unix"
+}
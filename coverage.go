@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// 文件被跳过的原因
+const (
+	skipExcluded    = "excluded"         // 匹配排除规则
+	skipExcludedDir = "excluded_dir"     // 整个目录匹配排除规则
+	skipSizeLimit   = "size_limit"       // 超过大小限制
+	skipPermission  = "permission"       // 无读取权限
+	skipError       = "error"            // 其他读取错误
+	skipNonRegular  = "non_regular"      // 符号链接、设备等非普通文件
+	skipOtherFS     = "other_filesystem" // one_filesystem 下跨越文件系统边界的目录
+	skipNotIncluded = "not_included"     // 不匹配 include 规则
+	skipIgnoreFile  = "ignore_file"      // 被目录中的 .webmonignore 排除
+)
+
+var skipReasonNames = map[string]string{
+	skipExcluded:    "匹配排除规则",
+	skipExcludedDir: "目录被排除",
+	skipSizeLimit:   "超过大小限制",
+	skipPermission:  "无读取权限",
+	skipError:       "读取错误",
+	skipNonRegular:  "非普通文件",
+	skipOtherFS:     "其他文件系统",
+	skipNotIncluded: "不在 include 范围内",
+	skipIgnoreFile:  "被忽略文件排除",
+}
+
+const maxSkipSamples = 100
+
+type skipStat struct {
+	Count   int      `json:"count"`
+	Bytes   int64    `json:"bytes"`
+	Samples []string `json:"samples"`
+}
+
+// coverageStats 统计一次扫描中实际受保护和被跳过的文件
+type coverageStats struct {
+	Hashed      int                  `json:"hashed"`
+	HashedBytes int64                `json:"hashed_bytes"`
+	StatOnly    int                  `json:"stat_only,omitempty"` // 增量扫描中按大小和修改时间判定未变、没有重新计算哈希的文件，也计入 hashed
+	Sampled     int                  `json:"sampled,omitempty"`   // 超过大小限制、只按首尾部分计算哈希的文件，也计入 hashed
+	Skipped     map[string]*skipStat `json:"skipped"`
+}
+
+func newCoverageStats() *coverageStats {
+	return &coverageStats{Skipped: make(map[string]*skipStat)}
+}
+
+func (c *coverageStats) hashed(size int64) {
+	c.Hashed++
+	c.HashedBytes += size
+}
+
+func (c *coverageStats) statOnly(size int64) {
+	c.hashed(size)
+	c.StatOnly++
+}
+
+func (c *coverageStats) sampled(size int64) {
+	c.hashed(size)
+	c.Sampled++
+}
+
+func (c *coverageStats) skip(reason, path string, size int64) {
+	st, ok := c.Skipped[reason]
+	if !ok {
+		st = &skipStat{}
+		c.Skipped[reason] = st
+	}
+	st.Count++
+	st.Bytes += size
+	if len(st.Samples) < maxSkipSamples {
+		st.Samples = append(st.Samples, path)
+	}
+}
+
+// merge 把另一个根目录的统计合并进来
+func (c *coverageStats) merge(o *coverageStats) {
+	if o == nil {
+		return
+	}
+	c.Hashed += o.Hashed
+	c.HashedBytes += o.HashedBytes
+	c.StatOnly += o.StatOnly
+	c.Sampled += o.Sampled
+	for reason, st := range o.Skipped {
+		cur, ok := c.Skipped[reason]
+		if !ok {
+			cur = &skipStat{}
+			c.Skipped[reason] = cur
+		}
+		cur.Count += st.Count
+		cur.Bytes += st.Bytes
+		for _, p := range st.Samples {
+			if len(cur.Samples) < maxSkipSamples {
+				cur.Samples = append(cur.Samples, p)
+			}
+		}
+	}
+}
+
+// Percent 返回按文件数计算的覆盖率，整个被排除的目录按一个条目计
+func (c *coverageStats) Percent() float64 {
+	total := c.Hashed
+	for _, st := range c.Skipped {
+		total += st.Count
+	}
+	if total == 0 {
+		return 100
+	}
+	return float64(c.Hashed) * 100 / float64(total)
+}
+
+func (c *coverageStats) BytesPercent() float64 {
+	total := c.HashedBytes
+	for _, st := range c.Skipped {
+		total += st.Bytes
+	}
+	if total == 0 {
+		return 100
+	}
+	return float64(c.HashedBytes) * 100 / float64(total)
+}
+
+func (c *coverageStats) summary() string {
+	reasons := make([]string, 0, len(c.Skipped))
+	for r := range c.Skipped {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, 0, len(reasons))
+	for _, r := range reasons {
+		parts = append(parts, fmt.Sprintf("%s %d", skipReasonNames[r], c.Skipped[r].Count))
+	}
+	verified := fmt.Sprintf("已校验 %d 个文件", c.Hashed)
+	if c.StatOnly > 0 {
+		verified += fmt.Sprintf("（其中 %d 个大小和修改时间未变，未重新计算哈希）", c.StatOnly)
+	}
+	if c.Sampled > 0 {
+		verified += fmt.Sprintf("（其中 %d 个大文件只校验首尾部分）", c.Sampled)
+	}
+	if len(parts) == 0 {
+		return verified + "，覆盖率 100%"
+	}
+	return fmt.Sprintf("%s，覆盖率 %.1f%%（按大小 %.1f%%），跳过: %s",
+		verified, c.Percent(), c.BytesPercent(), strings.Join(parts, "，"))
+}
+
+func (c *coverageStats) writeText(w io.Writer) {
+	fmt.Fprintln(w, c.summary())
+	reasons := make([]string, 0, len(c.Skipped))
+	for r := range c.Skipped {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		st := c.Skipped[r]
+		fmt.Fprintf(w, "\n%s: %d 个，共 %d bytes\n", skipReasonNames[r], st.Count, st.Bytes)
+		for _, p := range st.Samples {
+			fmt.Fprintln(w, "  "+p)
+		}
+		if st.Count > len(st.Samples) {
+			fmt.Fprintf(w, "  ... 另有 %d 个\n", st.Count-len(st.Samples))
+		}
+	}
+}
+
+func skipReasonFor(err error) string {
+	if errors.Is(err, fs.ErrPermission) {
+		return skipPermission
+	}
+	return skipError
+}
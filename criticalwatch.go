@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// CriticalWatchConfig 配置单独高频检查的关键文件，例如 SSH authorized_keys、.htpasswd 和面板配置，
+// 任何改动都立即以 critical 级别报警，不受扫描间隔和人工确认模式影响，quiet_hours 也不会推迟
+type CriticalWatchConfig struct {
+	Files    []string `json:"files"`    // 支持通配符，例如 /home/*/.ssh/authorized_keys
+	Interval string   `json:"interval"` // 默认 10s
+	Channels []string `json:"channels"` // 留空则发送到所有已配置的渠道
+	NoDiff   bool     `json:"no_diff"`  // 不在警报中附带内容差异
+}
+
+const (
+	defaultCriticalInterval = 10 * time.Second
+	maxCriticalSize         = 1 << 20
+)
+
+type criticalFile struct {
+	Hash    string `json:"hash"`
+	Size    int64  `json:"size"`
+	Content string `json:"content,omitempty"` // 用于生成差异，超过 1MB 或二进制文件不保存
+}
+
+var (
+	criticalWatch    CriticalWatchConfig
+	criticalInterval = defaultCriticalInterval
+
+	criticalMu    sync.Mutex
+	criticalFiles map[string]*criticalFile
+)
+
+func applyCriticalWatchConfig(c CriticalWatchConfig) error {
+	criticalWatch = c
+	for _, p := range c.Files {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("无效的匹配模式 %s: %v", p, err)
+		}
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("无效的 interval: %s", c.Interval)
+		}
+		criticalInterval = d
+	}
+	return nil
+}
+
+func criticalStateFile() string {
+	return hashDBFile + ".critical.json"
+}
+
+// startCriticalWatch 建立关键文件基线并按 interval 定时检查
+func startCriticalWatch() {
+	if len(criticalWatch.Files) == 0 {
+		return
+	}
+	// 第一次运行时静默建立基线
+	criticalFiles = make(map[string]*criticalFile)
+	data, err := os.ReadFile(criticalStateFile())
+	if err == nil {
+		if err := json.Unmarshal(data, &criticalFiles); err != nil {
+			log.Printf("解析关键文件状态错误: %v", err)
+			criticalFiles = make(map[string]*criticalFile)
+		}
+	}
+	checkCriticalFiles(err != nil)
+	log.Printf("关键文件监视: %d 个文件，检查间隔 %s", len(criticalFiles), criticalInterval)
+
+	go func() {
+		ticker := time.NewTicker(criticalInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkCriticalFiles(false)
+		}
+	}()
+}
+
+// expandCriticalFiles 展开通配符，每次检查都重新展开以发现新出现的文件
+func expandCriticalFiles() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range criticalWatch.Files {
+		matches, _ := filepath.Glob(p)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() && !seen[m] {
+				seen[m] = true
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+// checkCriticalFiles 比较关键文件与上次记录的内容，baseline 为 true 时只记录不报警
+func checkCriticalFiles(baseline bool) {
+	criticalMu.Lock()
+	defer criticalMu.Unlock()
+
+	current := make(map[string]bool)
+	var events []Event
+	for _, path := range expandCriticalFiles() {
+		current[path] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("读取关键文件 %s 失败: %v", path, err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		cf := &criticalFile{Hash: hex.EncodeToString(sum[:]), Size: int64(len(data))}
+		if len(data) <= maxCriticalSize && utf8.Valid(data) {
+			cf.Content = string(data)
+		}
+
+		old, ok := criticalFiles[path]
+		criticalFiles[path] = cf
+		switch {
+		case !ok:
+			events = append(events, Event{Type: "new", Path: path, Size: cf.Size, NewHash: cf.Hash,
+				Diff: criticalDiff("", cf)})
+		case old.Hash != cf.Hash:
+			events = append(events, Event{Type: "modified", Path: path, Size: cf.Size, OldHash: old.Hash,
+				NewHash: cf.Hash, Diff: criticalDiff(old.Content, cf)})
+		}
+	}
+	for path, old := range criticalFiles {
+		if !current[path] {
+			// 读取失败的文件仍然存在时不当作删除
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+			delete(criticalFiles, path)
+			events = append(events, Event{Type: "deleted", Path: path, OldHash: old.Hash})
+		}
+	}
+	if len(events) == 0 && !baseline {
+		return
+	}
+
+	if data, err := json.MarshalIndent(criticalFiles, "", "  "); err == nil {
+		if err := writeStateFile(criticalStateFile(), data, 0600); err != nil {
+			log.Printf("保存关键文件状态错误: %v", err)
+		}
+	}
+	if baseline {
+		return
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	for _, ev := range events {
+		ev.Time = now()
+		ev.Severity = sevCritical
+		rememberEvent(ev)
+		agentQueueEvent(ev)
+		alert(Notification{Time: ev.Time, Severity: sevCritical, Text: "关键文件发生变化\n" + formatEvent(ev),
+			Events: []Event{ev}, Channels: criticalChannels()})
+	}
+}
+
+func criticalDiff(old string, cf *criticalFile) string {
+	if criticalWatch.NoDiff || (cf.Content == "" && cf.Size > 0) {
+		return ""
+	}
+	return lineDiff(old, cf.Content, maxDiffLines)
+}
+
+// criticalChannels 返回关键文件警报的发送渠道，未指定时发送到所有已配置的渠道
+func criticalChannels() []string {
+	if len(criticalWatch.Channels) > 0 {
+		return criticalWatch.Channels
+	}
+	registered, _ := currentNotifiers()
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
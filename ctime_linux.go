@@ -0,0 +1,17 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileCTime 返回状态改变时间（Unix 纳秒）。修改时间可以用 touch 伪造，状态改变时间只能由内核更新
+func fileCTime(info os.FileInfo) int64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return st.Ctim.Nano()
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// fileCTime 在其他平台上不可用，快速校验只比较大小和修改时间
+func fileCTime(info os.FileInfo) int64 {
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 后台运行和单实例锁：-daemon 以相同参数在后台重新启动自身，前台进程随即退出。
+// 守护进程启动时锁定 <db>.lock，同一个哈希数据库已有实例在运行时拒绝启动，
+// 避免两个扫描进程互相覆盖基线和状态文件
+
+const daemonEnv = "WEBMONITOR_DAEMON"
+
+var (
+	daemonMode bool
+	pidFile    string
+
+	// instanceLock 在进程运行期间一直保持打开
+	instanceLock *os.File
+)
+
+// runDaemonize 在后台启动守护进程，等待片刻确认它没有立即退出
+func runDaemonize() int {
+	if readOnly {
+		explicit := false
+		flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "log" })
+		if !explicit {
+			fmt.Fprintln(os.Stderr, "只读模式下与 -daemon 一起使用时必须用 -log 指定日志文件")
+			return exitError
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法确定程序路径: %v\n", err)
+		return exitError
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.SysProcAttr = detachAttr()
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "无法启动守护进程: %v\n", err)
+		return exitError
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		fmt.Fprintf(os.Stderr, "守护进程启动失败（%v），详见日志 %s\n", err, logFilePath)
+		return exitError
+	case <-time.After(2 * time.Second):
+	}
+	fmt.Printf("已在后台运行，PID %d\n", cmd.Process.Pid)
+	return exitClean
+}
+
+// isDaemonChild 判断当前进程是否是 -daemon 启动的后台进程
+func isDaemonChild() bool {
+	if os.Getenv(daemonEnv) == "" {
+		return false
+	}
+	os.Unsetenv(daemonEnv)
+	return true
+}
+
+// acquireInstanceLock 锁定哈希数据库对应的锁文件并写入 PID 文件，已被其他实例锁定时退出
+func acquireInstanceLock() {
+	// 只读模式不写入任何状态，数据目录通常也不可写，不加锁
+	if !readOnly {
+		path := hashDBFile + ".lock"
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatalf("无法创建锁文件目录: %v", err)
+		}
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			log.Fatalf("无法打开锁文件: %v", err)
+		}
+		if err := lockFile(f); err != nil {
+			pid := "未知"
+			if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+				pid = strings.TrimSpace(string(data))
+			}
+			log.Fatalf("另一个实例（PID %s）正在使用哈希数据库 %s，拒绝启动", pid, hashDBFile)
+		}
+		f.Truncate(0)
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+		instanceLock = f
+	}
+
+	if pidFile == "" && daemonMode && !readOnly {
+		pidFile = hashDBFile + ".pid"
+	}
+	if pidFile != "" {
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			log.Fatalf("无法写入 PID 文件: %v", err)
+		}
+		log.Printf("PID 文件: %s", pidFile)
+	}
+}
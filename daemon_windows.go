@@ -0,0 +1,34 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = modkernel32.NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	detachedProcess         = 0x8
+	createNewProcessGroup   = 0x200
+)
+
+// lockFile 对文件末尾之后的一个字节加非阻塞的排他锁，进程退出时自动释放。
+// Windows 的锁会阻止其他进程读取被锁的范围，锁在 PID 之后使其他实例仍能读出 PID
+func lockFile(f *os.File) error {
+	ol := syscall.Overlapped{Offset: 0x7fffffff}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// detachAttr 让后台进程不附加到当前控制台
+func detachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | createNewProcessGroup, HideWindow: true}
+}
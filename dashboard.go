@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// DashboardConfig 配置内置的只读网页面板
+type DashboardConfig struct {
+	Listen   string `json:"listen"` // 例如 127.0.0.1:8080，留空不启用
+	Username string `json:"username"`
+	Password string `json:"password" secret:"true"` // 配置后使用 HTTP Basic 认证
+	TLSCert  string `json:"tls_cert"`
+	TLSKey   string `json:"tls_key"`
+}
+
+var dashboard DashboardConfig
+
+type dashboardDir struct {
+	Path        string
+	Files       int
+	Unavailable bool
+}
+
+type dashboardPage struct {
+	Now      string
+	Status   ctlStatus
+	Dirs     []dashboardDir
+	LastScan string
+	Silenced string
+	Paused   string
+	Coverage string
+	Alerts   []alertRecord
+}
+
+var dashboardFuncs = template.FuncMap{
+	"fmtTime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return formatTime(t)
+	},
+	"since": func(t time.Time) string { return time.Since(t).Round(time.Second).String() },
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(dashboardFuncs).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>文件防篡改监控</title>
+<style>
+body { font-family: -apple-system, "Microsoft YaHei", sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; } h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; min-width: 50%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 12px 4px 0; text-align: left; vertical-align: top; }
+.bad { color: #c00; } .ok { color: #080; } .warn { color: #b60; } .muted { color: #888; }
+pre { margin: 0; white-space: pre-wrap; font-family: inherit; }
+</style>
+</head>
+<body>
+<h1>{{.Status.Version}}</h1>
+<p class="muted">{{.Now}} · 每 10 秒刷新</p>
+
+<table>
+<tr><th>基线文件</th><td>{{.Status.Files}}</td></tr>
+<tr><th>待确认变动</th><td>{{if .Status.Pending}}<span class="warn">{{.Status.Pending}}</span>{{else}}0{{end}}{{if not .Status.ManualAccept}} <span class="muted">(未启用 manual_accept)</span>{{end}}</td></tr>
+<tr><th>上次扫描</th><td>{{.LastScan}}</td></tr>
+<tr><th>扫描状态</th><td>{{if .Status.Progress.Scanning}}扫描中 {{.Status.Progress.Dir}}，已检查 {{.Status.Progress.Files}} 个文件，耗时 {{since .Status.Progress.StartedAt}}{{else}}空闲{{end}}</td></tr>
+{{if .Silenced}}<tr><th>警报静默</th><td class="warn">至 {{.Silenced}}</td></tr>{{end}}
+{{if .Paused}}<tr><th>扫描暂停</th><td class="warn">{{.Paused}}</td></tr>{{end}}
+{{with .Coverage}}<tr><th>覆盖率</th><td>{{.}}</td></tr>{{end}}
+</table>
+
+<h2>监控目录</h2>
+<table>
+<tr><th>目录</th><th>文件数</th><th>状态</th></tr>
+{{range .Dirs}}<tr><td>{{.Path}}</td><td>{{.Files}}</td><td>{{if .Unavailable}}<span class="bad">不可用</span>{{else}}<span class="ok">正常</span>{{end}}</td></tr>
+{{end}}</table>
+
+{{if .Status.PendingChanges}}<h2>待确认变动</h2>
+<table>
+<tr><th>时间</th><th>类型</th><th>级别</th><th>路径</th></tr>
+{{range .Status.PendingChanges}}<tr><td>{{fmtTime .Time}}</td><td>{{.Type}}</td><td>{{.Severity}}</td><td>{{.Path}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>最近警报</h2>
+<table>
+{{range .Alerts}}<tr><td>{{fmtTime .Time}}</td><td><pre>{{.Message}}</pre></td></tr>
+{{else}}<tr><td class="muted">暂无警报</td></tr>
+{{end}}</table>
+
+<h2>通知渠道</h2>
+<table>
+<tr><th>渠道</th><th>状态</th><th>最近发送</th></tr>
+{{range .Status.Channels}}<tr><td>{{.Name}}</td><td>{{if .OK}}<span class="ok">正常</span>{{else}}<span class="bad">异常 {{.LastError}}</span>{{end}}</td><td>{{fmtTime .LastSent}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func startDashboard() {
+	if dashboard.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", dashboardHandleIndex)
+	mux.HandleFunc("/api/status", ctlHandleStatus)
+
+	srv := &http.Server{Addr: dashboard.Listen, Handler: dashboardAuth(mux)}
+	go func() {
+		var err error
+		if dashboard.TLSCert != "" && dashboard.TLSKey != "" {
+			log.Printf("网页面板监听于 https://%s", dashboard.Listen)
+			err = srv.ListenAndServeTLS(dashboard.TLSCert, dashboard.TLSKey)
+		} else {
+			log.Printf("网页面板监听于 http://%s", dashboard.Listen)
+			err = srv.ListenAndServe()
+		}
+		log.Printf("网页面板服务退出: %v", err)
+	}()
+}
+
+func dashboardAuth(next http.Handler) http.Handler {
+	if dashboard.Password == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(dashboard.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(dashboard.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="webmonitor"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func dashboardHandleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	st := buildStatus()
+	page := dashboardPage{
+		Now:      formatTime(now()),
+		Status:   st,
+		LastScan: "尚未完成扫描",
+	}
+	if !st.LastScan.IsZero() {
+		page.LastScan = formatTime(st.LastScan) + "（" + time.Since(st.LastScan).Round(time.Second).String() + "前）"
+	}
+	if st.Coverage != nil {
+		page.Coverage = st.Coverage.summary()
+	}
+	if now().Before(st.SilencedUntil) {
+		page.Silenced = formatTime(st.SilencedUntil)
+	}
+	page.Paused = pauseText(st)
+	for _, dir := range st.Directories {
+		page.Dirs = append(page.Dirs, dashboardDir{
+			Path:        dir,
+			Files:       st.DirectoryFiles[dir],
+			Unavailable: containsString(st.Unavailable, dir),
+		})
+	}
+	sort.Slice(page.Dirs, func(i, j int) bool { return page.Dirs[i].Path < page.Dirs[j].Path })
+	// 最新的警报在前
+	for i := len(st.RecentAlerts) - 1; i >= 0; i-- {
+		page.Alerts = append(page.Alerts, st.RecentAlerts[i])
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, page); err != nil {
+		log.Printf("渲染网页面板错误: %v", err)
+	}
+}
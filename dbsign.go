@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 配置 hash_db_key 后，json 存储的哈希数据库旁会保存 HMAC-SHA256 签名（.sig 文件），
+// 加载时签名不符或缺失则拒绝加载并报警，攻击者不能直接编辑 hashdb.json 来隐藏 webshell
+
+var (
+	// dbHMACKey 由 dbKeyMu 保护，重新加载配置时可能更换
+	dbKeyMu    sync.Mutex
+	dbHMACKey  []byte
+	signDBMode bool
+)
+
+var errBaselineSignature = errors.New("哈希数据库签名校验失败")
+
+// parseDBKey 检查 hash_db_key，未配置时使用 WEBMON_DB_KEY 环境变量，都没有时返回 nil
+func parseDBKey(key string) ([]byte, error) {
+	if key == "" {
+		key = os.Getenv("WEBMON_DB_KEY")
+	}
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) < 16 {
+		return nil, fmt.Errorf("hash_db_key 至少需要 16 个字符")
+	}
+	if storageCfg.Type != "" && storageCfg.Type != "json" {
+		return nil, fmt.Errorf("hash_db_key 只用于 json 存储，当前存储类型为 %s", storageCfg.Type)
+	}
+	return []byte(key), nil
+}
+
+func applyDBKey(key string) error {
+	k, err := parseDBKey(key)
+	if err != nil {
+		return err
+	}
+	dbKeyMu.Lock()
+	dbHMACKey = k
+	dbKeyMu.Unlock()
+	return nil
+}
+
+// dbKey 返回当前的签名密钥，未配置时为 nil
+func dbKey() []byte {
+	dbKeyMu.Lock()
+	defer dbKeyMu.Unlock()
+	return dbHMACKey
+}
+
+// reloadDBKey 在重新加载配置时更换 hash_db_key：先按原密钥确认 json 数据库文件在运行期间未被改动，
+// 再用新密钥重新签名，之后保存基线时不会误报文件被修改
+func reloadDBKey(key string) error {
+	k, err := parseDBKey(key)
+	if err != nil {
+		return err
+	}
+	old := dbKey()
+	if hmac.Equal(old, k) {
+		return nil
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	applyDBKey(key)
+	if s, ok := store.(*jsonStorage); ok {
+		s.resign(old)
+	}
+	log.Println("hash_db_key 已更换，哈希数据库使用新密钥签名")
+	return nil
+}
+
+func baselineSigFile(path string) string {
+	return path + ".sig"
+}
+
+func baselineMAC(data []byte) []byte {
+	return baselineMACWith(dbKey(), data)
+}
+
+func baselineMACWith(key, data []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// verifyBaselineSignature 校验数据库文件内容的签名，返回签名值
+func verifyBaselineSignature(path string, data []byte) ([]byte, error) {
+	if len(dbKey()) == 0 {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(baselineSigFile(path))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: 缺少签名文件 %s（首次启用 hash_db_key 时请确认基线可信后运行 -sign-db）",
+			errBaselineSignature, baselineSigFile(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无法读取签名文件: %v", errBaselineSignature, err)
+	}
+	// 保存过程中签名文件可能同时列出原签名和新签名，与其中任何一个相符即可
+	mac := baselineMAC(data)
+	for _, line := range strings.Fields(string(raw)) {
+		if want, err := hex.DecodeString(line); err == nil && hmac.Equal(want, mac) {
+			return mac, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s 的内容与签名不符，可能已被篡改", errBaselineSignature, path)
+}
+
+// writeBaselineSignature 原子地写入签名文件，每行一个签名，跳过空的签名
+func writeBaselineSignature(path string, macs ...[]byte) error {
+	var b strings.Builder
+	for _, mac := range macs {
+		if len(mac) > 0 {
+			b.WriteString(hex.EncodeToString(mac) + "\n")
+		}
+	}
+	if err := writeFileAtomic(baselineSigFile(path), []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("写入哈希数据库签名错误: %v", err)
+	}
+	return nil
+}
+
+// refuseTamperedBaseline 在基线签名校验失败时报警并退出，不能像文件损坏时那样重新建立基线，
+// 否则被篡改的文件会被当作可信内容
+func refuseTamperedBaseline(err error) {
+	alert(Notification{Severity: sevCritical, Text: fmt.Sprintf("拒绝加载哈希数据库: %v", err)})
+	sendWG.Wait()
+	log.Fatalf("拒绝加载哈希数据库: %v", err)
+}
+
+// runSignDB 为当前的哈希数据库文件生成签名，用于首次启用 hash_db_key 或人工核对基线之后
+func runSignDB() int {
+	if err := prepareOneShotConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if len(dbKey()) == 0 {
+		fmt.Fprintln(os.Stderr, "错误：未配置 hash_db_key 或 WEBMON_DB_KEY")
+		return exitError
+	}
+	path := storageCfg.Path
+	if path == "" {
+		path = hashDBFile
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法读取哈希数据库文件: %v\n", err)
+		return exitError
+	}
+	db, err := parseBaselineJSON(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if err := writeBaselineSignature(path, baselineMAC(data)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("已为 %s（%d 条记录）生成签名 %s\n", path, len(db), baselineSigFile(path))
+	return exitClean
+}
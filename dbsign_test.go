@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSignedSaveInterrupted 检查保存基线的每一步中断后，磁盘上的数据库和签名文件仍然能通过校验
+func TestSignedSaveInterrupted(t *testing.T) {
+	saved := dbKey()
+	defer func() { dbHMACKey = saved }()
+	if err := applyDBKey("test-key-0123456789"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "hashdb.json")
+	oldData, newData := []byte(`{"/a":{"hash":"1"}}`), []byte(`{"/a":{"hash":"2"}}`)
+	oldMAC, newMAC := baselineMAC(oldData), baselineMAC(newData)
+	check := func(step string, data []byte) {
+		t.Helper()
+		if err := writeFileAtomic(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifyBaselineSignature(path, data); err != nil {
+			t.Errorf("%s: %v", step, err)
+		}
+	}
+
+	if err := writeBaselineSignature(path, oldMAC); err != nil {
+		t.Fatal(err)
+	}
+	check("before save", oldData)
+	if err := writeBaselineSignature(path, newMAC, oldMAC); err != nil {
+		t.Fatal(err)
+	}
+	check("signature staged, database not replaced", oldData)
+	check("database replaced, old signature not dropped", newData)
+	if err := writeBaselineSignature(path, newMAC); err != nil {
+		t.Fatal(err)
+	}
+	check("after save", newData)
+
+	// 新签名写入完成后旧内容不再被接受
+	if _, err := verifyBaselineSignature(path, oldData); err == nil {
+		t.Error("old database still accepted after the save completed")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp-*")); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+	if _, err := os.Stat(baselineSigFile(path)); err != nil {
+		t.Error(err)
+	}
+}
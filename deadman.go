@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DeadmanConfig 配置每次扫描后访问的外部存活检测地址（healthchecks.io、Uptime Kuma push 等）
+type DeadmanConfig struct {
+	URL     string `json:"url"`      // 扫描成功后访问
+	FailURL string `json:"fail_url"` // 扫描出错时访问，留空则不访问，由外部系统超时报警
+	Timeout string `json:"timeout"`  // 默认 10s
+}
+
+var deadman DeadmanConfig
+
+func pingDeadman(scanErrs int) {
+	target := deadman.URL
+	if scanErrs > 0 {
+		target = deadman.FailURL
+	}
+	if target == "" {
+		return
+	}
+
+	timeout := 10 * time.Second
+	if deadman.Timeout != "" {
+		if d, err := time.ParseDuration(deadman.Timeout); err == nil {
+			timeout = d
+		}
+	}
+
+	// 与通知一样计入 sendWG，scan 子命令退出前会等待存活检测请求完成
+	sendWG.Add(1)
+	go func() {
+		defer sendWG.Done()
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(target)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("返回 %s", resp.Status)
+			}
+		}
+		if err != nil {
+			log.Printf("存活检测地址访问失败: %v", err)
+		}
+		reportChannel("deadman", err)
+	}()
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 深度审计（deep_audit）：独立于日常扫描定时执行（例如每周一次），重新计算所有文件的哈希和附加摘要、
+// 重新读取全部属性并写入基线，再与事件记录（.churn.json）核对：自上次审计以来基线中发生变更的文件
+// 都应有对应的事件，没有事件的变更说明基线可能被绕过监控直接修改。结果写成签名的 JSON 报告，供合规检查留存
+
+// DeepAuditConfig 配置定时深度审计
+type DeepAuditConfig struct {
+	Interval  string   `json:"interval"`          // 两次审计的间隔，例如 168h；留空不定时审计
+	Days      []string `json:"days"`              // 只在这些日子的 from-to 时段内开始审计，留空表示任何时间
+	From      string   `json:"from"`              // HH:MM
+	To        string   `json:"to"`                // HH:MM
+	ReportDir string   `json:"report_dir"`        // 默认为哈希数据库旁的 .audit 目录
+	Keep      int      `json:"keep"`              // 保留最近多少份报告，默认 52
+	Key       string   `json:"key" secret:"true"` // 报告的 HMAC-SHA256 签名密钥，默认使用 hash_db_key
+	GPGKey    string   `json:"gpg_key"`           // 设置后同时用 gpg 生成 .asc 签名
+	GPG       string   `json:"gpg"`               // gpg 可执行文件，默认 gpg
+}
+
+const defaultAuditKeep = 52
+
+var (
+	deepAudit       DeepAuditConfig
+	auditInterval   time.Duration
+	auditWindow     *scheduleWindow
+	auditKey        []byte
+	deepAuditMode   bool
+	verifyAuditPath string
+)
+
+// auditState 保存在哈希数据库旁，记录上次审计时基线中每个文件的哈希，下次审计据此找出期间的变更
+type auditState struct {
+	Last    time.Time         `json:"last"`
+	Report  string            `json:"report,omitempty"`
+	Hashes  map[string]string `json:"hashes"`
+	Pending []string          `json:"pending,omitempty"` // 当时等待确认的变动，之后被确认时事件早于本次审计
+}
+
+type auditReport struct {
+	Command       string     `json:"command"`
+	Status        string     `json:"status"` // clean, findings, error
+	Host          string     `json:"host"`
+	Version       string     `json:"version"`
+	Started       time.Time  `json:"started"`
+	Finished      time.Time  `json:"finished"`
+	Previous      *time.Time `json:"previous,omitempty"`
+	Directories   []string   `json:"directories"`
+	Files         int        `json:"files"`
+	BaselineFiles int        `json:"baseline_files"`
+	Applied       bool       `json:"applied"` // 差异是否已按正常流程报警并写入基线
+
+	Changes  []auditChange `json:"changes"`  // 本次审计发现的与基线不一致的文件
+	Digests  int           `json:"digests"`  // 补齐附加摘要的文件数
+	Metadata int           `json:"metadata"` // 补齐属性的文件数
+	Pending  int           `json:"pending"`  // 审计结束时等待确认的变动数
+	Journal  auditJournal  `json:"journal"`
+	Errors   []string      `json:"errors"`
+}
+
+type auditChange struct {
+	Event
+	Pending bool `json:"pending,omitempty"` // 审计前已在等待确认，日常扫描已经报告过
+}
+
+type auditJournal struct {
+	Checked bool   `json:"checked"`
+	Note    string `json:"note,omitempty"`
+	Changed int    `json:"changed"` // 自上次审计以来基线中变更的文件数
+	// Unrecorded 是基线变更但没有任何事件记录的文件
+	Unrecorded []string `json:"unrecorded"`
+	// Reverted 是期间有事件记录、但基线与上次审计时相同的文件（改动后又恢复），仅供参考
+	Reverted []string `json:"reverted,omitempty"`
+}
+
+func applyDeepAuditConfig(c DeepAuditConfig) error {
+	deepAudit, auditInterval, auditWindow, auditKey = c, 0, nil, nil
+	if c.Key != "" {
+		if len(c.Key) < 16 {
+			return fmt.Errorf("deep_audit.key 至少需要 16 个字符")
+		}
+		auditKey = []byte(c.Key)
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("deep_audit.interval 格式错误: %s", c.Interval)
+		}
+		auditInterval = d
+	}
+	if len(c.Days) > 0 || c.From != "" || c.To != "" {
+		w, err := parseWindow(c.Days, c.From, c.To)
+		if err != nil {
+			return fmt.Errorf("deep_audit 时段%v", err)
+		}
+		auditWindow = &w
+	}
+	if deepAudit.Keep == 0 {
+		deepAudit.Keep = defaultAuditKeep
+	}
+	if deepAudit.GPG == "" {
+		deepAudit.GPG = "gpg"
+	}
+	return nil
+}
+
+// auditSigningKey 返回报告的 HMAC 密钥，未单独配置时使用 hash_db_key
+func auditSigningKey() []byte {
+	if len(auditKey) > 0 {
+		return auditKey
+	}
+	return dbKey()
+}
+
+func auditReportDir() string {
+	if deepAudit.ReportDir != "" {
+		return deepAudit.ReportDir
+	}
+	return hashDBFile + ".audit"
+}
+
+func auditStateFile() string {
+	return hashDBFile + ".audit.json"
+}
+
+func loadAuditState() (*auditState, error) {
+	data, err := os.ReadFile(auditStateFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st auditState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("解析审计状态错误: %v", err)
+	}
+	return &st, nil
+}
+
+// startDeepAudit 启动定时审计，每分钟检查一次是否到期
+func startDeepAudit() {
+	if auditInterval == 0 {
+		return
+	}
+	if len(auditSigningKey()) == 0 && deepAudit.GPGKey == "" {
+		log.Printf("深度审计未配置签名密钥（deep_audit.key、hash_db_key 或 deep_audit.gpg_key），报告将不签名")
+	}
+	log.Printf("深度审计: 每 %s 一次，报告目录 %s", auditInterval, auditReportDir())
+
+	go func() {
+		var attempted time.Time
+		for {
+			time.Sleep(time.Minute)
+			st, err := loadAuditState()
+			if err != nil {
+				log.Printf("读取审计状态错误: %v", err)
+			}
+			t := now()
+			if st != nil && t.Sub(st.Last) < auditInterval {
+				continue
+			}
+			// 报告保存失败时状态不会更新，最多每小时重试一次
+			if t.Sub(attempted) < min(auditInterval, time.Hour) {
+				continue
+			}
+			if auditWindow != nil && !auditWindow.matches(t) {
+				continue
+			}
+			attempted = t
+			runAudit(true)
+		}
+	}()
+}
+
+// runAudit 执行一次深度审计。apply 为 true 时（守护进程中）差异按正常流程报警并写入基线，
+// 属性和附加摘要一并补齐；一次性命令只报告不修改基线
+func runAudit(apply bool) auditReport {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+
+	rep := auditReport{Command: "deep-audit", Host: hostname(), Version: appversion, Started: now(),
+		Applied: apply, Changes: []auditChange{}, Errors: []string{}}
+	rep.Journal.Unrecorded = []string{}
+	log.Println("开始深度审计..")
+
+	prev, err := loadAuditState()
+	if err != nil {
+		rep.Errors = append(rep.Errors, err.Error())
+	}
+	if prev != nil {
+		rep.Previous = &prev.Last
+	}
+
+	expandDirs()
+	if apply {
+		if err := refreshHashDB(); err != nil {
+			log.Printf("读取共享基线错误: %v", err)
+		}
+	}
+	dbMu.Lock()
+	dirs := monitorDirs
+	if apply {
+		progress = scanProgress{Scanning: true, StartedAt: rep.Started}
+	}
+	dbMu.Unlock()
+	rep.Directories = dirs
+
+	// 审计不使用增量扫描的快速校验，重新计算每个文件的哈希和附加摘要、读取全部属性
+	statFastPath = false
+	res := scanTree(dirs)
+	if shuttingDown() {
+		// 遍历被中止，结果不完整，不保存报告和审计状态
+		log.Println("程序正在停止，深度审计被中止")
+		if apply {
+			dbMu.Lock()
+			progress.Scanning = false
+			progress.Dir = ""
+			dbMu.Unlock()
+		}
+		rep.Status = "error"
+		rep.Errors = append(rep.Errors, "程序正在停止，审计被中止")
+		return rep
+	}
+	rep.Files = res.Files
+	rep.Errors = append(rep.Errors, res.Errors...)
+	rep.Digests, rep.Metadata = len(res.Digests), len(res.Meta)
+	dbMu.Lock()
+	for _, ev := range res.Events {
+		_, waiting := pending[pendingKey(ev)]
+		rep.Changes = append(rep.Changes, auditChange{Event: ev, Pending: waiting})
+	}
+	dbMu.Unlock()
+
+	if apply {
+		applyScanResult(res)
+		saveChurnStats()
+		dbMu.Lock()
+		lastScan = now()
+		lastScanErrs = len(res.Errors)
+		lastCoverage = res.Coverage
+		if len(res.Errors) == 0 {
+			lastFullScan = rep.Started
+		}
+		progress.Scanning = false
+		progress.Dir = ""
+		dbMu.Unlock()
+	}
+
+	dbMu.Lock()
+	cur := make(map[string]string, len(hashDB))
+	for path, e := range hashDB {
+		cur[path] = e.Hash
+	}
+	waiting := make([]string, 0, len(pending))
+	for key := range pending {
+		waiting = append(waiting, key)
+	}
+	sort.Strings(waiting)
+	rep.BaselineFiles = len(hashDB)
+	rep.Pending = len(pending)
+	stats := churnStats
+	if stats == nil {
+		stats = loadChurnStats()
+	}
+	rep.Journal = checkJournal(prev, cur, stats)
+	dbMu.Unlock()
+
+	rep.Finished = now()
+	rep.Status = "clean"
+	if len(rep.Changes) > 0 || len(rep.Journal.Unrecorded) > 0 {
+		rep.Status = "findings"
+	}
+	if len(rep.Errors) > 0 {
+		rep.Status = "error"
+	}
+
+	file, err := writeAuditReport(rep)
+	if err != nil {
+		log.Printf("保存审计报告错误: %v", err)
+		rep.Status = "error"
+		rep.Errors = append(rep.Errors, err.Error())
+	} else {
+		// 报告保存失败时不更新状态，下次审计仍与上一次保存了报告的审计比较
+		st := auditState{Last: rep.Started, Report: file, Hashes: cur, Pending: waiting}
+		if data, err := json.Marshal(st); err == nil {
+			if err := writeStateFile(auditStateFile(), data, 0600); err != nil {
+				log.Printf("保存审计状态错误: %v", err)
+			}
+		}
+	}
+
+	log.Printf("深度审计完成: %d 个文件，差异 %d，无事件记录的基线变更 %d，错误 %d，报告 %s",
+		rep.Files, len(rep.Changes), len(rep.Journal.Unrecorded), len(rep.Errors), file)
+	if len(rep.Journal.Unrecorded) > 0 {
+		alert(Notification{Severity: sevCritical, Text: fmt.Sprintf("深度审计发现 %d 个文件的基线变更没有对应的事件记录，哈希数据库可能被绕过监控直接修改:\n%s",
+			len(rep.Journal.Unrecorded), strings.Join(limitStrings(rep.Journal.Unrecorded, 20), "\n"))})
+	}
+	return rep
+}
+
+// checkJournal 比较两次审计之间的基线变更与事件记录，调用方需持有 dbMu
+func checkJournal(prev *auditState, cur map[string]string, stats map[string]*churnStat) auditJournal {
+	j := auditJournal{Unrecorded: []string{}}
+	if prev == nil {
+		j.Note = "首次审计，从下一次审计开始核对事件记录"
+		return j
+	}
+	if sharedBaseline {
+		j.Note = "基线保存在多台主机共用的后端中，其他主机确认的变动没有本机事件记录，未核对"
+		return j
+	}
+	if now().Sub(prev.Last) > churnRetention {
+		j.Note = fmt.Sprintf("距上次审计超过 %s，更早的事件记录已被清理，未核对", churnRetention)
+		return j
+	}
+	j.Checked = true
+
+	wasPending := make(map[string]bool, len(prev.Pending))
+	for _, key := range prev.Pending {
+		wasPending[key] = true
+	}
+	recorded := func(path string) bool {
+		st, ok := stats[path]
+		return (ok && !st.Last.Before(prev.Last)) || wasPending[path]
+	}
+	// 移动事件只记录在新路径上
+	added := make(map[string][]string)
+	for path, h := range cur {
+		if _, ok := prev.Hashes[path]; !ok {
+			added[h] = append(added[h], path)
+		}
+	}
+
+	for path, h := range cur {
+		old, ok := prev.Hashes[path]
+		if ok && (old == h || hashAlgoOf(old) != hashAlgoOf(h)) {
+			// 哈希算法切换时基线会在没有事件的情况下换成新哈希
+			continue
+		}
+		j.Changed++
+		if !recorded(path) && watched(path, watchContent) {
+			j.Unrecorded = append(j.Unrecorded, path)
+		}
+	}
+	for path, h := range prev.Hashes {
+		if _, ok := cur[path]; ok {
+			continue
+		}
+		j.Changed++
+		if recorded(path) || !watched(path, watchContent) {
+			continue
+		}
+		moved := false
+		for _, p := range added[h] {
+			moved = moved || recorded(p)
+		}
+		if !moved {
+			j.Unrecorded = append(j.Unrecorded, path)
+		}
+	}
+	for path, st := range stats {
+		if st.Last.Before(prev.Last) {
+			continue
+		}
+		if h, ok := cur[path]; ok && prev.Hashes[path] == h {
+			if _, waiting := pending[path]; !waiting {
+				j.Reverted = append(j.Reverted, path)
+			}
+		}
+	}
+	sort.Strings(j.Unrecorded)
+	sort.Strings(j.Reverted)
+	return j
+}
+
+func limitStrings(s []string, n int) []string {
+	if len(s) <= n {
+		return s
+	}
+	return append(s[:n:n], fmt.Sprintf("... 另有 %d 个", len(s)-n))
+}
+
+// writeAuditReport 保存报告并签名，清理超出保留数量的旧报告
+func writeAuditReport(rep auditReport) (string, error) {
+	dir := auditReportDir()
+	if readOnly && deepAudit.ReportDir == "" {
+		return "", fmt.Errorf("只读模式下需要配置 deep_audit.report_dir 才能保存审计报告")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("无法创建审计报告目录: %v", err)
+	}
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "audit-"+rep.Started.Format("20060102-150405")+".json")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return "", fmt.Errorf("写入审计报告错误: %v", err)
+	}
+	if key := auditSigningKey(); len(key) > 0 {
+		m := hmac.New(sha256.New, key)
+		m.Write(data)
+		if err := os.WriteFile(file+".sig", []byte(hex.EncodeToString(m.Sum(nil))+"\n"), 0600); err != nil {
+			return file, fmt.Errorf("写入审计报告签名错误: %v", err)
+		}
+	}
+	if deepAudit.GPGKey != "" {
+		args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--local-user", deepAudit.GPGKey, "--output", file + ".asc", file}
+		if out, err := exec.Command(deepAudit.GPG, args...).CombinedOutput(); err != nil {
+			return file, fmt.Errorf("GPG 签名审计报告失败: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	pruneAuditReports(dir)
+	return file, nil
+}
+
+func pruneAuditReports(dir string) {
+	if deepAudit.Keep < 0 {
+		return
+	}
+	reports, _ := filepath.Glob(filepath.Join(dir, "audit-*.json"))
+	sort.Strings(reports)
+	for len(reports) > deepAudit.Keep {
+		for _, f := range []string{reports[0], reports[0] + ".sig", reports[0] + ".asc"} {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				log.Printf("删除旧审计报告错误: %v", err)
+			}
+		}
+		reports = reports[1:]
+	}
+}
+
+// runDeepAudit 立即执行一次审计并保存报告，不修改基线（0 无差异，1 有差异，2 出错）
+func runDeepAudit() int {
+	if err := prepareOneShot(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	rep := runAudit(false)
+	writeOutput(rep, func(w io.Writer) {
+		for _, c := range rep.Changes {
+			note := ""
+			if c.Pending {
+				note = "（等待确认）"
+			}
+			fmt.Fprintf(w, "%-10s %s%s\n", c.Type, c.Path, note)
+		}
+		for _, p := range rep.Journal.Unrecorded {
+			fmt.Fprintf(w, "无事件记录 %s\n", p)
+		}
+		if rep.Journal.Note != "" {
+			fmt.Fprintln(w, rep.Journal.Note)
+		}
+		for _, e := range rep.Errors {
+			fmt.Fprintln(w, "错误:", e)
+		}
+		fmt.Fprintf(w, "审计了 %d 个文件：差异 %d，自上次审计以来基线变更 %d（无事件记录 %d），错误 %d\n",
+			rep.Files, len(rep.Changes), rep.Journal.Changed, len(rep.Journal.Unrecorded), len(rep.Errors))
+	})
+	switch rep.Status {
+	case "clean":
+		return exitClean
+	case "findings":
+		return exitChanges
+	}
+	return exitError
+}
+
+// runVerifyAudit 校验审计报告的签名（0 有效，1 无效，2 出错）
+func runVerifyAudit() int {
+	if configFile != "" {
+		oneShot = true
+		log.SetFlags(0)
+		log.SetOutput(timestampWriter{os.Stderr})
+		loadConfigFromFile()
+	}
+	data, err := os.ReadFile(verifyAuditPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法读取审计报告: %v\n", err)
+		return exitError
+	}
+
+	checked := false
+	if raw, err := os.ReadFile(verifyAuditPath + ".sig"); err == nil {
+		key := auditSigningKey()
+		if len(key) == 0 {
+			fmt.Fprintln(os.Stderr, "错误：未配置 deep_audit.key 或 hash_db_key，无法校验 .sig 签名")
+			return exitError
+		}
+		want, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+		m := hmac.New(sha256.New, key)
+		m.Write(data)
+		if err != nil || !hmac.Equal(want, m.Sum(nil)) {
+			fmt.Printf("%s 的内容与 HMAC 签名不符，报告可能已被修改\n", verifyAuditPath)
+			return exitChanges
+		}
+		fmt.Printf("HMAC 签名有效: %s\n", verifyAuditPath)
+		checked = true
+	}
+	if _, err := os.Stat(verifyAuditPath + ".asc"); err == nil {
+		gpg := deepAudit.GPG
+		if gpg == "" {
+			gpg = "gpg"
+		}
+		out, err := exec.Command(gpg, "--batch", "--verify", verifyAuditPath+".asc", verifyAuditPath).CombinedOutput()
+		if err != nil {
+			fmt.Printf("GPG 签名无效: %s\n%s", verifyAuditPath, out)
+			return exitChanges
+		}
+		fmt.Printf("GPG 签名有效: %s\n%s", verifyAuditPath, out)
+		checked = true
+	}
+	if !checked {
+		fmt.Fprintf(os.Stderr, "错误：%s 没有签名文件（.sig 或 .asc）\n", verifyAuditPath)
+		return exitError
+	}
+	return exitClean
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// deviceID 返回文件所在设备号，用于判断挂载点是否发生变化
+func deviceID(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// deviceNumbers 返回设备文件的主、次设备号
+func deviceNumbers(info os.FileInfo) (major, minor uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	rdev := uint64(st.Rdev)
+	switch runtime.GOOS {
+	case "linux":
+		major = (rdev>>8)&0xfff | (rdev>>32)&^0xfff
+		minor = rdev&0xff | (rdev>>12)&^0xff
+	case "darwin":
+		major, minor = rdev>>24, rdev&0xffffff
+	default:
+		major, minor = rdev>>8&0xff, rdev&0xffff00ff
+	}
+	return major, minor, true
+}
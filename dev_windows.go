@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Windows 下 FileInfo 不提供设备号，挂载检测只依赖目录是否存在
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+func deviceNumbers(info os.FileInfo) (major, minor uint64, ok bool) {
+	return 0, 0, false
+}
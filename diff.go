@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// 内容差异（diff）：文本文件被修改时，在警报中附上统一格式（unified diff）的新旧内容差异，
+// 不用登录服务器就能看到被插入的代码。旧内容取自内容快照，因此需要启用 snapshots
+
+// DiffConfig 配置警报中的内容差异
+type DiffConfig struct {
+	Enabled     bool  `json:"enabled"`
+	MaxFileSize int64 `json:"max_file_size"` // 新旧内容都不超过该大小（字节）才生成差异，默认 256 KB
+	MaxLines    int   `json:"max_lines"`     // 差异最多输出的行数，默认 60
+	Context     int   `json:"context"`       // 每处改动前后的上下文行数，默认 3
+}
+
+var diffConfig = DiffConfig{MaxFileSize: 256 << 10, MaxLines: 60, Context: 3}
+
+func applyDiffConfig(c DiffConfig) error {
+	if c.MaxFileSize < 0 || c.MaxLines < 0 || c.Context < 0 {
+		return fmt.Errorf("diff 的 max_file_size、max_lines 和 context 不能为负数")
+	}
+	if c.Enabled && !snapshots.Enabled {
+		return fmt.Errorf("diff 需要启用 snapshots，旧内容取自内容快照")
+	}
+	if c.MaxFileSize == 0 {
+		c.MaxFileSize = 256 << 10
+	}
+	if c.MaxLines == 0 {
+		c.MaxLines = 60
+	}
+	if c.Context == 0 {
+		c.Context = 3
+	}
+	diffConfig = c
+	return nil
+}
+
+// addContentDiff 为被修改的文本文件附上与基线内容的差异，已有差异（seo_watch）时不覆盖
+func addContentDiff(ev *Event) {
+	if !diffConfig.Enabled || ev.Type != "modified" || ev.Stream != "" || ev.Diff != "" {
+		return
+	}
+	obj := snapshotObject(snapshotDir(), ev.OldHash)
+	if obj == "" {
+		return
+	}
+	old, ok := readDiffText(obj)
+	if !ok {
+		return
+	}
+	cur, ok := readDiffText(ev.Path)
+	if !ok {
+		return
+	}
+	ev.Diff = unifiedDiff(ev.Path, old, cur, diffConfig.Context, diffConfig.MaxLines)
+}
+
+// readDiffText 读取不超过大小限制的文本文件
+func readDiffText(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > diffConfig.MaxFileSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !isText(data) {
+		return "", false
+	}
+	return string(data), true
+}
+
+// isText 按内容判断是否为文本文件，含 NUL 字节的视为二进制
+func isText(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	ct := http.DetectContentType(data)
+	return strings.HasPrefix(ct, "text/") || strings.Contains(ct, "json") || strings.Contains(ct, "javascript") || strings.Contains(ct, "xml")
+}
+
+type diffOp struct {
+	kind byte // ' '、'-' 或 '+'
+	line string
+}
+
+// unifiedDiff 生成统一格式的差异；文件太大无法逐行比较时返回空字符串
+func unifiedDiff(path, old, new string, context, limit int) string {
+	a, b := splitLines(old), splitLines(new)
+	ops, ok := diffLines(a, b)
+	if !ok {
+		return ""
+	}
+
+	out := []string{"--- a" + path, "+++ b" + path}
+	aLine, bLine := 1, 1 // 下一个操作在旧、新文件中的行号
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+		// 向前带上 context 行，向后合并间隔不超过 2*context 行的改动
+		start := i
+		for start > 0 && i-start < context && ops[start-1].kind == ' ' {
+			start--
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(run, end+context)
+				break
+			}
+			end = run
+		}
+
+		hunkA, hunkB := aLine-(i-start), bLine-(i-start)
+		var body []string
+		na, nb := 0, 0
+		for _, op := range ops[start:end] {
+			body = append(body, string(op.kind)+op.line)
+			if op.kind != '+' {
+				na++
+			}
+			if op.kind != '-' {
+				nb++
+			}
+		}
+		out = append(out, fmt.Sprintf("@@ -%s +%s @@", hunkRange(hunkA, na), hunkRange(hunkB, nb)))
+		out = append(out, body...)
+
+		for _, op := range ops[i:end] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		i = end
+	}
+
+	if len(out) > limit+2 {
+		out = append(out[:limit+2], fmt.Sprintf("... 另有 %d 行", len(out)-limit-2))
+	}
+	return strings.Join(out, "\n")
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// diffLines 用最长公共子序列计算逐行的编辑序列，相同的开头和结尾不参与计算
+func diffLines(a, b []string) ([]diffOp, bool) {
+	var head, tail []diffOp
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		head = append(head, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		tail = append([]diffOp{{' ', a[len(a)-1]}}, tail...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	if len(a)*len(b) > 4000000 {
+		return nil, false
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := head
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return append(ops, tail...), true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 摘要投递（delivery_mode 为 digest）：与 per_scan 一样把一次扫描发现的变动合并成一条警报，
+// 但按目录和事件类型分组，每组只列出前几个文件名，部署时成百上千个文件变动也只是一条不长的消息
+
+const deliveryDigest = "digest"
+
+// digestMaxFiles 为每个目录的每类变动最多列出的文件数
+var digestMaxFiles = 5
+
+var eventTypeTitles = []struct{ typ, title string }{
+	{"new", "新文件"},
+	{"modified", "被修改"},
+	{"deleted", "被删除"},
+	{"renamed", "被移动或重命名"},
+	{"attributes", "属性被修改"},
+	{"stream_new", "新的备用数据流"},
+	{"stream_modified", "备用数据流被修改"},
+	{"stream_deleted", "备用数据流被删除"},
+}
+
+// formatDigest 按目录、事件类型汇总事件
+func formatDigest(events []Event) string {
+	dirs := map[string]map[string][]string{}
+	counts := map[string]int{}
+	for _, ev := range events {
+		dir, name := filepath.Dir(ev.Path), filepath.Base(ev.Path)
+		switch {
+		case ev.Type == "renamed" && filepath.Dir(ev.OldPath) == dir:
+			name = filepath.Base(ev.OldPath) + " -> " + name
+		case ev.Type == "renamed":
+			name = ev.OldPath + " -> " + name
+		case ev.Stream != "":
+			name += ":" + ev.Stream
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = map[string][]string{}
+		}
+		dirs[dir][ev.Type] = append(dirs[dir][ev.Type], name)
+		counts[ev.Type]++
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "本次扫描发现 %d 个变动，涉及 %d 个目录", len(events), len(dirs))
+	var totals []string
+	for _, t := range eventTypeTitles {
+		if counts[t.typ] > 0 {
+			totals = append(totals, fmt.Sprintf("%s %d", t.title, counts[t.typ]))
+		}
+	}
+	if len(totals) > 0 {
+		b.WriteString("（" + strings.Join(totals, "，") + "）")
+	}
+
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+	sort.Strings(names)
+	for _, dir := range names {
+		groups := dirs[dir]
+		n := 0
+		for _, files := range groups {
+			n += len(files)
+		}
+		fmt.Fprintf(&b, "\n%s (%d):", dir, n)
+		for _, t := range eventTypeTitles {
+			files := groups[t.typ]
+			if len(files) == 0 {
+				continue
+			}
+			sort.Strings(files)
+			shown := files
+			if len(shown) > digestMaxFiles {
+				shown = shown[:digestMaxFiles]
+			}
+			fmt.Fprintf(&b, "\n  %s %d: %s", t.title, len(files), strings.Join(shown, ", "))
+			if len(files) > len(shown) {
+				fmt.Fprintf(&b, " ... 另有 %d 个", len(files)-len(shown))
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DingTalkConfig 配置钉钉群机器人，secret 为机器人“加签”安全设置中的密钥
+type DingTalkConfig struct {
+	URL       string   `json:"url" secret:"true"`
+	Secret    string   `json:"secret" secret:"true"`
+	Template  string   `json:"template"`   // markdown 消息模板，为空时使用默认模板
+	AtMobiles []string `json:"at_mobiles"` // 需要 @ 的成员手机号
+	AtAll     bool     `json:"at_all"`
+	Timeout   string   `json:"timeout"` // 默认 10s
+}
+
+const defaultDingTalkTemplate = `### 文件防篡改警报 [{{.Severity}}]
+- 主机: {{.Host}}
+- 时间: {{.Time}}
+
+{{.Text}}`
+
+type dingTalkNotifier struct {
+	cfg    DingTalkConfig
+	tmpl   *template.Template
+	client *http.Client
+}
+
+func newDingTalkNotifier(cfg DingTalkConfig) (*dingTalkNotifier, error) {
+	tmpl, err := parseMessageTemplate("dingtalk", cfg.Template, defaultDingTalkTemplate)
+	if err != nil {
+		return nil, err
+	}
+	timeout := 10 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &dingTalkNotifier{cfg: cfg, tmpl: tmpl, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (dn *dingTalkNotifier) Send(n Notification) error {
+	text, err := renderMessage(dn.tmpl, n)
+	if err != nil {
+		return err
+	}
+	// markdown 中单个换行不会换行，转成两个空格加换行
+	text = strings.ReplaceAll(text, "\n", "  \n")
+	for _, m := range dn.cfg.AtMobiles {
+		text += " @" + m
+	}
+
+	msg := map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": "文件防篡改警报: " + strings.SplitN(n.Text, "\n", 2)[0],
+			"text":  text,
+		},
+		"at": map[string]interface{}{
+			"atMobiles": dn.cfg.AtMobiles,
+			"isAtAll":   dn.cfg.AtAll,
+		},
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	endpoint := dn.cfg.URL
+	if dn.cfg.Secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		sep := "&"
+		if !strings.Contains(endpoint, "?") {
+			sep = "?"
+		}
+		endpoint += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(signDingTalk(dn.cfg.Secret, ts))
+	}
+
+	resp, err := dn.client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 钉钉出错时仍返回 200，需要检查 errcode
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("返回 %s，无法解析响应: %v", resp.Status, err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("钉钉返回错误 %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// signDingTalk 按钉钉加签规则计算 base64(HMAC-SHA256(secret, timestamp + "\n" + secret))
+func signDingTalk(secret, ts string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
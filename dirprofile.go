@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+// 按目录的监控设置：wenjian.directories 的每一项可以是目录字符串，也可以是带独立设置的对象，例如
+// {"path": "/etc/nginx", "exclude": [], "check_interval": "1m", "max_file_size": 1048576, "severity": "critical"}。
+// 对象中写出的设置代替该目录的全局设置（exclude 写成 [] 表示不排除任何文件，include 写成 [] 表示不限制），没写的沿用全局设置。
+// path 可以是通配符，展开出的每个目录使用同一份设置
+
+// DirEntry 是 wenjian.directories 中的一项
+type DirEntry struct {
+	Path          string   `json:"path"`
+	Exclude       []string `json:"exclude,omitempty"`
+	Include       []string `json:"include,omitempty"`
+	IgnoreFiles   *bool    `json:"ignore_files,omitempty"`
+	CheckInterval string   `json:"check_interval,omitempty"`
+	MaxFileSize   *int64   `json:"max_file_size,omitempty"`
+	Severity      string   `json:"severity,omitempty"`
+}
+
+func (d *DirEntry) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*d = DirEntry{Path: path}
+		return nil
+	}
+	type plain DirEntry
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("wenjian.directories 的每一项应为目录或带 path 的对象: %v", err)
+	}
+	*d = DirEntry(p)
+	return nil
+}
+
+// MarshalJSON 没有独立设置的目录仍写成字符串，exclude、include 为空列表时保留，与不写区分
+func (d DirEntry) MarshalJSON() ([]byte, error) {
+	if d.plain() {
+		return json.Marshal(d.Path)
+	}
+	list := func(l []string) *[]string {
+		if l == nil {
+			return nil
+		}
+		return &l
+	}
+	return json.Marshal(struct {
+		Path          string    `json:"path"`
+		Exclude       *[]string `json:"exclude,omitempty"`
+		Include       *[]string `json:"include,omitempty"`
+		IgnoreFiles   *bool     `json:"ignore_files,omitempty"`
+		CheckInterval string    `json:"check_interval,omitempty"`
+		MaxFileSize   *int64    `json:"max_file_size,omitempty"`
+		Severity      string    `json:"severity,omitempty"`
+	}{d.Path, list(d.Exclude), list(d.Include), d.IgnoreFiles, d.CheckInterval, d.MaxFileSize, d.Severity})
+}
+
+func (d DirEntry) plain() bool {
+	return d.Exclude == nil && d.Include == nil && d.IgnoreFiles == nil && d.CheckInterval == "" && d.MaxFileSize == nil && d.Severity == ""
+}
+
+// String 用于配置改动的通知，带独立设置的目录附上设置
+func (d DirEntry) String() string {
+	if d.plain() {
+		return d.Path
+	}
+	data, _ := json.Marshal(d)
+	return string(data)
+}
+
+func dirEntryPaths(entries []DirEntry) []string {
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.Path
+	}
+	return paths
+}
+
+func dirEntryStrings(entries []DirEntry) []string {
+	list := make([]string, len(entries))
+	for i, e := range entries {
+		list[i] = e.String()
+	}
+	return list
+}
+
+type dirProfile struct {
+	DirEntry
+	interval time.Duration
+}
+
+// 目录与检查间隔的比较允许一秒（很短的间隔为十分之一）的误差，避免计时器稍早醒来时把到期的目录推迟到下一轮
+const rootDueSlack = time.Second
+
+func dueSlack(interval time.Duration) time.Duration {
+	return min(rootDueSlack, interval/10)
+}
+
+var (
+	// dirProfiles 为带独立设置的目录，按配置中的顺序
+	dirProfiles []*dirProfile
+	// rootProfiles 为展开后的各监控目录使用的设置，与 monitorDirs 一起由 expandDirs 在 dbMu 下更新
+	rootProfiles map[string]*dirProfile
+
+	// rootScanned 为各监控目录上次扫描的时间，只由主循环读写
+	rootScanned = make(map[string]time.Time)
+	// skippedRoots 为本次扫描中未到检查时间的目录，不检查其中的删除，由 scanMu 保护
+	skippedRoots []string
+)
+
+// applyDirProfiles 检查并应用各目录的设置，调用方需持有 scanMu
+func applyDirProfiles(entries []DirEntry) error {
+	var profiles []*dirProfile
+	for _, e := range entries {
+		if strings.TrimSpace(e.Path) == "" {
+			return fmt.Errorf("wenjian.directories 中有空的目录")
+		}
+		if e.plain() {
+			continue
+		}
+		p := &dirProfile{DirEntry: e}
+		if err := validateExcludes(e.Exclude); err != nil {
+			return fmt.Errorf("目录 %s: %v", e.Path, err)
+		}
+		if err := validateIncludes(e.Include); err != nil {
+			return fmt.Errorf("目录 %s: %v", e.Path, err)
+		}
+		if e.CheckInterval != "" {
+			d, err := time.ParseDuration(e.CheckInterval)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("目录 %s 的 check_interval 格式错误: %s", e.Path, e.CheckInterval)
+			}
+			p.interval = d
+		}
+		if e.MaxFileSize != nil && *e.MaxFileSize < 0 {
+			return fmt.Errorf("目录 %s 的 max_file_size 不能为负数", e.Path)
+		}
+		if e.Severity != "" {
+			if !validSeverity(e.Severity) {
+				return fmt.Errorf("目录 %s 的级别 %q 无效", e.Path, e.Severity)
+			}
+			p.Severity = strings.ToLower(e.Severity)
+		}
+		profiles = append(profiles, p)
+	}
+	dirProfiles = profiles
+	return nil
+}
+
+// matchProfiles 为展开后的监控目录找到配置中对应的设置
+func matchProfiles(dirs []string) map[string]*dirProfile {
+	m := make(map[string]*dirProfile)
+	for _, d := range dirs {
+		for _, p := range dirProfiles {
+			if strings.ContainsAny(p.Path, "*?[") {
+				if ok, _ := filepath.Match(filepath.Clean(p.Path), filepath.Clean(d)); !ok {
+					continue
+				}
+			} else if filepath.Clean(p.Path) != filepath.Clean(d) {
+				continue
+			}
+			m[d] = p
+			break
+		}
+	}
+	return m
+}
+
+// profileFor 返回 path 所在监控目录的设置，没有独立设置时返回 nil
+func profileFor(path string) *dirProfile {
+	if root, ok := rootFor(path, monitorDirs); ok {
+		return rootProfiles[root]
+	}
+	return nil
+}
+
+// excludesFor 返回适用于 path 的排除规则
+func excludesFor(path string) []string {
+	if p := profileFor(path); p != nil && p.Exclude != nil {
+		return p.Exclude
+	}
+	return exclude
+}
+
+// includesFor 返回适用于 path 的 include 规则，为空表示不限制
+func includesFor(path string) []string {
+	if p := profileFor(path); p != nil && p.Include != nil {
+		return p.Include
+	}
+	return include
+}
+
+// included 判断文件是否在 include 范围内，目录总是继续向下扫描
+func included(path string) bool {
+	rules := includesFor(path)
+	return len(rules) == 0 || matcher.Matches(path, rules)
+}
+
+// allExcludes 返回全局和各目录的全部排除规则，用于统计规则的命中情况
+func allExcludes() []string {
+	patterns := append([]string(nil), exclude...)
+	for _, p := range dirProfiles {
+		for _, pattern := range p.Exclude {
+			if !containsString(patterns, pattern) {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return patterns
+}
+
+// rootInterval 返回监控目录的检查间隔：目录自己的 check_interval，否则为当前扫描计划的间隔
+func rootInterval(root string, t time.Time) time.Duration {
+	interval, _ := intervalAt(t)
+	if p := rootProfiles[root]; p != nil && p.interval > 0 {
+		interval = p.interval
+	}
+	return interval
+}
+
+// dueRoots 把监控目录分为已到检查时间和还没到的两部分，force 为 true 时全部检查
+func dueRoots(dirs []string, force bool, t time.Time) (due, skipped []string) {
+	for _, d := range dirs {
+		interval := rootInterval(d, t)
+		if force || rootScanned[d].Add(interval).Sub(t) <= dueSlack(interval) {
+			due = append(due, d)
+		} else {
+			skipped = append(skipped, d)
+		}
+	}
+	return due, skipped
+}
+
+// underSkippedRoot 判断 path 是否属于本次扫描跳过的监控目录
+func underSkippedRoot(path string) bool {
+	if len(skippedRoots) == 0 {
+		return false
+	}
+	root, ok := rootFor(path, monitorDirs)
+	return ok && containsString(skippedRoots, root)
+}
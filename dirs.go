@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// dirPatterns 保存配置文件和命令行中的原始目录，可以包含通配符
+	dirPatterns  []string
+	argDirs      []string
+	dirsFromFile string
+)
+
+// loadDirsFromFile 读取每行一个目录的列表文件，忽略空行和 # 注释
+func loadDirsFromFile(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("无法读取目录列表文件 %s: %v", path, err)
+		return nil
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs
+}
+
+// expandDirs 展开通配符并重新读取目录列表文件，每次扫描前调用以发现新增的站点目录
+func expandDirs() {
+	patterns := append(append([]string(nil), dirPatterns...), argDirs...)
+	if dirsFromFile != "" {
+		patterns = append(patterns, loadDirsFromFile(dirsFromFile)...)
+	}
+
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(d string) {
+		if !seen[d] {
+			seen[d] = true
+			dirs = append(dirs, d)
+		}
+	}
+
+	for _, p := range patterns {
+		if !strings.ContainsAny(p, "*?[") {
+			add(p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			log.Printf("无效的目录通配符 %s: %v", p, err)
+			continue
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.IsDir() {
+				add(m)
+			}
+		}
+	}
+
+	profiles := matchProfiles(dirs)
+	dbMu.Lock()
+	old := monitorDirs
+	monitorDirs = dirs
+	rootProfiles = profiles
+	dbMu.Unlock()
+
+	// 首次展开时 old 为空，不重复输出
+	if len(old) == 0 {
+		return
+	}
+	for _, d := range dirs {
+		if !containsString(old, d) {
+			log.Printf("新增监控目录: %s", d)
+		}
+	}
+	for _, d := range old {
+		if !containsString(dirs, d) {
+			log.Printf("移除监控目录: %s", d)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EmailConfig struct {
+	Host       string   `json:"host"`
+	Port       int      `json:"port"`                   // 默认 tls 模式 465，其余 587
+	TLS        string   `json:"tls"`                    // starttls（默认）、tls（直接 TLS）、none
+	Username   string   `json:"username"`               // 为空时不认证
+	Password   string   `json:"password" secret:"true"` // 支持 enc:/env:/file:/vault: 引用
+	From       string   `json:"from"`
+	To         []string `json:"to"`
+	Subject    string   `json:"subject"`     // 主题前缀，默认 [webmonitor]
+	Retries    int      `json:"retries"`     // 临时性错误的重试次数，默认 3
+	RetryDelay string   `json:"retry_delay"` // 首次重试等待时间，之后每次加倍，默认 5s
+	Timeout    string   `json:"timeout"`     // 默认 30s
+}
+
+type emailNotifier struct {
+	cfg        EmailConfig
+	addr       string
+	retryDelay time.Duration
+	timeout    time.Duration
+}
+
+func newEmailNotifier(cfg EmailConfig) (*emailNotifier, error) {
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("无效的 tls 模式 %q，可选 starttls、tls、none", cfg.TLS)
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("必须配置 from 和 to")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS == "tls" {
+			cfg.Port = 465
+		}
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = "[webmonitor]"
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = 3
+	}
+
+	en := &emailNotifier{
+		cfg:        cfg,
+		addr:       net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		retryDelay: 5 * time.Second,
+		timeout:    30 * time.Second,
+	}
+	if d, err := time.ParseDuration(cfg.RetryDelay); err == nil && d > 0 {
+		en.retryDelay = d
+	}
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		en.timeout = d
+	}
+	return en, nil
+}
+
+func (en *emailNotifier) Send(n Notification) error {
+	msg := en.message(n)
+	delay := en.retryDelay
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = en.deliver(msg); err == nil {
+			return nil
+		}
+		if attempt >= en.cfg.Retries || !smtpTransient(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (en *emailNotifier) deliver(msg []byte) error {
+	dialer := &net.Dialer{Timeout: en.timeout}
+	tlsConfig := &tls.Config{ServerName: en.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if en.cfg.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", en.addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", en.addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(en.timeout))
+
+	c, err := smtp.NewClient(conn, en.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello(hostname()); err != nil {
+		return err
+	}
+	if en.cfg.TLS == "starttls" {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+	if en.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", en.cfg.Username, en.cfg.Password, en.cfg.Host)); err != nil {
+			return fmt.Errorf("认证失败: %w", err)
+		}
+	}
+	if err := c.Mail(en.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range en.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("%s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (en *emailNotifier) message(n Notification) []byte {
+	subject := fmt.Sprintf("%s[%s] %s", en.cfg.Subject, n.Severity, strings.SplitN(n.Text, "\n", 2)[0])
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", en.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(en.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	text := formatTime(n.Time) + "\r\n" + strings.ReplaceAll(n.Text, "\n", "\r\n") + "\r\n"
+	if n.HTML != "" {
+		b.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+		text = n.HTML
+	} else {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	}
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(text))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes()
+}
+
+// smtpTransient 判断是否值得重试：网络错误和 4xx 响应是临时性的，5xx 是永久性的
+func smtpTransient(err error) bool {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code >= 400 && tpErr.Code < 500
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// 熵值分析（entropy）：对新增和被修改的脚本文件计算信息熵，整体或某一段内容熵值异常高
+// （加壳、混淆、大段 base64 载荷）时即使没有命中任何特征也标记为可疑。
+// 图片、压缩包等本来熵值就高，只检查服务器会执行的脚本和浏览器加载的 .js 文件；
+// 正常源码整体一般在 4.5-5.5 bits/byte，base64 接近 6，加密或压缩数据接近 8
+
+// EntropyConfig 配置熵值分析
+type EntropyConfig struct {
+	Enabled         bool    `json:"enabled"`
+	Threshold       float64 `json:"threshold"`        // 整体熵值阈值（bits/byte），默认 5.8
+	WindowThreshold float64 `json:"window_threshold"` // 任意 4 KB 窗口的熵值阈值，默认 5.9，用于发现嵌在正常代码中的载荷
+	MinBlob         int     `json:"min_blob"`         // 连续 base64 字符达到该长度时报告，默认 2000，负数不检查
+	Severity        string  `json:"severity"`         // 命中时的级别，默认 high
+	MaxFileSize     int64   `json:"max_file_size"`    // 读取的最大字节数，默认 1 MB
+}
+
+const entropyWindow = 4 << 10
+
+var entropy = EntropyConfig{Threshold: highEntropyBits, WindowThreshold: 5.9, MinBlob: 2000, Severity: sevHigh, MaxFileSize: 1 << 20}
+
+func applyEntropyConfig(c EntropyConfig) error {
+	if c.Threshold == 0 {
+		c.Threshold = highEntropyBits
+	}
+	if c.WindowThreshold == 0 {
+		c.WindowThreshold = 5.9
+	}
+	if c.Threshold < 0 || c.Threshold > 8 || c.WindowThreshold < 0 || c.WindowThreshold > 8 {
+		return fmt.Errorf("entropy 的阈值应在 0-8 之间")
+	}
+	if c.MinBlob == 0 {
+		c.MinBlob = 2000
+	}
+	if c.Severity == "" {
+		c.Severity = sevHigh
+	}
+	if !validSeverity(c.Severity) {
+		return fmt.Errorf("entropy.severity 无效: %s", c.Severity)
+	}
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("entropy.max_file_size 不能为负数")
+	}
+	if c.MaxFileSize == 0 {
+		c.MaxFileSize = 1 << 20
+	}
+	entropy = c
+	return nil
+}
+
+// isScriptFile 判断文件是否为服务器会执行的脚本或浏览器加载的 .js 文件
+func isScriptFile(path string) bool {
+	return executableExts[strings.ToLower(filepath.Ext(path))] || isBrowserJS(path)
+}
+
+// checkEntropy 检查新增、修改或移动的脚本文件的熵值，把发现写入事件
+func checkEntropy(ev *Event) {
+	if !entropy.Enabled || ev.Stream != "" || !isScriptFile(ev.Path) {
+		return
+	}
+	switch ev.Type {
+	case "new", "modified", "renamed":
+	default:
+		return
+	}
+	content, err := readHead(ev.Path, entropy.MaxFileSize)
+	if err != nil {
+		return
+	}
+
+	var findings []string
+	whole := shannonEntropy(content)
+	if whole >= entropy.Threshold {
+		findings = append(findings, fmt.Sprintf("整体熵值偏高: %.2f bits/byte", whole))
+	} else if peak, at := maxWindowEntropy(content); peak >= entropy.WindowThreshold {
+		findings = append(findings, fmt.Sprintf("局部熵值偏高: 第 %d 字节起的 4 KB 为 %.2f bits/byte", at, peak))
+	}
+	if entropy.MinBlob > 0 {
+		if n, at := longestBase64Run(content); n >= entropy.MinBlob {
+			findings = append(findings, fmt.Sprintf("第 %d 字节起有 %d 个连续的 base64 字符", at, n))
+		}
+	}
+	if len(findings) == 0 {
+		return
+	}
+	ev.Entropy = whole
+	ev.Findings = append(ev.Findings, findings...)
+	ev.Severity = maxSeverity(ev.Severity, entropy.Severity)
+	if !containsString(ev.Signals, sigHighEntropy) {
+		addSignal(ev, sigHighEntropy)
+	}
+}
+
+// maxWindowEntropy 返回每隔半个窗口取样的 4 KB 窗口中最高的熵值及其起始位置
+func maxWindowEntropy(data []byte) (float64, int) {
+	best, at := 0.0, 0
+	if len(data) <= entropyWindow {
+		return shannonEntropy(data), 0
+	}
+	for start := 0; start+entropyWindow <= len(data); start += entropyWindow / 2 {
+		if h := shannonEntropy(data[start : start+entropyWindow]); h > best {
+			best, at = h, start
+		}
+	}
+	return best, at
+}
+
+// longestBase64Run 返回最长的连续 base64 字符串的长度和起始位置
+func longestBase64Run(data []byte) (int, int) {
+	best, bestAt, run := 0, 0, 0
+	for i, c := range data {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=' {
+			run++
+			if run > best {
+				best, bestAt = run, i-run+1
+			}
+			continue
+		}
+		run = 0
+	}
+	return best, bestAt
+}
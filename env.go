@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 环境变量覆盖：WEBMON_ 加上大写的配置项路径覆盖配置文件中的值，嵌套的配置项用下划线连接，
+// 例如 WEBMON_CHECK_INTERVAL、WEBMON_WENJIAN_DIRECTORIES、WEBMON_NOTIFY_TELEGRAM_BOT_TOKEN。
+// 常用的命令行参数也可以用环境变量设置（WEBMON_DB、WEBMON_INTERVAL 等），命令行上显式指定时以命令行为准。
+// 默认的配置文件不存在时只使用环境变量，容器和 CI 中不需要生成配置文件
+
+const envVarPrefix = "WEBMON_"
+
+// defaultConfigFile 为 -config 的默认值
+const defaultConfigFile = "data/config.json"
+
+// envFlags 是可以用环境变量设置的命令行参数
+var envFlags = []string{"config", "db", "log", "interval", "dirs-from", "max-file-size", "pid-file", "read-only", "ctl-addr", "output"}
+
+// envReserved 是程序另有用途的环境变量，不是配置项
+var envReserved = []string{"WEBMON_CTL_TOKEN", "WEBMON_DB_KEY", "WEBMON_MASTER_KEY", "WEBMON_MASTER_KEY_FILE"}
+
+var (
+	// envOverrides 为最近一次读取配置时生效的环境变量，envUnknown 为不对应任何配置项的环境变量
+	envOverrides []string
+	envUnknown   []string
+)
+
+func envName(path ...string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(strings.Join(path, "_"), "-", "_"))
+}
+
+// applyEnvFlags 用环境变量设置命令行上没有指定的参数
+func applyEnvFlags(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, name := range envFlags {
+		if fs.Lookup(name) == nil || explicit[name] {
+			continue
+		}
+		if v, ok := os.LookupEnv(envName(name)); ok {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("环境变量 %s 无效: %v", envName(name), err)
+			}
+		}
+	}
+	return nil
+}
+
+// configEnv 返回除命令行参数和保留变量以外的 WEBMON_ 环境变量
+func configEnv() map[string]string {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envVarPrefix) || containsString(envReserved, name) {
+			continue
+		}
+		flagVar := false
+		for _, f := range envFlags {
+			flagVar = flagVar || envName(f) == name
+		}
+		if !flagVar {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// applyEnvConfig 把环境变量中的配置项写入 JSON 配置
+func applyEnvConfig(data []byte) ([]byte, error) {
+	vars := configEnv()
+	envOverrides, envUnknown = nil, nil
+	if len(vars) == 0 {
+		return data, nil
+	}
+
+	var cfg map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件错误: %v", err)
+	}
+	if cfg == nil {
+		cfg = make(map[string]interface{})
+	}
+	var walk func(t reflect.Type, path []string) error
+	walk = func(t reflect.Type, path []string) error {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				key := strings.Split(f.Tag.Get("json"), ",")[0]
+				if key == "-" || f.PkgPath != "" {
+					continue
+				}
+				if key == "" {
+					key = f.Name
+				}
+				if err := walk(f.Type, append(path[:len(path):len(path)], key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		name := envName(path...)
+		raw, ok := vars[name]
+		if !ok {
+			return nil
+		}
+		delete(vars, name)
+		v, err := envValue(raw, t)
+		if err != nil {
+			return fmt.Errorf("环境变量 %s 无效: %v", name, err)
+		}
+		m := cfg
+		for _, key := range path[:len(path)-1] {
+			next, ok := m[key].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[key] = next
+			}
+			m = next
+		}
+		m[path[len(path)-1]] = v
+		envOverrides = append(envOverrides, name)
+		return nil
+	}
+	if err := walk(reflect.TypeOf(Config{}), nil); err != nil {
+		return nil, err
+	}
+	for name := range vars {
+		envUnknown = append(envUnknown, name)
+	}
+	sort.Strings(envOverrides)
+	sort.Strings(envUnknown)
+	return json.Marshal(cfg)
+}
+
+// envValue 按配置项的类型解析环境变量的值：字符串原样使用，字符串列表用逗号分隔，
+// 布尔值和数字按字面解析，其他类型（映射、规则列表等）写成 JSON
+func envValue(raw string, t reflect.Type) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		return strconv.ParseBool(strings.TrimSpace(raw))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("应为整数")
+		}
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("应为数字")
+		}
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case reflect.Slice:
+		// 元素可以从字符串解析的列表（例如 wenjian.directories）也用逗号分隔
+		byString := t.Elem().Kind() == reflect.String || reflect.PtrTo(t.Elem()).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem())
+		if byString && !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			items := []interface{}{}
+			for _, s := range strings.Split(raw, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					items = append(items, s)
+				}
+			}
+			return items, nil
+		}
+	}
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("应为 JSON: %v", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type EscalationConfig struct {
+	RepeatCount     int      `json:"repeat_count"`     // 同一文件在 repeat_window 内变动达到次数即升级
+	RepeatWindow    string   `json:"repeat_window"`    // 默认 1h
+	UnackedAfter    string   `json:"unacked_after"`    // 待确认变动超过该时长仍未确认即升级
+	UnackedSeverity string   `json:"unacked_severity"` // 只对不高于该级别的变动生效，默认 low
+	Severity        string   `json:"severity"`         // 升级后的级别，默认 critical
+	Channels        []string `json:"channels"`         // 升级时额外通知的渠道
+}
+
+var (
+	escalation   EscalationConfig
+	repeatWindow = time.Hour
+	unackedAfter time.Duration
+
+	// changeHistory 记录各文件在 repeat_window 内的变动时间，由主循环清理过期的记录。
+	// record 也会在控制接口和深度审计的 goroutine 中调用，因此由 historyMu 保护
+	historyMu     sync.Mutex
+	changeHistory = make(map[string][]time.Time)
+	escalated     = make(map[string]bool)
+)
+
+func applyEscalationConfig(c EscalationConfig) error {
+	if c.RepeatWindow != "" {
+		d, err := time.ParseDuration(c.RepeatWindow)
+		if err != nil {
+			return fmt.Errorf("无效的 repeat_window: %v", err)
+		}
+		repeatWindow = d
+	}
+	if c.UnackedAfter != "" {
+		d, err := time.ParseDuration(c.UnackedAfter)
+		if err != nil {
+			return fmt.Errorf("无效的 unacked_after: %v", err)
+		}
+		unackedAfter = d
+	}
+	if c.UnackedSeverity == "" {
+		c.UnackedSeverity = sevLow
+	}
+	if c.Severity == "" {
+		c.Severity = sevCritical
+	}
+	if !validSeverity(c.UnackedSeverity) || !validSeverity(c.Severity) {
+		return fmt.Errorf("升级策略中的级别无效")
+	}
+	if unackedAfter > 0 && !manualAccept {
+		log.Println("未启用 manual_accept，unacked_after 升级策略不会生效")
+	}
+	escalation = c
+	return nil
+}
+
+// escalateRepeated 在同一文件短时间内反复变动时提升事件级别
+func escalateRepeated(ev *Event) {
+	if escalation.RepeatCount <= 0 {
+		return
+	}
+
+	historyMu.Lock()
+	history := append(recentChanges(changeHistory[ev.Path], ev.Time.Add(-repeatWindow)), ev.Time)
+	changeHistory[ev.Path] = history
+	historyMu.Unlock()
+
+	if len(history) >= escalation.RepeatCount {
+		ev.Severity = maxSeverity(ev.Severity, escalation.Severity)
+		ev.extra = escalation.Channels
+		log.Printf("警报升级: %s 在 %v 内变动了 %d 次", ev.Path, repeatWindow, len(history))
+	}
+}
+
+// recentChanges 去掉 history 中不晚于 cutoff 的时间，复用原切片
+func recentChanges(history []time.Time, cutoff time.Time) []time.Time {
+	kept := history[:0]
+	for _, t := range history {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// pruneChangeHistory 清理 repeat_window 之前的变动时间，之后没有再变动的文件不再占用内存
+func pruneChangeHistory(t time.Time) {
+	cutoff := t.Add(-repeatWindow)
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for path, history := range changeHistory {
+		if kept := recentChanges(history, cutoff); len(kept) > 0 {
+			changeHistory[path] = kept
+		} else {
+			delete(changeHistory, path)
+		}
+	}
+}
+
+// checkEscalations 检查长时间未确认的低级别变动并升级，同时清理过期的变动记录
+func checkEscalations() {
+	pruneChangeHistory(now())
+	if unackedAfter <= 0 || !manualAccept {
+		return
+	}
+
+	var due []Event
+	t := now()
+	dbMu.Lock()
+	for path := range escalated {
+		if _, ok := pending[path]; !ok {
+			delete(escalated, path)
+		}
+	}
+	for path, ev := range pending {
+		if escalated[path] || !severityAtLeast(escalation.UnackedSeverity, ev.Severity) {
+			continue
+		}
+		if t.Sub(ev.Time) >= unackedAfter {
+			escalated[path] = true
+			due = append(due, ev)
+		}
+	}
+	dbMu.Unlock()
+
+	for _, ev := range due {
+		ev.Severity = escalation.Severity
+		alert(Notification{
+			Severity: ev.Severity,
+			Text:     fmt.Sprintf("警报升级: 变动超过 %v 未确认\n%s", unackedAfter, formatEvent(ev)),
+			Events:   []Event{ev},
+			Extra:    escalation.Channels,
+		})
+	}
+}
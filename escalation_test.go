@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRecordConcurrentWithPrune 模拟控制接口的 /ctl/check 在主循环清理变动记录的同时调用 record，
+// 用 go test -race 运行时检查 changeHistory 的并发访问
+func TestRecordConcurrentWithPrune(t *testing.T) {
+	saved := escalation
+	escalation.RepeatCount = 3
+	defer func() { escalation = saved }()
+
+	dir := t.TempDir()
+	base := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			record(Event{Type: "deleted", Path: filepath.Join(dir, fmt.Sprintf("f%d", i%20)), Time: base}, false)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			pruneChangeHistory(base.Add(time.Duration(i%3) * repeatWindow))
+		}
+	}()
+	wg.Wait()
+
+	pruneChangeHistory(base.Add(2 * repeatWindow))
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if len(changeHistory) != 0 {
+		t.Errorf("changeHistory still has %d paths after the window passed", len(changeHistory))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+// 排除规则和 include 规则的写法与匹配语义见 matcher 包，这里在加载配置时检查规则
+
+// validateExcludes 在加载配置时检查排除规则，写错的规则不再被静默忽略
+func validateExcludes(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := matcher.Parse(p); err != nil {
+			return fmt.Errorf("无效的排除规则 %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// validateIncludes 检查 include 规则，写法与排除规则相同
+func validateIncludes(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := matcher.Parse(p); err != nil {
+			return fmt.Errorf("无效的 include 规则 %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// regexExcludes 编译 exclude_regex 中的正则表达式，返回可以与其他排除规则一起使用的规则
+func regexExcludes(exprs []string) ([]string, error) {
+	var rules []string
+	for _, expr := range exprs {
+		if _, err := matcher.Parse(matcher.RegexPrefix + expr); err != nil {
+			return nil, fmt.Errorf("无效的排除正则 %q: %v", expr, err)
+		}
+		rules = append(rules, matcher.RegexPrefix+expr)
+	}
+	return rules, nil
+}
+
+// rootFor 返回包含 path 的最深的监控目录
+func rootFor(path string, dirs []string) (string, bool) {
+	best := ""
+	for _, d := range dirs {
+		if (path == d || underDir(path, d)) && len(d) > len(best) {
+			best = d
+		}
+	}
+	return best, best != ""
+}
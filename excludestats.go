@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+// excludeStat 统计一条排除规则在一次完整扫描中屏蔽了多少内容
+type excludeStat struct {
+	Pattern  string `json:"pattern"`
+	Files    int    `json:"files"`    // 被排除的文件
+	Dirs     int    `json:"dirs"`     // 被整体跳过的目录
+	Baseline int    `json:"baseline"` // 已在基线中、现在被该规则隐藏的文件
+}
+
+func (s excludeStat) hits() int {
+	return s.Files + s.Dirs + s.Baseline
+}
+
+// 匹配数至少达到 excludeSpikeMin 且是上次的 excludeSpikeFactor 倍以上时报警
+const (
+	excludeSpikeMin    = 100
+	excludeSpikeFactor = 10
+)
+
+var lastExcludeStats []excludeStat // 上次完整扫描的统计，由 dbMu 保护
+
+func excludeStatsFile() string {
+	return hashDBFile + ".exclude.json"
+}
+
+func loadExcludeStats() ([]excludeStat, error) {
+	data, err := os.ReadFile(excludeStatsFile())
+	if err != nil {
+		return nil, err
+	}
+	var stats []excludeStat
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("解析排除规则统计错误: %v", err)
+	}
+	return stats, nil
+}
+
+func excludeEntry(hits map[string]*excludeStat, pattern string) *excludeStat {
+	st, ok := hits[pattern]
+	if !ok {
+		st = &excludeStat{Pattern: pattern}
+		hits[pattern] = st
+	}
+	return st
+}
+
+// countExclude 记录一次排除规则命中
+func countExclude(hits map[string]*excludeStat, pattern string, dir bool) {
+	st := excludeEntry(hits, pattern)
+	if dir {
+		st.Dirs++
+	} else {
+		st.Files++
+	}
+}
+
+// auditExcludes 在完整扫描后汇总各排除规则的命中数，
+// 对没有匹配任何内容的规则给出提示，对命中数突然暴增的规则报警（可能有人添加了用来隐藏文件的规则）
+func auditExcludes(hits map[string]*excludeStat) {
+	dbMu.Lock()
+	for path := range hashDB {
+		if pattern, ok := matcher.Match(path, excludesFor(path)); ok {
+			excludeEntry(hits, pattern).Baseline++
+		}
+	}
+	prev := lastExcludeStats
+	dbMu.Unlock()
+
+	if prev == nil {
+		prev, _ = loadExcludeStats()
+	}
+	prevHits := make(map[string]int, len(prev))
+	for _, st := range prev {
+		prevHits[st.Pattern] = st.hits()
+	}
+
+	patterns := allExcludes()
+	stats := make([]excludeStat, 0, len(patterns))
+	for _, pattern := range patterns {
+		st := excludeStat{Pattern: pattern}
+		if h, ok := hits[pattern]; ok {
+			st = *h
+		}
+		stats = append(stats, st)
+
+		before, known := prevHits[pattern]
+		n := st.hits()
+		switch {
+		case n == 0 && (!known || before > 0):
+			log.Printf("排除规则 %q 本次扫描没有匹配任何文件，可以考虑删除", pattern)
+		case n >= excludeSpikeMin && n >= excludeSpikeFactor*(before+1) && (known || prev != nil):
+			text := fmt.Sprintf("排除规则匹配的文件数突然增加: %s\n上次: %d，本次: %d（文件 %d，目录 %d，基线中被隐藏 %d）\n请确认这条规则是否由可信人员添加",
+				pattern, before, n, st.Files, st.Dirs, st.Baseline)
+			if !known {
+				text = fmt.Sprintf("新增的排除规则匹配了大量文件: %s\n本次: %d（文件 %d，目录 %d，基线中被隐藏 %d）\n请确认这条规则是否由可信人员添加",
+					pattern, n, st.Files, st.Dirs, st.Baseline)
+			}
+			alert(Notification{Severity: sevHigh, Text: text})
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].hits() > stats[j].hits() })
+
+	dbMu.Lock()
+	lastExcludeStats = stats
+	dbMu.Unlock()
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err == nil {
+		err = writeStateFile(excludeStatsFile(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("保存排除规则统计错误: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+var explainPath string
+
+type explainRule struct {
+	Pattern string `json:"pattern"`
+	Kind    string `json:"kind"`              // dir, name, path, glob, regex
+	Matched string `json:"matched,omitempty"` // 规则匹配的路径，可能是上级目录
+}
+
+type explainOutput struct {
+	Command  string        `json:"command"`
+	Status   string        `json:"status"` // monitored, skipped, error
+	Path     string        `json:"path"`
+	Root     string        `json:"root,omitempty"`
+	Reason   string        `json:"reason,omitempty"` // 跳过原因，与 -coverage 中的原因一致
+	Detail   string        `json:"detail"`
+	Rule     string        `json:"rule,omitempty"` // 生效的排除规则
+	Rules    []explainRule `json:"rules"`
+	Baseline *Entry        `json:"baseline,omitempty"`
+	Errors   []string      `json:"errors"`
+}
+
+// runExplain 说明一个路径是否受监控，以及由哪条排除规则或哪个原因跳过。
+// 退出码 0 表示受监控，1 表示不受监控，2 表示出错
+func runExplain() int {
+	out := explainOutput{Command: "explain", Rules: []explainRule{}, Errors: []string{}}
+	fail := func(err error) int {
+		out.Status = "error"
+		out.Errors = append(out.Errors, err.Error())
+		writeOutput(out, func(w io.Writer) { fmt.Fprintln(w, err) })
+		return exitError
+	}
+	if err := prepareOneShotConfig(); err != nil {
+		return fail(err)
+	}
+	if _, err := loadHashDB(); err != nil {
+		return fail(err)
+	}
+
+	path, err := filepath.Abs(explainPath)
+	if err != nil {
+		return fail(err)
+	}
+	// 基线和扫描使用配置中写法的路径，换算回同样的形式
+	out.Path = path
+	for _, d := range monitorDirs {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(abs, path); err == nil && (path == abs || underDir(path, abs)) {
+			if out.Root == "" || len(d) > len(out.Root) {
+				out.Root = d
+				out.Path = filepath.Join(d, rel)
+			}
+		}
+	}
+
+	ruleAt, ruleOK := "", false
+	rules := excludesFor(out.Path)
+	if out.Root != "" {
+		out.Rule, ruleAt, ruleOK = matcher.MatchUnder(out.Path, out.Root, rules)
+	}
+	for _, pattern := range rules {
+		r, err := matcher.Parse(pattern)
+		if err != nil {
+			continue
+		}
+		er := explainRule{Pattern: pattern, Kind: r.Kind}
+		if out.Root != "" {
+			if _, at, ok := matcher.MatchUnder(out.Path, out.Root, []string{pattern}); ok {
+				er.Matched = at
+			}
+		} else if r.Match(out.Path) {
+			er.Matched = out.Path
+		}
+		out.Rules = append(out.Rules, er)
+	}
+	if e, ok := hashDB[out.Path]; ok {
+		out.Baseline = e
+	}
+
+	out.Status = "skipped"
+	info, statErr := os.Lstat(out.Path)
+	fsBoundary := ""
+	var ignoreRule *ignoreRule
+	ignoreAt, ignored := "", false
+	if out.Root != "" {
+		fsBoundary = otherFilesystem(out.Path, out.Root)
+		ignoreRule, ignoreAt, ignored = ignoredUnder(out.Path, out.Root, statErr == nil && info.IsDir())
+	}
+	switch {
+	case out.Root == "":
+		out.Detail = "不在任何监控目录下"
+	case ruleOK && ruleAt == out.Path:
+		out.Reason = skipExcluded
+		out.Detail = fmt.Sprintf("匹配排除规则 %s（%s）", out.Rule, ruleKindName(out.Rule))
+	case ruleOK:
+		out.Reason = skipExcludedDir
+		out.Detail = fmt.Sprintf("上级目录 %s 匹配排除规则 %s（%s）", ruleAt, out.Rule, ruleKindName(out.Rule))
+	case ignored:
+		out.Reason = skipIgnoreFile
+		out.Rule = ignoreRule.String()
+		if ignoreAt == out.Path {
+			out.Detail = fmt.Sprintf("匹配忽略文件中的规则 %s", ignoreRule)
+		} else {
+			out.Detail = fmt.Sprintf("上级目录 %s 匹配忽略文件中的规则 %s", ignoreAt, ignoreRule)
+		}
+	case statErr != nil:
+		out.Reason = skipReasonFor(statErr)
+		out.Detail = fmt.Sprintf("无法访问: %v", statErr)
+	case fsBoundary != "":
+		out.Reason = skipOtherFS
+		out.Detail = fmt.Sprintf("%s 位于其他文件系统，one_filesystem 下不扫描", fsBoundary)
+	case info.IsDir():
+		out.Status = "monitored"
+		out.Detail = "目录受监控，其中的文件逐个按规则判断"
+	case !included(out.Path):
+		out.Reason = skipNotIncluded
+		out.Detail = fmt.Sprintf("不匹配任何 include 规则（%s）", strings.Join(includesFor(out.Path), ", "))
+	case specialFile(info):
+		out.Status = "monitored"
+		out.Detail = "特殊文件，只记录类型和设备号"
+	case !info.Mode().IsRegular():
+		out.Reason = skipNonRegular
+		out.Detail = "非普通文件（例如符号链接），不计算哈希"
+	case overSizeLimit(path, info) && sampleLargeFiles():
+		out.Status = "monitored"
+		out.Detail = fmt.Sprintf("文件大小 %d 超过限制 %d，只校验开头 %d MB、结尾 %d MB 以及大小和修改时间",
+			info.Size(), maxFileSizeFor(path), largeFiles.HeadMB, largeFiles.TailMB)
+	case overSizeLimit(path, info):
+		out.Reason = skipSizeLimit
+		out.Detail = fmt.Sprintf("文件大小 %d 超过限制 %d", info.Size(), maxFileSizeFor(path))
+	default:
+		out.Status = "monitored"
+		out.Detail = "受监控"
+	}
+
+	writeOutput(out, func(w io.Writer) {
+		fmt.Fprintf(w, "路径: %s\n", out.Path)
+		if out.Root != "" {
+			fmt.Fprintf(w, "监控目录: %s\n", out.Root)
+		}
+		fmt.Fprintf(w, "结果: %s\n", out.Detail)
+		if len(out.Rules) > 0 {
+			fmt.Fprintln(w, "排除规则:")
+			for _, r := range out.Rules {
+				mark := "不匹配"
+				if r.Matched != "" {
+					mark = "匹配 " + r.Matched
+				}
+				fmt.Fprintf(w, "  %-30s %-8s %s\n", r.Pattern, matcher.KindNames[r.Kind], mark)
+			}
+		}
+		if out.Baseline != nil {
+			fmt.Fprintf(w, "基线: %s，最近校验 %s\n", out.Baseline.Hash, out.Baseline.LastVerified.In(timeLoc).Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Fprintln(w, "基线: 无记录")
+		}
+	})
+	if out.Status == "monitored" {
+		return exitClean
+	}
+	return exitChanges
+}
+
+// ruleKindName 返回规则类型的中文名称
+func ruleKindName(pattern string) string {
+	r, err := matcher.Parse(pattern)
+	if err != nil {
+		return ""
+	}
+	return matcher.KindNames[r.Kind]
+}
+
+// otherFilesystem 在启用 one_filesystem 时返回 path 之上（包括 path 本身为目录时）
+// 第一个与监控目录不在同一设备上的目录
+func otherFilesystem(path, root string) string {
+	if !oneFilesystem {
+		return ""
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return ""
+	}
+	rootDev, ok := deviceID(info)
+	if !ok {
+		return ""
+	}
+	var chain []string
+	if info, err := os.Lstat(path); err == nil && info.IsDir() && path != root {
+		chain = append(chain, path)
+	}
+	for dir := filepath.Dir(path); underDir(dir, root); dir = filepath.Dir(dir) {
+		chain = append([]string{dir}, chain...)
+	}
+	for _, dir := range chain {
+		if info, err := os.Stat(dir); err == nil {
+			if dev, ok := deviceID(info); ok && dev != rootDev {
+				return dir
+			}
+		}
+	}
+	return ""
+}
+
+func specialFile(info os.FileInfo) bool {
+	_, ok := specialHash(info)
+	return ok
+}
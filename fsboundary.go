@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	oneFilesystem  bool
+	alertNewMounts bool
+	mountSource    bool
+
+	// knownMounts 记录在监控目录下已见过的挂载点，首次扫描时静默建立
+	knownMounts      = make(map[string]bool)
+	mountsBaselined  bool
+	mountTableCached []mountEntry
+	mountsMu         sync.Mutex // 各根目录并发扫描时保护以上挂载点状态
+)
+
+type mountEntry struct {
+	Point  string
+	Source string
+	FSType string
+}
+
+// mountWalker 在遍历一个监控根目录时跟踪各目录的设备号，用于识别挂载点
+type mountWalker struct {
+	root string
+	devs map[string]uint64
+}
+
+func newMountWalker(root string) *mountWalker {
+	return &mountWalker{root: root, devs: make(map[string]uint64)}
+}
+
+// visitDir 处理一个目录，返回 true 表示应跳过该目录（跨越了文件系统边界）
+func (mw *mountWalker) visitDir(path string, info os.FileInfo) bool {
+	if !oneFilesystem && !alertNewMounts {
+		return false
+	}
+	dev, ok := deviceID(info)
+	if !ok {
+		return false
+	}
+	mw.devs[path] = dev
+	if path == mw.root {
+		return false
+	}
+
+	parentDev, ok := mw.devs[filepath.Dir(path)]
+	if !ok || parentDev == dev {
+		return false
+	}
+
+	// 设备号与父目录不同，说明这里是一个挂载点
+	if alertNewMounts {
+		mountsMu.Lock()
+		seen, baselined := knownMounts[path], mountsBaselined
+		knownMounts[path] = true
+		mountsMu.Unlock()
+		if !seen {
+			if baselined {
+				alert(Notification{Severity: sevHigh, Text: fmt.Sprintf("监控目录下出现新的挂载点: %s%s",
+					path, mountDescription(path))})
+			} else {
+				log.Printf("监控目录下的挂载点: %s%s", path, mountDescription(path))
+			}
+		}
+	}
+	return oneFilesystem
+}
+
+// finishMountScan 在一次扫描结束时调用，之后出现的挂载点都会报警
+func finishMountScan() {
+	mountsMu.Lock()
+	mountsBaselined = true
+	mountTableCached = nil
+	mountsMu.Unlock()
+}
+
+func mountDescription(path string) string {
+	m, ok := mountFor(path)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("\n挂载来源: %s (%s)", m.Source, m.FSType)
+}
+
+// mountFor 返回包含 path 的最深挂载点，挂载表在每次扫描中只读取一次
+func mountFor(path string) (mountEntry, bool) {
+	mountsMu.Lock()
+	if mountTableCached == nil {
+		mountTableCached = readMountTable()
+	}
+	table := mountTableCached
+	mountsMu.Unlock()
+
+	var best mountEntry
+	found := false
+	for _, m := range table {
+		if path == m.Point || strings.HasPrefix(path, strings.TrimSuffix(m.Point, "/")+"/") {
+			if !found || len(m.Point) > len(best.Point) {
+				best, found = m, true
+			}
+		}
+	}
+	return best, found
+}
+
+// eventMount 返回事件中附带的挂载来源信息
+func eventMount(path string) string {
+	if !mountSource {
+		return ""
+	}
+	m, ok := mountFor(path)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s) on %s", m.Source, m.FSType, m.Point)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+var (
+	goldenPath string
+	compareDir string
+)
+
+type goldenOutput struct {
+	Command   string   `json:"command"`
+	Status    string   `json:"status"`
+	Live      string   `json:"live"`
+	Golden    string   `json:"golden"`
+	Extra     []string `json:"extra"`     // 只存在于线上目录
+	Missing   []string `json:"missing"`   // 只存在于黄金副本
+	Differing []string `json:"differing"` // 两边内容不同
+	Same      int      `json:"same"`
+	Errors    []string `json:"errors"`
+}
+
+// hashTree 计算目录下所有普通文件的哈希，键为相对路径；排除规则按线上目录中的对应路径判断
+func hashTree(root, liveRoot string, errs *[]string) map[string]string {
+	files := make(map[string]string)
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			*errs = append(*errs, err.Error())
+			if info != nil && info.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		live := filepath.Join(liveRoot, rel)
+		if matcher.Matches(live, excludesFor(live)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !included(live) || ignoredPath(live) {
+			return nil
+		}
+		hash, err := calculateFileHash(path)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("计算文件哈希错误 %s: %v", path, err))
+			return nil
+		}
+		files[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	return files
+}
+
+// runCompareGolden 比较线上目录和只读的黄金副本（挂载的镜像、解压的发布包），不需要已有基线
+func runCompareGolden() int {
+	out := goldenOutput{Command: "compare", Golden: goldenPath,
+		Extra: []string{}, Missing: []string{}, Differing: []string{}, Errors: []string{}}
+	fail := func(err error) int {
+		out.Status = "error"
+		out.Errors = append(out.Errors, err.Error())
+		writeOutput(out, func(w io.Writer) { fmt.Fprintln(w, err) })
+		return exitError
+	}
+
+	oneShot = true
+	if _, err := os.Stat(configFile); (configFile != "" && err == nil) || len(configEnv()) > 0 {
+		loadConfigFromFile()
+	}
+	live := compareDir
+	if live == "" {
+		expandDirs()
+		if len(monitorDirs) != 1 {
+			return fail(fmt.Errorf("有 %d 个监控目录，请用 -against 指定要比较的线上目录", len(monitorDirs)))
+		}
+		live = monitorDirs[0]
+	}
+	out.Live = live
+
+	if info, err := os.Stat(goldenPath); err != nil || !info.IsDir() {
+		return fail(fmt.Errorf("黄金副本目录不可用: %s", goldenPath))
+	}
+
+	liveFiles := hashTree(live, live, &out.Errors)
+	goldenFiles := hashTree(goldenPath, live, &out.Errors)
+
+	for rel, hash := range liveFiles {
+		g, ok := goldenFiles[rel]
+		switch {
+		case !ok:
+			out.Extra = append(out.Extra, rel)
+		case g != hash:
+			out.Differing = append(out.Differing, rel)
+		default:
+			out.Same++
+		}
+	}
+	for rel := range goldenFiles {
+		if _, ok := liveFiles[rel]; !ok {
+			out.Missing = append(out.Missing, rel)
+		}
+	}
+	sort.Strings(out.Extra)
+	sort.Strings(out.Missing)
+	sort.Strings(out.Differing)
+
+	code := exitClean
+	out.Status = "clean"
+	if len(out.Extra)+len(out.Missing)+len(out.Differing) > 0 {
+		code, out.Status = exitChanges, "changes"
+	}
+	if len(out.Errors) > 0 {
+		code, out.Status = exitError, "error"
+	}
+
+	writeOutput(out, func(w io.Writer) {
+		for _, p := range out.Extra {
+			fmt.Fprintln(w, "多出   ", p)
+		}
+		for _, p := range out.Missing {
+			fmt.Fprintln(w, "缺少   ", p)
+		}
+		for _, p := range out.Differing {
+			fmt.Fprintln(w, "不一致 ", p)
+		}
+		for _, e := range out.Errors {
+			fmt.Fprintln(w, "错误:", e)
+		}
+		fmt.Fprintf(w, "%s 与 %s 比较：一致 %d，多出 %d，缺少 %d，不一致 %d\n",
+			live, goldenPath, out.Same, len(out.Extra), len(out.Missing), len(out.Differing))
+	})
+	return code
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// 哈希算法：sha256 为默认值，它的哈希不带前缀，与已有基线兼容；其他算法的哈希写成 "算法:十六进制"，
+// 基线中记录了每个哈希使用的算法，更换算法后不会把不同算法的哈希直接比较
+
+const (
+	algoSHA256 = "sha256"
+	algoSHA512 = "sha512"
+	algoBLAKE3 = "blake3"
+	algoXXH64  = "xxh64"
+)
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	algoSHA256: sha256.New,
+	algoSHA512: sha512.New,
+	algoBLAKE3: newBLAKE3,
+	algoXXH64:  newXXH64,
+}
+
+var hashAlgorithm = algoSHA256
+
+func applyHashAlgorithm(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "":
+		name = algoSHA256
+	case "xxhash", "xxhash64":
+		name = algoXXH64
+	}
+	if hashAlgorithms[name] == nil {
+		return fmt.Errorf("不支持的哈希算法 %s（可选 sha256、sha512、blake3、xxh64）", name)
+	}
+	if name == algoXXH64 {
+		log.Printf("警告：xxh64 不是密码学哈希，攻击者可以构造内容不同但哈希相同的文件，只适用于不涉及安全的大目录")
+	}
+	hashAlgorithm = name
+	return nil
+}
+
+// hashAlgoOf 返回基线哈希使用的算法，特殊文件的记录返回空字符串，大文件的部分哈希返回 partial
+func hashAlgoOf(h string) string {
+	if strings.HasPrefix(h, specialPrefix) {
+		return ""
+	}
+	if strings.HasPrefix(h, partialPrefix) {
+		return algoPartial
+	}
+	if i := strings.Index(h, ":"); i > 0 && hashAlgorithms[h[:i]] != nil {
+		return h[:i]
+	}
+	return algoSHA256
+}
+
+func algoPrefix(algo string) string {
+	if algo == algoSHA256 {
+		return ""
+	}
+	return algo + ":"
+}
+
+// hashFileWith 用指定算法计算文件哈希
+func hashFileWith(filePath, algo string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := hashAlgorithms[algo]()
+	if _, err := io.Copy(h, throttled(file)); err != nil {
+		return "", err
+	}
+	return algoPrefix(algo) + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashBytes 用当前算法计算一段内容的哈希，格式与基线中的记录相同
+func hashBytes(data []byte) string {
+	h := hashAlgorithms[hashAlgorithm]()
+	h.Write(data)
+	return algoPrefix(hashAlgorithm) + hex.EncodeToString(h.Sum(nil))
+}
+
+// sameContent 判断当前文件是否与基线哈希一致。基线使用其他算法时按该算法重新计算，
+// 一致则说明文件未变，调用方应把基线换成当前算法的哈希
+func sameContent(path, stored, current string) bool {
+	if stored == current {
+		return true
+	}
+	algo := hashAlgoOf(stored)
+	if algo == algoPartial {
+		// 部分哈希包含修改时间，也可能是按其他参数计算的，按记录中的参数重新计算
+		return samePartialHash(path, stored)
+	}
+	if algo == "" || algo == hashAlgoOf(current) {
+		return false
+	}
+	old, err := hashFileWith(path, algo)
+	if err != nil {
+		log.Printf("用 %s 校验 %s 失败: %v", algo, path, err)
+		return false
+	}
+	return old == stored
+}
+
+// countOtherAlgorithms 统计基线中不是当前算法的记录数
+func countOtherAlgorithms(db map[string]*Entry) int {
+	n := 0
+	for _, e := range db {
+		if a := hashAlgoOf(e.Hash); a != "" && a != algoPartial && a != hashAlgorithm {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+const defaultHashWorkers = 4
+
+// hashWorkers 是每个根目录同时计算哈希的文件数；遍历目录树只在一个 goroutine 中进行，
+// 普通文件交给工作池计算哈希，结果由调用方加锁合并
+var hashWorkers = defaultHashWorkers
+
+type hashPool struct {
+	jobs    chan func()
+	wg      sync.WaitGroup
+	once    sync.Once
+	onPanic func(error)
+}
+
+// newHashPool 启动 n 个工作 goroutine；任务中发生 panic 时调用 onPanic，不影响其余任务
+func newHashPool(n int, onPanic func(error)) *hashPool {
+	n = max(1, n)
+	p := &hashPool{jobs: make(chan func(), n), onPanic: onPanic}
+	for i := 0; i < n; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *hashPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		p.run(job)
+	}
+}
+
+func (p *hashPool) run(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.onPanic(fmt.Errorf("%v", r))
+		}
+	}()
+	job()
+}
+
+// submit 在工作池已满时阻塞，调用方不能持有任务中需要的锁
+func (p *hashPool) submit(job func()) {
+	p.jobs <- job
+}
+
+// wait 等待已提交的任务全部完成，可以重复调用
+func (p *hashPool) wait() {
+	p.once.Do(func() {
+		close(p.jobs)
+		p.wg.Wait()
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+type HeartbeatConfig struct {
+	Interval string   `json:"interval"` // 例如 6h，留空表示不发送心跳
+	Channels []string `json:"channels"` // 留空则发送到默认渠道
+}
+
+var heartbeat HeartbeatConfig
+
+// startHeartbeat 定时发送“监控仍在运行”的消息，使监控本身停止工作也能被察觉
+func startHeartbeat() {
+	if heartbeat.Interval == "" {
+		return
+	}
+	interval, err := time.ParseDuration(heartbeat.Interval)
+	if err != nil || interval <= 0 {
+		log.Printf("无效的心跳间隔 '%s'，不发送心跳", heartbeat.Interval)
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sendHeartbeat()
+		}
+	}()
+}
+
+func sendHeartbeat() {
+	dbMu.Lock()
+	files := len(hashDB)
+	last := lastScan
+	errs := lastScanErrs
+	dbMu.Unlock()
+
+	state := "正常"
+	if last.IsZero() {
+		state = "尚未完成"
+	} else if errs > 0 {
+		state = fmt.Sprintf("有 %d 个错误", errs)
+	}
+	lastText := "-"
+	if !last.IsZero() {
+		lastText = formatTime(last)
+	}
+
+	text := fmt.Sprintf("心跳: %s 运行中\n上次扫描: %s (%s)\n已建立基线的文件: %d",
+		appversion, lastText, state, files)
+	if anchor := auditLogAnchor(); anchor != "" {
+		text += "\n审计日志: " + anchor
+	}
+	log.Println("发送心跳")
+	dispatch(Notification{Time: now(), Severity: sevInfo, Text: text, Channels: heartbeat.Channels})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPCheck 配置扫描后抓取的页面，用于发现 CDN、反向代理或数据库内容被篡改等文件扫描看不到的情况
+type HTTPCheck struct {
+	URL     string   `json:"url"`
+	Expect  []string `json:"expect"`  // 页面中必须出现的关键字
+	Forbid  []string `json:"forbid"`  // 页面中不能出现的关键字，例如 "hacked by"
+	Hash    bool     `json:"hash"`    // 比较页面内容哈希，首次成功抓取时建立基线
+	Ignore  []string `json:"ignore"`  // 计算哈希前删除匹配的动态内容（时间、token 等）的正则
+	Status  int      `json:"status"`  // 期望的状态码，默认 200
+	Timeout string   `json:"timeout"` // 默认 15s
+
+	ignore []*regexp.Regexp
+}
+
+// httpState 是一个页面的基线和当前状态，保存在 <hash_db_file>.http.json
+type httpState struct {
+	Hash      string    `json:"hash,omitempty"`
+	PageHash  string    `json:"page_hash,omitempty"` // 最近一次抓取的哈希
+	Problem   string    `json:"problem,omitempty"`   // 当前的异常，为空表示正常
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+const httpMaxBody = 5 << 20
+
+var (
+	httpChecks []HTTPCheck
+
+	httpMu     sync.Mutex
+	httpStates = make(map[string]*httpState)
+)
+
+func applyHTTPChecks(checks []HTTPCheck) error {
+	for i := range checks {
+		c := &checks[i]
+		if c.URL == "" {
+			return fmt.Errorf("第 %d 项缺少 url", i+1)
+		}
+		for _, expr := range c.Ignore {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("%s 的 ignore 正则 %q 无效: %v", c.URL, expr, err)
+			}
+			c.ignore = append(c.ignore, re)
+		}
+	}
+	httpChecks = checks
+	return nil
+}
+
+func httpStateFile() string {
+	return hashDBFile + ".http.json"
+}
+
+func loadHTTPState() {
+	data, err := os.ReadFile(httpStateFile())
+	if err != nil {
+		return
+	}
+	httpMu.Lock()
+	defer httpMu.Unlock()
+	if err := json.Unmarshal(data, &httpStates); err != nil {
+		log.Printf("解析网页基线文件错误: %v", err)
+	}
+}
+
+func saveHTTPState() {
+	httpMu.Lock()
+	data, err := json.MarshalIndent(httpStates, "", "  ")
+	httpMu.Unlock()
+	if err == nil {
+		err = writeStateFile(httpStateFile(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("保存网页基线文件错误: %v", err)
+	}
+}
+
+// runHTTPChecks 在每次扫描后抓取配置的页面，状态变化时报警
+func runHTTPChecks() {
+	if len(httpChecks) == 0 {
+		return
+	}
+	for _, c := range httpChecks {
+		hash, problem := fetchAndCompare(c)
+
+		httpMu.Lock()
+		st, ok := httpStates[c.URL]
+		if !ok {
+			st = &httpState{}
+			httpStates[c.URL] = st
+		}
+		st.CheckedAt = now()
+		prev := st.Problem
+		changedFrom := ""
+		if hash != "" {
+			st.PageHash = hash
+			switch {
+			case !c.Hash:
+			case st.Hash == "":
+				st.Hash = hash
+				log.Printf("已建立网页基线: %s", c.URL)
+			case hash != st.Hash && manualAccept:
+				// 等待通过 -ctl accept <url> 确认
+				problem = "页面内容与基线不一致: " + hash
+			case hash != st.Hash:
+				// 自动模式下与文件一样接受新内容，只报警一次
+				changedFrom, st.Hash = st.Hash, hash
+			}
+		}
+		st.Problem = problem
+		httpMu.Unlock()
+
+		switch {
+		case problem != "" && problem != prev:
+			alert(Notification{Severity: sevHigh, Text: fmt.Sprintf("网页内容异常: %s\n原因: %s", c.URL, problem)})
+		case problem == "" && prev != "":
+			alert(Notification{Severity: sevInfo, Text: fmt.Sprintf("网页内容已恢复正常: %s", c.URL)})
+		}
+		if changedFrom != "" {
+			alert(Notification{Severity: sevHigh, Text: fmt.Sprintf("网页内容发生变化: %s\n原哈希: %s\n新哈希: %s", c.URL, changedFrom, hash)})
+		}
+	}
+	saveHTTPState()
+}
+
+// fetchAndCompare 返回处理后的页面哈希和发现的问题
+func fetchAndCompare(c HTTPCheck) (string, string) {
+	timeout := 15 * time.Second
+	if d, err := time.ParseDuration(c.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	client := &http.Client{Timeout: timeout}
+	req, err := http.NewRequest(http.MethodGet, c.URL, nil)
+	if err != nil {
+		return "", err.Error()
+	}
+	// 与普通访客一样获取页面，避免 CDN 返回不同的缓存
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; webmonitor)")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "无法访问: " + err.Error()
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBody))
+	if err != nil {
+		return "", "读取页面错误: " + err.Error()
+	}
+
+	want := c.Status
+	if want == 0 {
+		want = http.StatusOK
+	}
+	if resp.StatusCode != want {
+		return "", fmt.Sprintf("状态码 %d，期望 %d", resp.StatusCode, want)
+	}
+
+	page := string(body)
+	lower := strings.ToLower(page)
+	for _, kw := range c.Expect {
+		if !strings.Contains(lower, strings.ToLower(kw)) {
+			return "", "缺少关键字: " + kw
+		}
+	}
+	for _, kw := range c.Forbid {
+		if strings.Contains(lower, strings.ToLower(kw)) {
+			return "", "出现禁止的关键字: " + kw
+		}
+	}
+
+	for _, re := range c.ignore {
+		page = re.ReplaceAllString(page, "")
+	}
+	sum := sha256.Sum256([]byte(page))
+	return hex.EncodeToString(sum[:]), ""
+}
+
+// acceptHTTPBaseline 在 manual_accept 模式下把页面当前内容设为基线，urls 为空时接受全部
+func acceptHTTPBaseline(urls []string) []string {
+	httpMu.Lock()
+	var accepted []string
+	for url, st := range httpStates {
+		if len(urls) > 0 && !containsString(urls, url) {
+			continue
+		}
+		if st.PageHash != "" && st.Hash != "" && st.PageHash != st.Hash {
+			st.Hash = st.PageHash
+			st.Problem = ""
+			accepted = append(accepted, url)
+		}
+	}
+	httpMu.Unlock()
+	if len(accepted) > 0 {
+		saveHTTPState()
+	}
+	return accepted
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+// 目录中的忽略文件：监控目录下任意一级目录中的 .webmonignore 按 gitignore 的写法列出该目录下不需要监控的文件，
+// 应用的维护者不需要修改集中管理的配置。每行一条规则，# 开头为注释，! 开头表示重新监控前面规则排除的文件，
+// 以 / 结尾的规则只匹配目录；含 / 的规则相对于忽略文件所在的目录匹配，否则匹配任意一级的名称；** 匹配任意多级目录。
+// 下级目录中的规则优先，同一文件中后面的规则优先。忽略文件只能增加排除的内容，不能让配置中排除的文件重新受监控；
+// 忽略文件本身总是受监控，新增或修改忽略文件会像其他文件一样报警。wenjian.ignore_files 为 false 时不读取忽略文件
+
+const ignoreFileName = ".webmonignore"
+
+type ignoreRule struct {
+	pattern  string
+	file     string // 规则所在的忽略文件
+	line     int
+	negate   bool
+	dirOnly  bool
+	anchored bool     // 相对于忽略文件所在目录匹配
+	segs     []string // 按 / 拆开的各段
+}
+
+// String 用于日志和 -explain，写明规则的出处
+func (r *ignoreRule) String() string {
+	return fmt.Sprintf("%s:%d: %s", r.file, r.line, r.pattern)
+}
+
+var (
+	// ignoreFilesEnabled 为全局的 wenjian.ignore_files
+	ignoreFilesEnabled = true
+
+	// ignoreCache 缓存各目录中忽略文件的规则（没有忽略文件时为 nil），每次扫描开始时清空
+	ignoreMu    sync.Mutex
+	ignoreCache = make(map[string][]*ignoreRule)
+)
+
+func resetIgnoreCache() {
+	ignoreMu.Lock()
+	ignoreCache = make(map[string][]*ignoreRule)
+	ignoreMu.Unlock()
+}
+
+// ignoreFilesFor 判断监控目录 root 是否读取忽略文件，目录自己的 ignore_files 优先
+func ignoreFilesFor(root string) bool {
+	if p := rootProfiles[root]; p != nil && p.IgnoreFiles != nil {
+		return *p.IgnoreFiles
+	}
+	return ignoreFilesEnabled
+}
+
+// ignoreRulesIn 返回目录 dir 中忽略文件的规则
+func ignoreRulesIn(dir string) []*ignoreRule {
+	ignoreMu.Lock()
+	rules, ok := ignoreCache[dir]
+	ignoreMu.Unlock()
+	if ok {
+		return rules
+	}
+	file := filepath.Join(dir, ignoreFileName)
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("读取忽略文件 %s 错误: %v", file, err)
+	}
+	if err == nil {
+		rules = parseIgnoreFile(file, data)
+	}
+	ignoreMu.Lock()
+	ignoreCache[dir] = rules
+	ignoreMu.Unlock()
+	return rules
+}
+
+// parseIgnoreFile 解析忽略文件，写错的规则记录到日志后跳过
+func parseIgnoreFile(file string, data []byte) []*ignoreRule {
+	var rules []*ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(strings.TrimPrefix(sc.Text(), "\ufeff"), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := &ignoreRule{pattern: line, file: file, line: n}
+		if strings.HasPrefix(line, "!") {
+			r.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			log.Printf("忽略文件 %s 第 %d 行规则为空，已跳过", file, n)
+			continue
+		}
+		r.segs = strings.Split(line, "/")
+		valid := true
+		for _, seg := range r.segs {
+			if _, err := path.Match(seg, ""); err != nil {
+				log.Printf("忽略文件 %s 第 %d 行通配符语法错误，已跳过: %v", file, n, err)
+				valid = false
+				break
+			}
+		}
+		if valid {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// match 判断相对于忽略文件所在目录、斜杠分隔的路径 rel 是否匹配规则
+func (r *ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.segs[0], path.Base(rel))
+		return ok
+	}
+	return matcher.MatchSegments(r.segs, strings.Split(rel, "/"))
+}
+
+// ignoredByFile 按 root 到 path 所在目录之间各级的忽略文件判断 path 本身是否被忽略，
+// 不检查上级目录（扫描时被忽略的目录已经整个跳过），返回决定结果的规则
+func ignoredByFile(p, root string, isDir bool) (*ignoreRule, bool) {
+	if filepath.Base(p) == ignoreFileName || !ignoreFilesFor(root) {
+		return nil, false
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil, false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	var decided *ignoreRule
+	dir := root
+	for i := range parts {
+		sub := strings.Join(parts[i:], "/")
+		for _, r := range ignoreRulesIn(dir) {
+			if r.match(sub, isDir) {
+				decided = r
+			}
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	if decided == nil || decided.negate {
+		return nil, false
+	}
+	return decided, true
+}
+
+// ignoredUnder 依次检查 root 之下 path 的各级上级目录和 path 本身，返回忽略它的规则和规则匹配的路径
+func ignoredUnder(p, root string, isDir bool) (*ignoreRule, string, bool) {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil, "", false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	cur := root
+	for i, part := range parts {
+		cur = filepath.Join(cur, part)
+		if r, ok := ignoredByFile(cur, root, isDir || i < len(parts)-1); ok {
+			return r, cur, true
+		}
+	}
+	return nil, "", false
+}
+
+// ignoredPath 判断文件 path 是否被所在监控目录中的忽略文件排除
+func ignoredPath(p string) bool {
+	root, ok := rootFor(p, monitorDirs)
+	if !ok {
+		return false
+	}
+	_, _, ignored := ignoredUnder(p, root, false)
+	return ignored
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 大文件（large_files）：超过大小限制的文件默认跳过；mode 为 partial 时只读取开头和结尾各若干 MB，
+// 连同大小和修改时间一起计算哈希，多 GB 的上传文件和媒体文件也能发现替换、截断和追加。
+// 基线中的记录形如 partial:4,4:<哈希>，其中记录了读取的 MB 数，修改配置后旧记录仍能按原来的方式校验
+
+const (
+	largeFileSkip    = "skip"
+	largeFilePartial = "partial"
+
+	partialPrefix = "partial:"
+	algoPartial   = "partial"
+)
+
+// LargeFileConfig 配置超过大小限制的文件如何处理
+type LargeFileConfig struct {
+	Mode   string `json:"mode"`    // skip（默认）或 partial
+	HeadMB int64  `json:"head_mb"` // partial 时读取开头的 MB 数，默认 4
+	TailMB int64  `json:"tail_mb"` // partial 时读取结尾的 MB 数，默认 4
+}
+
+var largeFiles = LargeFileConfig{Mode: largeFileSkip, HeadMB: 4, TailMB: 4}
+
+func applyLargeFileConfig(c LargeFileConfig) error {
+	switch c.Mode {
+	case "":
+		c.Mode = largeFileSkip
+	case largeFileSkip, largeFilePartial:
+	default:
+		return fmt.Errorf("large_files.mode 无效: %s（可选 skip、partial）", c.Mode)
+	}
+	if c.HeadMB < 0 || c.TailMB < 0 {
+		return fmt.Errorf("large_files.head_mb 和 tail_mb 不能为负数")
+	}
+	if c.HeadMB == 0 && c.TailMB == 0 {
+		c.HeadMB, c.TailMB = 4, 4
+	}
+	largeFiles = c
+	return nil
+}
+
+// sampleLargeFiles 为 true 时超过大小限制的文件按首尾部分计算哈希，而不是跳过
+func sampleLargeFiles() bool {
+	return largeFiles.Mode == largeFilePartial
+}
+
+// hashForBaseline 计算扫描和建立基线时记录的哈希：超过大小限制的文件按首尾部分计算，不计算附加摘要
+func hashForBaseline(path string, info os.FileInfo) (string, map[string]string, error) {
+	if sampleLargeFiles() && overSizeLimit(path, info) {
+		h, err := partialHash(path, largeFiles.HeadMB, largeFiles.TailMB, hashAlgorithm)
+		return h, nil, err
+	}
+	return hashFileDigests(path)
+}
+
+// partialHash 读取文件开头 head MB 和结尾 tail MB，连同大小和修改时间计算哈希
+func partialHash(path string, head, tail int64, algo string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := hashAlgorithms[algo]()
+	size := info.Size()
+	headBytes, tailBytes := head<<20, tail<<20
+	if size <= headBytes+tailBytes {
+		if _, err := io.Copy(h, throttled(file)); err != nil {
+			return "", err
+		}
+	} else {
+		if _, err := io.CopyN(h, throttled(file), headBytes); err != nil {
+			return "", err
+		}
+		if _, err := file.Seek(size-tailBytes, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, throttled(file)); err != nil {
+			return "", err
+		}
+	}
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(size))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(info.ModTime().UnixNano()))
+	h.Write(buf[:])
+	return fmt.Sprintf("%s%d,%d:%s%s", partialPrefix, head, tail, algoPrefix(algo), hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// parsePartialHash 取出部分哈希记录的参数，不是部分哈希时返回 false
+func parsePartialHash(h string) (head, tail int64, algo string, ok bool) {
+	rest, found := strings.CutPrefix(h, partialPrefix)
+	if !found {
+		return 0, 0, "", false
+	}
+	params, digest, found := strings.Cut(rest, ":")
+	if !found {
+		return 0, 0, "", false
+	}
+	hs, ts, found := strings.Cut(params, ",")
+	if !found {
+		return 0, 0, "", false
+	}
+	var err1, err2 error
+	head, err1 = strconv.ParseInt(hs, 10, 64)
+	tail, err2 = strconv.ParseInt(ts, 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, "", false
+	}
+	algo = hashAlgoOf(digest)
+	if hashAlgorithms[algo] == nil {
+		return 0, 0, "", false
+	}
+	return head, tail, algo, true
+}
+
+// samePartialHash 按基线记录中的参数重新计算部分哈希并比较
+func samePartialHash(path, stored string) bool {
+	head, tail, algo, ok := parsePartialHash(stored)
+	if !ok {
+		return false
+	}
+	h, err := partialHash(path, head, tail, algo)
+	return err == nil && h == stored
+}
+
+// currentHashFormat 判断基线记录是否就是当前配置下扫描会得到的哈希格式
+func currentHashFormat(h string) bool {
+	if head, tail, algo, ok := parsePartialHash(h); ok {
+		return head == largeFiles.HeadMB && tail == largeFiles.TailMB && algo == hashAlgorithm
+	}
+	return hashAlgoOf(h) == hashAlgorithm
+}
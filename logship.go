@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志直送（log_shipping）：把变动事件、警报和扫描摘要直接推送到 Loki 的 push 接口或
+// Elasticsearch 的 bulk 接口，没有安装日志采集程序的主机也能集中检索。
+// 记录先放入各目的地的队列，攒够 batch_size 条或每隔 flush_interval 批量发送；
+// 发送失败时保留在队列中，按 1s、2s、4s…（最长 5 分钟）退避重试，队列超过 max_queue 时丢弃最早的记录
+
+// LogShipConfig 配置日志直送
+type LogShipConfig struct {
+	Loki          LokiConfig          `json:"loki"`
+	Elasticsearch ElasticsearchConfig `json:"elasticsearch"`
+	BatchSize     int                 `json:"batch_size"`     // 每批最多发送的记录数，默认 500
+	FlushInterval string              `json:"flush_interval"` // 默认 10s
+	MaxQueue      int                 `json:"max_queue"`      // 每个目的地最多缓存的记录数，默认 10000
+	Timeout       string              `json:"timeout"`        // 单次请求超时，默认 10s
+}
+
+// LokiConfig 配置 Loki 推送
+type LokiConfig struct {
+	URL      string            `json:"url"`       // push 接口，例如 http://loki:3100/loki/api/v1/push
+	Labels   map[string]string `json:"labels"`    // 附加的静态标签，默认已有 job、host、kind、severity
+	TenantID string            `json:"tenant_id"` // 多租户时的 X-Scope-OrgID
+	Username string            `json:"username"`
+	Password string            `json:"password" secret:"true"`
+	Headers  map[string]string `json:"headers"`
+}
+
+// ElasticsearchConfig 配置 Elasticsearch 推送
+type ElasticsearchConfig struct {
+	URL      string            `json:"url"`                   // 例如 https://es:9200，请求发往 <url>/_bulk
+	Index    string            `json:"index"`                 // 索引名，默认 webmonitor-{date}，{date} 替换为 YYYY.MM.DD
+	APIKey   string            `json:"api_key" secret:"true"` // 以 Authorization: ApiKey 发送
+	Username string            `json:"username"`
+	Password string            `json:"password" secret:"true"`
+	Headers  map[string]string `json:"headers"`
+}
+
+const maxShipBackoff = 5 * time.Minute
+
+// shipDoc 是发送的一条记录，kind 为 event、alert 或 scan
+type shipDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Host      string    `json:"host"`
+	Kind      string    `json:"kind"`
+	Severity  string    `json:"severity,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Silenced  bool      `json:"silenced,omitempty"`
+	Event     *Event    `json:"event,omitempty"`
+	Scan      *shipScan `json:"scan,omitempty"`
+}
+
+type shipScan struct {
+	Files         int     `json:"files"`
+	BaselineFiles int     `json:"baseline_files"`
+	Events        int     `json:"events"`
+	Errors        int     `json:"errors"`
+	Pending       int     `json:"pending"`
+	DurationMS    int64   `json:"duration_ms"`
+	Coverage      float64 `json:"coverage"`
+}
+
+// logShipper 是一个目的地，send 返回需要重试的记录
+type logShipper struct {
+	name      string
+	send      func(docs []shipDoc) ([]shipDoc, error)
+	queue     []shipDoc
+	lastFlush time.Time
+	delay     time.Duration
+	next      time.Time
+}
+
+var (
+	logShip       LogShipConfig
+	shipInterval  = 10 * time.Second
+	shipMu        sync.Mutex // 保护 logShippers 及其队列
+	logShippers   []*logShipper
+	shipLoopStart sync.Once
+)
+
+func configureLogShipping(c LogShipConfig) error {
+	if c.BatchSize < 0 || c.MaxQueue < 0 {
+		return fmt.Errorf("log_shipping 的 batch_size 和 max_queue 不能为负数")
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 500
+	}
+	if c.MaxQueue == 0 {
+		c.MaxQueue = 10000
+	}
+	interval := 10 * time.Second
+	if c.FlushInterval != "" {
+		d, err := time.ParseDuration(c.FlushInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("log_shipping.flush_interval 格式错误: %s", c.FlushInterval)
+		}
+		interval = d
+	}
+	timeout := 10 * time.Second
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("log_shipping.timeout 格式错误: %s", c.Timeout)
+		}
+		timeout = d
+	}
+	for name, u := range map[string]string{"loki.url": c.Loki.URL, "elasticsearch.url": c.Elasticsearch.URL} {
+		if u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			return fmt.Errorf("log_shipping.%s 应为 http:// 或 https:// 地址: %s", name, u)
+		}
+	}
+	if c.Elasticsearch.Index == "" {
+		c.Elasticsearch.Index = "webmonitor-{date}"
+	}
+
+	// 每个目的地使用加载时的配置，重新加载配置不影响正在发送的批次
+	client := &http.Client{Timeout: timeout}
+	var shippers []*logShipper
+	if c.Loki.URL != "" {
+		lc := c.Loki
+		send := func(docs []shipDoc) ([]shipDoc, error) { return sendLoki(client, lc, docs) }
+		shippers = append(shippers, &logShipper{name: "loki", send: send})
+	}
+	if c.Elasticsearch.URL != "" {
+		ec := c.Elasticsearch
+		send := func(docs []shipDoc) ([]shipDoc, error) { return sendElasticsearch(client, ec, docs) }
+		shippers = append(shippers, &logShipper{name: "elasticsearch", send: send})
+	}
+
+	shipMu.Lock()
+	// 重新加载配置时保留同一目的地尚未发送的记录
+	for _, s := range shippers {
+		for _, old := range logShippers {
+			if old.name == s.name {
+				s.queue = old.queue
+			}
+		}
+	}
+	logShip, shipInterval, logShippers = c, interval, shippers
+	shipMu.Unlock()
+
+	for _, s := range shippers {
+		notifyMu.Lock()
+		if _, ok := channels[s.name]; !ok {
+			channels[s.name] = &channelState{Name: s.name, OK: true}
+		}
+		notifyMu.Unlock()
+	}
+	return nil
+}
+
+// startLogShipping 启动后台发送，配置了目的地时才运行
+func startLogShipping() {
+	shipLoopStart.Do(func() {
+		go func() {
+			for {
+				time.Sleep(time.Second)
+				flushLogShippers(false)
+			}
+		}()
+	})
+}
+
+// flushLogShippers 发送到期的批次，force 为 true 时不管批次大小和间隔
+func flushLogShippers(force bool) {
+	shipMu.Lock()
+	shippers := logShippers
+	shipMu.Unlock()
+	for _, s := range shippers {
+		for {
+			shipMu.Lock()
+			t := now()
+			ready := len(s.queue) > 0 && !t.Before(s.next) &&
+				(force || len(s.queue) >= logShip.BatchSize || t.Sub(s.lastFlush) >= shipInterval)
+			if !ready {
+				shipMu.Unlock()
+				break
+			}
+			n := min(len(s.queue), logShip.BatchSize)
+			batch := s.queue[:n:n]
+			s.queue = s.queue[n:]
+			s.lastFlush = t
+			shipMu.Unlock()
+
+			retry, err := s.send(append([]shipDoc(nil), batch...))
+			reportChannel(s.name, err)
+			shipMu.Lock()
+			if len(retry) > 0 {
+				s.queue = append(retry, s.queue...)
+				if over := len(s.queue) - logShip.MaxQueue; over > 0 {
+					log.Printf("%s 发送队列已满，丢弃最早的 %d 条记录", s.name, over)
+					s.queue = s.queue[over:]
+				}
+			}
+			if err != nil {
+				s.delay = min(max(2*s.delay, time.Second), maxShipBackoff)
+				s.next = now().Add(s.delay)
+				log.Printf("日志发送到 %s 失败，%v 后重试: %v", s.name, s.delay, err)
+			} else {
+				s.delay = 0
+			}
+			more := err == nil && len(s.queue) >= logShip.BatchSize
+			shipMu.Unlock()
+			if !more {
+				break
+			}
+		}
+	}
+}
+
+func shippingEnabled() bool {
+	shipMu.Lock()
+	defer shipMu.Unlock()
+	return len(logShippers) > 0 && !oneShot
+}
+
+func enqueueShipDoc(doc shipDoc) {
+	if oneShot {
+		return
+	}
+	doc.Host = hostname()
+	shipMu.Lock()
+	defer shipMu.Unlock()
+	for _, s := range logShippers {
+		s.queue = append(s.queue, doc)
+		if len(s.queue) > logShip.MaxQueue {
+			s.queue = s.queue[1:]
+		}
+	}
+}
+
+func shipEvent(ev Event) {
+	if !shippingEnabled() {
+		return
+	}
+	enqueueShipDoc(shipDoc{Timestamp: ev.Time, Kind: "event", Severity: ev.Severity, Message: describeEvent(ev), Event: &ev})
+}
+
+func shipAlert(n Notification, silenced bool) {
+	if !shippingEnabled() {
+		return
+	}
+	enqueueShipDoc(shipDoc{Timestamp: n.Time, Kind: "alert", Severity: n.Severity, Message: n.Text, Silenced: silenced})
+}
+
+func shipScanSummary(sum agentSummary) {
+	if !shippingEnabled() {
+		return
+	}
+	enqueueShipDoc(shipDoc{Timestamp: sum.Time, Kind: "scan", Message: fmt.Sprintf("扫描完成: %d 个文件，%d 个变动，%d 个错误", sum.Files, sum.Events, sum.Errors),
+		Scan: &shipScan{Files: sum.Files, BaselineFiles: sum.BaselineFiles, Events: sum.Events, Errors: sum.Errors,
+			Pending: sum.Pending, DurationMS: sum.Duration.Milliseconds(), Coverage: sum.Coverage}})
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// sendLoki 按标签分成多个流推送，失败时整批重试
+func sendLoki(client *http.Client, cfg LokiConfig, docs []shipDoc) ([]shipDoc, error) {
+	streams := map[string]*lokiStream{}
+	var keys []string
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].Timestamp.Before(docs[j].Timestamp) })
+	for _, d := range docs {
+		labels := map[string]string{"job": "webmonitor", "host": d.Host, "kind": d.Kind}
+		if d.Severity != "" {
+			labels["severity"] = d.Severity
+		}
+		for k, v := range cfg.Labels {
+			labels[k] = v
+		}
+		key := d.Kind + "\x00" + d.Severity
+		st, ok := streams[key]
+		if !ok {
+			st = &lokiStream{Stream: labels}
+			streams[key] = st
+			keys = append(keys, key)
+		}
+		line, err := json.Marshal(d)
+		if err != nil {
+			continue
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(d.Timestamp.UnixNano(), 10), string(line)})
+	}
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, k := range keys {
+		body.Streams = append(body.Streams, streams[k])
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", cfg.TenantID)
+	}
+	if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if _, err := shipRequest(client, req); err != nil {
+		// 4xx（除 429）是格式或内容问题，重试也不会成功
+		if se, ok := err.(*shipStatusError); ok && se.code/100 == 4 && se.code != http.StatusTooManyRequests {
+			return nil, err
+		}
+		return docs, err
+	}
+	return nil, nil
+}
+
+// sendElasticsearch 用 bulk 接口写入，只重试被限流或服务端出错的记录
+func sendElasticsearch(client *http.Client, cfg ElasticsearchConfig, docs []shipDoc) ([]shipDoc, error) {
+	var buf bytes.Buffer
+	for _, d := range docs {
+		index := strings.ReplaceAll(cfg.Index, "{date}", d.Timestamp.UTC().Format("2006.01.02"))
+		meta, _ := json.Marshal(map[string]map[string]string{"index": {"_index": index}})
+		line, err := json.Marshal(d)
+		if err != nil {
+			continue
+		}
+		buf.Write(meta)
+		buf.WriteByte('\n')
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(cfg.URL, "/")+"/_bulk", &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if cfg.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+cfg.APIKey)
+	} else if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := shipRequest(client, req)
+	if err != nil {
+		if se, ok := err.(*shipStatusError); ok && se.code/100 == 4 && se.code != http.StatusTooManyRequests {
+			return nil, err
+		}
+		return docs, err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil || !result.Errors {
+		return nil, nil
+	}
+	var retry []shipDoc
+	var firstErr string
+	rejected := 0
+	for i, item := range result.Items {
+		for _, r := range item {
+			switch {
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				if i < len(docs) {
+					retry = append(retry, docs[i])
+				}
+			case r.Status >= 300:
+				rejected++
+				if firstErr == "" {
+					firstErr = string(r.Error)
+				}
+			}
+		}
+	}
+	if rejected > 0 {
+		log.Printf("Elasticsearch 拒绝了 %d 条记录: %s", rejected, firstErr)
+	}
+	if len(retry) > 0 {
+		return retry, fmt.Errorf("%d 条记录被限流或服务端出错", len(retry))
+	}
+	return nil, nil
+}
+
+type shipStatusError struct {
+	code int
+	body string
+}
+
+func (e *shipStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.code, e.body)
+}
+
+// shipRequest 发送请求，返回 2xx 响应的内容
+func shipRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return nil, &shipStatusError{code: resp.StatusCode, body: strings.TrimSpace(string(body[:min(len(body), 200)]))}
+	}
+	return body, nil
+}
@@ -0,0 +1,213 @@
+// Package matcher 实现排除规则（以及写法相同的 include 规则）的匹配，路径和规则都先统一为斜杠分隔：
+//
+//   - 以 / 结尾的是目录规则，匹配该目录本身及其下的全部内容。以 / 或盘符开头时从根开始匹配，
+//     例如 /var/www/cache/；否则匹配路径中任意位置的目录，例如 node_modules/、uploads/tmp/
+//   - 不含 / 的是名称规则，只与路径的最后一段比较，例如 *.log、error_log
+//   - 含有 ** 段的是多级规则，** 匹配零到多级目录，例如 **/node_modules/**、**/*.log、/var/www/**/cache/*.tmp。
+//     以 / 或盘符开头时从根开始匹配，否则匹配路径中任意位置
+//   - 其他规则与完整路径比较，例如 /var/www/html/config.php、/var/www/*/debug.php
+//
+// 各种规则都可以使用 * ? [...] 通配符，除 ** 以外的通配符不跨越 /。扫描时被排除的目录整个跳过，
+// 因此一个文件的任一上级目录匹配规则，该文件也不受监控。
+//
+// 加上 regex: 前缀的是正则规则，在斜杠分隔的完整路径中查找（需要整体匹配时用 ^ 和 $），
+// 不做通配符和 / 的处理
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	KindDir   = "dir"
+	KindName  = "name"
+	KindPath  = "path"
+	KindGlob  = "glob"
+	KindRegex = "regex"
+)
+
+// RegexPrefix 为正则规则的前缀
+const RegexPrefix = "regex:"
+
+// KindNames 为各类规则的中文名称
+var KindNames = map[string]string{
+	KindDir:   "目录规则",
+	KindName:  "名称规则",
+	KindPath:  "路径规则",
+	KindGlob:  "多级规则",
+	KindRegex: "正则规则",
+}
+
+// Rule 为解析后的一条规则
+type Rule struct {
+	Pattern  string
+	Kind     string
+	norm     string         // 统一为斜杠分隔后的规则
+	anchored bool           // 目录规则和多级规则是否从根开始匹配
+	segs     []string       // 目录规则和多级规则按 / 拆开的各段，不从根开始匹配时以 ** 开头
+	re       *regexp.Regexp // 正则规则编译后的表达式
+}
+
+// ruleCache 缓存解析过的规则，扫描时每个文件都要逐条匹配
+var ruleCache sync.Map
+
+// Parse 解析一条规则，规则写错时返回错误
+func Parse(pattern string) (*Rule, error) {
+	if v, ok := ruleCache.Load(pattern); ok {
+		return v.(*Rule), nil
+	}
+	// 正则中的反斜杠是转义符，不能当作路径分隔符转换
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		if expr == "" {
+			return nil, errors.New("正则表达式为空")
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式语法错误: %v", err)
+		}
+		r := &Rule{Pattern: pattern, Kind: KindRegex, norm: expr, re: re}
+		ruleCache.Store(pattern, r)
+		return r, nil
+	}
+	p := filepath.ToSlash(pattern)
+	if strings.Trim(p, "/") == "" {
+		return nil, errors.New("规则为空")
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, fmt.Errorf("通配符语法错误: %v", err)
+		}
+	}
+
+	r := &Rule{Pattern: pattern, norm: p}
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	r.anchored = strings.HasPrefix(p, "/") || filepath.VolumeName(pattern) != ""
+	if !r.anchored {
+		r.segs = []string{"**"}
+	}
+	r.segs = append(r.segs, segs...)
+	switch {
+	case strings.HasSuffix(p, "/"):
+		// 目录规则同时匹配目录下的全部内容
+		r.Kind = KindDir
+		r.segs = append(r.segs, "**")
+	case !strings.Contains(p, "/"):
+		r.Kind = KindName
+	case containsString(segs, "**"):
+		r.Kind = KindGlob
+	default:
+		r.Kind = KindPath
+	}
+	ruleCache.Store(pattern, r)
+	return r, nil
+}
+
+// Match 判断路径 p 是否匹配规则
+func (r *Rule) Match(p string) bool {
+	p = filepath.ToSlash(p)
+	switch r.Kind {
+	case KindRegex:
+		return r.re.MatchString(p)
+	case KindName:
+		ok, _ := path.Match(r.norm, path.Base(p))
+		return ok
+	case KindPath:
+		ok, _ := path.Match(r.norm, p)
+		return ok
+	}
+	return MatchSegments(r.segs, strings.Split(strings.Trim(p, "/"), "/"))
+}
+
+// MatchSegments 判断 parts 是否整体匹配 segs，** 匹配零到多段。
+// 逐段推进 segs 中所有可能到达的位置，多个 ** 时也不会反复回溯
+func MatchSegments(segs, parts []string) bool {
+	cur := make([]bool, len(segs)+1)
+	next := make([]bool, len(segs)+1)
+	cur[0] = true
+	skipGlobstars(segs, cur)
+	for _, part := range parts {
+		clear(next)
+		alive := false
+		for i, on := range cur[:len(segs)] {
+			if !on {
+				continue
+			}
+			if segs[i] == "**" {
+				next[i], alive = true, true
+			} else if ok, _ := path.Match(segs[i], part); ok {
+				next[i+1], alive = true, true
+			}
+		}
+		if !alive {
+			return false
+		}
+		skipGlobstars(segs, next)
+		cur, next = next, cur
+	}
+	return cur[len(segs)]
+}
+
+// skipGlobstars 处理 ** 匹配零段的情况：能到达 ** 的位置也能到达它后面的一段
+func skipGlobstars(segs []string, on []bool) {
+	for i, s := range segs {
+		if on[i] && s == "**" {
+			on[i+1] = true
+		}
+	}
+}
+
+// Matches 判断 path 是否匹配 patterns 中的任一规则
+func Matches(path string, patterns []string) bool {
+	_, ok := Match(path, patterns)
+	return ok
+}
+
+// Match 返回第一条匹配 path 的规则，写错的规则被跳过（加载配置时已经报告）
+func Match(path string, patterns []string) (string, bool) {
+	for _, pattern := range patterns {
+		r, err := Parse(pattern)
+		if err != nil {
+			continue
+		}
+		if r.Match(path) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// MatchUnder 依次检查 root 之下 path 的各级上级目录和 path 本身，
+// 返回第一条匹配的规则和它匹配的路径，与扫描时跳过整个被排除目录的行为一致。
+// path 不在 root 之下时只检查 path 本身
+func MatchUnder(path, root string, patterns []string) (rule, at string, ok bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		if rule, ok = Match(path, patterns); ok {
+			at = path
+		}
+		return rule, at, ok
+	}
+	cur := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		if rule, ok := Match(cur, patterns); ok {
+			return rule, cur, true
+		}
+	}
+	return "", "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package matcher
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseKind(t *testing.T) {
+	tests := []struct {
+		pattern string
+		kind    string
+	}{
+		{"node_modules/", KindDir},
+		{"/var/www/cache/", KindDir},
+		{"uploads/tmp/", KindDir},
+		{"*.log", KindName},
+		{"error_log", KindName},
+		{"/var/www/html/config.php", KindPath},
+		{"/var/www/*/debug.php", KindPath},
+		{"uploads/*.php", KindPath},
+		{"**/node_modules/**", KindGlob},
+		{"**/*.log", KindGlob},
+		{"/var/www/**/cache/*.tmp", KindGlob},
+		{"a/**/b.txt", KindGlob},
+		{`regex:\.php\d$`, KindRegex},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.pattern)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.pattern, err)
+			continue
+		}
+		if r.Kind != tt.kind {
+			t.Errorf("Parse(%q).Kind = %s, want %s", tt.pattern, r.Kind, tt.kind)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, pattern := range []string{"", "/", "//", "[", "a/[b/c", "*.[log", "regex:", "regex:(", `regex:a\`} {
+		if _, err := Parse(pattern); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", pattern)
+		}
+		if Matches("/var/www/a", []string{pattern}) {
+			t.Errorf("invalid rule %q matched", pattern)
+		}
+	}
+}
+
+type matchTest struct {
+	pattern string
+	path    string
+	want    bool
+}
+
+func runMatchTests(t *testing.T, tests []matchTest) {
+	t.Helper()
+	for _, tt := range tests {
+		r, err := Parse(tt.pattern)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got := r.Match(tt.path); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []matchTest{
+		// 目录规则：不从根开始时匹配任意位置的目录，包括目录本身和其下的全部内容
+		{"node_modules/", "/var/www/app/node_modules", true},
+		{"node_modules/", "/var/www/app/node_modules/lodash/index.js", true},
+		{"node_modules/", "/var/www/node_modules.bak/index.js", false},
+		{"uploads/tmp/", "/var/www/uploads/tmp/a.php", true},
+		{"uploads/tmp/", "/var/www/uploads/a.php", false},
+		{"/var/www/cache/", "/var/www/cache", true},
+		{"/var/www/cache/", "/var/www/cache/a/b.html", true},
+		{"/var/www/cache/", "/srv/var/www/cache/a.html", false},
+		{"cach?/", "/var/www/cache/a.html", true},
+
+		// 名称规则只与最后一段比较
+		{"*.log", "/var/www/error.log", true},
+		{"*.log", "/var/www/log.txt", false},
+		{"*.log", "/var/www/a.log/b.txt", false},
+		{"error_log", "/var/www/html/error_log", true},
+		{"[ab].php", "/var/www/b.php", true},
+		{"[ab].php", "/var/www/c.php", false},
+
+		// 路径规则与完整路径比较，* 不跨越 /
+		{"/var/www/html/config.php", "/var/www/html/config.php", true},
+		{"/var/www/html/config.php", "/var/www/html/config.php.bak", false},
+		{"/var/www/*/debug.php", "/var/www/site/debug.php", true},
+		{"/var/www/*/debug.php", "/var/www/a/b/debug.php", false},
+		{"uploads/*.php", "/var/www/uploads/x.php", false},
+		{"uploads/*.php", "uploads/x.php", true},
+
+		// 多级规则
+		{"**/node_modules/**", "/x/node_modules/a/b.js", true},
+		{"**/node_modules/**", "/x/node_modules", true},
+		{"**/*.log", "/a/b/c.log", true},
+		{"**/*.log", "c.log", true},
+		{"/var/www/**/cache/*.tmp", "/var/www/cache/a.tmp", true},
+		{"/var/www/**/cache/*.tmp", "/var/www/a/b/cache/a.tmp", true},
+		{"/var/www/**/cache/*.tmp", "/var/www/a/cache/b/a.tmp", false},
+		{"/var/www/**/cache/*.tmp", "/srv/var/www/cache/a.tmp", false},
+		{"a/**/b.txt", "/x/a/b.txt", true},
+		{"a/**/b.txt", "/x/a/y/z/b.txt", true},
+		{"a/**/b.txt", "/x/a/y/z/c.txt", false},
+		{"**/**/**/a/**/**/b", "/a/x/y/b", true},
+		{"**/**/**/a/**/**/b", "/b/x/y/a", false},
+
+		// 正则规则在完整路径中查找
+		{`regex:\.php\d$`, "/var/www/shell.php5", true},
+		{`regex:\.php\d$`, "/var/www/shell.php", false},
+		{"regex:^/tmp/", "/tmp/x", true},
+		{"regex:^/tmp/", "/var/tmp/x", false},
+		{"regex:cache", "/var/www/cache/a", true},
+	}
+	runMatchTests(t, tests)
+}
+
+// TestMatchNativeSeparators 使用本系统的路径分隔符，Windows 上即为反斜杠
+func TestMatchNativeSeparators(t *testing.T) {
+	var tests []matchTest
+	for _, tt := range []matchTest{
+		{"node_modules/", "/var/www/node_modules/a.js", true},
+		{"/var/www/cache/", "/var/www/cache/a.html", true},
+		{"/var/www/*/debug.php", "/var/www/site/debug.php", true},
+		{"**/*.log", "/a/b/c.log", true},
+		{"regex:/cache/", "/var/www/cache/a", true},
+	} {
+		tests = append(tests, matchTest{filepath.FromSlash(tt.pattern), filepath.FromSlash(tt.path), tt.want})
+	}
+	// 正则中的反斜杠是转义符，不能转换为 /
+	tests = append(tests, matchTest{`regex:\.bak$`, filepath.FromSlash("/var/www/a.bak"), true})
+	runMatchTests(t, tests)
+}
+
+func TestMatchWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("盘符和反斜杠分隔符只在 Windows 上有效")
+	}
+	runMatchTests(t, []matchTest{
+		{`C:\inetpub\wwwroot\cache\`, `C:\inetpub\wwwroot\cache\a.html`, true},
+		{`C:\inetpub\wwwroot\cache\`, `D:\inetpub\wwwroot\cache\a.html`, false},
+		{`C:\inetpub\**\*.log`, `C:\inetpub\wwwroot\logs\a.log`, true},
+		{`App_Data\`, `C:\inetpub\wwwroot\App_Data\db.mdf`, true},
+		{`*.config`, `C:\inetpub\wwwroot\web.config`, true},
+		{`C:/inetpub/wwwroot/web.config`, `C:\inetpub\wwwroot\web.config`, true},
+		{`regex:^C:/inetpub/`, `C:\inetpub\wwwroot\a`, true},
+	})
+}
+
+func TestMatchFirstRule(t *testing.T) {
+	patterns := []string{"[", "*.tmp", "cache/", "*.html"}
+	rule, ok := Match(filepath.FromSlash("/var/www/cache/a.html"), patterns)
+	if !ok || rule != "cache/" {
+		t.Errorf("Match = %q, %v, want cache/", rule, ok)
+	}
+	if Matches(filepath.FromSlash("/var/www/a.php"), patterns) {
+		t.Error("Matches(/var/www/a.php) = true")
+	}
+}
+
+func TestMatchUnder(t *testing.T) {
+	root := filepath.FromSlash("/var/www")
+	tests := []struct {
+		path     string
+		patterns []string
+		rule, at string
+	}{
+		// 名称规则匹配上级目录时，其下的文件也被排除
+		{"/var/www/a.log/b.txt", []string{"*.log"}, "*.log", "/var/www/a.log"},
+		{"/var/www/html/cache/x/y.html", []string{"*.html", "cache"}, "cache", "/var/www/html/cache"},
+		{"/var/www/html/index.php", []string{"*.log"}, "", ""},
+		// 监控目录本身不属于其下的内容，只检查路径本身
+		{"/var/www", []string{"www"}, "www", "/var/www"},
+		// 不在监控目录之下时只检查路径本身
+		{"/srv/a.log/b.txt", []string{"*.log"}, "", ""},
+		{"/srv/a.log", []string{"*.log"}, "*.log", "/srv/a.log"},
+	}
+	for _, tt := range tests {
+		rule, at, ok := MatchUnder(filepath.FromSlash(tt.path), root, tt.patterns)
+		if ok != (tt.rule != "") || rule != tt.rule || at != filepath.FromSlash(tt.at) {
+			t.Errorf("MatchUnder(%q, %v) = %q, %q, %v, want %q, %q", tt.path, tt.patterns, rule, at, ok, tt.rule, tt.at)
+		}
+	}
+}
+
+// FuzzMatch 检查任意规则和路径都不会导致 panic，且 Match 与 MatchUnder 的结果一致：
+// 路径本身匹配时 MatchUnder 也匹配，MatchUnder 返回的位置是路径本身或它在监控目录下的上级目录，
+// 并且 Match 在该位置返回同一条规则
+func FuzzMatch(f *testing.F) {
+	for _, seed := range []struct{ pattern, root, rel string }{
+		{"node_modules/", "/var/www", "app/node_modules/a.js"},
+		{"/var/www/cache/", "/var/www", "cache/a"},
+		{"*.log", "/var/www", "a.log/b.txt"},
+		{"/var/www/*/debug.php", "/var/www", "site/debug.php"},
+		{"**/a/**/b", "/", "x/a/y/b"},
+		{`regex:\.php\d$`, "/var/www", "shell.php5"},
+		{"[", "/var/www", "a"},
+		{"a/**/", "", "../a/b"},
+	} {
+		f.Add(seed.pattern, seed.root, seed.rel)
+	}
+	f.Fuzz(func(t *testing.T, pattern, root, rel string) {
+		patterns := []string{pattern}
+		p := filepath.Join(root, rel)
+		if r, err := Parse(pattern); err == nil {
+			r.Match(p)
+		}
+		_, direct := Match(p, patterns)
+		rule, at, under := MatchUnder(p, root, patterns)
+		if direct && !under {
+			t.Fatalf("Match(%q, %q) matched but MatchUnder with root %q did not", p, pattern, root)
+		}
+		if !under {
+			return
+		}
+		if rule != pattern {
+			t.Fatalf("MatchUnder returned rule %q, want %q", rule, pattern)
+		}
+		if at != p && !strings.HasPrefix(p, strings.TrimSuffix(at, string(filepath.Separator))+string(filepath.Separator)) {
+			t.Fatalf("MatchUnder(%q, %q) matched at %q, not the path or one of its parents", p, root, at)
+		}
+		if got, ok := Match(at, patterns); !ok || got != rule {
+			t.Fatalf("Match(%q) = %q, %v, but MatchUnder matched it with %q", at, got, ok, rule)
+		}
+	})
+}
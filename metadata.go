@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// 文件属性：基线除内容哈希外还记录大小、权限、属主和修改时间。内容不变而属性变化（chmod、chown、
+// 伪造时间戳）时产生 attributes 事件；旧基线中没有属性的记录在下一次扫描时静默补齐。
+// 多台主机共用的基线后端不记录属性：各主机的属主和时间戳不同，记录后会互相覆盖
+
+// FileMeta 是基线中记录的文件属性，UID/GID 为 -1 表示平台不支持（Windows）
+type FileMeta struct {
+	Size  int64       `json:"size"`
+	Mode  os.FileMode `json:"mode"`
+	UID   int         `json:"uid"`
+	GID   int         `json:"gid"`
+	MTime time.Time   `json:"mtime"`
+	// CTime 是状态改变时间（Unix 纳秒，只在 Linux 上记录），只用于增量扫描判断文件是否变化，不单独报警
+	CTime int64 `json:"ctime,omitempty"`
+}
+
+const (
+	attrMode  = "mode"
+	attrOwner = "owner"
+	attrGroup = "group"
+	attrMTime = "mtime"
+	attrSize  = "size"
+)
+
+// sharedBaseline 为 true 表示基线保存在多台主机共用的后端中
+var sharedBaseline bool
+
+func fileMeta(info os.FileInfo) *FileMeta {
+	if sharedBaseline {
+		return nil
+	}
+	m := &FileMeta{Size: info.Size(), Mode: info.Mode(), UID: -1, GID: -1, MTime: info.ModTime(), CTime: fileCTime(info)}
+	if uid, gid, ok := fileOwner(info); ok {
+		m.UID, m.GID = uid, gid
+	}
+	return m
+}
+
+// metaChanges 返回发生变化的属性
+func metaChanges(old, cur *FileMeta) []string {
+	if old == nil || cur == nil {
+		return nil
+	}
+	var changed []string
+	if old.Mode != cur.Mode {
+		changed = append(changed, attrMode)
+	}
+	if old.UID >= 0 && cur.UID >= 0 && old.UID != cur.UID {
+		changed = append(changed, attrOwner)
+	}
+	if old.GID >= 0 && cur.GID >= 0 && old.GID != cur.GID {
+		changed = append(changed, attrGroup)
+	}
+	if !old.MTime.Equal(cur.MTime) {
+		changed = append(changed, attrMTime)
+	}
+	if old.Size != cur.Size {
+		changed = append(changed, attrSize)
+	}
+	return changed
+}
+
+// sameMetaKey 判断两次变动的权限和属主是否相同，修改时间不参与比较，用于待确认事件去重
+func sameMetaKey(a, b *FileMeta) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Mode == b.Mode && a.UID == b.UID && a.GID == b.GID
+}
+
+func copyMeta(m *FileMeta) *FileMeta {
+	if m == nil {
+		return nil
+	}
+	cp := *m
+	return &cp
+}
+
+// formatMode 按 ls 的习惯显示权限并附带八进制值，例如 -rwsr-xr-x (4755)
+func formatMode(m os.FileMode) string {
+	b := []byte(m.Perm().String())
+	octal := uint32(m.Perm())
+	if m.IsDir() {
+		b[0] = 'd'
+	}
+	for _, s := range []struct {
+		bit   os.FileMode
+		value uint32
+		pos   int
+		set   byte
+	}{{os.ModeSetuid, 04000, 3, 's'}, {os.ModeSetgid, 02000, 6, 's'}, {os.ModeSticky, 01000, 9, 't'}} {
+		if m&s.bit == 0 {
+			continue
+		}
+		octal |= s.value
+		if b[s.pos] == 'x' {
+			b[s.pos] = s.set
+		} else {
+			b[s.pos] = s.set - 'a' + 'A'
+		}
+	}
+	return fmt.Sprintf("%s (%04o)", b, octal)
+}
+
+// describeMetaChanges 列出属性的新旧值，每项一行
+func describeMetaChanges(old, cur *FileMeta, attrs []string) string {
+	var lines []string
+	for _, a := range attrs {
+		switch a {
+		case attrMode:
+			lines = append(lines, fmt.Sprintf("权限: %s -> %s", formatMode(old.Mode), formatMode(cur.Mode)))
+		case attrOwner:
+			lines = append(lines, fmt.Sprintf("属主: uid %d -> %d", old.UID, cur.UID))
+		case attrGroup:
+			lines = append(lines, fmt.Sprintf("属组: gid %d -> %d", old.GID, cur.GID))
+		case attrMTime:
+			lines = append(lines, fmt.Sprintf("修改时间: %s -> %s", formatTime(old.MTime), formatTime(cur.MTime)))
+		case attrSize:
+			lines = append(lines, fmt.Sprintf("大小: %d -> %d bytes", old.Size, cur.Size))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,360 +1,1732 @@
-package main
-
-import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
-	"flag"
-	"fmt"
-	"io"
-	"log"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
-)
-
-var (
-	configFile    string
-	monitorDirs   []string
-	hashDBFile    string
-	logFilePath   string
-	checkInterval time.Duration
-	hashDB        = make(map[string]string)
-	logFile       *os.File
-	exclude       []string
-	MaxFileSize   int64
-	appversion    string
-)
-
-type Config struct {
-	Wenjian struct {
-		Directories []string `json:"directories"`
-		Exclude     []string `json:"exclude"`
-	} `json:"wenjian"`
-
-	HashDBFile    string `json:"hash_db_file"`
-	LogFile       string `json:"log_file"`
-	CheckInterval string `json:"check_interval"`
-}
-
-func init() {
-	flag.StringVar(&configFile, "config", "data/config.json", "Path to configuration file (JSON format)")
-	flag.StringVar(&hashDBFile, "db", "data/hashdb.json", "Path to hash database file")
-	flag.StringVar(&logFilePath, "log", "data/webmonitor.log", "Path to log file")
-
-	flag.DurationVar(&checkInterval, "interval", 20*time.Minute, "Check interval (e.g. 5m, 1h)")
-}
-
-func main() {
-	// 解析命令行参数
-	flag.Parse()
-
-	// 处理额外指定的目录参数
-	args := flag.Args()
-	if len(args) > 0 {
-		monitorDirs = append(monitorDirs, args...)
-	}
-
-	appversion = "Webserver文件防篡改监控-秋裤子1.2版"
-	initLog()
-	defer logFile.Close()
-
-	log.Println(appversion)
-
-	// 加载配置
-	if configFile != "" {
-		loadConfigFromFile()
-	} else {
-		log.Println("未指定配置文件，使用命令行参数")
-	}
-
-	// 确保至少有一个监控目录
-	if len(monitorDirs) == 0 {
-		log.Fatal("错误：未指定任何监控目录")
-	}
-
-	log.Printf("监控目录: %v\n", monitorDirs)
-	log.Printf("检查间隔: %v\n", checkInterval)
-	log.Printf("哈希数据库文件: %s\n", hashDBFile)
-	log.Printf("日志文件: %s\n", logFilePath)
-
-	// 初始化哈希数据库
-	initHashDB()
-
-	// 确保程序退出时保存哈希数据库
-	defer saveHashDB()
-
-	// 开始监控
-	startMonitoring()
-}
-
-func initLog() {
-	// 创建日志目录
-	if err := os.MkdirAll(filepath.Dir(logFilePath), 0755); err != nil {
-		log.Fatalf("无法创建日志目录: %v", err)
-	}
-
-	var err error
-	logFile, err = os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatal("无法打开日志文件:", err)
-	}
-	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
-}
-
-func loadConfigFromFile() {
-	file, err := os.ReadFile(configFile)
-	if err != nil {
-		log.Fatalf("无法读取配置文件: %v", err)
-	}
-
-	var config Config
-	if err := json.Unmarshal(file, &config); err != nil {
-		log.Fatalf("解析配置文件错误: %v", err)
-	}
-
-	if len(config.Wenjian.Directories) == 0 {
-		log.Fatalf("配置文件中必须指定至少一个监控目录: %v", err)
-	}
-	monitorDirs = config.Wenjian.Directories
-	exclude = config.Wenjian.Exclude
-	MaxFileSize = 10485760
-
-	if config.HashDBFile != "" {
-		hashDBFile = config.HashDBFile
-	}
-
-	if config.LogFile != "" {
-		logFilePath = config.LogFile
-	}
-
-	if config.CheckInterval != "" {
-		duration, err := time.ParseDuration(config.CheckInterval)
-		if err != nil {
-			log.Printf("无效的检查间隔 '%s', 使用默认值: %v", config.CheckInterval, err)
-		} else {
-			checkInterval = duration
-		}
-	}
-}
-
-func initHashDB() {
-	// 尝试从文件加载已有的哈希数据库
-	if _, err := os.Stat(hashDBFile); err == nil {
-		file, err := os.ReadFile(hashDBFile)
-		if err != nil {
-			log.Printf("无法读取哈希数据库文件: %v", err)
-		} else {
-			if err := json.Unmarshal(file, &hashDB); err != nil {
-				log.Printf("解析哈希数据库错误: %v", err)
-			} else {
-				log.Printf("从文件加载了 %d 个文件的哈希值", len(hashDB))
-				return
-			}
-		}
-	}
-
-	// 如果无法加载，则重新初始化
-	log.Println("初始化新的哈希数据库...")
-	for _, dir := range monitorDirs {
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			if !info.IsDir() {
-				hash, err := calculateFileHash(path)
-				if err != nil {
-					log.Printf("计算文件哈希错误 %s: %v\n", path, err)
-					return nil
-				}
-				hashDB[path] = hash
-
-			}
-			return nil
-		})
-
-		if err != nil {
-			log.Printf("遍历目录错误 %s: %v\n", dir, err)
-		}
-	}
-
-	// 保存初始哈希数据库
-	if err := saveHashDB(); err != nil {
-		log.Printf("保存哈希数据库错误: %v", err)
-	}
-
-	log.Println("哈希数据库初始化完成")
-}
-
-func saveHashDB() error {
-	// 确保目录存在
-	if err := os.MkdirAll(filepath.Dir(hashDBFile), 0755); err != nil {
-		return fmt.Errorf("无法创建哈希数据库目录: %v", err)
-	}
-
-	data, err := json.MarshalIndent(hashDB, "", "  ")
-	if err != nil {
-		return fmt.Errorf("序列化哈希数据库错误: %v", err)
-	}
-
-	if err := os.WriteFile(hashDBFile, data, 0644); err != nil {
-		return fmt.Errorf("写入哈希数据库文件错误: %v", err)
-	}
-
-	return nil
-}
-
-func calculateFileHash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
-	}
-
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
-
-func startMonitoring() {
-	log.Printf("开始监控文件变化，检查间隔: %v...\n", checkInterval)
-
-	ticker := time.NewTicker(checkInterval)
-	defer ticker.Stop()
-
-	// 立即执行一次检查
-	checkFiles()
-
-	for range ticker.C {
-		checkFiles()
-	}
-}
-
-func checkFiles() {
-	log.Println(appversion + " 开始文件检查..")
-	changesDetected := false
-
-	for _, dir := range monitorDirs {
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			// 跳过目录本身，只检查目录内容
-			if path == dir {
-				return nil
-			}
-
-			// 检查是否应该排除该文件/目录
-			if shouldExclude(path, exclude) {
-				if info.IsDir() {
-					return filepath.SkipDir // 跳过整个目录
-				}
-
-				return nil // 跳过单个文件
-			}
-
-			// 只处理普通文件（跳过目录、符号链接等）
-			if !info.Mode().IsRegular() {
-				return nil
-			}
-
-			// 检查文件大小限制
-			if MaxFileSize > 0 && info.Size() > MaxFileSize {
-
-				return nil
-			}
-
-			currentHash, err := calculateFileHash(path)
-			if err != nil {
-				log.Printf("计算文件哈希错误 %s: %v\n", path, err)
-				return nil
-			}
-
-			storedHash, exists := hashDB[path]
-
-			if !exists {
-				// 新文件
-				hashDB[path] = currentHash
-				alert(fmt.Sprintf("发现新文件: %s\n大小: %d bytes\n哈希: %s",
-					path, info.Size(), currentHash))
-				changesDetected = true
-			} else if storedHash != currentHash {
-				// 文件被修改
-				hashDB[path] = currentHash
-				alert(fmt.Sprintf("文件被修改: %s\n大小: %d bytes\n原哈希: %s\n新哈希: %s",
-					path, info.Size(), storedHash, currentHash))
-				changesDetected = true
-			}
-
-			return nil
-		})
-
-		if err != nil {
-			log.Printf("遍历目录错误 %s: %v\n", dir, err)
-		}
-	}
-
-	// 检查是否有文件被删除（同时考虑排除规则）
-	for path := range hashDB {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			// 检查被删除的文件是否在排除列表中
-			if !shouldExclude(path, exclude) {
-				delete(hashDB, path)
-				alert(fmt.Sprintf("文件被删除: %s", path))
-				changesDetected = true
-			}
-		}
-	}
-
-	if changesDetected {
-		if err := saveHashDB(); err != nil {
-			log.Printf("保存哈希数据库错误: %v", err)
-		}
-	}
-
-	log.Println("文件检查完成 -.-")
-}
-
-func alert(message string) {
-	// 记录到日志
-	now := time.Now()
-	riqi := now.Format("2006-01-02 15:04:05") + " "
-	log.Println("警报:", riqi+message)
-
-}
-func shouldExclude(path string, excludePatterns []string) bool {
-	// 统一使用斜杠路径分隔符，避免Windows反斜杠问题
-	normalizedPath := filepath.ToSlash(path)
-
-	for _, pattern := range excludePatterns {
-		// 处理目录排除 (以/结尾的模式)
-		if strings.HasSuffix(pattern, "/") {
-			dirPattern := strings.TrimSuffix(pattern, "/")
-			if strings.HasPrefix(normalizedPath, dirPattern+"/") {
-				return true
-			}
-			continue
-		}
-
-		// 处理通配符匹配
-		if strings.Contains(pattern, "*") {
-			// 匹配完整路径
-			if match, _ := filepath.Match(pattern, filepath.Base(normalizedPath)); match {
-				return true
-			}
-			continue
-		}
-
-		// 精确匹配完整路径
-		if normalizedPath == pattern {
-			return true
-		}
-	}
-	return false
-}
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+var (
+	configFile    string
+	monitorDirs   []string
+	hashDBFile    string
+	logFilePath   string
+	checkInterval time.Duration
+	hashDB        = make(map[string]*Entry)
+	logFile       *os.File
+	exclude       []string
+	include       []string // 非空时只监控匹配其中规则的文件
+	MaxFileSize   int64
+	appversion    string
+
+	// 人工确认模式下等待确认的变动
+	manualAccept bool
+	pending      = make(map[string]Event)
+
+	// hashDB 与 pending 可能被控制接口并发访问
+	dbMu     sync.Mutex
+	scanMu   sync.Mutex
+	rescanCh = make(chan struct{}, 1)
+
+	lastScan      time.Time
+	lastScanErrs  int
+	lastCoverage  *coverageStats
+	progress      scanProgress
+	activeRoots   []string // 正在扫描的根目录
+	parallelRoots = defaultParallelRoots
+	silencedUntil time.Time
+	// scanPaused 为 true 时不执行定时扫描，pausedUntil 为零表示直到 resume
+	scanPaused  bool
+	pausedUntil time.Time
+	control     ControlConfig
+	ctlCmd      string
+	ctlAddr     string
+	tuiMode     bool
+	encryptMode bool
+)
+
+// Event 描述一次文件变动
+type Event struct {
+	Type    string    `json:"type"` // new, modified, deleted, renamed, attributes, stream_new, stream_modified, stream_deleted, policy_violation
+	Path    string    `json:"path"`
+	OldPath string    `json:"old_path,omitempty"` // renamed 事件的原路径
+	Stream  string    `json:"stream,omitempty"`   // stream_* 事件的 NTFS 备用数据流名称
+	Size    int64     `json:"size,omitempty"`
+	OldHash string    `json:"old_hash,omitempty"`
+	NewHash string    `json:"new_hash,omitempty"`
+	Time    time.Time `json:"time"`
+
+	Severity string   `json:"severity,omitempty"`
+	Mount    string   `json:"mount,omitempty"`
+	Risk     int      `json:"risk,omitempty"`     // 0-100 风险分数
+	Signals  []string `json:"signals,omitempty"`  // 命中的风险信号
+	Diff     string   `json:"diff,omitempty"`     // 文本文件的内容差异
+	Findings []string `json:"findings,omitempty"` // 内容检查发现的可疑特征
+
+	Webshell   []string `json:"webshell,omitempty"`   // 命中的 WebShell 特征 ID
+	Yara       []string `json:"yara,omitempty"`       // 命中的 YARA 规则（命名空间:规则名）
+	Entropy    float64  `json:"entropy,omitempty"`    // 熵值分析命中时的整体熵值（bits/byte）
+	Quarantine string   `json:"quarantine,omitempty"` // 文件已被隔离时的隔离记录 ID
+
+	Digests map[string]string `json:"digests,omitempty"` // 新内容的附加摘要
+
+	OldMeta    *FileMeta `json:"old_meta,omitempty"`
+	NewMeta    *FileMeta `json:"new_meta,omitempty"`
+	Attributes []string  `json:"attributes,omitempty"` // attributes 事件中变化的属性
+	// extra 为需要额外通知的渠道，不对外暴露
+	extra []string
+}
+
+// Entry 是哈希数据库中一个文件的基线记录
+type Entry struct {
+	Hash         string    `json:"hash"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastVerified time.Time `json:"last_verified"`
+	LastChanged  time.Time `json:"last_changed"`
+
+	// Streams 是 NTFS 备用数据流名称到哈希的映射
+	Streams map[string]string `json:"streams,omitempty"`
+
+	// Digests 是附加摘要，算法名到十六进制哈希的映射
+	Digests map[string]string `json:"digests,omitempty"`
+
+	Meta *FileMeta `json:"meta,omitempty"`
+}
+
+// scanProgress 记录当前扫描进度，供控制接口和 TUI 展示
+type scanProgress struct {
+	Scanning  bool      `json:"scanning"`
+	Dir       string    `json:"dir,omitempty"`
+	Files     int       `json:"files"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+type Config struct {
+	Wenjian struct {
+		Directories []DirEntry `json:"directories"` // 支持通配符，例如 /var/www/*/public_html；每一项也可以是带独立设置的对象
+		DirsFrom    string     `json:"dirs_from"`   // 每行一个目录的列表文件
+		Exclude     []string   `json:"exclude"`
+		// ExcludeRegex 是在完整路径中查找的正则表达式，例如 .*/cache/.*\.tmp$
+		ExcludeRegex []string `json:"exclude_regex"`
+		// Include 非空时只监控匹配其中规则的文件，例如 ["*.php", "*.js"]，写法与 exclude 相同
+		Include []string `json:"include"`
+		// IgnoreFiles 为 false 时不读取监控目录中的 .webmonignore，默认读取
+		IgnoreFiles *bool `json:"ignore_files"`
+		// Attributes 按目录声明需要报警的变化，例如 {"/etc/nginx": ["content", "permissions", "ownership"]}
+		Attributes map[string][]string `json:"attributes"`
+		// MaxFileSize 是默认的文件大小上限（字节），0 表示不限制；MaxFileSizes 按目录覆盖
+		MaxFileSize  *int64           `json:"max_file_size"`
+		MaxFileSizes map[string]int64 `json:"max_file_sizes"`
+	} `json:"wenjian"`
+
+	HashDBFile    string   `json:"hash_db_file"`
+	HashDBKey     string   `json:"hash_db_key" secret:"true"` // 哈希数据库的 HMAC 签名密钥，建议写成 env: 或 file: 引用
+	HashAlgorithm string   `json:"hash_algorithm"`            // sha256（默认）、sha512、blake3 或 xxh64
+	ExtraHashes   []string `json:"extra_hashes"`              // 附加保存的摘要，例如 ["md5", "sha1"]
+	LogFile       string   `json:"log_file"`
+	CheckInterval string   `json:"check_interval"`
+	WatchConfig   bool     `json:"watch_config"` // 每次扫描前检查配置文件，内容变化时自动重新加载
+	ManualAccept  bool     `json:"manual_accept"`
+
+	DetectADS        bool            `json:"detect_ads"`              // Windows 下检测 NTFS 备用数据流
+	PrivilegedHelper []string        `json:"privileged_helper"`       // 无权限读取时重试的命令，例如 ["sudo", "-n", "/usr/bin/sha256sum"]
+	NewTreeThreshold int             `json:"new_tree_threshold"`      // 新目录文件数达到该值时合并为一条警报，默认 10，负数不合并
+	BulkSnapshot     int             `json:"bulk_snapshot_threshold"` // 一次确认达到该数量的变动前自动创建基线还原点，默认 20，负数不创建
+	ParallelRoots    int             `json:"parallel_roots"`          // 同时扫描的根目录数，默认 4，1 表示逐个扫描
+	HashWorkers      int             `json:"hash_workers"`            // 每个根目录同时计算哈希的文件数，默认 4，1 表示逐个计算
+	Throttle         ThrottleConfig  `json:"throttle"`
+	LargeFiles       LargeFileConfig `json:"large_files"`        // 超过大小限制的文件跳过或只校验首尾部分
+	Incremental      bool            `json:"incremental"`        // 大小和修改时间等属性未变的文件不重新计算哈希
+	FullScanInterval string          `json:"full_scan_interval"` // 增量扫描时每隔多久完整计算一次，默认 24h
+
+	OneFilesystem  bool   `json:"one_filesystem"`   // 不跨越文件系统边界
+	AlertNewMounts bool   `json:"alert_new_mounts"` // 监控目录下出现新挂载点时报警
+	MountSource    bool   `json:"mount_source"`     // 事件中附带挂载来源
+	Timezone       string `json:"timezone"`
+	TimeFormat     string `json:"time_format"`
+
+	Schedule []ScheduleRule `json:"schedule"`
+
+	DeliveryMode   string `json:"delivery_mode"`    // per_event、per_scan 或 digest
+	DigestMaxFiles int    `json:"digest_max_files"` // digest 模式下每个目录的每类变动最多列出的文件数，默认 5
+
+	Escalation   EscalationConfig    `json:"escalation"`
+	Risk         RiskConfig          `json:"risk"`
+	Severity     []SeverityRule      `json:"severity_rules"`
+	UploadPolicy UploadPolicyConfig  `json:"upload_policy"`
+	HTTPChecks   []HTTPCheck         `json:"http_checks"`
+	Ownership    []OwnershipPolicy   `json:"ownership_policy"`
+	SEOWatch     SEOWatchConfig      `json:"seo_watch"`
+	Critical     CriticalWatchConfig `json:"critical_watch"`
+	Skimmer      SkimmerConfig       `json:"skimmer"`
+	Heartbeat    HeartbeatConfig     `json:"heartbeat"`
+	Deadman      DeadmanConfig       `json:"deadman"`
+	DeepAudit    DeepAuditConfig     `json:"deep_audit"`
+	Quarantine   QuarantineConfig    `json:"quarantine"`
+	AutoRestore  AutoRestoreConfig   `json:"auto_restore"`
+	Snapshots    SnapshotConfig      `json:"snapshots"`
+	Diff         DiffConfig          `json:"diff"`
+	Webshell     WebshellConfig      `json:"webshell"`
+	Yara         YaraConfig          `json:"yara"`
+	Entropy      EntropyConfig       `json:"entropy"`
+	Reports      ReportConfig        `json:"reports"`
+	NewExec      NewExecutableConfig `json:"new_executables"`
+	Vault        VaultConfig         `json:"vault"`
+
+	Control   ControlConfig   `json:"control"`
+	Dashboard DashboardConfig `json:"dashboard"`
+	API       APIConfig       `json:"api"`
+	Agent     AgentConfig     `json:"agent"`
+	LogShip   LogShipConfig   `json:"log_shipping"`
+	AuditLog  AuditLogConfig  `json:"audit_log"`
+	Storage   StorageConfig   `json:"storage"`
+	Notify    NotifyConfig    `json:"notify"`
+}
+
+func init() {
+	flag.StringVar(&configFile, "config", defaultConfigFile, "Path to configuration file (JSON, or YAML/TOML by .yaml/.yml/.toml extension)")
+	flag.StringVar(&hashDBFile, "db", "data/hashdb.json", "Path to hash database file")
+	flag.StringVar(&logFilePath, "log", "data/webmonitor.log", "Path to log file")
+
+	flag.DurationVar(&checkInterval, "interval", 20*time.Minute, "Check interval (e.g. 5m, 1h)")
+	flag.Int64Var(&MaxFileSize, "max-file-size", defaultMaxFileSize, "Skip (or with large_files.mode partial, sample) files larger than this many bytes; 0 disables the limit; overrides wenjian.max_file_size")
+	flag.StringVar(&dirsFromFile, "dirs-from", "", "Read additional directories (one per line, globs allowed) from a file")
+
+	flag.StringVar(&ctlCmd, "ctl", "", "Send a command to a running daemon and exit (status, rescan, check, accept, silence, export, restore-point, restore-points, rollback, simulate, pause, resume, reload)")
+	flag.StringVar(&ctlAddr, "ctl-addr", "", "Daemon control address: unix socket path or https://host:port")
+	flag.BoolVar(&daemonMode, "daemon", false, "Detach and run in the background (log only to -log); refuses to start while another instance uses the same hash DB")
+	flag.StringVar(&pidFile, "pid-file", "", "Write the daemon's PID to this file (default <db>.pid with -daemon)")
+	flag.BoolVar(&tuiMode, "tui", false, "Show a live terminal status view of a running daemon")
+	flag.BoolVar(&encryptMode, "encrypt-secret", false, "Read a value from stdin and print it encrypted with the master key for use in config.json")
+	flag.StringVar(&masterKeyFile, "master-key-file", "", "Path to the master key used to decrypt enc: values in the config")
+
+	flag.BoolVar(&verifyMode, "verify", false, "Compare the tree against the baseline once without updating it, then exit (0 clean, 1 changes, 2 errors)")
+	flag.BoolVar(&diffMode, "diff", false, "Like -verify but print old and new hashes for every difference")
+	flag.BoolVar(&reportMode, "report", false, "Print baseline statistics and exit")
+	flag.BoolVar(&coverageMode, "coverage", false, "Scan once and report which files are skipped and why, then exit")
+	flag.StringVar(&goldenPath, "golden", "", "Compare the live docroot against a read-only golden copy at this path, then exit")
+	flag.StringVar(&compareDir, "against", "", "With -golden or -check-manifest, the live directory to compare (default: the only monitored directory)")
+	flag.StringVar(&explainPath, "explain", "", "Show whether a path is monitored and which exclude rule or limit skips it, then exit (0 monitored, 1 skipped, 2 errors)")
+	flag.BoolVar(&signDBMode, "sign-db", false, "Sign the current hash database with hash_db_key after reviewing it, then exit")
+	flag.BoolVar(&suggestMode, "suggest-excludes", false, "Suggest exclude patterns for paths with constant legitimate churn in the event history, then exit")
+	flag.BoolVar(&applySuggest, "apply", false, "With -suggest-excludes, add the suggested patterns to wenjian.exclude in the config file")
+	flag.StringVar(&outputFormat, "output", "text", "Output format for one-shot commands: text or json")
+	flag.StringVar(&restorePointName, "restore-point", "", "Save the current baseline as a named restore point, then exit")
+	flag.BoolVar(&listRestoreMode, "list-restore-points", false, "List baseline restore points, then exit")
+	flag.StringVar(&rollbackBaselineTo, "rollback-baseline", "", "Replace the baseline with the given restore point (ID or name), then exit")
+	flag.DurationVar(&staleAfter, "stale-after", 24*time.Hour, "With -report, list baseline entries not re-verified within this duration")
+	flag.StringVar(&manifestPath, "check-manifest", "", "Check the baseline against a vendor hash manifest (md5sum format or WordPress checksums JSON) without rescanning, then exit")
+	flag.StringVar(&hashListPath, "match-hashes", "", "Report baseline files whose hashes appear in a threat-intel hash list (one per line) without rescanning, then exit")
+	flag.BoolVar(&readOnly, "read-only", false, "Verify and report only: never rewrite the baseline or state files, and alert on any write to the data directory (for immutable container images)")
+	flag.BoolVar(&buildBaseline, "build-baseline", false, "Build the baseline for a read-only image (e.g. in a Dockerfile RUN step), then exit; refuses to overwrite an existing baseline")
+	flag.BoolVar(&forceFullScan, "full-scan", false, "With incremental scanning enabled, hash every file instead of trusting unchanged size and mtime (daemon, -verify, -diff, -coverage)")
+	flag.BoolVar(&deepAuditMode, "deep-audit", false, "Rehash every file, re-read all metadata, cross-check baseline changes against the event history and write a signed audit report, then exit (0 clean, 1 findings, 2 errors)")
+	flag.BoolVar(&listQuarantineMode, "list-quarantine", false, "List files moved to the quarantine directory, then exit")
+	flag.StringVar(&restoreQuarantineID, "restore-quarantine", "", "Move a quarantined file (by ID from -list-quarantine) back to its original path, then exit")
+	flag.StringVar(&showContentPath, "show-content", "", "Print a file's baseline content from the content snapshot store, then exit")
+	flag.StringVar(&showContentHash, "content-hash", "", "With -show-content or -restore-content, use this hash (e.g. an old_hash from an alert) instead of the baseline")
+	flag.StringVar(&restoreContentPath, "restore-content", "", "Restore a file's baseline content from the content snapshot store, then exit")
+	flag.StringVar(&htmlReportOut, "html-report", "", "Write an HTML summary report of the current (unfinished) report period to this file (- for stdout), then exit")
+	flag.StringVar(&verifyAuditLogPath, "verify-audit-log", "", "Check the hash chain (and HMAC, if keyed) of a tamper-evident audit log, then exit (0 intact, 1 tampered, 2 errors)")
+	flag.StringVar(&verifyAuditPath, "verify-audit", "", "Check the signature of a deep audit report, then exit (0 valid, 1 invalid, 2 errors)")
+}
+
+func main() {
+	appversion = "Webserver文件防篡改监控-秋裤子1.2版"
+
+	// server 子命令：作为收集端接收多台主机上监控实例的报告
+	if len(os.Args) > 1 && os.Args[1] == "server" {
+		os.Exit(runCollectorServer(os.Args[2:]))
+	}
+	// baseline 子命令：导出和导入带 GPG 签名的基线
+	if len(os.Args) > 1 && os.Args[1] == "baseline" {
+		os.Exit(runBaselineCommand(os.Args[2:]))
+	}
+	// aggregate 子命令：汇总多台主机导出的事件和基线
+	if len(os.Args) > 1 && os.Args[1] == "aggregate" {
+		os.Exit(runAggregate(os.Args[2:]))
+	}
+	// install-service、uninstall-service、start-service、stop-service 子命令：管理系统服务
+	if len(os.Args) > 1 && isServiceCommand(os.Args[1]) {
+		os.Exit(runServiceCommand(os.Args[1], os.Args[2:]))
+	}
+
+	// 解析子命令和命令行参数，未指定的参数可以来自环境变量
+	parseCommandLine()
+	if err := applyEnvFlags(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+
+	// 处理额外指定的目录参数
+	args := flag.Args()
+	if len(args) > 0 && ctlCmd == "" {
+		argDirs = append(argDirs, args...)
+	}
+
+	// 客户端模式：只与运行中的守护进程通信，不打开日志和数据库
+	if ctlCmd != "" {
+		os.Exit(runCtl(ctlCmd, args))
+	}
+	if tuiMode {
+		os.Exit(runTUI())
+	}
+	if encryptMode {
+		os.Exit(runEncryptSecret())
+	}
+	switch command {
+	case "init":
+		os.Exit(runBuildBaseline(forceInit))
+	case "verify":
+		if diffMode {
+			os.Exit(runVerify("diff", true))
+		}
+		os.Exit(runVerify("verify", false))
+	}
+	switch {
+	case verifyMode:
+		os.Exit(runVerify("verify", false))
+	case diffMode:
+		os.Exit(runVerify("diff", true))
+	case reportMode:
+		os.Exit(runReport())
+	case coverageMode:
+		os.Exit(runCoverage())
+	case goldenPath != "":
+		os.Exit(runCompareGolden())
+	case explainPath != "":
+		os.Exit(runExplain())
+	case signDBMode:
+		os.Exit(runSignDB())
+	case suggestMode:
+		os.Exit(runSuggestExcludes())
+	case restorePointName != "" || listRestoreMode || rollbackBaselineTo != "":
+		os.Exit(runRestorePointCommand())
+	case manifestPath != "":
+		os.Exit(runCheckManifest())
+	case hashListPath != "":
+		os.Exit(runMatchHashes())
+	case buildBaseline:
+		os.Exit(runBuildBaseline(false))
+	case deepAuditMode:
+		os.Exit(runDeepAudit())
+	case listQuarantineMode || restoreQuarantineID != "":
+		os.Exit(runQuarantineCommand())
+	case showContentPath != "" || restoreContentPath != "":
+		os.Exit(runContentCommand())
+	case verifyAuditPath != "":
+		os.Exit(runVerifyAudit())
+	case htmlReportOut != "":
+		os.Exit(runHTMLReport())
+	case verifyAuditLogPath != "":
+		os.Exit(runVerifyAuditLog())
+	}
+
+	// 后台运行：以相同参数重新启动自身后退出
+	if daemonMode && !isDaemonChild() {
+		os.Exit(runDaemonize())
+	}
+
+	// 作为 Windows 服务运行时先连接 SCM
+	startServiceMode()
+
+	initLog()
+	defer logFile.Close()
+
+	log.Println(appversion)
+
+	// 加载配置
+	if configFile != "" || len(configEnv()) > 0 {
+		loadConfigFromFile()
+		if len(envOverrides) > 0 {
+			log.Printf("环境变量覆盖的配置项: %s", strings.Join(envOverrides, ", "))
+		}
+		for _, name := range envUnknown {
+			log.Printf("环境变量 %s 不对应任何配置项，已忽略", name)
+		}
+	} else {
+		log.Println("未指定配置文件，使用命令行参数")
+	}
+
+	// 展开目录通配符
+	expandDirs()
+
+	// 确保至少有一个监控目录
+	if len(monitorDirs) == 0 {
+		log.Fatal("错误：未指定任何监控目录")
+	}
+	if err := checkQuarantineDir(); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	// 同一个哈希数据库只允许一个实例
+	acquireInstanceLock()
+
+	log.Printf("监控目录: %v\n", monitorDirs)
+	log.Printf("检查间隔: %v\n", checkInterval)
+	log.Printf("哈希数据库文件: %s\n", hashDBFile)
+	if logFile != nil {
+		log.Printf("日志文件: %s\n", logFilePath)
+	}
+
+	openAuditLog()
+
+	// 初始化哈希数据库
+	initHashDB()
+	loadHTTPState()
+	seedSEOCache()
+	seedJSDomains()
+
+	// scan 子命令：扫描一次后退出，不启动控制接口等后台服务
+	if command == "scan" {
+		startSignalHandler()
+		startLogShipping()
+		os.Exit(runScanOnce())
+	}
+
+	// 启动控制接口
+	startControlServer()
+	startDashboard()
+	startAPIServer()
+	startHeartbeat()
+	startCriticalWatch()
+	startDataDirGuard()
+	startDeepAudit()
+	startReports()
+	startLogShipping()
+
+	// 开始监控，收到退出信号后保存基线并退出
+	startSignalHandler()
+	startMonitoring()
+	os.Exit(shutdown())
+}
+
+func initLog() {
+	// 只读模式下未显式指定 -log 时只输出到标准输出，由容器运行时收集
+	if readOnly {
+		explicit := false
+		flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "log" })
+		if !explicit {
+			log.SetFlags(0)
+			log.SetOutput(timestampWriter{os.Stdout})
+			return
+		}
+	}
+	// 创建日志目录
+	if err := os.MkdirAll(filepath.Dir(logFilePath), 0755); err != nil {
+		log.Fatalf("无法创建日志目录: %v", err)
+	}
+
+	var err error
+	logFile, err = os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatal("无法打开日志文件:", err)
+	}
+	log.SetFlags(0)
+	log.SetOutput(timestampWriter{io.MultiWriter(os.Stdout, logFile)})
+}
+
+// readConfigFile 读取并解析配置文件，解密其中的加密值
+func readConfigFile() (Config, error) {
+	var config Config
+	file, err := os.ReadFile(configFile)
+	switch {
+	case err == nil:
+		configSum = sha256.Sum256(file)
+	case (configFile == "" || configFile == defaultConfigFile) && os.IsNotExist(err) && len(configEnv()) > 0:
+		// 没有配置文件，全部配置来自环境变量
+		file = []byte("{}")
+		err = nil
+	default:
+		return config, fmt.Errorf("无法读取配置文件: %v", err)
+	}
+
+	// YAML 和 TOML 配置先转换为 JSON，之后的解密和解析与 JSON 配置相同
+	switch configFormat(configFile) {
+	case "yaml":
+		file, err = yamlToJSON(file, reflect.TypeOf(config))
+	case "toml":
+		file, err = tomlToJSON(file)
+	}
+	if err != nil {
+		return config, fmt.Errorf("解析配置文件错误: %v", err)
+	}
+
+	// 环境变量覆盖配置文件中的值，之后同样解密和解析引用
+	if file, err = applyEnvConfig(file); err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal(file, &config); err != nil {
+		return config, fmt.Errorf("解析配置文件错误: %v", err)
+	}
+
+	// 解密凭据字段中的加密值，读取外部引用的凭据
+	if err := resolveSecrets(&config); err != nil {
+		return config, fmt.Errorf("解密配置文件错误: %v", err)
+	}
+	return config, nil
+}
+
+// configFormat 按扩展名判断配置文件的格式，.yaml 和 .yml 为 YAML，.toml 为 TOML，其他按 JSON 处理
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// applyScanSettings 应用扫描相关的设置，这些设置可以热加载，调用方需持有 scanMu
+func applyScanSettings(config Config) error {
+	if len(config.Wenjian.Directories) == 0 && dirsFromFile == "" && len(argDirs) == 0 {
+		return fmt.Errorf("配置文件中必须指定至少一个监控目录")
+	}
+	if err := validateExcludes(config.Wenjian.Exclude); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+	regexRules, err := regexExcludes(config.Wenjian.ExcludeRegex)
+	if err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+	if err := validateIncludes(config.Wenjian.Include); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+	if config.ParallelRoots < 0 {
+		return fmt.Errorf("parallel_roots 不能为负数")
+	}
+	if config.HashWorkers < 0 {
+		return fmt.Errorf("hash_workers 不能为负数")
+	}
+	windows, err := parseSchedule(config.Schedule)
+	if err != nil {
+		return fmt.Errorf("解析扫描计划错误: %v", err)
+	}
+	if err := applyAttributePolicy(config.Wenjian.Attributes); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+	if err := applySizeLimitConfig(config.Wenjian.MaxFileSize, config.Wenjian.MaxFileSizes); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+	if err := applyIncrementalConfig(config.Incremental, config.FullScanInterval); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+	if err := applyDirProfiles(config.Wenjian.Directories); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+
+	dirPatterns = dirEntryPaths(config.Wenjian.Directories)
+	// -dirs-from 优先于配置文件中的 dirs_from
+	if dirsFromFile == "" || dirsFromFile == configDirsFrom {
+		dirsFromFile = config.Wenjian.DirsFrom
+		configDirsFrom = config.Wenjian.DirsFrom
+	}
+	dbMu.Lock()
+	exclude = append(append([]string(nil), config.Wenjian.Exclude...), regexRules...)
+	include = config.Wenjian.Include
+	ignoreFilesEnabled = config.Wenjian.IgnoreFiles == nil || *config.Wenjian.IgnoreFiles
+	resetIgnoreCache()
+	dbMu.Unlock()
+	parallelRoots, hashWorkers = defaultParallelRoots, defaultHashWorkers
+	if config.ParallelRoots > 0 {
+		parallelRoots = config.ParallelRoots
+	}
+	if config.HashWorkers > 0 {
+		hashWorkers = config.HashWorkers
+	}
+	scanCalendar = windows
+
+	checkInterval = flagInterval
+	if config.CheckInterval != "" {
+		duration, err := time.ParseDuration(config.CheckInterval)
+		if err != nil {
+			log.Printf("无效的检查间隔 '%s', 使用默认值: %v", config.CheckInterval, err)
+		} else {
+			checkInterval = duration
+		}
+	}
+	return nil
+}
+
+func loadConfigFromFile() {
+	config, err := readConfigFile()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manualAccept = config.ManualAccept
+	privilegedHelper = config.PrivilegedHelper
+	if config.BulkSnapshot != 0 {
+		bulkSnapshotThreshold = config.BulkSnapshot
+	}
+	if config.NewTreeThreshold != 0 {
+		newTreeThreshold = config.NewTreeThreshold
+	}
+	if err := applyLargeFileConfig(config.LargeFiles); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyThrottleConfig(config.Throttle); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	detectADS = config.DetectADS
+	if detectADS && !adsSupported {
+		log.Println("detect_ads 只在 Windows 上生效")
+	}
+	oneFilesystem = config.OneFilesystem
+	alertNewMounts = config.AlertNewMounts
+	mountSource = config.MountSource
+	control = config.Control
+	dashboard = config.Dashboard
+	apiConfig = config.API
+
+	if err := applyTimeConfig(config.Timezone, config.TimeFormat); err != nil {
+		log.Fatal(err)
+	}
+	// 扫描计划按时区解析，在 applyTimeConfig 之后应用；未配置 check_interval 时使用 -interval
+	flagInterval = checkInterval
+	if err := applyScanSettings(config); err != nil {
+		log.Fatal(err)
+	}
+
+	switch config.DeliveryMode {
+	case "":
+	case deliveryPerEvent, deliveryPerScan, deliveryDigest:
+		deliveryMode = config.DeliveryMode
+	default:
+		log.Fatalf("无效的 delivery_mode: %s", config.DeliveryMode)
+	}
+	if config.DigestMaxFiles < 0 {
+		log.Fatalf("配置错误: digest_max_files 不能为负数")
+	}
+	digestMaxFiles = 5
+	if config.DigestMaxFiles > 0 {
+		digestMaxFiles = config.DigestMaxFiles
+	}
+
+	if err := applyEscalationConfig(config.Escalation); err != nil {
+		log.Fatalf("解析升级策略错误: %v", err)
+	}
+	if err := applySeverityRules(config.Severity); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyRiskConfig(config.Risk); err != nil {
+		log.Fatalf("解析风险评分配置错误: %v", err)
+	}
+	if err := applyWebshellConfig(config.Webshell); err != nil {
+		log.Fatalf("解析 WebShell 特征配置错误: %v", err)
+	}
+	if err := applyYaraConfig(config.Yara); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyReportConfig(config.Reports); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyEntropyConfig(config.Entropy); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyNewExecutableConfig(config.NewExec); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyUploadPolicyConfig(config.UploadPolicy); err != nil {
+		log.Fatalf("解析上传目录策略错误: %v", err)
+	}
+	if err := applyHTTPChecks(config.HTTPChecks); err != nil {
+		log.Fatalf("解析网页检查配置错误: %v", err)
+	}
+	if err := applySEOWatchConfig(config.SEOWatch); err != nil {
+		log.Fatalf("解析 seo_watch 配置错误: %v", err)
+	}
+	applySkimmerConfig(config.Skimmer)
+	if err := applyCriticalWatchConfig(config.Critical); err != nil {
+		log.Fatalf("解析 critical_watch 配置错误: %v", err)
+	}
+	if err := applyOwnershipPolicies(config.Ownership); err != nil {
+		log.Fatalf("解析属主策略错误: %v", err)
+	}
+	heartbeat = config.Heartbeat
+	deadman = config.Deadman
+	if err := applyDeepAuditConfig(config.DeepAudit); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyQuarantineConfig(config.Quarantine); err != nil {
+		log.Fatalf("解析隔离规则错误: %v", err)
+	}
+	if err := applyAutoRestoreConfig(config.AutoRestore); err != nil {
+		log.Fatalf("解析自动恢复配置错误: %v", err)
+	}
+	if err := applySnapshotConfig(config.Snapshots); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyDiffConfig(config.Diff); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := configureNotifiers(config.Notify); err != nil {
+		log.Fatal(err)
+	}
+	if err := configureAgent(config.Agent); err != nil {
+		log.Fatalf("解析收集端配置错误: %v", err)
+	}
+	if err := configureLogShipping(config.LogShip); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyAuditLogConfig(config.AuditLog); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+
+	if config.HashDBFile != "" {
+		hashDBFile = config.HashDBFile
+	}
+	if err := applyStorageConfig(config.Storage); err != nil {
+		log.Fatalf("解析存储配置错误: %v", err)
+	}
+	if err := applyDBKey(config.HashDBKey); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyHashAlgorithm(config.HashAlgorithm); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+	if err := applyExtraHashes(config.ExtraHashes); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+
+	if config.LogFile != "" {
+		logFilePath = config.LogFile
+	}
+
+	loadedConfig = config
+}
+
+func initHashDB() {
+	// 尝试从存储后端加载已有的哈希数据库
+	if n, err := loadHashDB(); errors.Is(err, errBaselineSignature) {
+		refuseTamperedBaseline(err)
+	} else if err != nil {
+		log.Print(err)
+	} else if n > 0 {
+		log.Printf("从文件加载了 %d 个文件的哈希值", n)
+		if other := countOtherAlgorithms(hashDB); other > 0 {
+			log.Printf("基线中有 %d 条记录使用其他哈希算法，校验内容未变后会转换为 %s", other, hashAlgorithm)
+		}
+		return
+	}
+
+	if readOnly {
+		log.Fatalf("只读模式需要在构建镜像时用 -build-baseline 生成的基线，无法从 %s 加载", hashDBFile)
+	}
+	if command == "scan" {
+		// scan 只与已有的基线比较，基线由 init 建立，避免脚本中意外地把当前状态当作基线
+		log.Printf("哈希数据库不存在或为空: %s，请先执行 init 建立基线", hashDBFile)
+		os.Exit(exitError)
+	}
+
+	// 如果无法加载，则重新初始化
+	buildHashDB()
+}
+
+// buildHashDB 遍历监控目录，为其中的文件建立基线并保存
+func buildHashDB() {
+	log.Println("初始化新的哈希数据库...")
+	for _, dir := range monitorDirs {
+		pool := newHashPool(hashWorkers, func(err error) { log.Printf("初始化目录 %s 时发生内部错误: %v", dir, err) })
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// 与扫描一致，跳过匹配排除规则的文件和整个目录，以及不在 include 范围内的文件
+			if path != dir && matcher.Matches(path, excludesFor(dir)) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() && !included(path) {
+				return nil
+			}
+			if _, ok := ignoredByFile(path, dir, info.IsDir()); ok {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if h, ok := specialHash(info); ok {
+				t := now()
+				dbMu.Lock()
+				hashDB[path] = &Entry{Hash: h, FirstSeen: t, LastVerified: t, LastChanged: t}
+				dbMu.Unlock()
+				log.Printf("监控目录中存在特殊文件: %s (%s)", path, specialKind(h))
+				return nil
+			}
+			// 与扫描一致，超过大小限制的文件不计入基线（large_files.mode 为 partial 时只计算首尾部分）
+			if info.IsDir() || (overSizeLimit(path, info) && !sampleLargeFiles()) {
+				return nil
+			}
+			pool.submit(func() {
+				hash, digests, err := hashForBaseline(path, info)
+				if err != nil {
+					log.Printf("计算文件哈希错误 %s: %v\n", path, err)
+					return
+				}
+				snapshotContent(path, hash)
+				t := now()
+				e := &Entry{Hash: hash, FirstSeen: t, LastVerified: t, LastChanged: t, Digests: digests, Meta: fileMeta(info)}
+				if detectADS && adsSupported {
+					if streams, err := hashStreams(path); err == nil {
+						e.Streams = streams
+					}
+				}
+				dbMu.Lock()
+				hashDB[path] = e
+				dbMu.Unlock()
+			})
+			return nil
+		})
+		pool.wait()
+
+		if err != nil {
+			log.Printf("遍历目录错误 %s: %v\n", dir, err)
+		}
+	}
+
+	// 保存初始哈希数据库
+	if err := saveHashDB(); err != nil {
+		log.Printf("保存哈希数据库错误: %v", err)
+	}
+
+	log.Println("哈希数据库初始化完成")
+}
+
+func calculateFileHash(filePath string) (string, error) {
+	return hashFileWith(filePath, hashAlgorithm)
+}
+
+func startMonitoring() {
+	log.Printf("开始监控文件变化，检查间隔: %v...\n", checkInterval)
+
+	for _, w := range scanCalendar {
+		log.Printf("扫描计划: %s", w.label)
+	}
+
+	// 立即执行一次检查（若当前处于禁止扫描的窗口则等待）
+	if _, ok := intervalAt(now()); ok {
+		checkFiles(true)
+	}
+
+	timer := time.NewTimer(nextScanWait())
+	defer timer.Stop()
+
+	for !shuttingDown() {
+		select {
+		case <-shutdownCh:
+			return
+		case <-timer.C:
+			// 暂停期间不执行定时扫描，控制接口的立即扫描请求照常执行
+			if pauseWait() == 0 && nextScanWait() == 0 {
+				reloadIfConfigChanged()
+				checkFiles(false)
+			}
+		case <-rescanCh:
+			log.Println("收到控制接口的立即扫描请求")
+			reloadIfConfigChanged()
+			checkFiles(true)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case reply := <-reloadCh:
+			reply <- reloadConfig()
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		checkEscalations()
+		flushQuietHours(false)
+		wait := nextScanWait()
+		if p := pauseWait(); p > wait {
+			wait = p
+		}
+		timer.Reset(wait)
+	}
+}
+
+// pauseWait 在扫描暂停期间返回需要继续等待的时间，未暂停或暂停已到期时返回 0
+func pauseWait() time.Duration {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	if !scanPaused {
+		return 0
+	}
+	if pausedUntil.IsZero() {
+		// 直到 resume，resume 时会通过立即扫描请求唤醒
+		return checkInterval
+	}
+	d := pausedUntil.Sub(now())
+	if d <= 0 {
+		scanPaused = false
+		log.Println("扫描暂停已到期，恢复定时扫描")
+		return 0
+	}
+	return d
+}
+
+// checkFiles 检查已到检查时间的监控目录，force 为 true 时检查全部目录
+func checkFiles(force bool) {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+
+	log.Println(appversion + " 开始文件检查..")
+
+	// 重新展开目录通配符，发现新增的站点
+	expandDirs()
+
+	// 多台主机共用基线时先合并其他主机确认的变动
+	if err := refreshHashDB(); err != nil {
+		log.Printf("读取共享基线错误: %v", err)
+	}
+
+	dbMu.Lock()
+	progress = scanProgress{Scanning: true, StartedAt: now()}
+	dirs, skipped := dueRoots(monitorDirs, force, progress.StartedAt)
+	dbMu.Unlock()
+	if len(skipped) > 0 {
+		log.Printf("本次检查 %d 个到期的目录，%d 个目录未到检查时间", len(dirs), len(skipped))
+	}
+
+	full := beginScan(true)
+	skippedRoots = skipped
+	res := scanTree(dirs)
+	skippedRoots = nil
+	if shuttingDown() {
+		// 遍历被中止，结果不完整，不记录这次扫描
+		log.Println("程序正在停止，本次扫描被中止，结果不保存")
+		dbMu.Lock()
+		progress.Scanning = false
+		progress.Dir = ""
+		activeRoots = nil
+		dbMu.Unlock()
+		return
+	}
+	scanErrs := len(res.Errors)
+	log.Println(res.Coverage.summary())
+	// 跳过了部分目录时，这些目录中已知的违规不能视为已解决
+	res.Partial = len(skipped) > 0
+	applyScanResult(res)
+	if len(skipped) == 0 {
+		// 只检查了部分目录时，跳过的目录中的规则没有命中是正常的
+		auditExcludes(res.ExcludeHits)
+	}
+	saveChurnStats()
+
+	scanned := make(map[string]time.Time, len(dirs)+len(skipped))
+	for _, d := range skipped {
+		scanned[d] = rootScanned[d]
+	}
+	for _, d := range dirs {
+		scanned[d] = progress.StartedAt
+	}
+	rootScanned = scanned
+
+	dbMu.Lock()
+	lastScan = now()
+	lastScanErrs = scanErrs
+	lastScanEvents = len(res.Events)
+	reportScanStats(lastScan.Sub(progress.StartedAt), scanErrs)
+	lastCoverage = res.Coverage
+	if full && scanErrs == 0 && len(skipped) == 0 {
+		lastFullScan = progress.StartedAt
+	}
+	sum := agentSummary{Time: lastScan, Duration: lastScan.Sub(progress.StartedAt), Files: res.Files,
+		BaselineFiles: len(hashDB), Events: len(res.Events), Errors: scanErrs, Pending: len(pending),
+		Coverage: res.Coverage.Percent()}
+	progress.Scanning = false
+	progress.Dir = ""
+	activeRoots = nil
+	dbMu.Unlock()
+	agentReportScan(sum)
+	shipScanSummary(sum)
+
+	saveReportStats()
+	pingDeadman(scanErrs)
+	runHTTPChecks()
+
+	log.Println("文件检查完成 -.-")
+}
+
+// applyScanResult 记录扫描结果：发送警报、更新基线并保存
+func applyScanResult(res scanResult) {
+	// 退出过程中中止的遍历不完整，没走到的文件会被误判为删除
+	if shuttingDown() {
+		return
+	}
+	changesDetected := len(res.Events) > 0
+
+	// 更新校验时间；文件已恢复原状时撤销等待确认的变动
+	verifiedAt := now()
+	dbMu.Lock()
+	for _, path := range res.Verified {
+		if e, ok := hashDB[path]; ok {
+			e.LastVerified = verifiedAt
+		}
+		delete(pending, path)
+	}
+	for path, h := range res.Rehashed {
+		if e, ok := hashDB[path]; ok {
+			e.Hash = h
+		}
+	}
+	for path, d := range res.Digests {
+		if e, ok := hashDB[path]; ok {
+			e.Digests = d
+		}
+	}
+	for path, m := range res.Meta {
+		if e, ok := hashDB[path]; ok {
+			e.Meta = m
+		}
+	}
+	for _, ev := range res.Silent {
+		applyEvent(ev)
+	}
+	roots := monitorDirs
+	dbMu.Unlock()
+
+	if !manualAccept {
+		snapshotBeforeBulk(len(res.Events), "自动")
+	}
+
+	// 整棵新出现的目录树合并成一条警报
+	trees := groupNewTrees(res.Events, roots)
+	grouped := make(map[int]bool)
+	for _, idx := range trees {
+		for _, i := range idx {
+			grouped[i] = true
+		}
+	}
+
+	for i, ev := range res.Events {
+		if !grouped[i] {
+			record(ev, true)
+		}
+	}
+
+	treeRoots := make([]string, 0, len(trees))
+	for root := range trees {
+		treeRoots = append(treeRoots, root)
+	}
+	sort.Strings(treeRoots)
+	for _, root := range treeRoots {
+		var recorded []Event
+		for _, i := range trees[root] {
+			if ev, ok := record(res.Events[i], false); ok {
+				recorded = append(recorded, ev)
+			}
+		}
+		if len(recorded) == 0 {
+			continue
+		}
+		n := Notification{Severity: sevInfo, Text: formatNewTree(root, recorded), Events: recorded}
+		for _, ev := range recorded {
+			n.Severity = maxSeverity(n.Severity, ev.Severity)
+		}
+		alert(n)
+	}
+
+	flushScanEvents()
+	finishMountScan()
+	reportViolations(res.Violations, res.Partial)
+
+	// 校验时间每次扫描都会更新，因此总是保存
+	if changesDetected || len(res.Verified) > 0 {
+		if err := saveHashDB(); err != nil {
+			log.Printf("保存哈希数据库错误: %v", err)
+		}
+	}
+	snapshotVerified(res.Verified)
+}
+
+func withinAny(path string, dirs []string) bool {
+	for _, d := range dirs {
+		if path == d || underDir(path, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanResult 是一次扫描与基线比较的结果，不包含任何副作用
+type scanResult struct {
+	Events   []Event
+	Verified []string                     // 内容与基线一致的文件
+	Rehashed map[string]string            // 按基线中的旧算法校验一致、需要换成当前算法哈希的文件
+	Digests  map[string]map[string]string // 内容未变、需要补齐附加摘要的文件
+	Meta     map[string]*FileMeta         // 需要补齐属性的旧基线记录
+	Silent   []Event                      // 按属性策略不报警、直接写入基线的变动
+	Errors   []string
+	Files    int
+	Coverage *coverageStats
+
+	Violations []policyViolation // 属主策略违规
+	Partial    bool              // 只扫描了部分路径
+
+	denied *permissionTracker // 单个根目录的权限问题，合并后汇总输出
+
+	ExcludeHits map[string]*excludeStat // 各排除规则的命中数
+}
+
+// scanTree 遍历目录并与哈希数据库比较，只返回差异，不修改数据库也不发送警报
+func scanTree(dirs []string) scanResult {
+	return scanPaths(dirs, false)
+}
+
+// progressEnter 和 progressLeave 维护扫描进度中正在扫描的根目录列表
+func progressEnter(dir string) {
+	dbMu.Lock()
+	activeRoots = append(activeRoots, dir)
+	progress.Dir = strings.Join(activeRoots, ", ")
+	dbMu.Unlock()
+}
+
+func progressLeave(dir string) {
+	dbMu.Lock()
+	for i, d := range activeRoots {
+		if d == dir {
+			activeRoots = append(activeRoots[:i], activeRoots[i+1:]...)
+			break
+		}
+	}
+	progress.Dir = strings.Join(activeRoots, ", ")
+	dbMu.Unlock()
+}
+
+// scanRoot 扫描一个根目录，可以与其他根目录并发执行
+func scanRoot(dir string, partial bool) (res scanResult) {
+	res.Coverage = newCoverageStats()
+	res.denied = &permissionTracker{}
+	res.ExcludeHits = make(map[string]*excludeStat)
+	res.Rehashed = make(map[string]string)
+	res.Digests = make(map[string]map[string]string)
+	res.Meta = make(map[string]*FileMeta)
+	cov := res.Coverage
+	denied := res.denied
+	scanErr := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		log.Print(msg)
+		res.Errors = append(res.Errors, strings.TrimSpace(msg))
+	}
+
+	// 根目录不可用时跳过，等待下次扫描重试
+	if !partial && !checkRoot(dir) {
+		res.Errors = append(res.Errors, "监控目录不可用: "+dir)
+		return res
+	}
+
+	progressEnter(dir)
+	defer progressLeave(dir)
+	started := time.Now()
+	defer func() {
+		// 单个目录内部出错时只影响该目录，其余目录的结果照常使用
+		if r := recover(); r != nil {
+			scanErr("扫描目录 %s 时发生内部错误: %v\n", dir, r)
+		}
+		log.Printf("目录 %s 扫描完成: %d 个文件，耗时 %s", dir, res.Files, time.Since(started).Round(time.Millisecond))
+	}()
+
+	// mu 保护 res 及其中的统计，遍历和各哈希任务都在持有 mu 时更新结果
+	var mu sync.Mutex
+	pool := newHashPool(hashWorkers, func(err error) {
+		mu.Lock()
+		scanErr("扫描目录 %s 时发生内部错误: %v\n", dir, err)
+		mu.Unlock()
+	})
+	defer pool.wait()
+
+	mw := newMountWalker(dir)
+	excl := excludesFor(dir)
+	// 按需检查子目录时，忽略文件从所在的监控目录开始读取
+	ignoreRoot := dir
+	if root, ok := rootFor(dir, monitorDirs); ok {
+		ignoreRoot = root
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if shuttingDown() {
+			return filepath.SkipAll
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			// 子目录或文件无法访问时记录原因并继续扫描其余部分
+			reason := skipReasonFor(err)
+			if reason == skipPermission {
+				denied.add(path)
+			} else {
+				scanErr("访问错误 %s: %v\n", path, err)
+			}
+			cov.skip(reason, path, 0)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// 跳过目录本身，只检查目录内容
+		if path == dir && info.IsDir() {
+			mw.visitDir(path, info)
+			res.Violations = append(res.Violations, checkOwnership(path, info)...)
+			return nil
+		}
+
+		// 检查是否应该排除该文件/目录
+		if pattern, ok := matcher.Match(path, excl); ok {
+			countExclude(res.ExcludeHits, pattern, info.IsDir())
+			if info.IsDir() {
+				cov.skip(skipExcludedDir, path, 0)
+				return filepath.SkipDir // 跳过整个目录
+			}
+
+			cov.skip(skipExcluded, path, info.Size())
+			return nil // 跳过单个文件
+		}
+		if _, ok := ignoredByFile(path, ignoreRoot, info.IsDir()); ok {
+			if info.IsDir() {
+				cov.skip(skipIgnoreFile, path, 0)
+				return filepath.SkipDir
+			}
+			cov.skip(skipIgnoreFile, path, info.Size())
+			return nil
+		}
+		if !info.IsDir() && !included(path) {
+			cov.skip(skipNotIncluded, path, info.Size())
+			return nil
+		}
+
+		// 检查文件系统边界
+		if info.IsDir() && mw.visitDir(path, info) {
+			cov.skip(skipOtherFS, path, 0)
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || info.Mode().IsRegular() {
+			res.Violations = append(res.Violations, checkOwnership(path, info)...)
+		}
+
+		// 套接字、命名管道和设备文件只记录类型
+		if h, ok := specialHash(info); ok {
+			cov.skip(skipNonRegular, path, 0)
+			dbMu.Lock()
+			stored, exists := hashDB[path]
+			dbMu.Unlock()
+			switch {
+			case !exists:
+				res.Events = append(res.Events, Event{Type: "new", Path: path, NewHash: h})
+			case stored.Hash != h:
+				res.Events = append(res.Events, Event{Type: "modified", Path: path, OldHash: stored.Hash, NewHash: h})
+			default:
+				res.Verified = append(res.Verified, path)
+			}
+			return nil
+		}
+
+		// 只处理普通文件（跳过目录、符号链接等）
+		if !info.Mode().IsRegular() {
+			if !info.IsDir() {
+				cov.skip(skipNonRegular, path, 0)
+			}
+			return nil
+		}
+
+		// 检查文件大小限制，large_files.mode 为 partial 时按首尾部分计算哈希
+		if overSizeLimit(path, info) && !sampleLargeFiles() {
+			cov.skip(skipSizeLimit, path, info.Size())
+			return nil
+		}
+
+		// 增量扫描：属性与基线完全一致时不重新计算哈希
+		if statFastPath {
+			dbMu.Lock()
+			stored, exists := hashDB[path]
+			unchanged := exists && statUnchanged(stored, info)
+			if unchanged {
+				progress.Files++
+			}
+			dbMu.Unlock()
+			if unchanged {
+				res.Files++
+				cov.statOnly(info.Size())
+				res.Verified = append(res.Verified, path)
+				return nil
+			}
+		}
+
+		// 提交任务时暂时释放 mu，工作池已满时等待任务完成，而任务需要 mu 来合并结果
+		mu.Unlock()
+		pool.submit(func() { hashAndCompare(path, info, &res, &mu, scanErr) })
+		mu.Lock()
+		return nil
+	})
+	pool.wait()
+	// 工作池完成的顺序不固定，按路径排序使各次扫描的事件顺序一致
+	sort.SliceStable(res.Events, func(i, j int) bool { return res.Events[i].Path < res.Events[j].Path })
+
+	if err != nil {
+		scanErr("遍历目录错误 %s: %v\n", dir, err)
+	}
+	return res
+}
+
+// hashAndCompare 在工作池中计算一个普通文件的哈希并与基线比较，结果在持有 mu 时合并到 res
+func hashAndCompare(path string, info os.FileInfo, res *scanResult, mu *sync.Mutex, scanErr func(string, ...interface{})) {
+	if shuttingDown() {
+		return
+	}
+	sampled := sampleLargeFiles() && overSizeLimit(path, info)
+	currentHash, digests, err := hashForBaseline(path, info)
+	if err != nil && skipReasonFor(err) == skipPermission && len(privilegedHelper) > 0 && !sampled {
+		// 无权限时通过特权辅助命令重试
+		currentHash, err = hashWithHelper(path)
+		if err != nil {
+			log.Printf("特权辅助命令读取 %s 失败: %v", path, err)
+			err = os.ErrPermission
+		}
+	}
+	if err != nil {
+		reason := skipReasonFor(err)
+		mu.Lock()
+		if reason == skipPermission {
+			res.denied.add(path)
+		} else {
+			scanErr("计算文件哈希错误 %s: %v\n", path, err)
+		}
+		res.Coverage.skip(reason, path, info.Size())
+		mu.Unlock()
+		return
+	}
+
+	dbMu.Lock()
+	progress.Files++
+	stored, exists := hashDB[path]
+	storedHash := ""
+	var storedStreams, storedDigests map[string]string
+	var storedMeta *FileMeta
+	if exists {
+		storedHash = stored.Hash
+		storedStreams = stored.Streams
+		storedDigests = stored.Digests
+		storedMeta = copyMeta(stored.Meta)
+	}
+	dbMu.Unlock()
+
+	// 检查 NTFS 备用数据流
+	var streamEvents []Event
+	var streamErr error
+	if detectADS && adsSupported {
+		streamEvents, streamErr = scanStreams(path, storedStreams)
+	}
+	same := exists && sameContent(path, storedHash, currentHash)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if sampled {
+		res.Coverage.sampled(info.Size())
+	} else {
+		res.Coverage.hashed(info.Size())
+	}
+	res.Files++
+	if streamErr != nil {
+		scanErr("枚举备用数据流错误 %s: %v\n", path, streamErr)
+	}
+	res.Events = append(res.Events, streamEvents...)
+
+	meta := fileMeta(info)
+	if !exists {
+		// 新文件
+		res.Events = append(res.Events, Event{Type: "new", Path: path, Size: info.Size(), NewHash: currentHash, Digests: digests, NewMeta: meta})
+	} else if !same {
+		// 文件被修改
+		res.Events = append(res.Events, Event{Type: "modified", Path: path, Size: info.Size(), OldHash: storedHash, NewHash: currentHash, Digests: digests,
+			OldMeta: storedMeta, NewMeta: meta})
+	} else {
+		if storedHash != currentHash {
+			res.Rehashed[path] = currentHash
+		}
+		if digests != nil && digestsMissing(storedDigests) {
+			res.Digests[path] = digests
+		}
+		attrs := metaChanges(storedMeta, meta)
+		if meta != nil && (storedMeta == nil || (len(attrs) == 0 && storedMeta.CTime != meta.CTime)) {
+			// 补齐旧基线的属性；状态改变时间变化但内容和属性都没变时也要更新，否则增量扫描每次都会重新计算
+			res.Meta[path] = meta
+		}
+		if len(attrs) > 0 {
+			// 内容未变、属性变化；不计入已校验，否则会撤销等待确认的属性变动
+			res.Events = append(res.Events, Event{Type: "attributes", Path: path, Size: info.Size(), OldHash: currentHash, NewHash: currentHash,
+				OldMeta: storedMeta, NewMeta: meta, Attributes: attrs})
+		} else {
+			res.Verified = append(res.Verified, path)
+		}
+	}
+}
+
+// scanPaths 是 scanTree 的实现；partial 为 true 时只检查给定的文件或子目录，
+// 不做根目录可用性检查，删除检查也只限于这些路径之下
+func scanPaths(dirs []string, partial bool) scanResult {
+	res := scanResult{Coverage: newCoverageStats(), Partial: partial, ExcludeHits: make(map[string]*excludeStat),
+		Rehashed: make(map[string]string), Digests: make(map[string]map[string]string), Meta: make(map[string]*FileMeta)}
+	denied := &permissionTracker{}
+	// 每次扫描重新读取忽略文件
+	resetIgnoreCache()
+
+	// 各根目录在独立的 goroutine 中扫描，一个很大或很慢的目录不会拖慢其他目录
+	parts := make([]scanResult, len(dirs))
+	sem := make(chan struct{}, max(1, parallelRoots))
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			parts[i] = scanRoot(dir, partial)
+		}(i, dir)
+	}
+	wg.Wait()
+
+	for _, part := range parts {
+		res.Events = append(res.Events, part.Events...)
+		res.Verified = append(res.Verified, part.Verified...)
+		for path, h := range part.Rehashed {
+			res.Rehashed[path] = h
+		}
+		for path, d := range part.Digests {
+			res.Digests[path] = d
+		}
+		for path, m := range part.Meta {
+			res.Meta[path] = m
+		}
+		res.Errors = append(res.Errors, part.Errors...)
+		res.Files += part.Files
+		res.Coverage.merge(part.Coverage)
+		res.Violations = append(res.Violations, part.Violations...)
+		denied.merge(part.denied)
+		for pattern, h := range part.ExcludeHits {
+			st := excludeEntry(res.ExcludeHits, pattern)
+			st.Files += h.Files
+			st.Dirs += h.Dirs
+		}
+	}
+
+	// 权限问题汇总输出，不再每个文件每次扫描都记录一行错误
+	if msg := denied.summary(); msg != "" {
+		log.Println(msg)
+		res.Errors = append(res.Errors, fmt.Sprintf("无权限读取 %d 个文件或目录", len(denied.paths)))
+	}
+
+	// 检查是否有文件被删除（同时考虑排除规则）
+	dbMu.Lock()
+	known := make(map[string]string, len(hashDB))
+	for path, e := range hashDB {
+		known[path] = e.Hash
+	}
+	dbMu.Unlock()
+
+	var deleted []string
+	for path := range known {
+		if underUnavailableRoot(path) || underSkippedRoot(path) {
+			continue
+		}
+		if partial && !withinAny(path, dirs) {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			// 检查被删除的文件是否被排除、被忽略文件排除或在 include 范围外，被隔离的文件不算删除
+			if !matcher.Matches(path, excludesFor(path)) && included(path) && !ignoredPath(path) && !quarantinedPath(path) {
+				deleted = append(deleted, path)
+			}
+		}
+	}
+	sort.Strings(deleted)
+	for _, path := range deleted {
+		res.Events = append(res.Events, Event{Type: "deleted", Path: path, OldHash: known[path]})
+	}
+
+	res.Events = pairRenames(res.Events)
+	t := now()
+	for i := range res.Events {
+		res.Events[i].Time = t
+	}
+	res.Events, res.Silent = filterByAttributePolicy(res.Events)
+	return res
+}
+
+// pairRenames 把同一次扫描中哈希相同的“删除”和“新文件”合并为一个重命名/移动事件
+func pairRenames(events []Event) []Event {
+	deletedByHash := make(map[string][]int)
+	for i, ev := range events {
+		if ev.Type == "deleted" {
+			deletedByHash[ev.OldHash] = append(deletedByHash[ev.OldHash], i)
+		}
+	}
+	if len(deletedByHash) == 0 {
+		return events
+	}
+
+	consumed := make(map[int]bool)
+	for i, ev := range events {
+		if ev.Type != "new" {
+			continue
+		}
+		candidates := deletedByHash[ev.NewHash]
+		if len(candidates) == 0 {
+			continue
+		}
+		d := candidates[0]
+		deletedByHash[ev.NewHash] = candidates[1:]
+		consumed[d] = true
+		events[i].Type = "renamed"
+		events[i].OldPath = events[d].Path
+		events[i].OldHash = events[d].OldHash
+	}
+
+	out := events[:0]
+	for i, ev := range events {
+		if !consumed[i] {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// record 处理一次变动：自动模式下直接更新数据库，人工确认模式下放入待确认列表
+// deliverNow 为 false 时只记录不发送，由调用方合并发送；返回整理后的事件和是否需要报警
+func record(ev Event, deliverNow bool) (Event, bool) {
+	if ev.Time.IsZero() {
+		ev.Time = now()
+	}
+	ev.Mount = eventMount(ev.Path)
+	ev.Severity = initialSeverity(ev)
+	var quiet bool
+	if isSpecialEvent(ev) {
+		// 非普通文件不能读取内容（打开命名管道会阻塞），只按类型报警
+		addSignal(&ev, sigSpecialFile)
+	} else if ev.Type == "attributes" {
+		// 内容与基线一致，不需要再检查内容
+	} else {
+		scoreRisk(&ev)
+		checkWebshell(&ev)
+		checkYara(&ev)
+		checkEntropy(&ev)
+		quiet = applyUploadPolicy(&ev)
+		checkSEOFile(&ev)
+		checkSkimmer(&ev)
+		addContentDiff(&ev)
+	}
+	if !isSpecialEvent(ev) {
+		checkPrivilegeGain(&ev)
+		checkNewExecutable(&ev)
+	}
+	if !quiet {
+		escalateRepeated(&ev)
+	}
+	quarantined := !quiet && quarantineEvent(&ev)
+	// 被修改的文件先隔离再恢复：可疑内容留在隔离区，原内容放回原处
+	restored := !quiet && autoRestoreEvent(&ev)
+	if !quarantined && !restored && ev.Type != "deleted" && ev.Stream == "" {
+		snapshotContent(ev.Path, ev.NewHash)
+	}
+
+	dbMu.Lock()
+	recordChurn(ev)
+	reportEventStats(ev)
+	if quarantined || restored {
+		// 文件已移到隔离区或已恢复原内容，基线保持原样，也不需要确认
+	} else if readOnly || (manualAccept && !quiet && !autoAcceptable(ev)) {
+		// 同一变动只报警一次，直到被确认或再次变化
+		if prev, ok := pending[pendingKey(ev)]; ok && prev.Type == ev.Type && prev.NewHash == ev.NewHash && sameMetaKey(prev.NewMeta, ev.NewMeta) {
+			dbMu.Unlock()
+			return ev, false
+		}
+		pending[pendingKey(ev)] = ev
+	} else {
+		applyEvent(ev)
+	}
+	dbMu.Unlock()
+	rememberEvent(ev)
+	agentQueueEvent(ev)
+	shipEvent(ev)
+
+	if quiet {
+		return ev, false
+	}
+	if deliverNow {
+		deliver(ev)
+	}
+	return ev, true
+}
+
+// pendingKey 是待确认列表的键，备用数据流与所属文件分开记录
+func pendingKey(ev Event) string {
+	if ev.Stream != "" {
+		return ev.Path + ":" + ev.Stream
+	}
+	return ev.Path
+}
+
+// applyEvent 把变动写入哈希数据库，调用方需持有 dbMu
+func applyEvent(ev Event) {
+	if ev.OldHash != ev.NewHash && ev.Stream == "" {
+		releaseSnapshot(ev.OldHash)
+	}
+	switch ev.Type {
+	case "stream_new", "stream_modified", "stream_deleted":
+		applyStreamEvent(ev)
+	case "deleted":
+		delete(hashDB, ev.Path)
+	case "renamed":
+		e := hashDB[ev.OldPath]
+		delete(hashDB, ev.OldPath)
+		if e == nil {
+			e = &Entry{FirstSeen: ev.Time}
+		}
+		e.Hash, e.LastChanged, e.LastVerified = ev.NewHash, ev.Time, ev.Time
+		e.Digests, e.Meta = ev.Digests, ev.NewMeta
+		hashDB[ev.Path] = e
+	case "new":
+		hashDB[ev.Path] = &Entry{Hash: ev.NewHash, FirstSeen: ev.Time, LastVerified: ev.Time, LastChanged: ev.Time, Digests: ev.Digests, Meta: ev.NewMeta}
+	case "attributes":
+		if e := hashDB[ev.Path]; e != nil {
+			e.Meta, e.LastVerified = ev.NewMeta, ev.Time
+			// 由内容修改转换来的事件（该目录不监控内容）同时更新哈希
+			if ev.OldHash != ev.NewHash {
+				e.Hash, e.Digests, e.LastChanged = ev.NewHash, ev.Digests, ev.Time
+			}
+		}
+	default:
+		e := hashDB[ev.Path]
+		if e == nil {
+			e = &Entry{FirstSeen: ev.Time}
+			hashDB[ev.Path] = e
+		}
+		e.Hash, e.LastChanged, e.LastVerified = ev.NewHash, ev.Time, ev.Time
+		e.Digests = ev.Digests
+		if ev.NewMeta != nil {
+			e.Meta = ev.NewMeta
+		}
+	}
+}
+
+func formatEvent(ev Event) string {
+	text := describeEvent(ev)
+	if len(ev.Webshell) > 0 {
+		text = "【疑似 WebShell】" + text
+	}
+	if ev.Mount != "" {
+		text += "\n挂载: " + ev.Mount
+	}
+	if len(ev.Signals) > 0 {
+		text += fmt.Sprintf("\n风险: %d (%s)", ev.Risk, strings.Join(ev.Signals, ", "))
+	}
+	for _, f := range ev.Findings {
+		text += "\n可疑特征: " + f
+	}
+	if ev.Diff != "" {
+		text += "\n内容差异:\n" + ev.Diff
+	}
+	return text
+}
+
+func describeEvent(ev Event) string {
+	if isSpecialEvent(ev) {
+		return describeSpecial(ev)
+	}
+	switch ev.Type {
+	case "new":
+		return fmt.Sprintf("发现新文件: %s\n大小: %d bytes\n哈希: %s", ev.Path, ev.Size, ev.NewHash)
+	case "modified":
+		text := fmt.Sprintf("文件被修改: %s\n大小: %d bytes\n原哈希: %s\n新哈希: %s",
+			ev.Path, ev.Size, ev.OldHash, ev.NewHash)
+		// 内容变化时大小和修改时间必然变化，只列出权限和属主
+		var attrs []string
+		for _, a := range metaChanges(ev.OldMeta, ev.NewMeta) {
+			if a == attrMode || a == attrOwner || a == attrGroup {
+				attrs = append(attrs, a)
+			}
+		}
+		if len(attrs) > 0 {
+			text += "\n" + describeMetaChanges(ev.OldMeta, ev.NewMeta, attrs)
+		}
+		return text
+	case "attributes":
+		text := fmt.Sprintf("文件属性被修改: %s\n%s", ev.Path, describeMetaChanges(ev.OldMeta, ev.NewMeta, ev.Attributes))
+		if ev.OldHash != "" && ev.OldHash != ev.NewHash {
+			text += "\n内容也已变化（该目录的属性策略不监控内容）"
+		}
+		return text
+	case "deleted":
+		return fmt.Sprintf("文件被删除: %s", ev.Path)
+	case "renamed":
+		return fmt.Sprintf("文件被移动或重命名: %s -> %s\n大小: %d bytes\n哈希: %s",
+			ev.OldPath, ev.Path, ev.Size, ev.NewHash)
+	case "stream_new":
+		return fmt.Sprintf("发现新的 NTFS 备用数据流: %s:%s\n哈希: %s", ev.Path, ev.Stream, ev.NewHash)
+	case "stream_modified":
+		return fmt.Sprintf("NTFS 备用数据流被修改: %s:%s\n原哈希: %s\n新哈希: %s", ev.Path, ev.Stream, ev.OldHash, ev.NewHash)
+	case "stream_deleted":
+		return fmt.Sprintf("NTFS 备用数据流被删除: %s:%s", ev.Path, ev.Stream)
+	case "policy_violation":
+		return fmt.Sprintf("属主策略违规: %s\n%s", ev.Path, strings.Join(ev.Findings, "\n"))
+	}
+	return fmt.Sprintf("%s: %s", ev.Type, ev.Path)
+}
+
+func alert(n Notification) {
+	// 记录到日志
+	t := now()
+	if n.Time.IsZero() {
+		n.Time = t
+	}
+	riqi := formatTime(t) + " "
+	message := n.Text
+
+	// 一次性命令只在标准错误中输出
+	if oneShot {
+		log.Println("警报:", riqi+message)
+		return
+	}
+
+	rememberAlert(t, message)
+
+	dbMu.Lock()
+	silenced := t.Before(silencedUntil)
+	dbMu.Unlock()
+	shipAlert(n, silenced)
+	appendAuditLog(n, silenced)
+	if silenced {
+		log.Println("警报(已静默):", riqi+message)
+		return
+	}
+	log.Println("警报:", riqi+message)
+
+	dispatch(n)
+}
@@ -0,0 +1,69 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// readMountTable 解析 /proc/self/mountinfo
+func readMountTable() []mountEntry {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return []mountEntry{}
+	}
+	defer f.Close()
+
+	list := []mountEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// 可选字段以单独的 "-" 结束，其后是文件系统类型和挂载来源
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		list = append(list, mountEntry{
+			Point:  unescapeMount(fields[4]),
+			FSType: fields[sep+1],
+			Source: unescapeMount(fields[sep+2]),
+		})
+	}
+	return list
+}
+
+// mountinfo 中空格等字符以 \040 形式的八进制转义
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			v := 0
+			ok := true
+			for _, c := range s[i+1 : i+4] {
+				if c < '0' || c > '7' {
+					ok = false
+					break
+				}
+				v = v*8 + int(c-'0')
+			}
+			if ok {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// 非 Linux 系统暂不读取挂载表，事件中不附带挂载来源
+func readMountTable() []mountEntry {
+	return []mountEntry{}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rootStatus 记录一个监控根目录的可用状态
+type rootStatus struct {
+	dev         uint64
+	haveDev     bool
+	unavailable bool
+	reason      string
+	since       time.Time
+}
+
+var (
+	rootsMu sync.Mutex
+	roots   = make(map[string]*rootStatus)
+)
+
+// checkRoot 在扫描根目录前检查它是否还可用：目录消失、设备号改变（网络挂载被卸载后露出底层目录）
+// 或原本有文件的目录突然变空，都视为不可用，此时跳过该目录，避免产生大量“文件被删除”警报
+func checkRoot(dir string) bool {
+	rootsMu.Lock()
+	st, ok := roots[dir]
+	if !ok {
+		st = &rootStatus{}
+		roots[dir] = st
+	}
+	prev := *st
+	rootsMu.Unlock()
+
+	reason := ""
+	info, err := os.Stat(dir)
+	switch {
+	case err != nil:
+		reason = fmt.Sprintf("无法访问: %v", err)
+	case !info.IsDir():
+		reason = "不是目录"
+	default:
+		if dev, ok := deviceID(info); ok {
+			if prev.haveDev && dev != prev.dev {
+				reason = fmt.Sprintf("设备号由 %d 变为 %d，挂载可能已断开", prev.dev, dev)
+			} else if !prev.haveDev {
+				rootsMu.Lock()
+				st.dev, st.haveDev = dev, true
+				rootsMu.Unlock()
+			}
+		}
+		if reason == "" && rootIsEmpty(dir) && baselineCount(dir) > 0 {
+			reason = "目录为空但基线中有文件，挂载可能已断开"
+		}
+	}
+
+	if reason != "" {
+		if !prev.unavailable {
+			rootsMu.Lock()
+			st.unavailable, st.reason, st.since = true, reason, now()
+			rootsMu.Unlock()
+			alert(Notification{Severity: sevHigh, Text: fmt.Sprintf("监控目录不可用: %s\n原因: %s", dir, reason)})
+		}
+		return false
+	}
+
+	if prev.unavailable {
+		rootsMu.Lock()
+		st.unavailable, st.reason = false, ""
+		rootsMu.Unlock()
+		alert(Notification{Severity: sevWarning, Text: fmt.Sprintf("监控目录已恢复: %s\n不可用时长: %v",
+			dir, time.Since(prev.since).Round(time.Second))})
+	}
+	return true
+}
+
+func rootIsEmpty(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	names, _ := f.Readdirnames(1)
+	return len(names) == 0
+}
+
+// baselineCount 统计基线中位于 dir 下的文件数
+func baselineCount(dir string) int {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	n := 0
+	for path := range hashDB {
+		if underDir(path, dir) {
+			n++
+		}
+	}
+	return n
+}
+
+func underDir(path, dir string) bool {
+	dir = strings.TrimSuffix(dir, string(filepath.Separator))
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// underUnavailableRoot 判断文件是否位于当前不可用的根目录下，这些文件不做删除检查
+func underUnavailableRoot(path string) bool {
+	rootsMu.Lock()
+	defer rootsMu.Unlock()
+	for dir, st := range roots {
+		if st.unavailable && underDir(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func unavailableRoots() []string {
+	rootsMu.Lock()
+	defer rootsMu.Unlock()
+	var list []string
+	for dir, st := range roots {
+		if st.unavailable {
+			list = append(list, dir)
+		}
+	}
+	return list
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// messageData 是通知消息模板可用的字段
+type messageData struct {
+	Host     string
+	Time     string
+	Severity string
+	Text     string
+	Title    string // 警报文本的首行
+	Events   []Event
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"join":  strings.Join,
+}
+
+// parseMessageTemplate 解析渠道配置中的消息模板，为空时使用渠道的默认模板
+func parseMessageTemplate(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析消息模板错误: %v", err)
+	}
+	return t, nil
+}
+
+func renderMessage(t *template.Template, n Notification) (string, error) {
+	data := messageData{
+		Host:     hostname(),
+		Time:     formatTime(n.Time),
+		Severity: n.Severity,
+		Text:     n.Text,
+		Title:    strings.SplitN(n.Text, "\n", 2)[0],
+		Events:   n.Events,
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
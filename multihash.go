@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 附加摘要（extra_hashes）：除主哈希外为每个文件再保存几种摘要（例如 md5、sha1），
+// 基线可以直接与厂商发布的 MD5 清单、威胁情报的恶意文件哈希列表比对，不需要重新扫描。
+// 附加摘要与主哈希在同一次读取中计算，只用于比对，不用于判断文件是否变化
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// 十六进制长度对应的摘要算法，用于识别清单和哈希列表中的哈希
+var digestByLength = map[int]string{32: "md5", 40: "sha1", 64: "sha256", 128: "sha512"}
+
+var (
+	extraHashes []string
+
+	manifestPath string
+	hashListPath string
+)
+
+// applyExtraHashes 检查附加摘要的配置，与主哈希相同的算法不重复保存
+func applyExtraHashes(names []string) error {
+	extraHashes = nil
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if digestAlgorithms[name] == nil {
+			return fmt.Errorf("不支持的附加摘要 %s（可选 md5、sha1、sha256、sha512）", name)
+		}
+		if name == hashAlgorithm || containsString(extraHashes, name) {
+			continue
+		}
+		extraHashes = append(extraHashes, name)
+	}
+	sort.Strings(extraHashes)
+	return nil
+}
+
+// hashFileDigests 一次读取文件，同时计算主哈希和附加摘要
+func hashFileDigests(path string) (string, map[string]string, error) {
+	if len(extraHashes) == 0 {
+		h, err := calculateFileHash(path)
+		return h, nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	primary := hashAlgorithms[hashAlgorithm]()
+	writers := []io.Writer{primary}
+	extras := make([]hash.Hash, len(extraHashes))
+	for i, name := range extraHashes {
+		extras[i] = digestAlgorithms[name]()
+		writers = append(writers, extras[i])
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), throttled(file)); err != nil {
+		return "", nil, err
+	}
+	digests := make(map[string]string, len(extras))
+	for i, name := range extraHashes {
+		digests[name] = hex.EncodeToString(extras[i].Sum(nil))
+	}
+	return algoPrefix(hashAlgorithm) + hex.EncodeToString(primary.Sum(nil)), digests, nil
+}
+
+// digestsMissing 判断基线记录是否缺少配置的附加摘要（新加入 extra_hashes 后需要补齐）
+func digestsMissing(stored map[string]string) bool {
+	for _, name := range extraHashes {
+		if stored[name] == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// entryDigest 返回基线记录中指定算法的摘要（十六进制，不带前缀），主哈希也参与查找
+func entryDigest(e *Entry, algo string) (string, bool) {
+	if hashAlgoOf(e.Hash) == algo {
+		return strings.TrimPrefix(e.Hash, algoPrefix(algo)), true
+	}
+	d, ok := e.Digests[algo]
+	return d, ok && d != ""
+}
+
+func isHexDigest(s string) bool {
+	if digestByLength[len(s)] == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+type manifestMismatch struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Baseline string `json:"baseline"`
+}
+
+type manifestOutput struct {
+	Command    string             `json:"command"`
+	Status     string             `json:"status"`
+	Manifest   string             `json:"manifest"`
+	Root       string             `json:"root"`
+	Checked    int                `json:"checked"`
+	Mismatched []manifestMismatch `json:"mismatched"`
+	Missing    []string           `json:"missing"` // 清单中有、基线中没有的文件
+	NoDigest   int                `json:"no_digest"`
+	Errors     []string           `json:"errors"`
+}
+
+// readManifest 读取厂商的哈希清单，返回相对路径到哈希的映射。支持 md5sum/sha1sum 的输出格式
+// （"哈希  路径"，路径前可带 *），以及 WordPress checksums API 的 JSON（{"checksums": {路径: 哈希}}）
+func readManifest(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取清单: %v", err)
+	}
+	out := make(map[string]string)
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		var doc struct {
+			Checksums map[string]string `json:"checksums"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil || doc.Checksums == nil {
+			if err := json.Unmarshal(data, &doc.Checksums); err != nil {
+				return nil, fmt.Errorf("解析清单错误: %v", err)
+			}
+		}
+		for rel, h := range doc.Checksums {
+			out[filepath.ToSlash(rel)] = strings.ToLower(h)
+		}
+		return out, nil
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("清单第 %d 行格式错误: %s", n, line)
+		}
+		rel := strings.TrimPrefix(strings.TrimSpace(fields[1]), "*")
+		out[filepath.ToSlash(strings.TrimPrefix(rel, "./"))] = strings.ToLower(fields[0])
+	}
+	return out, sc.Err()
+}
+
+// runCheckManifest 用基线中保存的摘要核对厂商发布的哈希清单，不读取线上文件
+func runCheckManifest() int {
+	out := manifestOutput{Command: "check-manifest", Manifest: manifestPath,
+		Mismatched: []manifestMismatch{}, Missing: []string{}, Errors: []string{}}
+	fail := func(err error) int {
+		out.Status = "error"
+		out.Errors = append(out.Errors, err.Error())
+		writeOutput(out, func(w io.Writer) { fmt.Fprintln(w, err) })
+		return exitError
+	}
+	if err := prepareOneShot(); err != nil {
+		return fail(err)
+	}
+	root := compareDir
+	if root == "" {
+		if len(monitorDirs) != 1 {
+			return fail(fmt.Errorf("有 %d 个监控目录，请用 -against 指定清单对应的目录", len(monitorDirs)))
+		}
+		root = monitorDirs[0]
+	}
+	out.Root = root
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		return fail(err)
+	}
+
+	rels := make([]string, 0, len(manifest))
+	for rel := range manifest {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	noDigest := make(map[string]int)
+	for _, rel := range rels {
+		want := manifest[rel]
+		algo := digestByLength[len(want)]
+		if !isHexDigest(want) {
+			out.Errors = append(out.Errors, fmt.Sprintf("清单中 %s 的哈希无法识别: %s", rel, want))
+			continue
+		}
+		e, ok := hashDB[filepath.Join(root, filepath.FromSlash(rel))]
+		if !ok {
+			out.Missing = append(out.Missing, rel)
+			continue
+		}
+		got, ok := entryDigest(e, algo)
+		if !ok {
+			out.NoDigest++
+			noDigest[algo]++
+			continue
+		}
+		out.Checked++
+		if got != want {
+			out.Mismatched = append(out.Mismatched, manifestMismatch{Path: rel, Expected: want, Baseline: got})
+		}
+	}
+	for algo, n := range noDigest {
+		out.Errors = append(out.Errors, fmt.Sprintf("基线中有 %d 个文件没有 %s 摘要，请在 extra_hashes 中加入 %s 并完成一次扫描", n, algo, algo))
+	}
+	sort.Strings(out.Errors)
+
+	code := exitClean
+	out.Status = "clean"
+	if len(out.Mismatched) > 0 {
+		code, out.Status = exitChanges, "changes"
+	}
+	if len(out.Errors) > 0 && out.Checked == 0 {
+		code, out.Status = exitError, "error"
+	}
+
+	writeOutput(out, func(w io.Writer) {
+		for _, m := range out.Mismatched {
+			fmt.Fprintf(w, "不一致  %s\n        清单 %s\n        基线 %s\n", m.Path, m.Expected, m.Baseline)
+		}
+		for _, p := range out.Missing {
+			fmt.Fprintln(w, "缺少   ", p)
+		}
+		for _, e := range out.Errors {
+			fmt.Fprintln(w, "错误:", e)
+		}
+		fmt.Fprintf(w, "%s 与清单 %s 核对：一致 %d，不一致 %d，基线中缺少 %d\n",
+			root, manifestPath, out.Checked-len(out.Mismatched), len(out.Mismatched), len(out.Missing))
+	})
+	return code
+}
+
+type hashMatch struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+}
+
+// readHashList 读取威胁情报的哈希列表：每行一个哈希，取第一列，# 开头为注释，
+// 也接受 "算法:哈希" 的写法；返回的键为算法，值为哈希集合
+func readHashList(path string) (map[string]map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取哈希列表: %v", err)
+	}
+	defer file.Close()
+
+	list := make(map[string]map[string]bool)
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		h := strings.ToLower(strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' || r == ';' })[0])
+		algo := ""
+		if i := strings.Index(h, ":"); i > 0 {
+			algo, h = h[:i], h[i+1:]
+		}
+		if !isHexDigest(h) {
+			continue
+		}
+		if algo == "" {
+			algo = digestByLength[len(h)]
+		}
+		if list[algo] == nil {
+			list[algo] = make(map[string]bool)
+		}
+		list[algo][h] = true
+	}
+	return list, sc.Err()
+}
+
+// runMatchHashes 在基线中查找与威胁情报哈希列表相同的文件，不读取线上文件
+func runMatchHashes() int {
+	out := struct {
+		Command string      `json:"command"`
+		Status  string      `json:"status"`
+		List    string      `json:"list"`
+		Hashes  int         `json:"hashes"`
+		Matches []hashMatch `json:"matches"`
+		Errors  []string    `json:"errors"`
+	}{Command: "match-hashes", List: hashListPath, Matches: []hashMatch{}, Errors: []string{}}
+	fail := func(err error) int {
+		out.Status = "error"
+		out.Errors = append(out.Errors, err.Error())
+		writeOutput(out, func(w io.Writer) { fmt.Fprintln(w, err) })
+		return exitError
+	}
+	if err := prepareOneShot(); err != nil {
+		return fail(err)
+	}
+	list, err := readHashList(hashListPath)
+	if err != nil {
+		return fail(err)
+	}
+
+	stored := make(map[string]int)
+	for path, e := range hashDB {
+		for algo, set := range list {
+			if d, ok := entryDigest(e, algo); ok {
+				stored[algo]++
+				if set[d] {
+					out.Matches = append(out.Matches, hashMatch{Path: path, Algorithm: algo, Hash: d})
+				}
+			}
+		}
+	}
+	algos := make([]string, 0, len(list))
+	for algo, set := range list {
+		out.Hashes += len(set)
+		algos = append(algos, algo)
+	}
+	sort.Strings(algos)
+	for _, algo := range algos {
+		if stored[algo] == 0 {
+			out.Errors = append(out.Errors, fmt.Sprintf("列表中有 %d 个 %s 哈希，但基线没有保存 %s 摘要（在 extra_hashes 中加入）", len(list[algo]), algo, algo))
+		}
+	}
+	sort.Slice(out.Matches, func(i, j int) bool { return out.Matches[i].Path < out.Matches[j].Path })
+
+	code := exitClean
+	out.Status = "clean"
+	if len(out.Matches) > 0 {
+		code, out.Status = exitChanges, "matches"
+	}
+	if len(out.Errors) == len(algos) && len(algos) > 0 {
+		code, out.Status = exitError, "error"
+	}
+
+	writeOutput(out, func(w io.Writer) {
+		for _, m := range out.Matches {
+			fmt.Fprintf(w, "命中   %s (%s %s)\n", m.Path, m.Algorithm, m.Hash)
+		}
+		for _, e := range out.Errors {
+			fmt.Fprintln(w, "警告:", e)
+		}
+		fmt.Fprintf(w, "基线中 %d 个文件与 %s 中的 %d 个哈希比对，命中 %d 个\n", len(hashDB), hashListPath, out.Hashes, len(out.Matches))
+	})
+	return code
+}
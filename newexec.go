@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// 新可执行文件检测（new_executables）：监控目录下任何位置出现脚本（默认 .php、.jsp、.aspx、.sh）
+// 或可执行文件（文件头为 ELF/PE/Mach-O/#!，或带可执行位）时单独加信号并提升级别，
+// 不受普通“新文件”警报级别的影响。文件移动到这些扩展名也算新出现
+
+// NewExecutableConfig 配置新可执行文件检测
+type NewExecutableConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Extensions []string `json:"extensions"` // 视为可执行的扩展名，默认 .php、.jsp、.aspx、.sh
+	Severity   string   `json:"severity"`   // 命中时的级别，默认 high
+	Channels   []string `json:"channels"`   // 命中时额外通知的渠道
+}
+
+const sigNewExecutable = "new_executable"
+
+var defaultNewExecutableExts = []string{".php", ".jsp", ".aspx", ".sh"}
+
+var (
+	newExecutables   = NewExecutableConfig{Severity: sevHigh}
+	newExecutableExt map[string]bool
+)
+
+func applyNewExecutableConfig(c NewExecutableConfig) error {
+	if c.Severity == "" {
+		c.Severity = sevHigh
+	}
+	if !validSeverity(c.Severity) {
+		return fmt.Errorf("new_executables.severity 无效: %s", c.Severity)
+	}
+	list := c.Extensions
+	if len(list) == 0 {
+		list = defaultNewExecutableExts
+	}
+	exts := make(map[string]bool)
+	for _, ext := range list {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts[ext] = true
+	}
+	newExecutables = c
+	newExecutableExt = exts
+	return nil
+}
+
+// executableReason 返回文件被视为可执行的原因，不是可执行文件时返回空字符串
+func executableReason(ev *Event) string {
+	if ext := strings.ToLower(filepath.Ext(ev.Path)); newExecutableExt[ext] {
+		return "扩展名 " + ext
+	}
+	if ev.NewMeta != nil && ev.NewMeta.Mode.IsRegular() && ev.NewMeta.Mode&execBits != 0 {
+		return "可执行位 " + formatMode(ev.NewMeta.Mode)
+	}
+	if head, err := readHead(ev.Path, 4); err == nil {
+		for _, m := range executableMagic {
+			if bytes.HasPrefix(head, m) {
+				return "可执行文件头"
+			}
+		}
+	}
+	return ""
+}
+
+// checkNewExecutable 为新出现的脚本或可执行文件追加信号和发现
+func checkNewExecutable(ev *Event) {
+	if !newExecutables.Enabled || ev.Stream != "" {
+		return
+	}
+	var reason string
+	switch ev.Type {
+	case "new":
+		reason = executableReason(ev)
+	case "renamed":
+		// 只有移动后才变成可执行扩展名的算新出现，移动已有的可执行文件不算
+		ext := strings.ToLower(filepath.Ext(ev.Path))
+		if newExecutableExt[ext] && !newExecutableExt[strings.ToLower(filepath.Ext(ev.OldPath))] {
+			reason = "扩展名 " + ext
+		}
+	default:
+		return
+	}
+	if reason == "" {
+		return
+	}
+	addSignal(ev, sigNewExecutable)
+	ev.Findings = append(ev.Findings, fmt.Sprintf("新出现的可执行文件（%s）", reason))
+	ev.Severity = maxSeverity(ev.Severity, newExecutables.Severity)
+	for _, ch := range newExecutables.Channels {
+		if !containsString(ev.extra, ch) {
+			ev.extra = append(ev.extra, ch)
+		}
+	}
+}
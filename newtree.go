@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const defaultNewTreeThreshold = 10
+
+// newTreeThreshold 是新目录中文件数达到多少时合并为一条警报，负数表示不合并
+var newTreeThreshold = defaultNewTreeThreshold
+
+// groupNewTrees 找出整棵新出现的目录树：目录下在基线中没有任何文件。返回 树根 -> 事件下标
+func groupNewTrees(events []Event, roots []string) map[string][]int {
+	if newTreeThreshold < 0 {
+		return nil
+	}
+
+	// 基线中已有文件的所有上级目录
+	knownDirs := make(map[string]bool)
+	dbMu.Lock()
+	for path := range hashDB {
+		for d := filepath.Dir(path); !knownDirs[d]; d = filepath.Dir(d) {
+			knownDirs[d] = true
+			if d == filepath.Dir(d) {
+				break
+			}
+		}
+	}
+	dbMu.Unlock()
+
+	groups := make(map[string][]int)
+	for i, ev := range events {
+		if ev.Type != "new" {
+			continue
+		}
+		top := ""
+		for d := filepath.Dir(ev.Path); !knownDirs[d] && !containsString(roots, d) && d != filepath.Dir(d); d = filepath.Dir(d) {
+			top = d
+		}
+		if top != "" {
+			groups[top] = append(groups[top], i)
+		}
+	}
+
+	for top, idx := range groups {
+		if len(idx) < newTreeThreshold {
+			delete(groups, top)
+		}
+	}
+	return groups
+}
+
+func formatNewTree(root string, events []Event) string {
+	var total int64
+	exts := make(map[string]int)
+	for _, ev := range events {
+		total += ev.Size
+		ext := strings.ToLower(filepath.Ext(ev.Path))
+		if ext == "" {
+			ext = "(无扩展名)"
+		}
+		exts[ext]++
+	}
+
+	names := make([]string, 0, len(exts))
+	for ext := range exts {
+		names = append(names, ext)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if exts[names[i]] != exts[names[j]] {
+			return exts[names[i]] > exts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > 5 {
+		names = names[:5]
+	}
+	parts := make([]string, len(names))
+	for i, ext := range names {
+		parts[i] = fmt.Sprintf("%s %d", ext, exts[ext])
+	}
+
+	return fmt.Sprintf("发现新目录: %s\n文件数: %d\n总大小: %d bytes\n主要扩展名: %s",
+		root, len(events), total, strings.Join(parts, ", "))
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRecentAlerts = 50
+
+type alertRecord struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// channelState 记录一个通知渠道最近一次发送的结果
+type channelState struct {
+	Name      string    `json:"name"`
+	OK        bool      `json:"ok"`
+	LastSent  time.Time `json:"last_sent,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Notification 是发往各通知渠道的一条警报
+type Notification struct {
+	Time     time.Time
+	Severity string
+	Text     string
+	Events   []Event
+	// Extra 列出除默认渠道外还需额外通知的渠道，例如升级策略指定的渠道
+	Extra []string
+	// Channels 非空时只发送到这些渠道，不再使用默认渠道
+	Channels []string
+	// HTML 非空时邮件使用它作为正文，例如汇总报告
+	HTML string
+}
+
+// Notifier 由各通知渠道实现
+type Notifier interface {
+	Send(n Notification) error
+}
+
+const (
+	deliveryPerEvent = "per_event"
+	deliveryPerScan  = "per_scan"
+)
+
+var (
+	deliveryMode = deliveryPerEvent
+	scanEvents   []Event
+
+	notifyMu     sync.Mutex
+	recentAlerts []alertRecord
+	channels     = map[string]*channelState{"log": {Name: "log", OK: true}}
+
+	// notifiers 保存已配置的通知渠道，defaultChannels 为每条警报默认发送的渠道。
+	// 由 notifierMu 保护，重新加载配置时整体替换，替换前的 map 和切片不再修改
+	notifierMu      sync.Mutex
+	notifiers       = make(map[string]Notifier)
+	defaultChannels []string
+	sendWG          sync.WaitGroup
+)
+
+// NotifyConfig 汇总各通知渠道的配置
+type NotifyConfig struct {
+	Webhook  WebhookConfig  `json:"webhook"`
+	Email    EmailConfig    `json:"email"`
+	DingTalk DingTalkConfig `json:"dingtalk"`
+	WeCom    WeComConfig    `json:"wecom"`
+	Telegram TelegramConfig `json:"telegram"`
+	Slack    SlackConfig    `json:"slack"`
+	SNMP     SNMPConfig     `json:"snmp"`
+
+	Alertmanager AlertmanagerConfig `json:"alertmanager"`
+
+	// QuietHours 按渠道名配置静默时段，例如 {"email": [{"from": "22:00", "to": "07:00"}]}
+	QuietHours map[string][]QuietWindow `json:"quiet_hours"`
+
+	// MinSeverity 按渠道名配置最低级别，例如 {"dingtalk": "high"}，低于该级别的警报不发送到该渠道
+	MinSeverity map[string]string `json:"min_severity"`
+}
+
+// configureNotifiers 按配置重新注册所有通知渠道，配置有错误时保留原有的渠道。
+// 重新加载配置时也会调用，新读取的凭据随之生效
+func configureNotifiers(c NotifyConfig) error {
+	reg := make(map[string]Notifier)
+	var defaults []string
+	register := func(name string, n Notifier) {
+		reg[name] = n
+		defaults = append(defaults, name)
+	}
+
+	if len(c.Webhook.URLs) > 0 {
+		register("webhook", newWebhookNotifier(c.Webhook))
+	}
+	if c.Email.Host != "" {
+		en, err := newEmailNotifier(c.Email)
+		if err != nil {
+			return fmt.Errorf("邮件通知配置错误: %v", err)
+		}
+		register("email", en)
+	}
+	if c.DingTalk.URL != "" {
+		dn, err := newDingTalkNotifier(c.DingTalk)
+		if err != nil {
+			return fmt.Errorf("钉钉通知配置错误: %v", err)
+		}
+		register("dingtalk", dn)
+	}
+	if c.WeCom.RobotURL != "" || c.WeCom.CorpID != "" {
+		wn, err := newWeComNotifier(c.WeCom)
+		if err != nil {
+			return fmt.Errorf("企业微信通知配置错误: %v", err)
+		}
+		register("wecom", wn)
+	}
+	if c.Telegram.BotToken != "" {
+		tn, err := newTelegramNotifier(c.Telegram)
+		if err != nil {
+			return fmt.Errorf("Telegram 通知配置错误: %v", err)
+		}
+		register("telegram", tn)
+	}
+	if c.Slack.WebhookURL != "" {
+		register("slack", newSlackNotifier(c.Slack))
+	}
+	if len(c.SNMP.Targets) > 0 {
+		sn, err := newSNMPNotifier(c.SNMP)
+		if err != nil {
+			return fmt.Errorf("SNMP trap 配置错误: %v", err)
+		}
+		register("snmp", sn)
+	}
+	if len(c.Alertmanager.URLs) > 0 {
+		an, err := newAlertmanagerNotifier(c.Alertmanager)
+		if err != nil {
+			return fmt.Errorf("Alertmanager 配置错误: %v", err)
+		}
+		register("alertmanager", an)
+	}
+	quiet, err := parseQuietHours(c.QuietHours)
+	if err != nil {
+		return fmt.Errorf("静默时段配置错误: %v", err)
+	}
+	if err := validateChannelMinSeverity(c.MinSeverity); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+
+	notifierMu.Lock()
+	notifiers, defaultChannels = reg, defaults
+	quietHours, channelMinSeverity = quiet, c.MinSeverity
+	notifierMu.Unlock()
+
+	// 去掉已删除的渠道的状态，保留 log 和仍在使用的渠道最近一次的发送结果
+	notifyMu.Lock()
+	for name := range channels {
+		if _, ok := reg[name]; !ok && name != "log" {
+			delete(channels, name)
+		}
+	}
+	for name := range reg {
+		if _, ok := channels[name]; !ok {
+			channels[name] = &channelState{Name: name, OK: true}
+		}
+	}
+	notifyMu.Unlock()
+	return nil
+}
+
+// currentNotifiers 返回当前的通知渠道和默认渠道，调用方不能修改返回值
+func currentNotifiers() (map[string]Notifier, []string) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	return notifiers, defaultChannels
+}
+
+// dispatch 异步发送到默认渠道和额外指定的渠道，不阻塞扫描
+func dispatch(n Notification) {
+	registered, defaults := currentNotifiers()
+	targets := append([]string(nil), defaults...)
+	if len(n.Channels) > 0 {
+		targets = append([]string(nil), n.Channels...)
+	}
+	for _, name := range n.Extra {
+		if !containsString(targets, name) {
+			targets = append(targets, name)
+		}
+	}
+
+	for _, name := range targets {
+		notifier, ok := registered[name]
+		if !ok {
+			reportChannel(name, fmt.Errorf("未配置的通知渠道"))
+			continue
+		}
+		// 心跳等显式指定渠道的通知不按级别过滤
+		if len(n.Channels) == 0 && belowChannelMin(name, n) {
+			continue
+		}
+		if holdForQuietHours(name, n) {
+			continue
+		}
+		sendWG.Add(1)
+		go func(name string, notifier Notifier) {
+			defer sendWG.Done()
+			err := notifier.Send(n)
+			if err != nil {
+				log.Printf("通知渠道 %s 发送失败: %v", name, err)
+			}
+			reportChannel(name, err)
+		}(name, notifier)
+	}
+}
+
+func rememberAlert(t time.Time, message string) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	recentAlerts = append(recentAlerts, alertRecord{Time: t, Message: message})
+	if len(recentAlerts) > maxRecentAlerts {
+		recentAlerts = recentAlerts[len(recentAlerts)-maxRecentAlerts:]
+	}
+	channels["log"].LastSent = t
+}
+
+// reportChannel 由各通知渠道在发送后调用，用于展示渠道健康状况
+func reportChannel(name string, err error) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	st, ok := channels[name]
+	if !ok {
+		st = &channelState{Name: name}
+		channels[name] = st
+	}
+	st.OK = err == nil
+	if err != nil {
+		st.LastError = err.Error()
+	} else {
+		st.LastSent = now()
+		st.LastError = ""
+	}
+}
+
+func snapshotAlerts() []alertRecord {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+	return append([]alertRecord(nil), recentAlerts...)
+}
+
+func snapshotChannels() []channelState {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	list := make([]channelState, 0, len(channels))
+	for _, st := range channels {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// deliver 按投递模式发送事件：逐条立即发送，或缓存到本次扫描结束后合并发送
+func deliver(ev Event) {
+	if deliveryMode == deliveryPerScan || deliveryMode == deliveryDigest {
+		notifyMu.Lock()
+		scanEvents = append(scanEvents, ev)
+		notifyMu.Unlock()
+		return
+	}
+	alert(Notification{Severity: ev.Severity, Text: formatEvent(ev), Events: []Event{ev}, Extra: ev.extra})
+}
+
+// flushScanEvents 在每次扫描结束时调用，把缓存的事件合并成一条警报
+func flushScanEvents() {
+	notifyMu.Lock()
+	events := scanEvents
+	scanEvents = nil
+	notifyMu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	text := formatScanSummary(events)
+	if deliveryMode == deliveryDigest {
+		text = formatDigest(events)
+	}
+	n := Notification{Severity: sevInfo, Text: text, Events: events}
+	for _, ev := range events {
+		n.Severity = maxSeverity(n.Severity, ev.Severity)
+		for _, name := range ev.extra {
+			if !containsString(n.Extra, name) {
+				n.Extra = append(n.Extra, name)
+			}
+		}
+	}
+	alert(n)
+}
+
+func formatScanSummary(events []Event) string {
+	groups := map[string][]string{}
+	for _, ev := range events {
+		if ev.Type == "renamed" {
+			groups[ev.Type] = append(groups[ev.Type], ev.OldPath+" -> "+ev.Path)
+			continue
+		}
+		if ev.Stream != "" {
+			groups[ev.Type] = append(groups[ev.Type], ev.Path+":"+ev.Stream)
+			continue
+		}
+		groups[ev.Type] = append(groups[ev.Type], ev.Path)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "本次扫描发现 %d 个变动", len(events))
+	for _, g := range eventTypeTitles {
+		paths := groups[g.typ]
+		if len(paths) == 0 {
+			continue
+		}
+		sort.Strings(paths)
+		fmt.Fprintf(&b, "\n%s (%d):", g.title, len(paths))
+		for _, p := range paths {
+			b.WriteString("\n  " + p)
+		}
+	}
+	return b.String()
+}
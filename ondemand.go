@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+type checkVerdict struct {
+	Path    string   `json:"path"`
+	Status  string   `json:"status"` // clean, changes, error
+	Files   int      `json:"files"`
+	Changes []Event  `json:"changes"`
+	Errors  []string `json:"errors"`
+}
+
+// checkPath 立即检查一个文件或子目录并同步返回结果，发现的变动与定时扫描一样记录和报警
+func checkPath(path string) (checkVerdict, error) {
+	path = filepath.Clean(path)
+	v := checkVerdict{Path: path, Changes: []Event{}, Errors: []string{}}
+
+	dbMu.Lock()
+	dirs := monitorDirs
+	dbMu.Unlock()
+	root, ok := rootFor(path, dirs)
+	if !ok {
+		return v, fmt.Errorf("%s 不在监控目录中", path)
+	}
+	if rule, at, ok := matcher.MatchUnder(path, root, excludesFor(path)); ok {
+		return v, fmt.Errorf("%s 匹配排除规则 %s，不受监控", at, rule)
+	}
+	info, err := os.Lstat(path)
+	isDir := err == nil && info.IsDir()
+	if r, at, ok := ignoredUnder(path, root, isDir); ok {
+		return v, fmt.Errorf("%s 匹配忽略文件中的规则 %s，不受监控", at, r)
+	}
+	if err == nil && !isDir && !included(path) {
+		return v, fmt.Errorf("%s 不匹配 include 规则，不受监控", path)
+	}
+
+	// 等待正在进行的扫描结束，避免同时修改数据库
+	scanMu.Lock()
+	defer scanMu.Unlock()
+
+	log.Printf("按需检查: %s", path)
+	// 按需检查总是重新计算哈希
+	statFastPath = false
+	res := scanPaths([]string{path}, true)
+	applyScanResult(res)
+
+	v.Files = res.Files
+	v.Errors = append(v.Errors, res.Errors...)
+	v.Changes = append(v.Changes, res.Events...)
+	v.Status = "clean"
+	if len(v.Changes) > 0 {
+		v.Status = "changes"
+	}
+	if len(v.Errors) > 0 {
+		v.Status = "error"
+	}
+	return v, nil
+}
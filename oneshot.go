@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 一次性命令的退出码，供 Ansible、Salt、CI 等自动化工具判断结果
+const (
+	exitClean   = 0 // 没有变动
+	exitChanges = 1 // 发现变动
+	exitError   = 2 // 出错
+)
+
+var (
+	verifyMode   bool
+	diffMode     bool
+	reportMode   bool
+	coverageMode bool
+	outputFormat string
+	staleAfter   time.Duration
+	// oneShot 为 true 时警报只写入标准错误，不发送到通知渠道
+	oneShot bool
+)
+
+type verifyOutput struct {
+	Command  string   `json:"command"`
+	Status   string   `json:"status"` // clean, changes, error
+	Files    int      `json:"files"`
+	New      int      `json:"new"`
+	Modified int      `json:"modified"`
+	Deleted  int      `json:"deleted"`
+	Renamed  int      `json:"renamed"`
+	Changes  []Event  `json:"changes"`
+	Errors   []string `json:"errors"`
+}
+
+type reportOutput struct {
+	Command     string              `json:"command"`
+	Status      string              `json:"status"`
+	HashDB      string              `json:"hash_db"`
+	Updated     *time.Time          `json:"updated,omitempty"`
+	Files       int                 `json:"files"`
+	Directories map[string]int      `json:"directories"`
+	StaleAfter  string              `json:"stale_after"`
+	Stale       []staleEntry        `json:"stale"`
+	Excludes    []excludeStat       `json:"excludes,omitempty"`    // 上次完整扫描中各排除规则的命中数
+	Suggestions []excludeSuggestion `json:"suggestions,omitempty"` // 根据变动统计建议的排除规则
+	Errors      []string            `json:"errors"`
+}
+
+// staleEntry 是超过 -stale-after 未重新校验的基线记录，常见原因是文件超过大小限制或无法读取
+type staleEntry struct {
+	Path         string    `json:"path"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastVerified time.Time `json:"last_verified"`
+	LastChanged  time.Time `json:"last_changed"`
+}
+
+// prepareOneShot 为一次性命令加载配置和基线，日志只输出到标准错误
+func prepareOneShot() error {
+	if err := prepareOneShotConfig(); err != nil {
+		return err
+	}
+	n, err := loadHashDB()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("哈希数据库不存在或为空: %s", hashDBFile)
+	}
+	return nil
+}
+
+// prepareOneShotConfig 只加载配置和监控目录，不要求基线存在
+func prepareOneShotConfig() error {
+	oneShot = true
+	log.SetFlags(0)
+	log.SetOutput(timestampWriter{os.Stderr})
+
+	if configFile != "" || len(configEnv()) > 0 {
+		loadConfigFromFile()
+	}
+	expandDirs()
+	if len(monitorDirs) == 0 {
+		return fmt.Errorf("错误：未指定任何监控目录")
+	}
+	return nil
+}
+
+// runVerify 与基线比较但不更新基线，detail 为 true 时输出每个文件的哈希差异
+func runVerify(command string, detail bool) int {
+	out := verifyOutput{Command: command, Changes: []Event{}, Errors: []string{}}
+	if err := prepareOneShot(); err != nil {
+		out.Status = "error"
+		out.Errors = append(out.Errors, err.Error())
+		writeOutput(out, func(w io.Writer) { fmt.Fprintln(w, err) })
+		return exitError
+	}
+
+	beginScan(false)
+	res := scanTree(monitorDirs)
+	out.Files = res.Files
+	out.Errors = append(out.Errors, res.Errors...)
+	for _, ev := range res.Events {
+		out.Changes = append(out.Changes, ev)
+		switch ev.Type {
+		case "new":
+			out.New++
+		case "modified":
+			out.Modified++
+		case "deleted":
+			out.Deleted++
+		case "renamed":
+			out.Renamed++
+		}
+	}
+
+	code := exitClean
+	out.Status = "clean"
+	if len(out.Changes) > 0 {
+		code, out.Status = exitChanges, "changes"
+	}
+	if len(out.Errors) > 0 {
+		code, out.Status = exitError, "error"
+	}
+
+	writeOutput(out, func(w io.Writer) {
+		for _, ev := range out.Changes {
+			if detail {
+				fmt.Fprintln(w, describeEvent(ev))
+				fmt.Fprintln(w)
+			} else if ev.Type == "renamed" {
+				fmt.Fprintf(w, "%-8s %s -> %s\n", ev.Type, ev.OldPath, ev.Path)
+			} else {
+				fmt.Fprintf(w, "%-8s %s\n", ev.Type, ev.Path)
+			}
+		}
+		for _, e := range out.Errors {
+			fmt.Fprintln(w, "错误:", e)
+		}
+		fmt.Fprintf(w, "检查了 %d 个文件：新增 %d，修改 %d，删除 %d，移动 %d，错误 %d\n",
+			out.Files, out.New, out.Modified, out.Deleted, out.Renamed, len(out.Errors))
+	})
+	return code
+}
+
+// runReport 输出当前基线的统计信息
+func runReport() int {
+	out := reportOutput{Command: "report", HashDB: hashDBFile, Directories: map[string]int{},
+		StaleAfter: staleAfter.String(), Stale: []staleEntry{}, Errors: []string{}}
+	if err := prepareOneShot(); err != nil {
+		out.Status = "error"
+		out.Errors = append(out.Errors, err.Error())
+		writeOutput(out, func(w io.Writer) { fmt.Fprintln(w, err) })
+		return exitError
+	}
+
+	out.Status = "ok"
+	out.Files = len(hashDB)
+	if info, err := os.Stat(hashDBFile); err == nil {
+		t := info.ModTime().In(timeLoc)
+		out.Updated = &t
+	}
+	cutoff := time.Now().Add(-staleAfter)
+	for path, e := range hashDB {
+		if e.LastVerified.Before(cutoff) {
+			out.Stale = append(out.Stale, staleEntry{Path: path, FirstSeen: e.FirstSeen,
+				LastVerified: e.LastVerified, LastChanged: e.LastChanged})
+		}
+
+		root := "其他"
+		for _, dir := range monitorDirs {
+			if underDir(path, dir) {
+				root = dir
+				break
+			}
+		}
+		out.Directories[root]++
+	}
+
+	sort.Slice(out.Stale, func(i, j int) bool { return out.Stale[i].LastVerified.Before(out.Stale[j].LastVerified) })
+	out.Excludes, _ = loadExcludeStats()
+	out.Suggestions = suggestExcludes(loadChurnStats(), hashDB, monitorDirs)
+
+	writeOutput(out, func(w io.Writer) {
+		fmt.Fprintf(w, "哈希数据库: %s\n", out.HashDB)
+		if out.Updated != nil {
+			fmt.Fprintf(w, "更新时间: %s\n", formatTime(*out.Updated))
+		}
+		fmt.Fprintf(w, "基线文件数: %d\n", out.Files)
+		dirs := make([]string, 0, len(out.Directories))
+		for d := range out.Directories {
+			dirs = append(dirs, d)
+		}
+		sort.Strings(dirs)
+		for _, d := range dirs {
+			fmt.Fprintf(w, "  %-40s %d\n", filepath.Clean(d), out.Directories[d])
+		}
+
+		fmt.Fprintf(w, "超过 %v 未重新校验的文件: %d\n", staleAfter, len(out.Stale))
+		for i, e := range out.Stale {
+			if i == 50 {
+				fmt.Fprintf(w, "  ... 另有 %d 个，使用 -output json 查看全部\n", len(out.Stale)-i)
+				break
+			}
+			last := "从未校验"
+			if !e.LastVerified.IsZero() {
+				last = formatTime(e.LastVerified)
+			}
+			fmt.Fprintf(w, "  %s  %s\n", last, e.Path)
+		}
+
+		if len(out.Excludes) > 0 {
+			fmt.Fprintln(w, "排除规则命中（上次完整扫描）:")
+			for _, st := range out.Excludes {
+				fmt.Fprintf(w, "  %-40s 文件 %d  目录 %d  基线中被隐藏 %d\n", st.Pattern, st.Files, st.Dirs, st.Baseline)
+			}
+		}
+		if len(out.Suggestions) > 0 {
+			fmt.Fprintln(w, "建议的排除规则（运行 -suggest-excludes -apply 写入配置文件）:")
+			formatSuggestions(w, out.Suggestions)
+		}
+	})
+	return exitClean
+}
+
+// writeOutput 按 -output 输出 JSON 或可读文本
+func writeOutput(v interface{}, text func(io.Writer)) {
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	text(os.Stdout)
+}
+
+type coverageOutput struct {
+	Command      string         `json:"command"`
+	Status       string         `json:"status"`
+	Percent      float64        `json:"percent"`
+	BytesPercent float64        `json:"bytes_percent"`
+	Coverage     *coverageStats `json:"coverage,omitempty"`
+	Errors       []string       `json:"errors"`
+}
+
+// runCoverage 扫描一次并报告实际受保护的文件比例和被跳过的文件
+func runCoverage() int {
+	out := coverageOutput{Command: "coverage", Errors: []string{}}
+	if err := prepareOneShot(); err != nil {
+		out.Status = "error"
+		out.Errors = append(out.Errors, err.Error())
+		writeOutput(out, func(w io.Writer) { fmt.Fprintln(w, err) })
+		return exitError
+	}
+
+	beginScan(false)
+	res := scanTree(monitorDirs)
+	out.Status = "ok"
+	out.Coverage = res.Coverage
+	out.Percent = res.Coverage.Percent()
+	out.BytesPercent = res.Coverage.BytesPercent()
+	out.Errors = append(out.Errors, res.Errors...)
+
+	writeOutput(out, func(w io.Writer) { res.Coverage.writeText(w) })
+	if len(out.Errors) > 0 {
+		return exitError
+	}
+	return exitClean
+}
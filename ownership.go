@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OwnershipPolicy 声明一个目录下文件的属主要求，每次扫描检查，违规作为策略警报单独报告，不影响内容基线
+type OwnershipPolicy struct {
+	Dir           string   `json:"dir"`
+	Owner         string   `json:"owner"`           // 所有文件必须属于该用户
+	Group         string   `json:"group"`           // 所有文件必须属于该组
+	NotWritableBy []string `json:"not_writable_by"` // 这些用户（通常是 web 服务器用户）不能有写权限
+	Severity      string   `json:"severity"`        // 默认 high
+}
+
+// policyViolation 是一条属主策略违规
+type policyViolation struct {
+	Path     string
+	Rule     string
+	Severity string
+}
+
+type ownershipRule struct {
+	OwnershipPolicy
+	uid, gid int // -1 表示不检查
+	writers  []fileAccessor
+}
+
+// fileAccessor 是判断写权限所需的用户信息
+type fileAccessor struct {
+	name string
+	uid  int
+	gids []int
+}
+
+const maxViolationLines = 20
+
+var (
+	ownershipRules []ownershipRule
+	// knownViolations 记录已报告过的违规，同一违规只报警一次，由 dbMu 保护
+	knownViolations = make(map[string]bool)
+)
+
+func applyOwnershipPolicies(policies []OwnershipPolicy) error {
+	var rules []ownershipRule
+	for i, p := range policies {
+		if p.Dir == "" {
+			return fmt.Errorf("第 %d 条属主策略缺少 dir", i+1)
+		}
+		if !ownershipSupported {
+			log.Println("当前系统不支持属主策略检查，已忽略 ownership_policy")
+			return nil
+		}
+		if p.Severity == "" {
+			p.Severity = sevHigh
+		}
+		if !validSeverity(p.Severity) {
+			return fmt.Errorf("属主策略 %s 的级别无效: %s", p.Dir, p.Severity)
+		}
+		r := ownershipRule{OwnershipPolicy: p, uid: -1, gid: -1}
+		r.Dir = filepath.Clean(p.Dir)
+
+		var err error
+		if p.Owner != "" {
+			if r.uid, err = lookupUID(p.Owner); err != nil {
+				return fmt.Errorf("属主策略 %s: %v", p.Dir, err)
+			}
+		}
+		if p.Group != "" {
+			if r.gid, err = lookupGID(p.Group); err != nil {
+				return fmt.Errorf("属主策略 %s: %v", p.Dir, err)
+			}
+		}
+		for _, name := range p.NotWritableBy {
+			a, err := lookupAccessor(name)
+			if err != nil {
+				return fmt.Errorf("属主策略 %s: %v", p.Dir, err)
+			}
+			r.writers = append(r.writers, a)
+		}
+		rules = append(rules, r)
+	}
+	ownershipRules = rules
+	return nil
+}
+
+// checkOwnership 检查文件或目录是否符合所在目录的属主策略
+func checkOwnership(path string, info os.FileInfo) []policyViolation {
+	if len(ownershipRules) == 0 {
+		return nil
+	}
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return nil
+	}
+	mode := info.Mode().Perm()
+
+	var out []policyViolation
+	for _, r := range ownershipRules {
+		if path != r.Dir && !underDir(path, r.Dir) {
+			continue
+		}
+		if r.uid >= 0 && uid != r.uid {
+			out = append(out, policyViolation{path, fmt.Sprintf("属主应为 %s，实际为 %s", r.Owner, userName(uid)), r.Severity})
+		}
+		if r.gid >= 0 && gid != r.gid {
+			out = append(out, policyViolation{path, fmt.Sprintf("属组应为 %s，实际为 %s", r.Group, groupName(gid)), r.Severity})
+		}
+		for _, a := range r.writers {
+			if canWrite(a, uid, gid, mode) {
+				out = append(out, policyViolation{path, fmt.Sprintf("%s 可写（%s %s:%s）", a.name, mode, userName(uid), groupName(gid)), r.Severity})
+			}
+		}
+	}
+	return out
+}
+
+func canWrite(a fileAccessor, uid, gid int, mode os.FileMode) bool {
+	switch {
+	case a.uid == 0:
+		return false // root 总是可写，检查没有意义
+	case a.uid == uid:
+		return mode&0200 != 0
+	}
+	for _, g := range a.gids {
+		if g == gid {
+			return mode&0020 != 0
+		}
+	}
+	return mode&0002 != 0
+}
+
+// reportViolations 对新出现的违规发送一条汇总警报；完整扫描后清除已修复的违规记录
+func reportViolations(violations []policyViolation, partial bool) {
+	current := make(map[string]bool, len(violations))
+	var fresh []policyViolation
+
+	dbMu.Lock()
+	for _, v := range violations {
+		key := v.Path + "\x00" + v.Rule
+		current[key] = true
+		if !knownViolations[key] {
+			knownViolations[key] = true
+			fresh = append(fresh, v)
+		}
+	}
+	if !partial {
+		for key := range knownViolations {
+			if !current[key] {
+				delete(knownViolations, key)
+			}
+		}
+	}
+	dbMu.Unlock()
+
+	if len(fresh) == 0 {
+		return
+	}
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].Path < fresh[j].Path })
+
+	n := Notification{Severity: sevInfo}
+	lines := make([]string, 0, maxViolationLines+1)
+	for i, v := range fresh {
+		n.Severity = maxSeverity(n.Severity, v.Severity)
+		n.Events = append(n.Events, Event{Type: "policy_violation", Path: v.Path, Severity: v.Severity, Findings: []string{v.Rule}, Time: now()})
+		if i < maxViolationLines {
+			lines = append(lines, v.Path+": "+v.Rule)
+		}
+	}
+	if len(fresh) > maxViolationLines {
+		lines = append(lines, fmt.Sprintf("... 另有 %d 项", len(fresh)-maxViolationLines))
+	}
+	n.Text = fmt.Sprintf("属主策略违规 %d 项:\n%s", len(fresh), strings.Join(lines, "\n"))
+	alert(n)
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+const ownershipSupported = true
+
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+func lookupUID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+func lookupGID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// lookupAccessor 查询用户的 uid 和所属的全部组
+func lookupAccessor(name string) (fileAccessor, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return fileAccessor{}, err
+	}
+	a := fileAccessor{name: name}
+	if a.uid, err = strconv.Atoi(u.Uid); err != nil {
+		return a, err
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		gids = []string{u.Gid}
+	}
+	for _, g := range gids {
+		if id, err := strconv.Atoi(g); err == nil {
+			a.gids = append(a.gids, id)
+		}
+	}
+	return a, nil
+}
+
+func userName(uid int) string {
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(uid)
+}
+
+func groupName(gid int) string {
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		return g.Name
+	}
+	return strconv.Itoa(gid)
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// Windows 使用 ACL 管理权限，属主策略只在类 Unix 系统上检查
+const ownershipSupported = false
+
+var errOwnershipUnsupported = errors.New("Windows 不支持属主策略")
+
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func lookupUID(name string) (int, error) { return 0, errOwnershipUnsupported }
+
+func lookupGID(name string) (int, error) { return 0, errOwnershipUnsupported }
+
+func lookupAccessor(name string) (fileAccessor, error) {
+	return fileAccessor{}, errOwnershipUnsupported
+}
+
+func userName(uid int) string { return strconv.Itoa(uid) }
+
+func groupName(gid int) string { return strconv.Itoa(gid) }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	// privilegedHelper 是无权限读取时用来重试的命令，例如 ["sudo", "-n", "/usr/bin/sha256sum"]，
+	// 文件路径作为最后一个参数传入，输出的第一个字段作为哈希值
+	privilegedHelper []string
+
+	deniedMu   sync.Mutex
+	deniedSeen = make(map[string]bool)
+)
+
+// permissionTracker 汇总一次扫描中无权限读取的路径
+type permissionTracker struct {
+	paths []string
+	fresh int
+}
+
+func (pt *permissionTracker) add(path string) {
+	pt.paths = append(pt.paths, path)
+
+	// 每个路径只在第一次遇到时写一行日志
+	deniedMu.Lock()
+	seen := deniedSeen[path]
+	deniedSeen[path] = true
+	deniedMu.Unlock()
+	if !seen {
+		pt.fresh++
+		log.Printf("无权限读取 %s", path)
+	}
+}
+
+// merge 合并另一个根目录的统计
+func (pt *permissionTracker) merge(o *permissionTracker) {
+	if o == nil {
+		return
+	}
+	pt.paths = append(pt.paths, o.paths...)
+	pt.fresh += o.fresh
+}
+
+// summary 返回扫描摘要中的权限问题部分，没有问题时返回空字符串
+func (pt *permissionTracker) summary() string {
+	if len(pt.paths) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "无权限读取 %d 个文件或目录（本次新增 %d 个），这些文件未受保护", len(pt.paths), pt.fresh)
+	for i, p := range pt.paths {
+		if i == 5 {
+			fmt.Fprintf(&b, "\n  ... 另有 %d 个，使用 -coverage 查看", len(pt.paths)-i)
+			break
+		}
+		b.WriteString("\n  " + p)
+	}
+	b.WriteString("\n建议: " + privilegeHint())
+	return b.String()
+}
+
+func privilegeHint() string {
+	if runtime.GOOS == "windows" {
+		return "以管理员身份运行服务，或在 NTFS 权限中为运行账户授予读取权限"
+	}
+	name := "当前用户"
+	if u, err := user.Current(); err == nil {
+		if u.Uid == "0" {
+			return "已以 root 运行，请检查 SELinux/AppArmor 策略或文件系统挂载选项"
+		}
+		name = u.Username
+	}
+	hint := fmt.Sprintf("以 root 运行，或为 %s 添加读取权限，例如 setfacl -R -m u:%s:rX <目录>", name, name)
+	if len(privilegedHelper) == 0 {
+		hint += "，也可以配置 privileged_helper 通过 sudo 读取"
+	}
+	return hint
+}
+
+// hashWithHelper 通过特权辅助命令计算文件哈希
+func hashWithHelper(path string) (string, error) {
+	if len(privilegedHelper) == 0 {
+		return "", fmt.Errorf("未配置 privileged_helper")
+	}
+	args := append(append([]string(nil), privilegedHelper[1:]...), path)
+	out, err := exec.Command(privilegedHelper[0], args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("特权辅助命令失败: %v", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("特权辅助命令没有输出")
+	}
+	// 辅助命令应输出与 hash_algorithm 相同算法的十六进制哈希
+	return algoPrefix(hashAlgorithm) + strings.ToLower(fields[0]), nil
+}
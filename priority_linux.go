@@ -0,0 +1,50 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// lowerPriority 调整所有线程的 nice 值和 I/O 调度类别。Linux 上这两项都按线程生效，
+// 之后创建的线程从已有线程继承
+func lowerPriority(nice int, ioClass string, ioLevel int) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	prio := 0
+	switch ioClass {
+	case "idle":
+		prio = ioprioClassIdle << ioprioClassShift
+	case "best-effort":
+		prio = ioprioClassBE<<ioprioClassShift | ioLevel
+	}
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		if nice > 0 {
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil {
+				return fmt.Errorf("设置 nice 值: %v", err)
+			}
+		}
+		if prio != 0 {
+			if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+				return fmt.Errorf("设置 I/O 优先级: %v", errno)
+			}
+		}
+	}
+	return nil
+}
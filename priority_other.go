@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+func lowerPriority(nice int, ioClass string, ioLevel int) error {
+	return fmt.Errorf("throttle.nice 和 throttle.io_class 只在 Linux 上生效")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// 权限提升检测：文件获得 setuid/setgid 位，或原来不可执行的文件变成可执行，是留后门的常见手法。
+// 内容同时被修改时这类变化很容易淹没在普通的修改警报中，因此单独加信号并提升级别；
+// 属性策略不监控权限的目录也照样报警
+
+const (
+	sigSetuid  = "setuid"
+	sigExecBit = "exec_bit"
+)
+
+const execBits = 0111
+
+// privilegeGains 返回文件新获得的特权属性，old 为 nil 表示新文件（只检查 setuid/setgid）
+func privilegeGains(old, cur *FileMeta) (suid, exec bool) {
+	if cur == nil || !cur.Mode.IsRegular() {
+		return false, false
+	}
+	special := cur.Mode & (os.ModeSetuid | os.ModeSetgid)
+	if old == nil {
+		return special != 0, false
+	}
+	suid = special&^old.Mode != 0
+	exec = old.Mode&execBits == 0 && cur.Mode&execBits != 0
+	return suid, exec
+}
+
+// checkPrivilegeGain 为获得 setuid/setgid 或可执行位的变动追加信号，setuid/setgid 定为 critical，可执行位定为 high
+func checkPrivilegeGain(ev *Event) {
+	var old *FileMeta
+	switch ev.Type {
+	case "new":
+	case "modified", "attributes":
+		if ev.OldMeta == nil {
+			return
+		}
+		old = ev.OldMeta
+	default:
+		return
+	}
+	suid, exec := privilegeGains(old, ev.NewMeta)
+	if suid {
+		bits := ""
+		if ev.NewMeta.Mode&os.ModeSetuid != 0 && (old == nil || old.Mode&os.ModeSetuid == 0) {
+			bits = "setuid"
+		}
+		if ev.NewMeta.Mode&os.ModeSetgid != 0 && (old == nil || old.Mode&os.ModeSetgid == 0) {
+			if bits != "" {
+				bits += "/"
+			}
+			bits += "setgid"
+		}
+		addSignal(ev, sigSetuid)
+		ev.Findings = append(ev.Findings, fmt.Sprintf("获得 %s 位: %s", bits, formatMode(ev.NewMeta.Mode)))
+		ev.Severity = maxSeverity(ev.Severity, sevCritical)
+	}
+	if exec {
+		addSignal(ev, sigExecBit)
+		ev.Findings = append(ev.Findings, fmt.Sprintf("变为可执行: %s -> %s", formatMode(old.Mode), formatMode(ev.NewMeta.Mode)))
+		ev.Severity = maxSeverity(ev.Severity, sevHigh)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// 最小的 protobuf 编解码，只支持 proto/webmonitor.proto 中用到的 varint、double 和长度前缀类型
+
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+type pbWriter struct {
+	buf []byte
+}
+
+func (w *pbWriter) tag(field, wire int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wire))
+}
+
+// 与 proto3 一致，零值字段不编码
+func (w *pbWriter) int(field int, v int64) {
+	if v != 0 {
+		w.tag(field, pbVarint)
+		w.buf = binary.AppendUvarint(w.buf, uint64(v))
+	}
+}
+
+func (w *pbWriter) double(field int, v float64) {
+	if v != 0 {
+		w.tag(field, pbFixed64)
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+	}
+}
+
+func (w *pbWriter) string(field int, s string) {
+	if s != "" {
+		w.bytes(field, []byte(s))
+	}
+}
+
+func (w *pbWriter) strings(field int, list []string) {
+	for _, s := range list {
+		w.bytes(field, []byte(s))
+	}
+}
+
+// bytes 总是写入字段，嵌套消息（包括空消息）也用它编码
+func (w *pbWriter) bytes(field int, b []byte) {
+	w.tag(field, pbBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+type pbField struct {
+	Num  int
+	Wire int
+	Int  uint64 // varint 和定长字段的值
+	Data []byte // 长度前缀字段的内容
+}
+
+// pbParse 把一条消息拆成字段列表，未知字段照常返回，由调用方忽略
+func pbParse(b []byte) ([]pbField, error) {
+	var out []pbField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("protobuf: 字段标签无效")
+		}
+		b = b[n:]
+		f := pbField{Num: int(key >> 3), Wire: int(key & 7)}
+		switch f.Wire {
+		case pbVarint:
+			f.Int, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("protobuf: varint 无效")
+			}
+			b = b[n:]
+		case pbFixed64:
+			if len(b) < 8 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			f.Int = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case pbFixed32:
+			if len(b) < 4 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			f.Int = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case pbBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, io.ErrUnexpectedEOF
+			}
+			f.Data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return nil, fmt.Errorf("protobuf: 不支持的字段类型 %d", f.Wire)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// grpcFrame 按 gRPC 的长度前缀格式封装一条消息（不压缩）
+func grpcFrame(msg []byte) []byte {
+	out := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(out[1:], uint32(len(msg)))
+	return append(out, msg...)
+}
+
+// readGRPCMessage 读取一条 gRPC 消息，流结束时返回 io.EOF
+func readGRPCMessage(r io.Reader, limit int) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("grpc: 不支持压缩的消息")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if int64(n) > int64(limit) {
+		return nil, fmt.Errorf("grpc: 消息长度 %d 超过限制", n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return msg, nil
+}
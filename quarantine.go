@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 隔离（quarantine）：新增或被修改的文件命中隔离规则（例如 uploads 下新出现的 .php、风险分数达到 80）时，
+// 立即移到隔离目录并去掉执行和写权限，索引中记录原路径、哈希和属性，可以用 -restore-quarantine 放回。
+// 被隔离的新文件不写入基线；被修改的文件保留原基线记录，文件不存在期间不报删除
+
+// QuarantineConfig 配置隔离目录和隔离规则，rules 为空表示不隔离
+type QuarantineConfig struct {
+	Dir   string           `json:"dir"` // 隔离目录，默认为哈希数据库路径加 .quarantine，不能位于监控目录中
+	Rules []QuarantineRule `json:"rules"`
+}
+
+// QuarantineRule 的各项条件同时满足时隔离，留空的条件不限制
+type QuarantineRule struct {
+	Dirs     []string `json:"dirs"`     // 只隔离这些目录下的文件
+	Patterns []string `json:"patterns"` // 文件名通配符，例如 *.php
+	Types    []string `json:"types"`    // new、modified，默认两者
+	MinRisk  int      `json:"min_risk"` // 风险分数达到该值
+	Signals  []string `json:"signals"`  // 命中其中任一风险信号
+}
+
+// quarantineRecord 是隔离索引中的一条记录
+type quarantineRecord struct {
+	ID       string     `json:"id"`
+	Path     string     `json:"path"` // 原路径
+	File     string     `json:"file"` // 隔离目录中的文件
+	Type     string     `json:"type"` // 触发隔离的事件类型
+	Hash     string     `json:"hash"`
+	Meta     *FileMeta  `json:"meta,omitempty"`
+	Rule     int        `json:"rule"` // 命中的规则序号，从 1 开始
+	Risk     int        `json:"risk,omitempty"`
+	Signals  []string   `json:"signals,omitempty"`
+	Time     time.Time  `json:"time"`
+	Restored *time.Time `json:"restored,omitempty"`
+}
+
+var (
+	quarantine          QuarantineConfig
+	quarantineMu        sync.Mutex
+	listQuarantineMode  bool
+	restoreQuarantineID string
+)
+
+func applyQuarantineConfig(c QuarantineConfig) error {
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if len(r.Dirs) == 0 && len(r.Patterns) == 0 && r.MinRisk == 0 && len(r.Signals) == 0 {
+			return fmt.Errorf("第 %d 条隔离规则没有任何条件，至少需要 dirs、patterns、min_risk 或 signals 之一", i+1)
+		}
+		for j, dir := range r.Dirs {
+			r.Dirs[j] = filepath.Clean(dir)
+		}
+		for _, p := range r.Patterns {
+			if _, err := filepath.Match(p, ""); err != nil {
+				return fmt.Errorf("第 %d 条隔离规则的通配符 %q 无效", i+1, p)
+			}
+		}
+		for _, t := range r.Types {
+			if t != "new" && t != "modified" {
+				return fmt.Errorf("第 %d 条隔离规则的类型 %q 无效（可选 new、modified）", i+1, t)
+			}
+		}
+		for _, s := range r.Signals {
+			if _, ok := riskWeights[s]; !ok {
+				return fmt.Errorf("第 %d 条隔离规则中的风险信号 %q 未知", i+1, s)
+			}
+		}
+	}
+	if c.Dir != "" {
+		c.Dir = filepath.Clean(c.Dir)
+	}
+	quarantine = c
+	return nil
+}
+
+func quarantineDir() string {
+	if quarantine.Dir != "" {
+		return quarantine.Dir
+	}
+	return hashDBFile + ".quarantine"
+}
+
+func quarantineIndexFile() string {
+	return filepath.Join(quarantineDir(), "index.json")
+}
+
+// checkQuarantineDir 确认隔离目录不在监控目录中，否则隔离的文件会被当作新文件
+func checkQuarantineDir() error {
+	if len(quarantine.Rules) == 0 {
+		return nil
+	}
+	dir, err := filepath.Abs(quarantineDir())
+	if err != nil {
+		return err
+	}
+	for _, root := range monitorDirs {
+		if dir == root || underDir(dir, root) {
+			return fmt.Errorf("隔离目录 %s 位于监控目录 %s 中", dir, root)
+		}
+	}
+	return nil
+}
+
+// matchQuarantineRule 返回事件命中的第一条隔离规则的序号（从 1 开始），0 表示不隔离
+func matchQuarantineRule(ev Event) int {
+	if ev.Type != "new" && ev.Type != "modified" || ev.Stream != "" {
+		return 0
+	}
+	for i, r := range quarantine.Rules {
+		if len(r.Types) > 0 && !containsString(r.Types, ev.Type) {
+			continue
+		}
+		if len(r.Dirs) > 0 && !withinAny(ev.Path, r.Dirs) {
+			continue
+		}
+		if len(r.Patterns) > 0 && !matchesAnyName(filepath.Base(ev.Path), r.Patterns) {
+			continue
+		}
+		if ev.Risk < r.MinRisk {
+			continue
+		}
+		if len(r.Signals) > 0 && !hasAnySignal(ev.Signals, r.Signals) {
+			continue
+		}
+		return i + 1
+	}
+	return 0
+}
+
+func matchesAnyName(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(p), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnySignal(signals, want []string) bool {
+	for _, s := range want {
+		if containsString(signals, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantineEvent 在事件命中隔离规则时隔离文件，返回 true 表示已隔离，事件不再写入基线或待确认列表
+func quarantineEvent(ev *Event) bool {
+	if readOnly || oneShot || len(quarantine.Rules) == 0 {
+		return false
+	}
+	rule := matchQuarantineRule(*ev)
+	if rule == 0 {
+		return false
+	}
+
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	records, err := loadQuarantineIndex()
+	if err != nil {
+		log.Printf("读取隔离索引错误，未隔离 %s: %v", ev.Path, err)
+		return false
+	}
+	// 已经从隔离区放回的同一内容不再隔离
+	for _, r := range records {
+		if r.Path == ev.Path && r.Hash == ev.NewHash && r.Restored != nil {
+			return false
+		}
+	}
+
+	rec := quarantineRecord{ID: quarantineID(ev), Path: ev.Path, Type: ev.Type, Hash: ev.NewHash, Meta: ev.NewMeta,
+		Rule: rule, Risk: ev.Risk, Signals: ev.Signals, Time: now()}
+	rec.File = filepath.Join(quarantineDir(), rec.ID)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(rec.File); os.IsNotExist(err) {
+			break
+		}
+		rec.ID = fmt.Sprintf("%s-%d", quarantineID(ev), n)
+		rec.File = filepath.Join(quarantineDir(), rec.ID)
+	}
+	if err := os.MkdirAll(quarantineDir(), 0700); err != nil {
+		log.Printf("创建隔离目录错误，未隔离 %s: %v", ev.Path, err)
+		return false
+	}
+	if err := moveFile(ev.Path, rec.File); err != nil {
+		log.Printf("隔离文件 %s 失败: %v", ev.Path, err)
+		ev.Findings = append(ev.Findings, fmt.Sprintf("命中第 %d 条隔离规则，但隔离失败: %v", rule, err))
+		return false
+	}
+	// 只保留属主的读权限，隔离区中的文件不能被执行或改写
+	os.Chmod(rec.File, 0400)
+
+	records = append(records, rec)
+	if err := saveQuarantineIndex(records); err != nil {
+		log.Printf("保存隔离索引错误: %v", err)
+	}
+	ev.Quarantine = rec.ID
+	ev.Findings = append(ev.Findings, fmt.Sprintf("已按第 %d 条隔离规则移到隔离区（%s），可用 -restore-quarantine %s 放回", rule, rec.File, rec.ID))
+	log.Printf("已隔离 %s -> %s", ev.Path, rec.File)
+	return true
+}
+
+func quarantineID(ev *Event) string {
+	h := hashDigest(ev.NewHash)
+	if len(h) > 8 {
+		h = h[:8]
+	}
+	return now().Format("20060102-150405") + "-" + h
+}
+
+// quarantinedPath 判断文件是否因被隔离而不存在，删除检查跳过这些文件
+func quarantinedPath(path string) bool {
+	if len(quarantine.Rules) == 0 {
+		return false
+	}
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	records, err := loadQuarantineIndex()
+	if err != nil {
+		return false
+	}
+	for _, r := range records {
+		if r.Path == path && r.Restored == nil && r.Type == "modified" {
+			return true
+		}
+	}
+	return false
+}
+
+// moveFile 移动文件，跨文件系统时复制后删除原文件
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// loadQuarantineIndex 读取隔离索引，调用方需持有 quarantineMu
+func loadQuarantineIndex() ([]quarantineRecord, error) {
+	data, err := os.ReadFile(quarantineIndexFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []quarantineRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("解析隔离索引错误: %v", err)
+	}
+	return records, nil
+}
+
+func saveQuarantineIndex(records []quarantineRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := quarantineIndexFile() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, quarantineIndexFile())
+}
+
+// restoreQuarantined 把隔离的文件放回原路径并恢复权限；原路径已有文件时拒绝覆盖
+func restoreQuarantined(id string) (quarantineRecord, error) {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	records, err := loadQuarantineIndex()
+	if err != nil {
+		return quarantineRecord{}, err
+	}
+	for i, r := range records {
+		if r.ID != id {
+			continue
+		}
+		if r.Restored != nil {
+			return r, fmt.Errorf("%s 已于 %s 放回", id, formatTime(*r.Restored))
+		}
+		if _, err := os.Lstat(r.Path); err == nil {
+			return r, fmt.Errorf("%s 已存在，不覆盖", r.Path)
+		}
+		if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+			return r, err
+		}
+		if err := moveFile(r.File, r.Path); err != nil {
+			return r, err
+		}
+		mode := os.FileMode(0644)
+		if r.Meta != nil {
+			mode = r.Meta.Mode.Perm()
+		}
+		os.Chmod(r.Path, mode)
+		t := now()
+		records[i].Restored = &t
+		return records[i], saveQuarantineIndex(records)
+	}
+	return quarantineRecord{}, fmt.Errorf("隔离记录 %s 不存在", id)
+}
+
+// runQuarantineCommand 列出隔离的文件或把文件放回原路径
+func runQuarantineCommand() int {
+	if err := prepareOneShotConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if restoreQuarantineID != "" {
+		rec, err := restoreQuarantined(restoreQuarantineID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		writeOutput(rec, func(w io.Writer) {
+			fmt.Fprintf(w, "已放回 %s，下一次扫描会按 %s 事件重新检查\n", rec.Path, rec.Type)
+		})
+		return exitClean
+	}
+
+	quarantineMu.Lock()
+	records, err := loadQuarantineIndex()
+	quarantineMu.Unlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if records == nil {
+		records = []quarantineRecord{}
+	}
+	writeOutput(records, func(w io.Writer) {
+		if len(records) == 0 {
+			fmt.Fprintln(w, "没有隔离的文件")
+		}
+		for _, r := range records {
+			status := "隔离中"
+			if r.Restored != nil {
+				status = "已放回 " + formatTime(*r.Restored)
+			}
+			fmt.Fprintf(w, "%s  %s  %s  %s  风险 %d  %s\n", r.ID, formatTime(r.Time), r.Type, r.Path, r.Risk, status)
+		}
+	})
+	return exitClean
+}
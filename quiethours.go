@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuietWindow 是一个通知渠道的静默时段，时段内只立即发送 critical 警报，其余警报攒到时段结束后合并发送
+type QuietWindow struct {
+	Days []string `json:"days"` // mon..sun，留空表示每天
+	From string   `json:"from"` // HH:MM
+	To   string   `json:"to"`   // HH:MM，小于 from 表示跨过午夜
+}
+
+var (
+	quietHours = make(map[string][]scheduleWindow) // 由 notifierMu 保护
+	quietQueue = make(map[string][]Notification)   // 由 notifyMu 保护
+)
+
+func parseQuietHours(c map[string][]QuietWindow) (map[string][]scheduleWindow, error) {
+	parsed := make(map[string][]scheduleWindow)
+	for name, windows := range c {
+		for i, q := range windows {
+			w, err := parseWindow(q.Days, q.From, q.To)
+			if err != nil {
+				return nil, fmt.Errorf("渠道 %s 第 %d 个静默时段%v", name, i+1, err)
+			}
+			parsed[name] = append(parsed[name], w)
+		}
+	}
+	return parsed, nil
+}
+
+func inQuietHours(name string, t time.Time) bool {
+	notifierMu.Lock()
+	windows := quietHours[name]
+	notifierMu.Unlock()
+	for _, w := range windows {
+		if w.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// holdForQuietHours 在渠道处于静默时段时把非 critical 警报放入队列，返回 true 表示已放入队列
+func holdForQuietHours(name string, n Notification) bool {
+	// 退出前不再积压，否则队列中的警报会丢失
+	if n.Severity == sevCritical || shuttingDown() || !inQuietHours(name, now()) {
+		return false
+	}
+	notifyMu.Lock()
+	quietQueue[name] = append(quietQueue[name], n)
+	notifyMu.Unlock()
+	return true
+}
+
+// flushQuietHours 在静默时段结束后把各渠道攒下的警报合并成一条发送；force 为 true 时（程序退出前）不等时段结束
+func flushQuietHours(force bool) {
+	t := now()
+	notifyMu.Lock()
+	ready := make(map[string][]Notification)
+	for name, queued := range quietQueue {
+		if len(queued) > 0 && (force || !inQuietHours(name, t)) {
+			ready[name] = queued
+			delete(quietQueue, name)
+		}
+	}
+	notifyMu.Unlock()
+
+	names := make([]string, 0, len(ready))
+	for name := range ready {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		queued := ready[name]
+		digest := Notification{Time: t, Severity: sevInfo, Channels: []string{name}}
+		parts := make([]string, 0, len(queued))
+		for _, n := range queued {
+			digest.Severity = maxSeverity(digest.Severity, n.Severity)
+			digest.Events = append(digest.Events, n.Events...)
+			parts = append(parts, formatTime(n.Time)+" "+n.Text)
+		}
+		digest.Text = fmt.Sprintf("静默时段内的 %d 条警报:\n\n%s", len(queued), strings.Join(parts, "\n\n"))
+		log.Printf("静默时段结束，向 %s 发送 %d 条积压的警报", name, len(queued))
+		dispatch(digest)
+	}
+}
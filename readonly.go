@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 只读模式（-read-only）用于不可变基础设施和容器：基线在构建镜像时用 -build-baseline 生成，
+// 运行时只校验和报告，不改写基线和任何状态文件，变动不能确认，内容再次变化时才重复报警；
+// 数据目录（哈希数据库所在目录）中出现的任何写入都以 critical 级别报警
+
+var (
+	readOnly      bool
+	buildBaseline bool
+)
+
+const readOnlyGuardInterval = 10 * time.Second
+
+type dataFileState struct {
+	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
+}
+
+// writeStateFile 写入数据目录中的状态文件，只读模式下不写入
+func writeStateFile(path string, data []byte, perm os.FileMode) error {
+	if readOnly {
+		return nil
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// ctlMutating 在只读模式下拒绝会修改基线或监控目录的控制请求
+func ctlMutating(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readOnly {
+			http.Error(w, "只读模式下不能修改基线", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func snapshotDataDir(dir string, ignore []string) map[string]dataFileState {
+	snap := make(map[string]dataFileState)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir || containsString(ignore, path) {
+			return nil
+		}
+		snap[path] = dataFileState{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+		return nil
+	})
+	return snap
+}
+
+func diffDataDir(old, cur map[string]dataFileState) []string {
+	var changes []string
+	for path, st := range cur {
+		prev, ok := old[path]
+		switch {
+		case !ok:
+			changes = append(changes, "新增: "+path)
+		case prev != st:
+			changes = append(changes, "修改: "+path)
+		}
+	}
+	for path := range old {
+		if _, ok := cur[path]; !ok {
+			changes = append(changes, "删除: "+path)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// startDataDirGuard 在只读模式下定时检查数据目录，任何变化都立即报警
+func startDataDirGuard() {
+	if !readOnly {
+		return
+	}
+	dir := filepath.Dir(hashDBFile)
+	if dirWritable(dir) {
+		log.Printf("警告：数据目录 %s 可写，建议以只读方式挂载（例如 docker run --read-only 或 readOnlyRootFilesystem）", dir)
+	}
+	// 控制接口的 socket 和日志文件由本进程创建，不算作写入
+	ignore := []string{control.Socket}
+	if logFile != nil {
+		ignore = append(ignore, logFilePath)
+	}
+	snap := snapshotDataDir(dir, ignore)
+	log.Printf("只读模式：只校验和报告，不会改写基线；数据目录 %s 中的 %d 个文件受保护", dir, len(snap))
+
+	go func() {
+		for range time.Tick(readOnlyGuardInterval) {
+			cur := snapshotDataDir(dir, ignore)
+			changes := diffDataDir(snap, cur)
+			if len(changes) == 0 {
+				continue
+			}
+			snap = cur
+			log.Printf("只读模式下数据目录被写入: %s", strings.Join(changes, "; "))
+			alert(Notification{Severity: sevCritical, Text: fmt.Sprintf("只读模式下数据目录 %s 被写入，基线或配置可能被篡改:\n%s",
+				dir, strings.Join(changes, "\n"))})
+		}
+	}()
+}
+
+// runBuildBaseline 建立基线（init 子命令和构建镜像时的 -build-baseline），force 为 false 时不覆盖已有基线
+func runBuildBaseline(force bool) int {
+	if err := prepareOneShotConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	acquireInstanceLock()
+	n, err := loadHashDB()
+	if err != nil && !(force && errors.Is(err, errBaselineSignature)) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if n > 0 && !force {
+		fmt.Fprintf(os.Stderr, "基线已存在（%d 个文件）: %s，如需重建请先删除或使用 init -force\n", n, hashDBFile)
+		return exitError
+	}
+	if n > 0 || err != nil {
+		log.Printf("替换原有的基线（%d 个文件）: %s", n, hashDBFile)
+		dbMu.Lock()
+		hashDB = make(map[string]*Entry)
+		dbMu.Unlock()
+	}
+	buildHashDB()
+	closeStorage()
+
+	dbMu.Lock()
+	n = len(hashDB)
+	dbMu.Unlock()
+	if n == 0 {
+		fmt.Fprintln(os.Stderr, "监控目录中没有任何文件，没有建立基线")
+		return exitError
+	}
+	fmt.Printf("已建立 %d 个文件的基线: %s\n", n, hashDBFile)
+	return exitClean
+}
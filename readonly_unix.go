@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// dirWritable 判断当前进程能否写入目录（只读挂载或没有写权限时返回 false）
+func dirWritable(dir string) bool {
+	const wOK = 2
+	return syscall.Access(dir, wOK) == nil
+}
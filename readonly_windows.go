@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// Windows 上的写权限由 ACL 决定，不做预先检查，只依靠数据目录的变化检测
+func dirWritable(dir string) bool {
+	return false
+}
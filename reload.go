@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 热加载配置：收到 SIGHUP 或控制接口的 reload 请求后重新读取配置文件。扫描相关的设置
+// （监控目录、排除规则、检查间隔、扫描计划等）在当前扫描结束后立即生效，内存中的基线、
+// 待确认变动和统计都保留；其余配置项的修改只记录到日志，重启后生效。新配置有错误时继续使用原配置。
+// 启用 watch_config 时每次扫描前检查配置文件，内容变化时自动重新加载。
+// 每次重新加载都记录并通知改动了哪些设置，缩小监控范围（移除目录、增加排除规则）时以 warning 级别通知。
+// 通知渠道（notify）和 hash_db_key 同样重新应用，其中的 env:、file:、vault: 引用重新读取，更换凭据后不需要重启
+
+// reloadableKeys 是可以热加载的配置项
+var reloadableKeys = []string{"wenjian", "check_interval", "schedule", "incremental", "full_scan_interval",
+	"parallel_roots", "hash_workers", "watch_config", "notify", "hash_db_key", "vault"}
+
+const defaultParallelRoots = 4
+
+var (
+	// loadedConfig 为当前生效的配置
+	loadedConfig Config
+	// configDirsFrom 为上次从配置文件取得的 dirs_from，用来区分 -dirs-from 参数
+	configDirsFrom string
+	// flagInterval 为 -interval 参数，配置文件未指定 check_interval 时使用
+	flagInterval time.Duration
+	// configSum 为最近一次读取的配置文件内容的哈希，读取失败的内容也记录，避免每次扫描重复报错
+	configSum [sha256.Size]byte
+
+	// reloadCh 把重新加载请求交给主循环执行，避免与扫描同时修改设置
+	reloadCh = make(chan chan reloadResult, 1)
+)
+
+// reloadResult 是一次重新加载的结果
+type reloadResult struct {
+	Reloaded       bool     `json:"reloaded"`
+	Error          string   `json:"error,omitempty"`
+	Changes        []string `json:"changes,omitempty"`
+	Directories    []string `json:"directories,omitempty"`
+	RestartPending []string `json:"restart_pending,omitempty"` // 已修改但需要重启才能生效的配置项
+}
+
+// requestReload 请求主循环重新加载配置，返回接收结果的通道；已有请求在排队时返回 nil
+func requestReload() chan reloadResult {
+	reply := make(chan reloadResult, 1)
+	select {
+	case reloadCh <- reply:
+		return reply
+	default:
+		return nil
+	}
+}
+
+// reloadConfig 由主循环调用，重新读取配置文件并应用可以热加载的设置
+func reloadConfig() reloadResult {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+
+	if configFile == "" {
+		return reloadResult{Error: "未指定配置文件"}
+	}
+	log.Printf("重新加载配置文件 %s", configFile)
+	config, err := readConfigFile()
+	if err == nil {
+		if err = applyScanSettings(config); err == nil {
+			err = applyCredentials(config)
+		}
+		if err != nil {
+			// 设置可能已经应用了一部分，恢复原配置
+			applyScanSettings(loadedConfig)
+			applyCredentials(loadedConfig)
+		}
+	}
+	if err != nil {
+		log.Printf("重新加载配置失败，继续使用原配置: %v", err)
+		return reloadResult{Error: err.Error()}
+	}
+
+	pending := restartOnlyChanges(loadedConfig, config)
+	changes, narrowed := configDiff(loadedConfig, config)
+	loadedConfig.Wenjian = config.Wenjian
+	loadedConfig.CheckInterval = config.CheckInterval
+	loadedConfig.Schedule = config.Schedule
+	loadedConfig.Incremental = config.Incremental
+	loadedConfig.FullScanInterval = config.FullScanInterval
+	loadedConfig.ParallelRoots = config.ParallelRoots
+	loadedConfig.HashWorkers = config.HashWorkers
+	loadedConfig.WatchConfig = config.WatchConfig
+	loadedConfig.Notify = config.Notify
+	loadedConfig.HashDBKey = config.HashDBKey
+	loadedConfig.Vault = config.Vault
+
+	expandDirs()
+	dbMu.Lock()
+	dirs := append([]string(nil), monitorDirs...)
+	dbMu.Unlock()
+	log.Printf("配置已重新加载: 监控目录 %v，检查间隔 %v，排除规则 %d 条", dirs, checkInterval, len(exclude))
+	if len(pending) > 0 {
+		log.Printf("以下配置项的修改需要重启才能生效: %s", strings.Join(pending, ", "))
+	}
+	if len(changes) > 0 {
+		sev := sevInfo
+		if narrowed {
+			sev = sevWarning
+		}
+		alert(Notification{Severity: sev, Text: fmt.Sprintf("配置已重新加载（%s）:\n%s", configFile, strings.Join(changes, "\n"))})
+	}
+	return reloadResult{Reloaded: true, Changes: changes, Directories: dirs, RestartPending: pending}
+}
+
+// applyCredentials 按重新读取的配置重建通知渠道并更换 hash_db_key
+func applyCredentials(config Config) error {
+	if err := configureNotifiers(config.Notify); err != nil {
+		return err
+	}
+	if err := reloadDBKey(config.HashDBKey); err != nil {
+		return fmt.Errorf("配置错误: %v", err)
+	}
+	return nil
+}
+
+// reloadIfConfigChanged 在启用 watch_config 时由主循环在每次扫描前调用，配置文件内容变化时重新加载
+func reloadIfConfigChanged() {
+	if !loadedConfig.WatchConfig || configFile == "" {
+		return
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		// 编辑器保存时可能短暂不存在，下次扫描前再检查
+		return
+	}
+	if sha256.Sum256(data) == configSum {
+		return
+	}
+	log.Printf("检测到配置文件 %s 已修改", configFile)
+	reloadConfig()
+}
+
+// configDiff 列出可以热加载的设置的改动；narrowed 为 true 表示监控范围可能缩小
+func configDiff(old, cur Config) (changes []string, narrowed bool) {
+	addedDirs, removedDirs := diffStrings(dirEntryStrings(old.Wenjian.Directories), dirEntryStrings(cur.Wenjian.Directories))
+	for _, d := range addedDirs {
+		changes = append(changes, "+ 监控目录 "+d)
+	}
+	for _, d := range removedDirs {
+		changes = append(changes, "- 监控目录 "+d)
+	}
+	addedExcl, removedExcl := diffStrings(old.Wenjian.Exclude, cur.Wenjian.Exclude)
+	for _, p := range addedExcl {
+		changes = append(changes, "+ 排除规则 "+p)
+	}
+	for _, p := range removedExcl {
+		changes = append(changes, "- 排除规则 "+p)
+	}
+	addedRegex, removedRegex := diffStrings(old.Wenjian.ExcludeRegex, cur.Wenjian.ExcludeRegex)
+	for _, p := range addedRegex {
+		changes = append(changes, "+ 排除正则 "+p)
+	}
+	for _, p := range removedRegex {
+		changes = append(changes, "- 排除正则 "+p)
+	}
+	addedIncl, removedIncl := diffStrings(old.Wenjian.Include, cur.Wenjian.Include)
+	for _, p := range addedIncl {
+		changes = append(changes, "+ include 规则 "+p)
+	}
+	for _, p := range removedIncl {
+		changes = append(changes, "- include 规则 "+p)
+	}
+	// include 从无到有、或去掉其中的规则都会缩小监控范围
+	inclNarrowed := len(removedIncl) > 0 || (len(old.Wenjian.Include) == 0 && len(cur.Wenjian.Include) > 0)
+	// 重新启用忽略文件同样可能缩小监控范围
+	ignoreOn := func(c Config) bool { return c.Wenjian.IgnoreFiles == nil || *c.Wenjian.IgnoreFiles }
+	narrowed = len(removedDirs) > 0 || len(addedExcl) > 0 || len(addedRegex) > 0 || inclNarrowed ||
+		(!ignoreOn(old) && ignoreOn(cur)) || old.Wenjian.DirsFrom != cur.Wenjian.DirsFrom
+
+	setting := func(name string, a, b interface{}) {
+		x, _ := json.Marshal(a)
+		y, _ := json.Marshal(b)
+		if !bytes.Equal(x, y) {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, x, y))
+		}
+	}
+	setting("dirs_from", old.Wenjian.DirsFrom, cur.Wenjian.DirsFrom)
+	setting("attributes", old.Wenjian.Attributes, cur.Wenjian.Attributes)
+	setting("max_file_size", old.Wenjian.MaxFileSize, cur.Wenjian.MaxFileSize)
+	setting("max_file_sizes", old.Wenjian.MaxFileSizes, cur.Wenjian.MaxFileSizes)
+	setting("ignore_files", old.Wenjian.IgnoreFiles, cur.Wenjian.IgnoreFiles)
+	setting("check_interval", old.CheckInterval, cur.CheckInterval)
+	setting("schedule", old.Schedule, cur.Schedule)
+	setting("incremental", old.Incremental, cur.Incremental)
+	setting("full_scan_interval", old.FullScanInterval, cur.FullScanInterval)
+	setting("parallel_roots", old.ParallelRoots, cur.ParallelRoots)
+	setting("hash_workers", old.HashWorkers, cur.HashWorkers)
+	setting("watch_config", old.WatchConfig, cur.WatchConfig)
+	// 凭据不写入通知，只说明有改动
+	secret := func(name string, a, b interface{}) {
+		x, _ := json.Marshal(a)
+		y, _ := json.Marshal(b)
+		if !bytes.Equal(x, y) {
+			changes = append(changes, name+" 已更新")
+		}
+	}
+	secret("notify", old.Notify, cur.Notify)
+	secret("hash_db_key", old.HashDBKey, cur.HashDBKey)
+	secret("vault", old.Vault, cur.Vault)
+	return changes, narrowed
+}
+
+// diffStrings 返回 b 中新增的和 a 中被去掉的元素
+func diffStrings(a, b []string) (added, removed []string) {
+	for _, s := range b {
+		if !containsString(a, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if !containsString(b, s) {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// restartOnlyChanges 返回两份配置之间有差异、但不能热加载的顶层配置项
+func restartOnlyChanges(old, cur Config) []string {
+	a, b := configKeys(old), configKeys(cur)
+	var changed []string
+	for key, v := range b {
+		if !containsString(reloadableKeys, key) && string(a[key]) != string(v) {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func configKeys(c Config) map[string]json.RawMessage {
+	m := make(map[string]json.RawMessage)
+	data, err := json.Marshal(c)
+	if err == nil {
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+// reloadFromSignal 处理 SIGHUP，不等待结果，结果记录在日志中
+func reloadFromSignal() {
+	if requestReload() == nil {
+		log.Println("收到 SIGHUP，已有重新加载请求在排队")
+		return
+	}
+	log.Println("收到 SIGHUP，将在当前扫描结束后重新加载配置")
+}
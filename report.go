@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 定期汇总报告（reports）：每天或每周生成一份 HTML 报告，汇总期间的扫描次数、发现的变动、
+// 变动最多的目录和当前基线的统计，保存到报告目录并可通过邮件发送，便于交给审计人员。
+// 期间的统计保存在哈希数据库旁的 .report.json 中，重启后继续累计
+
+// ReportConfig 配置定期汇总报告
+type ReportConfig struct {
+	Period   string   `json:"period"`   // daily 或 weekly，留空不生成
+	Day      string   `json:"day"`      // weekly 时在星期几生成，默认 mon
+	At       string   `json:"at"`       // 生成时间 HH:MM，默认 00:00
+	Dir      string   `json:"dir"`      // 默认为哈希数据库旁的 .reports 目录
+	Keep     int      `json:"keep"`     // 保留最近多少份报告，默认 60，负数不清理
+	TopDirs  int      `json:"top_dirs"` // 列出变动最多的目录数，默认 10
+	Channels []string `json:"channels"` // 同时发送到这些渠道，email 渠道发送 HTML 正文，其他渠道发送文字摘要
+}
+
+const maxReportNotable = 100
+
+// reportStats 是一个报告期内的累计统计，由 dbMu 保护
+type reportStats struct {
+	Start       time.Time      `json:"start"`
+	Scans       int            `json:"scans"`
+	ErrorScans  int            `json:"error_scans"`  // 有错误的扫描次数
+	ScanSeconds float64        `json:"scan_seconds"` // 扫描总耗时
+	LastScan    time.Time      `json:"last_scan"`
+	Events      map[string]int `json:"events"`     // 按事件类型
+	Severities  map[string]int `json:"severities"` // 按级别
+	Dirs        map[string]int `json:"dirs"`       // 按所在目录
+	Notable     []reportEvent  `json:"notable"`    // high 及以上级别的变动，最多 100 条
+	Omitted     int            `json:"omitted,omitempty"`
+}
+
+type reportEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Path     string    `json:"path"`
+	Risk     int       `json:"risk,omitempty"`
+}
+
+var (
+	reports       ReportConfig
+	reportAt      int // 生成时间，距午夜的分钟数
+	reportDay     time.Weekday
+	curReport     *reportStats
+	reportDirty   bool
+	htmlReportOut string
+)
+
+func applyReportConfig(c ReportConfig) error {
+	switch c.Period {
+	case "", "daily", "weekly":
+	default:
+		return fmt.Errorf("reports.period 无效: %s（可选 daily、weekly）", c.Period)
+	}
+	at, err := parseClock(c.At, 0)
+	if err != nil {
+		return fmt.Errorf("reports.at 格式错误: %v", err)
+	}
+	day := time.Monday
+	if c.Day != "" {
+		wd, ok := weekdayNames[strings.ToLower(c.Day)[:min(3, len(c.Day))]]
+		if !ok {
+			return fmt.Errorf("reports.day 无效: %s", c.Day)
+		}
+		day = wd
+	}
+	if c.Keep == 0 {
+		c.Keep = 60
+	}
+	if c.TopDirs <= 0 {
+		c.TopDirs = 10
+	}
+	if c.Dir != "" {
+		c.Dir = filepath.Clean(c.Dir)
+	}
+	reports, reportAt, reportDay = c, at, day
+	return nil
+}
+
+func reportDir() string {
+	if reports.Dir != "" {
+		return reports.Dir
+	}
+	return hashDBFile + ".reports"
+}
+
+func reportStatsFile() string {
+	return hashDBFile + ".report.json"
+}
+
+func newReportStats(start time.Time) *reportStats {
+	return &reportStats{Start: start, Events: map[string]int{}, Severities: map[string]int{}, Dirs: map[string]int{}}
+}
+
+func loadReportStats() *reportStats {
+	st := newReportStats(now())
+	data, err := os.ReadFile(reportStatsFile())
+	if err != nil {
+		return st
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		log.Printf("解析报告统计错误: %v", err)
+		return newReportStats(now())
+	}
+	for _, m := range []*map[string]int{&st.Events, &st.Severities, &st.Dirs} {
+		if *m == nil {
+			*m = map[string]int{}
+		}
+	}
+	return st
+}
+
+// reportEventStats 把一次变动计入报告统计，调用方需持有 dbMu
+func reportEventStats(ev Event) {
+	if reports.Period == "" {
+		return
+	}
+	if curReport == nil {
+		curReport = loadReportStats()
+	}
+	curReport.Events[ev.Type]++
+	curReport.Severities[ev.Severity]++
+	curReport.Dirs[filepath.Dir(ev.Path)]++
+	if severityAtLeast(ev.Severity, sevHigh) {
+		if len(curReport.Notable) < maxReportNotable {
+			curReport.Notable = append(curReport.Notable, reportEvent{Time: ev.Time, Type: ev.Type,
+				Severity: ev.Severity, Path: ev.Path, Risk: ev.Risk})
+		} else {
+			curReport.Omitted++
+		}
+	}
+	reportDirty = true
+}
+
+// reportScanStats 把一次扫描计入报告统计，调用方需持有 dbMu
+func reportScanStats(d time.Duration, errs int) {
+	if reports.Period == "" {
+		return
+	}
+	if curReport == nil {
+		curReport = loadReportStats()
+	}
+	curReport.Scans++
+	curReport.LastScan = now()
+	curReport.ScanSeconds += d.Seconds()
+	if errs > 0 {
+		curReport.ErrorScans++
+	}
+	reportDirty = true
+}
+
+// saveReportStats 在扫描结束和生成报告后保存报告统计
+func saveReportStats() {
+	dbMu.Lock()
+	if !reportDirty || curReport == nil {
+		dbMu.Unlock()
+		return
+	}
+	data, err := json.Marshal(curReport)
+	reportDirty = false
+	dbMu.Unlock()
+
+	if err == nil {
+		err = writeStateFile(reportStatsFile(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("保存报告统计错误: %v", err)
+	}
+}
+
+// lastReportDue 返回不晚于 t 的最近一个报告时间点
+func lastReportDue(t time.Time) time.Time {
+	t = t.In(timeLoc)
+	due := time.Date(t.Year(), t.Month(), t.Day(), 0, reportAt, 0, 0, timeLoc)
+	if due.After(t) {
+		due = due.AddDate(0, 0, -1)
+	}
+	if reports.Period == "weekly" {
+		for due.Weekday() != reportDay {
+			due = due.AddDate(0, 0, -1)
+		}
+	}
+	return due
+}
+
+// startReports 启动定期报告，每分钟检查一次是否到了生成时间
+func startReports() {
+	if reports.Period == "" {
+		return
+	}
+	if readOnly && reports.Dir == "" {
+		log.Printf("只读模式下需要配置 reports.dir 才能保存汇总报告")
+	}
+	log.Printf("汇总报告: %s，报告目录 %s", reports.Period, reportDir())
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			dbMu.Lock()
+			if curReport == nil {
+				curReport = loadReportStats()
+			}
+			due := curReport.Start.Before(lastReportDue(now()))
+			dbMu.Unlock()
+			if due {
+				generateReport()
+			}
+		}
+	}()
+}
+
+// generateReport 生成本期报告，保存并发送后开始新的报告期
+func generateReport() {
+	dbMu.Lock()
+	st := curReport
+	end := now()
+	curReport = newReportStats(end)
+	reportDirty = true
+	page := buildReportPage(st, end)
+	dbMu.Unlock()
+	saveReportStats()
+
+	html, err := renderReport(page)
+	if err != nil {
+		log.Printf("生成汇总报告错误: %v", err)
+		return
+	}
+	if file, err := writeReport(html, end); err != nil {
+		log.Printf("保存汇总报告错误: %v", err)
+	} else {
+		log.Printf("汇总报告已保存: %s", file)
+	}
+	if len(reports.Channels) > 0 {
+		dispatch(Notification{Time: end, Severity: sevInfo, Text: reportSummaryText(page), HTML: html, Channels: reports.Channels})
+	}
+}
+
+func writeReport(html string, end time.Time) (string, error) {
+	if readOnly && reports.Dir == "" {
+		return "", fmt.Errorf("只读模式下需要配置 reports.dir")
+	}
+	dir := reportDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "report-"+end.In(timeLoc).Format("20060102-1504")+".html")
+	if err := os.WriteFile(file, []byte(html), 0600); err != nil {
+		return "", err
+	}
+	if reports.Keep > 0 {
+		old, _ := filepath.Glob(filepath.Join(dir, "report-*.html"))
+		sort.Strings(old)
+		for len(old) > reports.Keep {
+			os.Remove(old[0])
+			old = old[1:]
+		}
+	}
+	return file, nil
+}
+
+type reportRow struct {
+	Name  string
+	Count int
+	Class string
+}
+
+type reportPage struct {
+	Host, Version string
+	Start, End    time.Time
+	Stats         *reportStats
+	AvgScan       string
+	Changes       int
+	Types         []reportRow
+	Severities    []reportRow
+	TopDirs       []reportRow
+	MoreDirs      int
+
+	BaselineFiles int
+	BaselineBytes int64
+	Roots         []reportRow
+	Pending       int
+	LastScan      time.Time
+	Coverage      string
+}
+
+// buildReportPage 整理报告内容，调用方需持有 dbMu
+func buildReportPage(st *reportStats, end time.Time) reportPage {
+	p := reportPage{Host: hostname(), Version: appversion, Start: st.Start, End: end, Stats: st,
+		BaselineFiles: len(hashDB), Pending: len(pending), LastScan: st.LastScan}
+	if st.Scans > 0 {
+		p.AvgScan = time.Duration(st.ScanSeconds / float64(st.Scans) * float64(time.Second)).Round(time.Millisecond).String()
+	}
+	for _, t := range eventTypeTitles {
+		if n := st.Events[t.typ]; n > 0 {
+			p.Types = append(p.Types, reportRow{Name: t.title, Count: n})
+			p.Changes += n
+		}
+	}
+	for _, sev := range []string{sevCritical, sevHigh, sevWarning, sevLow, sevInfo} {
+		if n := st.Severities[sev]; n > 0 {
+			p.Severities = append(p.Severities, reportRow{Name: sev, Count: n, Class: "sev-" + sev})
+		}
+	}
+	for dir, n := range st.Dirs {
+		p.TopDirs = append(p.TopDirs, reportRow{Name: dir, Count: n})
+	}
+	sort.Slice(p.TopDirs, func(i, j int) bool {
+		if p.TopDirs[i].Count != p.TopDirs[j].Count {
+			return p.TopDirs[i].Count > p.TopDirs[j].Count
+		}
+		return p.TopDirs[i].Name < p.TopDirs[j].Name
+	})
+	if len(p.TopDirs) > reports.TopDirs {
+		p.MoreDirs = len(p.TopDirs) - reports.TopDirs
+		p.TopDirs = p.TopDirs[:reports.TopDirs]
+	}
+
+	roots := map[string]int{}
+	for path, e := range hashDB {
+		root, ok := rootFor(path, monitorDirs)
+		if !ok {
+			root = "其他"
+		}
+		roots[root]++
+		if e.Meta != nil {
+			p.BaselineBytes += e.Meta.Size
+		}
+	}
+	for root, n := range roots {
+		p.Roots = append(p.Roots, reportRow{Name: root, Count: n})
+	}
+	sort.Slice(p.Roots, func(i, j int) bool { return p.Roots[i].Name < p.Roots[j].Name })
+	if lastCoverage != nil {
+		p.Coverage = fmt.Sprintf("%.1f%%", lastCoverage.Percent())
+	}
+	return p
+}
+
+func reportSummaryText(p reportPage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "汇总报告 %s 至 %s\n", formatTime(p.Start), formatTime(p.End))
+	fmt.Fprintf(&b, "扫描 %d 次（有错误的 %d 次），发现变动 %d 个", p.Stats.Scans, p.Stats.ErrorScans, p.Changes)
+	for _, r := range p.Severities {
+		fmt.Fprintf(&b, "，%s %d", r.Name, r.Count)
+	}
+	fmt.Fprintf(&b, "\n基线文件: %d，待确认变动: %d", p.BaselineFiles, p.Pending)
+	if len(p.TopDirs) > 0 {
+		b.WriteString("\n变动最多的目录:")
+		for _, r := range p.TopDirs[:min(5, len(p.TopDirs))] {
+			fmt.Fprintf(&b, "\n  %s (%d)", r.Name, r.Count)
+		}
+	}
+	return b.String()
+}
+
+func renderReport(p reportPage) (string, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, p); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(dashboardFuncs).Funcs(template.FuncMap{
+	"bytes": formatBytes,
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>文件防篡改监控汇总报告 {{fmtTime .Start}} 至 {{fmtTime .End}}</title>
+<style>
+body { font-family: -apple-system, "Microsoft YaHei", sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; } h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; min-width: 50%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 12px 4px 0; text-align: left; vertical-align: top; }
+.muted { color: #888; } .sev-critical { color: #c00; font-weight: bold; } .sev-high { color: #c00; } .sev-warning { color: #b60; }
+</style>
+</head>
+<body>
+<h1>文件防篡改监控汇总报告</h1>
+<p>{{.Host}} · {{.Version}}<br>报告期: {{fmtTime .Start}} 至 {{fmtTime .End}}</p>
+
+<h2>扫描</h2>
+<table>
+<tr><th>扫描次数</th><td>{{.Stats.Scans}}</td></tr>
+<tr><th>有错误的扫描</th><td>{{.Stats.ErrorScans}}</td></tr>
+{{with .AvgScan}}<tr><th>平均耗时</th><td>{{.}}</td></tr>{{end}}
+<tr><th>上次扫描</th><td>{{fmtTime .LastScan}}</td></tr>
+{{with .Coverage}}<tr><th>覆盖率</th><td>{{.}}</td></tr>{{end}}
+</table>
+
+<h2>发现的变动（共 {{.Changes}} 个）</h2>
+{{if .Types}}<table>
+<tr><th>类型</th><th>数量</th></tr>
+{{range .Types}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<p></p>
+<table>
+<tr><th>级别</th><th>数量</th></tr>
+{{range .Severities}}<tr><td class="{{.Class}}">{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">报告期内没有发现变动</p>{{end}}
+
+{{if .TopDirs}}<h2>变动最多的目录</h2>
+<table>
+<tr><th>目录</th><th>变动数</th></tr>
+{{range .TopDirs}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}{{if .MoreDirs}}<tr><td class="muted" colspan="2">另有 {{.MoreDirs}} 个目录</td></tr>{{end}}
+</table>{{end}}
+
+{{if .Stats.Notable}}<h2>高级别变动</h2>
+<table>
+<tr><th>时间</th><th>类型</th><th>级别</th><th>风险</th><th>路径</th></tr>
+{{range .Stats.Notable}}<tr><td>{{fmtTime .Time}}</td><td>{{.Type}}</td><td class="sev-{{.Severity}}">{{.Severity}}</td><td>{{.Risk}}</td><td>{{.Path}}</td></tr>
+{{end}}{{if .Stats.Omitted}}<tr><td class="muted" colspan="5">另有 {{.Stats.Omitted}} 个未列出</td></tr>{{end}}
+</table>{{end}}
+
+<h2>当前基线</h2>
+<table>
+<tr><th>基线文件</th><td>{{.BaselineFiles}}</td></tr>
+<tr><th>文件总大小</th><td>{{bytes .BaselineBytes}}</td></tr>
+<tr><th>待确认变动</th><td>{{.Pending}}</td></tr>
+</table>
+<p></p>
+<table>
+<tr><th>监控目录</th><th>文件数</th></tr>
+{{range .Roots}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// formatBytes 把字节数格式化为 KB、MB、GB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// runHTMLReport 立即输出当前报告期（尚未结束）的汇总报告，不开始新的报告期
+func runHTMLReport() int {
+	if err := prepareOneShot(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if reports.TopDirs == 0 {
+		reports.TopDirs = 10
+	}
+	page := buildReportPage(loadReportStats(), now())
+	html, err := renderReport(page)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if htmlReportOut == "-" {
+		fmt.Print(html)
+		return exitClean
+	}
+	if err := os.WriteFile(htmlReportOut, []byte(html), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("汇总报告已写入 %s\n", htmlReportOut)
+	return exitClean
+}
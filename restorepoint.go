@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 基线还原点：在批量确认变动之前自动保存基线副本，误确认恶意变动后可以一条命令恢复
+
+const defaultBulkSnapshotThreshold = 20
+
+// bulkSnapshotThreshold 是一次确认多少个变动时自动创建还原点，负数表示不创建
+var bulkSnapshotThreshold = defaultBulkSnapshotThreshold
+
+type restorePoint struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Reason  string            `json:"reason,omitempty"`
+	Created time.Time         `json:"created"`
+	Files   int               `json:"files"`
+	DB      map[string]*Entry `json:"db,omitempty"`
+}
+
+var (
+	restorePointName   string
+	listRestoreMode    bool
+	rollbackBaselineTo string
+)
+
+var restoreNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func restoreDir() string {
+	return hashDBFile + ".restore"
+}
+
+// createRestorePoint 保存当前基线，调用方不能持有 dbMu
+func createRestorePoint(name, reason string) (restorePoint, error) {
+	if readOnly {
+		return restorePoint{}, fmt.Errorf("只读模式下不能创建还原点")
+	}
+	t := now()
+	name = strings.Trim(restoreNamePattern.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		name = "manual"
+	}
+	rp := restorePoint{
+		ID:      t.Format("20060102-150405") + "-" + name,
+		Name:    name,
+		Reason:  reason,
+		Created: t,
+	}
+
+	dbMu.Lock()
+	rp.DB = make(map[string]*Entry, len(hashDB))
+	for path, e := range hashDB {
+		copied := *e
+		rp.DB[path] = &copied
+	}
+	dbMu.Unlock()
+	rp.Files = len(rp.DB)
+
+	data, err := json.Marshal(rp)
+	if err != nil {
+		return rp, err
+	}
+	if err := os.MkdirAll(restoreDir(), 0700); err != nil {
+		return rp, fmt.Errorf("无法创建还原点目录: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(restoreDir(), rp.ID+".json"), data, 0600); err != nil {
+		return rp, fmt.Errorf("写入还原点错误: %v", err)
+	}
+	log.Printf("已创建基线还原点 %s（%d 个文件）: %s", rp.ID, rp.Files, reason)
+	return rp, nil
+}
+
+// listRestorePoints 按创建时间从新到旧列出还原点，不包含基线内容
+func listRestorePoints() ([]restorePoint, error) {
+	files, err := filepath.Glob(filepath.Join(restoreDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var points []restorePoint
+	for _, f := range files {
+		rp, err := readRestorePoint(f)
+		if err != nil {
+			log.Printf("读取还原点 %s 错误: %v", f, err)
+			continue
+		}
+		rp.DB = nil
+		points = append(points, rp)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Created.After(points[j].Created) })
+	return points, nil
+}
+
+func readRestorePoint(file string) (restorePoint, error) {
+	var rp restorePoint
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return rp, err
+	}
+	err = json.Unmarshal(data, &rp)
+	return rp, err
+}
+
+// findRestorePoint 按 ID 或名称查找还原点，名称重复时取最新的
+func findRestorePoint(ref string) (restorePoint, error) {
+	points, err := listRestorePoints()
+	if err != nil {
+		return restorePoint{}, err
+	}
+	for _, rp := range points {
+		if rp.ID == ref || rp.Name == ref {
+			return readRestorePoint(filepath.Join(restoreDir(), rp.ID+".json"))
+		}
+	}
+	return restorePoint{}, fmt.Errorf("找不到还原点 %s", ref)
+}
+
+// rollbackBaseline 把基线恢复到还原点，恢复前先为当前基线创建还原点
+func rollbackBaseline(ref string) (restorePoint, error) {
+	rp, err := findRestorePoint(ref)
+	if err != nil {
+		return rp, err
+	}
+	if _, err := createRestorePoint("before-rollback", "回滚到 "+rp.ID+" 之前的基线"); err != nil {
+		return rp, err
+	}
+
+	dbMu.Lock()
+	hashDB = rp.DB
+	if hashDB == nil {
+		hashDB = make(map[string]*Entry)
+	}
+	// 回滚后由下次扫描重新发现与基线不一致的文件
+	pending = make(map[string]Event)
+	dbMu.Unlock()
+
+	if err := saveHashDB(); err != nil {
+		return rp, err
+	}
+	log.Printf("基线已回滚到还原点 %s（%d 个文件）", rp.ID, rp.Files)
+	rp.DB = nil
+	return rp, nil
+}
+
+// snapshotBeforeBulk 在一次确认的变动数达到阈值时创建还原点
+func snapshotBeforeBulk(count int, how string) {
+	if bulkSnapshotThreshold < 0 || count < bulkSnapshotThreshold {
+		return
+	}
+	if _, err := createRestorePoint("bulk-accept", fmt.Sprintf("%s确认 %d 个变动之前", how, count)); err != nil {
+		log.Printf("创建还原点失败: %v", err)
+	}
+}
+
+// runRestorePointCommand 处理 -restore-point、-list-restore-points 和 -rollback-baseline，
+// 直接读写哈希数据库；守护进程运行时应改用 -ctl，否则守护进程保存基线时会覆盖修改
+func runRestorePointCommand() int {
+	if err := prepareOneShot(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	switch {
+	case listRestoreMode:
+		points, err := listRestorePoints()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		writeOutput(points, func(w io.Writer) {
+			if len(points) == 0 {
+				fmt.Fprintln(w, "没有还原点")
+			}
+			for _, rp := range points {
+				fmt.Fprintf(w, "%s  %s  %d 个文件  %s\n", rp.ID, formatTime(rp.Created), rp.Files, rp.Reason)
+			}
+		})
+	case restorePointName != "":
+		rp, err := createRestorePoint(restorePointName, "手动创建")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		rp.DB = nil
+		writeOutput(rp, func(w io.Writer) { fmt.Fprintf(w, "已创建还原点 %s（%d 个文件）\n", rp.ID, rp.Files) })
+	case rollbackBaselineTo != "":
+		rp, err := rollbackBaseline(rollbackBaselineTo)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		writeOutput(rp, func(w io.Writer) { fmt.Fprintf(w, "基线已回滚到 %s（%d 个文件）\n", rp.ID, rp.Files) })
+	}
+	return exitClean
+}
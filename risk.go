@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 风险评分：把多个可疑信号按权重相加得到 0-100 的分数，用于定级、路由和自动处理
+
+type RiskConfig struct {
+	UploadDirs      []string       `json:"upload_dirs"`       // 上传目录，出现在这里的文件更可疑
+	Weights         map[string]int `json:"weights"`           // 覆盖各信号的默认权重
+	Thresholds      []RiskRule     `json:"thresholds"`        // 分数达到 score 时提升级别并通知额外渠道
+	AutoAcceptBelow int            `json:"auto_accept_below"` // manual_accept 模式下低于该分数的变动自动确认
+}
+
+type RiskRule struct {
+	Score    int      `json:"score"`
+	Severity string   `json:"severity"`
+	Channels []string `json:"channels"`
+}
+
+const (
+	sigNewFile     = "new_file"
+	sigExecutable  = "executable"
+	sigHighEntropy = "high_entropy"
+	sigUploadDir   = "upload_dir"
+	sigWebshell    = "webshell"
+)
+
+var riskWeights = map[string]int{
+	sigNewFile:     10,
+	sigExecutable:  20,
+	sigHighEntropy: 25,
+	sigUploadDir:   25,
+	sigWebshell:    50,
+
+	// 由上传目录策略、seo_watch、JS 窃取脚本、特殊文件、权限提升、YARA 规则和新可执行文件检测追加的信号
+	sigScriptContent: 40,
+	sigSEOFile:       20,
+	sigJSSkimmer:     40,
+	sigSpecialFile:   60,
+	sigSetuid:        60,
+	sigExecBit:       30,
+	sigYara:          50,
+	sigNewExecutable: 30,
+}
+
+var risk RiskConfig
+
+// 服务器会执行的脚本扩展名
+var executableExts = map[string]bool{
+	".php": true, ".php3": true, ".php4": true, ".php5": true, ".php7": true, ".phtml": true, ".phar": true,
+	".asp": true, ".aspx": true, ".ashx": true, ".asmx": true, ".cer": true, ".asa": true,
+	".jsp": true, ".jspx": true, ".jspf": true,
+	".cgi": true, ".pl": true, ".py": true, ".sh": true, ".exe": true, ".dll": true, ".so": true,
+}
+
+const (
+	riskSampleSize  = 64 << 10
+	highEntropyBits = 5.8 // 正常源码一般在 4.5-5.5 bits/byte，混淆或编码后的载荷更高
+)
+
+func applyRiskConfig(c RiskConfig) error {
+	for name, w := range c.Weights {
+		if _, ok := riskWeights[name]; !ok {
+			return fmt.Errorf("未知的风险信号 %q", name)
+		}
+		riskWeights[name] = w
+	}
+	for i, rule := range c.Thresholds {
+		if rule.Severity != "" && !validSeverity(rule.Severity) {
+			return fmt.Errorf("风险阈值中的级别无效: %s", rule.Severity)
+		}
+		if rule.Severity == "" && len(rule.Channels) == 0 {
+			return fmt.Errorf("第 %d 条风险阈值既没有 severity 也没有 channels", i+1)
+		}
+	}
+	sort.Slice(c.Thresholds, func(i, j int) bool { return c.Thresholds[i].Score < c.Thresholds[j].Score })
+	for i, dir := range c.UploadDirs {
+		c.UploadDirs[i] = filepath.Clean(dir)
+	}
+	if c.AutoAcceptBelow > 0 && !manualAccept {
+		return fmt.Errorf("auto_accept_below 需要启用 manual_accept")
+	}
+	risk = c
+	return nil
+}
+
+// scoreRisk 计算事件的风险分数，并按阈值提升级别、追加通知渠道
+func scoreRisk(ev *Event) {
+	if ev.Type == "deleted" || ev.Type == "stream_deleted" {
+		return
+	}
+
+	var signals []string
+	if ev.Type == "new" || ev.Type == "stream_new" {
+		signals = append(signals, sigNewFile)
+	}
+	if executableExts[strings.ToLower(filepath.Ext(ev.Path))] {
+		signals = append(signals, sigExecutable)
+	}
+	upload := inUploadDir(ev.Path)
+	for _, dir := range risk.UploadDirs {
+		upload = upload || underDir(ev.Path, dir)
+	}
+	if upload {
+		signals = append(signals, sigUploadDir)
+	}
+
+	contentPath := ev.Path
+	if ev.Stream != "" {
+		contentPath = ev.Path + ":" + ev.Stream
+	}
+	if sample, err := readSample(contentPath); err == nil {
+		if shannonEntropy(sample) >= highEntropyBits {
+			signals = append(signals, sigHighEntropy)
+		}
+		if len(matchWebshell(sample)) > 0 {
+			signals = append(signals, sigWebshell)
+		}
+	}
+
+	score := 0
+	for _, s := range signals {
+		score += riskWeights[s]
+	}
+	if score > 100 {
+		score = 100
+	}
+	ev.Risk = score
+	ev.Signals = signals
+
+	for _, rule := range risk.Thresholds {
+		if score < rule.Score {
+			break
+		}
+		if rule.Severity != "" {
+			ev.Severity = maxSeverity(ev.Severity, rule.Severity)
+		}
+		for _, ch := range rule.Channels {
+			if !containsString(ev.extra, ch) {
+				ev.extra = append(ev.extra, ch)
+			}
+		}
+	}
+}
+
+// addSignal 在评分之后追加信号并累加权重
+func addSignal(ev *Event, sig string) {
+	ev.Signals = append(ev.Signals, sig)
+	ev.Risk += riskWeights[sig]
+	if ev.Risk > 100 {
+		ev.Risk = 100
+	}
+}
+
+func autoAcceptable(ev Event) bool {
+	return risk.AutoAcceptBelow > 0 && ev.Risk < risk.AutoAcceptBelow
+}
+
+func readSample(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	_, err = io.CopyN(&buf, f, riskSampleSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shannonEntropy 返回每字节的信息熵（bits），样本太小时返回 0
+func shannonEntropy(data []byte) float64 {
+	if len(data) < 256 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	n := float64(len(data))
+	h := 0.0
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
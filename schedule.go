@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduleRule 定义一个时间窗口内的扫描间隔，interval 为 off 表示该窗口内不扫描
+type ScheduleRule struct {
+	Days     []string `json:"days"` // mon..sun，留空表示每天
+	From     string   `json:"from"` // HH:MM
+	To       string   `json:"to"`   // HH:MM，小于 from 表示跨过午夜
+	Interval string   `json:"interval"`
+}
+
+type scheduleWindow struct {
+	days     map[time.Weekday]bool
+	from, to int // 当天的分钟数
+	interval time.Duration
+	off      bool
+	label    string
+}
+
+var scanCalendar []scheduleWindow
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseSchedule(rules []ScheduleRule) ([]scheduleWindow, error) {
+	var windows []scheduleWindow
+	for i, r := range rules {
+		w, err := parseWindow(r.Days, r.From, r.To)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条扫描计划%v", i+1, err)
+		}
+
+		switch strings.ToLower(r.Interval) {
+		case "off", "never":
+			w.off = true
+		default:
+			if w.interval, err = time.ParseDuration(r.Interval); err != nil || w.interval <= 0 {
+				return nil, fmt.Errorf("第 %d 条扫描计划的间隔无效: %s", i+1, r.Interval)
+			}
+		}
+		w.label = fmt.Sprintf("%s %s-%s %s", strings.Join(r.Days, ","), r.From, r.To, r.Interval)
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseWindow 解析星期和起止时间，供扫描计划和通知静默时段共用
+func parseWindow(days []string, from, to string) (scheduleWindow, error) {
+	w := scheduleWindow{days: make(map[time.Weekday]bool)}
+	for _, d := range days {
+		wd, ok := weekdayNames[strings.ToLower(d)[:min(3, len(d))]]
+		if !ok {
+			return w, fmt.Errorf("的星期无效: %s", d)
+		}
+		w.days[wd] = true
+	}
+
+	var err error
+	if w.from, err = parseClock(from, 0); err != nil {
+		return w, fmt.Errorf("的开始时间无效: %v", err)
+	}
+	if w.to, err = parseClock(to, 24*60); err != nil {
+		return w, fmt.Errorf("的结束时间无效: %v", err)
+	}
+	return w, nil
+}
+
+func parseClock(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w scheduleWindow) matches(t time.Time) bool {
+	tod := t.Hour()*60 + t.Minute()
+	day := func(wd time.Weekday) bool { return len(w.days) == 0 || w.days[wd] }
+
+	if w.from <= w.to {
+		return day(t.Weekday()) && tod >= w.from && tod < w.to
+	}
+	// 跨午夜的窗口：开始当天的晚段或次日的早段
+	if tod >= w.from {
+		return day(t.Weekday())
+	}
+	return tod < w.to && day((t.Weekday()+6)%7)
+}
+
+// intervalAt 返回某一时刻生效的扫描间隔，ok 为 false 表示当前禁止扫描
+func intervalAt(t time.Time) (interval time.Duration, ok bool) {
+	for _, w := range scanCalendar {
+		if w.matches(t) {
+			return w.interval, !w.off
+		}
+	}
+	return checkInterval, true
+}
+
+// nextScanWait 计算距离下一个监控目录到期还需等待多久，各目录按自己的检查间隔计算；
+// 为了及时响应窗口切换，最长等待一分钟后重新计算
+func nextScanWait() time.Duration {
+	t := now()
+	if _, ok := intervalAt(t); !ok {
+		return time.Minute
+	}
+	dbMu.Lock()
+	dirs := monitorDirs
+	dbMu.Unlock()
+	wait := time.Minute
+	for _, d := range dirs {
+		interval := rootInterval(d, t)
+		if w := rootScanned[d].Add(interval).Sub(t) - dueSlack(interval); w < wait {
+			wait = w
+		}
+	}
+	return max(wait, 0)
+}
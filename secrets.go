@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// 凭据字段中以 enc: 开头的字符串是用主密钥加密过的值（AES-256-GCM，base64 编码），
+// env:、file:、vault: 开头的字符串在启动时从外部来源读取
+const (
+	encPrefix   = "enc:"
+	envPrefix   = "env:"
+	filePrefix  = "file:"
+	vaultPrefix = "vault:"
+)
+
+var masterKeyFile string
+
+// masterKeySize 为主密钥的字节数。主密钥直接用作 AES-256 密钥，必须随机生成，不接受口令
+const masterKeySize = 32
+
+// loadMasterKey 从 WEBMON_MASTER_KEY 环境变量或密钥文件读取主密钥，返回 32 字节 AES 密钥
+func loadMasterKey() ([]byte, error) {
+	material := os.Getenv("WEBMON_MASTER_KEY")
+	source := "WEBMON_MASTER_KEY"
+	if material == "" {
+		path := masterKeyFile
+		if path == "" {
+			path = os.Getenv("WEBMON_MASTER_KEY_FILE")
+		}
+		if path == "" {
+			return nil, fmt.Errorf("配置中含有加密值，但未通过 WEBMON_MASTER_KEY 或 -master-key-file 提供主密钥")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取主密钥文件: %v", err)
+		}
+		material = strings.TrimSpace(string(data))
+		source = "主密钥文件 " + path
+	}
+	key, err := parseMasterKey(material)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", source, err)
+	}
+	return key, nil
+}
+
+// parseMasterKey 解码十六进制或 base64 编码的 32 字节主密钥，例如 openssl rand -base64 32 的输出
+func parseMasterKey(s string) ([]byte, error) {
+	if len(s) == 2*masterKeySize {
+		if key, err := hex.DecodeString(s); err == nil {
+			return key, nil
+		}
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(s); err == nil && len(key) == masterKeySize {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("主密钥必须是随机生成的 %d 字节，以 base64 或十六进制编码（可用 openssl rand -base64 32 生成），不能使用口令", masterKeySize)
+}
+
+func encryptSecret(key []byte, plaintext string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(key []byte, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encPrefix))
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("密文长度不足")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败，主密钥是否正确: %v", err)
+	}
+	return string(plain), nil
+}
+
+// resolveSecrets 把配置中带 secret 标签的凭据字段里的加密值和外部引用替换为明文，
+// 其他字段（例如以 file: 开头的目录或排除规则）原样保留。
+// 每次加载配置都会重新解析，重新加载配置时通知渠道和 hash_db_key 使用新读取的凭据
+func resolveSecrets(config *Config) error {
+	r := &secretResolver{}
+
+	// 先解析 vault 配置本身，它也可以引用环境变量或文件
+	vault = VaultConfig{}
+	if err := r.walk(reflect.ValueOf(&config.Vault).Elem(), "vault"); err != nil {
+		return err
+	}
+	vault = config.Vault
+
+	return r.walk(reflect.ValueOf(config).Elem(), "")
+}
+
+// secretResolver 在遇到第一个 enc: 值时才读取主密钥
+type secretResolver struct {
+	key []byte
+}
+
+// walk 递归遍历结构体、指针、切片和映射，解析带 secret:"true" 标签的 string 和 []string 字段
+func (r *secretResolver) walk(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return r.walk(v.Elem(), path)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// 映射的值不可寻址，复制出来解析后再写回
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := r.walk(elem, fmt.Sprintf("%s.%v", path, iter.Key())); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			if path == "" && name == "vault" {
+				continue
+			}
+			fv := v.Field(i)
+			if field.Tag.Get("secret") != "true" {
+				if err := r.walk(fv, name); err != nil {
+					return err
+				}
+				continue
+			}
+			switch {
+			case fv.Kind() == reflect.String:
+				plain, err := r.resolve(fv.String())
+				if err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				fv.SetString(plain)
+			case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+				for j := 0; j < fv.Len(); j++ {
+					plain, err := r.resolve(fv.Index(j).String())
+					if err != nil {
+						return fmt.Errorf("%s[%d]: %v", name, j, err)
+					}
+					fv.Index(j).SetString(plain)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolve 解密 enc: 值或读取 env:/file:/vault: 引用，其他值原样返回
+func (r *secretResolver) resolve(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, encPrefix):
+		if r.key == nil {
+			key, err := loadMasterKey()
+			if err != nil {
+				return s, err
+			}
+			r.key = key
+		}
+		return decryptSecret(r.key, s)
+	case strings.HasPrefix(s, envPrefix), strings.HasPrefix(s, filePrefix), strings.HasPrefix(s, vaultPrefix):
+		return resolveSecretRef(s)
+	}
+	return s, nil
+}
+
+// runEncryptSecret 从标准输入读取明文，输出可直接写入配置文件的加密值
+func runEncryptSecret() int {
+	key, err := loadMasterKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Fprintln(os.Stderr, "请输入要加密的值:")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	value, err := encryptSecret(key, strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Println(value)
+	return 0
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+// TestResolveSecretsOnlyCredentials 检查只有凭据字段解析引用，以 file: 开头的排除规则原样保留
+func TestResolveSecretsOnlyCredentials(t *testing.T) {
+	t.Setenv("WEBMON_TEST_SMTP_PASSWORD", "s3cret")
+	var config Config
+	config.Wenjian.Exclude = []string{"file:*.tmp"}
+	config.Notify.Email.Password = "env:WEBMON_TEST_SMTP_PASSWORD"
+	if err := resolveSecrets(&config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Notify.Email.Password; got != "s3cret" {
+		t.Errorf("notify.email.password = %q, want s3cret", got)
+	}
+	if got := config.Wenjian.Exclude[0]; got != "file:*.tmp" {
+		t.Errorf("wenjian.exclude[0] = %q, want it unchanged", got)
+	}
+
+	config.Notify.Email.Password = "env:WEBMON_TEST_UNSET"
+	if err := resolveSecrets(&config); err == nil {
+		t.Error("expected an error for an unset environment variable")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultConfig 配置 HashiCorp Vault，未填写时使用 VAULT_ADDR / VAULT_TOKEN 环境变量
+type VaultConfig struct {
+	Address   string `json:"address"`
+	Token     string `json:"token" secret:"true"`
+	TokenFile string `json:"token_file"`
+	Namespace string `json:"namespace"`
+}
+
+var vault VaultConfig
+
+// resolveSecretRef 解析 env:NAME、file:/path、vault:path#field 形式的引用
+func resolveSecretRef(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, envPrefix):
+		name := strings.TrimPrefix(ref, envPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("环境变量 %s 未设置", name)
+		}
+		return v, nil
+
+	case strings.HasPrefix(ref, filePrefix):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, filePrefix))
+		if err != nil {
+			return "", fmt.Errorf("无法读取密钥文件: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	case strings.HasPrefix(ref, vaultPrefix):
+		return readVaultSecret(strings.TrimPrefix(ref, vaultPrefix))
+	}
+	return ref, nil
+}
+
+// readVaultSecret 读取 Vault 中的一个字段，同时兼容 KV v1 和 KV v2
+func readVaultSecret(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || field == "" {
+		return "", fmt.Errorf("vault 引用格式应为 vault:路径#字段: %s", ref)
+	}
+
+	addr := vault.Address
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	token := vault.Token
+	if token == "" && vault.TokenFile != "" {
+		data, err := os.ReadFile(vault.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("无法读取 vault token 文件: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("引用了 vault 但未配置 vault 地址或 token")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if vault.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vault.Namespace)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("访问 vault 错误: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault 返回 %s: %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("解析 vault 响应错误: %v", err)
+	}
+
+	data := body.Data
+	// KV v2 把实际数据放在 data.data 下
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = inner
+		}
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault 路径 %s 中没有字段 %s", path, field)
+	}
+	return fmt.Sprint(v), nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SEOWatchConfig 重点监控 SEO 黑链常见的注入目标：robots.txt、sitemap*.xml、ads.txt 和 .well-known/，
+// 这些文件变化时提升级别，并在警报中附带内容差异
+type SEOWatchConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Patterns []string `json:"patterns"` // 额外的文件名通配符，例如 "baidu_verify_*.html"
+	Severity string   `json:"severity"` // 默认 high
+	MaxSize  int64    `json:"max_size"` // 超过该大小不保存内容、不做差异，默认 1MB
+}
+
+const sigSEOFile = "seo_file"
+
+var (
+	seoWatch    SEOWatchConfig
+	seoPatterns = []string{"robots.txt", "sitemap*.xml", "ads.txt", "app-ads.txt", "humans.txt", "security.txt"}
+)
+
+// 差异最多显示的行数
+const maxDiffLines = 30
+
+func applySEOWatchConfig(c SEOWatchConfig) error {
+	if c.Severity == "" {
+		c.Severity = sevHigh
+	}
+	if !validSeverity(c.Severity) {
+		return fmt.Errorf("无效的级别: %s", c.Severity)
+	}
+	for _, p := range c.Patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("无效的文件名通配符 %q: %v", p, err)
+		}
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1 << 20
+	}
+	seoWatch = c
+	return nil
+}
+
+func isSEOFile(path string) bool {
+	if !seoWatch.Enabled {
+		return false
+	}
+	if strings.Contains(filepath.ToSlash(path), "/.well-known/") {
+		return true
+	}
+	name := strings.ToLower(filepath.Base(path))
+	for _, p := range append(seoPatterns, seoWatch.Patterns...) {
+		if ok, _ := filepath.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// seoCacheFile 返回保存该文件上次内容的位置，位于哈希数据库旁的 .seo 目录
+func seoCacheFile(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(hashDBFile+".seo", hex.EncodeToString(sum[:16]))
+}
+
+func readSEOContent(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > seoWatch.MaxSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func cacheSEOContent(path, content string) {
+	if readOnly {
+		return
+	}
+	file := seoCacheFile(path)
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err == nil {
+		err = os.WriteFile(file, []byte(content), 0600)
+	}
+	if err != nil {
+		log.Printf("保存 %s 的内容副本错误: %v", path, err)
+	}
+}
+
+// seedSEOCache 为基线中还没有内容副本的重点文件保存副本，供之后计算差异
+func seedSEOCache() {
+	if !seoWatch.Enabled {
+		return
+	}
+	dbMu.Lock()
+	var paths []string
+	for path := range hashDB {
+		if isSEOFile(path) {
+			paths = append(paths, path)
+		}
+	}
+	dbMu.Unlock()
+
+	for _, path := range paths {
+		if _, err := os.Stat(seoCacheFile(path)); err == nil {
+			continue
+		}
+		if content, ok := readSEOContent(path); ok {
+			cacheSEOContent(path, content)
+		}
+	}
+}
+
+// checkSEOFile 提升重点文件变动的级别并附上与上次内容的差异
+func checkSEOFile(ev *Event) {
+	if ev.Stream != "" || !isSEOFile(ev.Path) {
+		return
+	}
+	ev.Severity = maxSeverity(ev.Severity, seoWatch.Severity)
+	addSignal(ev, sigSEOFile)
+
+	oldPath := ev.Path
+	if ev.Type == "renamed" {
+		oldPath = ev.OldPath
+	}
+	old, _ := os.ReadFile(seoCacheFile(oldPath))
+
+	if ev.Type == "deleted" {
+		os.Remove(seoCacheFile(ev.Path))
+		return
+	}
+	content, ok := readSEOContent(ev.Path)
+	if !ok {
+		return
+	}
+	if ev.Type != "renamed" {
+		ev.Diff = lineDiff(string(old), content, maxDiffLines)
+	}
+	cacheSEOContent(ev.Path, content)
+}
+
+// lineDiff 按最长公共子序列逐行比较，返回以 "+ "、"- " 开头的增删行，最多 limit 行
+func lineDiff(old, new string, limit int) string {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// 去掉相同的开头和结尾，减少计算量
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	var out []string
+	if len(a)*len(b) > 4000000 {
+		// 太大时退化为只列出增删的行
+		inA := make(map[string]bool, len(a))
+		inB := make(map[string]bool, len(b))
+		for _, l := range a {
+			inA[l] = true
+		}
+		for _, l := range b {
+			inB[l] = true
+		}
+		for _, l := range a {
+			if !inB[l] {
+				out = append(out, "- "+l)
+			}
+		}
+		for _, l := range b {
+			if !inA[l] {
+				out = append(out, "+ "+l)
+			}
+		}
+	} else {
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				i++
+				j++
+			case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+				out = append(out, "+ "+b[j])
+				j++
+			default:
+				out = append(out, "- "+a[i])
+				i++
+			}
+		}
+	}
+
+	if len(out) > limit {
+		out = append(out[:limit], fmt.Sprintf("... 另有 %d 行", len(out)-limit))
+	}
+	return strings.Join(out, "\n")
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
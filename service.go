@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 服务管理子命令：install-service、uninstall-service、start-service、stop-service。
+// Linux 上安装为 systemd 单元，Windows 上注册到服务控制管理器（SCM）。
+// 服务以安装时的工作目录和绝对路径的 -config、-db、-log 运行，其余参数原样传给守护进程
+
+// serviceOptions 为服务管理子命令的选项
+type serviceOptions struct {
+	name     string
+	user     string
+	unitDir  string
+	print    bool
+	noEnable bool
+	exe      string
+	workDir  string
+	args     []string // 传给守护进程的参数
+}
+
+var serviceOpt serviceOptions
+
+var serviceCommands = map[string]func(serviceOptions) error{
+	"install-service":   installService,
+	"uninstall-service": uninstallService,
+	"start-service":     startService,
+	"stop-service":      stopService,
+}
+
+func isServiceCommand(name string) bool {
+	return serviceCommands[name] != nil
+}
+
+func runServiceCommand(sub string, args []string) int {
+	fs := flag.NewFlagSet(sub, flag.ExitOnError)
+	fs.StringVar(&serviceOpt.name, "name", "webmonitor", "Service name")
+	if sub == "install-service" || sub == "uninstall-service" {
+		fs.StringVar(&serviceOpt.unitDir, "unit-dir", "/etc/systemd/system", "Directory of the systemd unit (Linux only)")
+	}
+	if sub == "install-service" {
+		fs.StringVar(&configFile, "config", defaultConfigFile, "Path to configuration file (JSON, or YAML/TOML by .yaml/.yml/.toml extension)")
+		fs.StringVar(&hashDBFile, "db", "data/hashdb.json", "Path to hash database file")
+		fs.StringVar(&logFilePath, "log", "data/webmonitor.log", "Path to log file")
+		fs.StringVar(&serviceOpt.user, "user", "", "Run the service as this user (default root / LocalSystem, which can read every monitored file)")
+		fs.BoolVar(&serviceOpt.print, "print", false, "Print the service definition to stdout instead of installing it")
+		fs.BoolVar(&serviceOpt.noEnable, "no-enable", false, "Install the service but do not enable or start it")
+		fs.Usage = func() {
+			fmt.Fprintln(os.Stderr, "用法: install-service [选项] [-- 传给守护进程的其他参数]")
+			fs.PrintDefaults()
+		}
+	}
+	fs.Parse(args)
+
+	if sub == "install-service" {
+		if err := prepareServiceInstall(fs.Args()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	} else if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "用法: %s [-name 服务名]\n", sub)
+		return exitError
+	}
+
+	if err := serviceCommands[sub](serviceOpt); err != nil {
+		fmt.Fprintf(os.Stderr, "%s 失败: %v\n", sub, err)
+		return exitError
+	}
+	return exitClean
+}
+
+// prepareServiceInstall 确定程序路径、工作目录和守护进程的参数
+func prepareServiceInstall(extra []string) error {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return fmt.Errorf("无法确定程序路径: %v", err)
+	}
+	serviceOpt.exe = exe
+	if serviceOpt.workDir, err = os.Getwd(); err != nil {
+		return fmt.Errorf("无法确定工作目录: %v", err)
+	}
+	// 服务的工作目录与当前目录相同，仍然写成绝对路径，便于查看服务定义时一眼看出用的是哪些文件
+	for _, p := range []*string{&configFile, &hashDBFile, &logFilePath} {
+		if *p, err = filepath.Abs(*p); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(configFile); err != nil {
+		return fmt.Errorf("配置文件不可用: %v", err)
+	}
+	serviceOpt.args = append([]string{"-config", configFile, "-db", hashDBFile, "-log", logFilePath}, extra...)
+	return nil
+}
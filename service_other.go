@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package main
+
+import "fmt"
+
+var errServiceUnsupported = fmt.Errorf("服务管理子命令只支持 Linux（systemd）和 Windows")
+
+func installService(o serviceOptions) error   { return errServiceUnsupported }
+func uninstallService(o serviceOptions) error { return errServiceUnsupported }
+func startService(o serviceOptions) error     { return errServiceUnsupported }
+func stopService(o serviceOptions) error      { return errServiceUnsupported }
+
+func startServiceMode() {}
+
+func reportServiceStopped() {}
@@ -0,0 +1,341 @@
+//go:build windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Windows 服务：install-service 把程序注册为自动启动的服务（崩溃后由 SCM 重启），
+// SCM 启动服务时带上 -service 参数，进程连接 SCM 后照常运行守护进程，收到停止或关机请求时与 SIGTERM 一样优雅退出
+
+var (
+	modadvapi32                      = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW               = modadvapi32.NewProc("OpenSCManagerW")
+	procCreateServiceW               = modadvapi32.NewProc("CreateServiceW")
+	procOpenServiceW                 = modadvapi32.NewProc("OpenServiceW")
+	procDeleteService                = modadvapi32.NewProc("DeleteService")
+	procStartServiceW                = modadvapi32.NewProc("StartServiceW")
+	procControlService               = modadvapi32.NewProc("ControlService")
+	procQueryServiceStatus           = modadvapi32.NewProc("QueryServiceStatus")
+	procCloseServiceHandle           = modadvapi32.NewProc("CloseServiceHandle")
+	procChangeServiceConfig2W        = modadvapi32.NewProc("ChangeServiceConfig2W")
+	procStartServiceCtrlDispatcherW  = modadvapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerEx = modadvapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus             = modadvapi32.NewProc("SetServiceStatus")
+)
+
+const (
+	scManagerAll        = 0xF003F
+	serviceAllAccess    = 0xF01FF
+	serviceWin32Own     = 0x10
+	serviceAutoStart    = 2
+	serviceErrorNormal  = 1
+	serviceConfigDesc   = 1
+	serviceConfigFail   = 2
+	scActionRestart     = 1
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+	serviceAcceptStop   = 1
+	serviceAcceptShut   = 4
+	serviceControlStop  = 1
+	serviceControlQuery = 4
+	serviceControlShut  = 5
+	errServiceExists    = syscall.Errno(1073)
+	errServiceNotActive = syscall.Errno(1062)
+)
+
+// serviceStatus 对应 SERVICE_STATUS
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// scAction 和 serviceFailureActions 对应 SC_ACTION 和 SERVICE_FAILURE_ACTIONSW
+type scAction struct {
+	Type  uint32
+	Delay uint32
+}
+
+type serviceFailureActions struct {
+	ResetPeriod uint32
+	RebootMsg   *uint16
+	Command     *uint16
+	Actions     uint32
+	ActionList  *scAction
+}
+
+var (
+	// 由 SCM 启动时 install-service 写入的服务名和工作目录
+	serviceName string
+	serviceDir  string
+
+	serviceHandle uintptr
+	serviceStop   = make(chan struct{}, 1)
+	serviceDone   = make(chan struct{})
+)
+
+func init() {
+	flag.StringVar(&serviceName, "service", "", "Run under the Windows service control manager with this service name (set by install-service)")
+	flag.StringVar(&serviceDir, "service-dir", "", "Working directory when running as a Windows service (set by install-service)")
+}
+
+func utf16Ptr(s string) *uint16 {
+	p, _ := syscall.UTF16PtrFromString(s)
+	return p
+}
+
+func serviceCall(p *syscall.LazyProc, args ...uintptr) (uintptr, error) {
+	r, _, err := p.Call(args...)
+	if r == 0 {
+		return 0, err
+	}
+	return r, nil
+}
+
+func openSCManager() (uintptr, error) {
+	h, err := serviceCall(procOpenSCManagerW, 0, 0, scManagerAll)
+	if err != nil {
+		return 0, fmt.Errorf("无法连接服务控制管理器（需要管理员权限）: %v", err)
+	}
+	return h, nil
+}
+
+// openService 打开已注册的服务，调用方负责关闭两个句柄
+func openService(name string) (uintptr, uintptr, error) {
+	scm, err := openSCManager()
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := serviceCall(procOpenServiceW, scm, uintptr(unsafe.Pointer(utf16Ptr(name))), serviceAllAccess)
+	if err != nil {
+		procCloseServiceHandle.Call(scm)
+		return 0, 0, fmt.Errorf("无法打开服务 %s: %v", name, err)
+	}
+	return scm, h, nil
+}
+
+func serviceCommandLine(o serviceOptions) string {
+	args := append([]string{o.exe, "-service", o.name, "-service-dir", o.workDir}, o.args...)
+	for i, a := range args {
+		args[i] = syscall.EscapeArg(a)
+	}
+	return strings.Join(args, " ")
+}
+
+func installService(o serviceOptions) error {
+	cmdline := serviceCommandLine(o)
+	if o.print {
+		fmt.Println(cmdline)
+		return nil
+	}
+	scm, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(scm)
+
+	var user uintptr
+	if o.user != "" {
+		// 只支持不需要密码的内置账户，例如 NT AUTHORITY\LocalService
+		user = uintptr(unsafe.Pointer(utf16Ptr(o.user)))
+	}
+	h, _, callErr := procCreateServiceW.Call(scm,
+		uintptr(unsafe.Pointer(utf16Ptr(o.name))), uintptr(unsafe.Pointer(utf16Ptr(appversion))),
+		serviceAllAccess, serviceWin32Own, serviceAutoStart, serviceErrorNormal,
+		uintptr(unsafe.Pointer(utf16Ptr(cmdline))), 0, 0, 0, user, 0)
+	if h == 0 {
+		if callErr == errServiceExists {
+			return fmt.Errorf("服务 %s 已存在，请先执行 uninstall-service", o.name)
+		}
+		return callErr
+	}
+	defer procCloseServiceHandle.Call(h)
+
+	desc := utf16Ptr("监控网站目录中的文件篡改并发送警报")
+	procChangeServiceConfig2W.Call(h, serviceConfigDesc, uintptr(unsafe.Pointer(&desc)))
+	// 进程异常退出后 5 秒重启，一天内没有再失败则重新计数
+	actions := []scAction{{scActionRestart, 5000}, {scActionRestart, 5000}, {scActionRestart, 60000}}
+	fail := serviceFailureActions{ResetPeriod: 86400, Actions: uint32(len(actions)), ActionList: &actions[0]}
+	if _, err := serviceCall(procChangeServiceConfig2W, h, serviceConfigFail, uintptr(unsafe.Pointer(&fail))); err != nil {
+		fmt.Fprintf(os.Stderr, "警告：无法设置服务失败后重启: %v\n", err)
+	}
+	fmt.Printf("服务 %s 已注册: %s\n", o.name, cmdline)
+
+	if o.noEnable {
+		fmt.Printf("执行 start-service -name %s 启动服务\n", o.name)
+		return nil
+	}
+	if _, err := serviceCall(procStartServiceW, h, 0, 0); err != nil {
+		return fmt.Errorf("服务已注册但无法启动: %v", err)
+	}
+	fmt.Printf("服务 %s 已启动\n", o.name)
+	return nil
+}
+
+func uninstallService(o serviceOptions) error {
+	scm, h, err := openService(o.name)
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(scm)
+	defer procCloseServiceHandle.Call(h)
+	if err := controlAndWait(h, o.name); err != nil && err != errServiceNotActive {
+		return err
+	}
+	if _, err := serviceCall(procDeleteService, h); err != nil {
+		return err
+	}
+	fmt.Printf("服务 %s 已停止并删除\n", o.name)
+	return nil
+}
+
+func startService(o serviceOptions) error {
+	scm, h, err := openService(o.name)
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(scm)
+	defer procCloseServiceHandle.Call(h)
+	if _, err := serviceCall(procStartServiceW, h, 0, 0); err != nil {
+		return err
+	}
+	fmt.Printf("服务 %s 已启动\n", o.name)
+	return nil
+}
+
+func stopService(o serviceOptions) error {
+	scm, h, err := openService(o.name)
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(scm)
+	defer procCloseServiceHandle.Call(h)
+	if err := controlAndWait(h, o.name); err != nil {
+		return err
+	}
+	fmt.Printf("服务 %s 已停止\n", o.name)
+	return nil
+}
+
+// controlAndWait 发送停止请求并等待服务进入停止状态，最多 30 秒
+func controlAndWait(h uintptr, name string) error {
+	var st serviceStatus
+	if _, err := serviceCall(procControlService, h, serviceControlStop, uintptr(unsafe.Pointer(&st))); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(300 * time.Millisecond) {
+		if _, err := serviceCall(procQueryServiceStatus, h, uintptr(unsafe.Pointer(&st))); err != nil {
+			return err
+		}
+		if st.CurrentState == serviceStopped {
+			return nil
+		}
+	}
+	return fmt.Errorf("等待服务 %s 停止超时", name)
+}
+
+func setServiceState(state uint32) {
+	st := serviceStatus{ServiceType: serviceWin32Own, CurrentState: state}
+	switch state {
+	case serviceRunning:
+		st.ControlsAccepted = serviceAcceptStop | serviceAcceptShut
+	case serviceStartPending, serviceStopPending:
+		// 退出时最长等待 20 秒发送通知，再加上保存基线的时间
+		st.WaitHint = 30000
+	}
+	procSetServiceStatus.Call(serviceHandle, uintptr(unsafe.Pointer(&st)))
+}
+
+// reportServiceStopped 在退出前告知 SCM 服务已停止
+func reportServiceStopped() {
+	if serviceHandle == 0 {
+		return
+	}
+	setServiceState(serviceStopped)
+	close(serviceDone)
+}
+
+// serviceCtrlHandler 对应 HandlerEx，在 SCM 的线程上被调用
+func serviceCtrlHandler(control, eventType, eventData, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShut:
+		setServiceState(serviceStopPending)
+		select {
+		case serviceStop <- struct{}{}:
+		default:
+		}
+	case serviceControlQuery:
+	default:
+		return 120 // ERROR_CALL_NOT_IMPLEMENTED
+	}
+	return 0
+}
+
+// startServiceMode 由 SCM 启动时连接 SCM 并切换到安装时的工作目录。
+// 连接 SCM 的调用会一直阻塞到服务停止，因此放在单独的线程上，守护进程照常在主 goroutine 中运行
+func startServiceMode() {
+	if serviceName == "" {
+		return
+	}
+	if serviceDir != "" {
+		if err := os.Chdir(serviceDir); err != nil {
+			log.Fatalf("无法切换到工作目录 %s: %v", serviceDir, err)
+		}
+	}
+	// 服务没有控制台，标准输出无效时日志只写入日志文件
+	if null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout, os.Stderr = null, null
+	}
+
+	ready := make(chan struct{})
+	failed := make(chan error, 1)
+	serviceMain := func(argc, argv uintptr) uintptr {
+		h, err := serviceCall(procRegisterServiceCtrlHandlerEx, uintptr(unsafe.Pointer(utf16Ptr(serviceName))),
+			syscall.NewCallback(serviceCtrlHandler), 0)
+		if err != nil {
+			failed <- err
+			return 0
+		}
+		serviceHandle = h
+		setServiceState(serviceRunning)
+		close(ready)
+		<-serviceStop
+		requestShutdown("收到服务停止请求")
+		// 等守护进程保存完基线并报告已停止后才返回
+		<-serviceDone
+		return 0
+	}
+	go func() {
+		runtime.LockOSThread()
+		table := []struct {
+			name *uint16
+			proc uintptr
+		}{{utf16Ptr(serviceName), syscall.NewCallback(serviceMain)}, {nil, 0}}
+		if _, err := serviceCall(procStartServiceCtrlDispatcherW, uintptr(unsafe.Pointer(&table[0]))); err != nil {
+			failed <- err
+		}
+	}()
+	select {
+	case <-ready:
+	case err := <-failed:
+		log.Fatalf("无法连接服务控制管理器（-service 只能由 SCM 使用）: %v", err)
+	case <-time.After(30 * time.Second):
+		log.Fatalf("等待服务控制管理器超时")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+const (
+	sevInfo     = "info"
+	sevLow      = "low"
+	sevWarning  = "warning"
+	sevHigh     = "high"
+	sevCritical = "critical"
+)
+
+var severityRank = map[string]int{
+	sevInfo:     0,
+	sevLow:      1,
+	sevWarning:  2,
+	sevHigh:     3,
+	sevCritical: 4,
+}
+
+func validSeverity(s string) bool {
+	_, ok := severityRank[strings.ToLower(s)]
+	return ok
+}
+
+// severityAtLeast 判断 s 是否不低于 min，未知级别按 info 处理
+func severityAtLeast(s, min string) bool {
+	return severityRank[strings.ToLower(s)] >= severityRank[strings.ToLower(min)]
+}
+
+func maxSeverity(a, b string) string {
+	if severityAtLeast(a, b) {
+		return a
+	}
+	return b
+}
+
+// defaultSeverity 按事件类型给出默认级别
+func defaultSeverity(ev Event) string {
+	if isSpecialEvent(ev) {
+		return sevCritical
+	}
+	switch ev.Type {
+	case "new", "modified", "renamed":
+		return sevWarning
+	case "deleted":
+		return sevLow
+	case "stream_new", "stream_modified":
+		// 浏览器下载标记 Zone.Identifier 很常见，其余备用数据流多半用于隐藏代码
+		if ev.Stream == "Zone.Identifier" {
+			return sevLow
+		}
+		return sevHigh
+	case "stream_deleted":
+		return sevWarning
+	case "attributes":
+		// 只有修改时间变化多半是复制或部署时未保留时间戳，权限和属主变化更可疑
+		for _, a := range ev.Attributes {
+			if a != attrMTime {
+				return sevWarning
+			}
+		}
+		return sevLow
+	}
+	return sevInfo
+}
+
+// SeverityRule 按事件类型和路径指定事件的初始级别，例如缓存目录的删除定为 info、index.php 的修改定为 critical。
+// paths 与排除规则的写法相同；按顺序使用第一条匹配的规则，之后的内容检查仍然可以提升级别
+type SeverityRule struct {
+	Types    []string `json:"types"` // 事件类型，留空表示所有类型
+	Paths    []string `json:"paths"` // 留空表示所有路径
+	Severity string   `json:"severity"`
+}
+
+var (
+	severityRules []SeverityRule
+	// channelMinSeverity 按渠道名配置的最低级别，低于该级别的警报不发送到该渠道，由 notifierMu 保护
+	channelMinSeverity map[string]string
+)
+
+var eventTypes = []string{"new", "modified", "deleted", "renamed", "attributes", "stream_new", "stream_modified", "stream_deleted"}
+
+func applySeverityRules(rules []SeverityRule) error {
+	for i, r := range rules {
+		if !validSeverity(r.Severity) {
+			return fmt.Errorf("第 %d 条级别规则的级别 %q 无效", i+1, r.Severity)
+		}
+		for _, t := range r.Types {
+			if !containsString(eventTypes, t) {
+				return fmt.Errorf("第 %d 条级别规则的事件类型 %q 无效", i+1, t)
+			}
+		}
+		if err := validateExcludes(r.Paths); err != nil {
+			return fmt.Errorf("第 %d 条级别规则: %v", i+1, err)
+		}
+		rules[i].Severity = strings.ToLower(r.Severity)
+	}
+	severityRules = rules
+	return nil
+}
+
+func validateChannelMinSeverity(m map[string]string) error {
+	for name, sev := range m {
+		if !validSeverity(sev) {
+			return fmt.Errorf("渠道 %s 的最低级别 %q 无效", name, sev)
+		}
+	}
+	return nil
+}
+
+// initialSeverity 返回第一条匹配的级别规则指定的级别，没有匹配时使用所在监控目录配置的级别，
+// 再按事件类型给出默认级别；特殊文件总是 critical，级别规则也不能降低
+func initialSeverity(ev Event) string {
+	if isSpecialEvent(ev) {
+		return sevCritical
+	}
+	for _, r := range severityRules {
+		if len(r.Types) > 0 && !containsString(r.Types, ev.Type) {
+			continue
+		}
+		if len(r.Paths) > 0 && !matcher.Matches(ev.Path, r.Paths) {
+			continue
+		}
+		return r.Severity
+	}
+	if p := profileFor(ev.Path); p != nil && p.Severity != "" {
+		return p.Severity
+	}
+	return defaultSeverity(ev)
+}
+
+// belowChannelMin 判断警报是否低于渠道配置的最低级别
+func belowChannelMin(name string, n Notification) bool {
+	notifierMu.Lock()
+	min, ok := channelMinSeverity[name]
+	notifierMu.Unlock()
+	return ok && !severityAtLeast(n.Severity, min)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 优雅退出：收到 SIGTERM/SIGINT（或 Windows 服务停止请求）后不再开始新的扫描，正在进行的遍历
+// 尽快中止并丢弃其结果（不完整的遍历会把没走到的文件误报为删除），然后发送缓存的警报、
+// 保存基线和统计后退出。再次收到信号时立即退出
+
+// shutdownTimeout 为退出前等待通知和日志发送完成的最长时间
+const shutdownTimeout = 20 * time.Second
+
+var (
+	shutdownCh   = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+// requestShutdown 通知主循环停止，可以多次调用
+func requestShutdown(reason string) {
+	shutdownOnce.Do(func() {
+		log.Printf("%s，正在停止...", reason)
+		close(shutdownCh)
+	})
+}
+
+// shuttingDown 判断是否已经开始退出，扫描遍历和哈希任务据此中止
+func shuttingDown() bool {
+	select {
+	case <-shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func startSignalHandler() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadFromSignal()
+		}
+	}()
+
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		requestShutdown("收到信号 " + s.String())
+		s = <-sig
+		log.Printf("再次收到信号 %v，立即退出", s)
+		os.Exit(exitError)
+	}()
+}
+
+// shutdown 在主循环结束后执行退出前的清理，返回进程的退出码
+func shutdown() int {
+	// 等待按需检查、深度审计等持有 scanMu 的操作结束，之后不再开始新的扫描
+	scanMu.Lock()
+
+	// 缓存到扫描结束的事件和静默时段内积压的警报，退出后就会丢失，立即发送
+	flushScanEvents()
+	flushQuietHours(true)
+	agentFlushQueue()
+
+	done := make(chan struct{})
+	go func() {
+		sendWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		log.Printf("等待通知发送超过 %v，不再等待", shutdownTimeout)
+	}
+	flushLogShippers(true)
+
+	code := exitClean
+	if err := saveHashDB(); err != nil {
+		log.Printf("保存哈希数据库失败: %v", err)
+		code = exitError
+	}
+	closeStorage()
+	saveChurnStats()
+	saveReportStats()
+
+	if pidFile != "" {
+		os.Remove(pidFile)
+	}
+	log.Println("已停止")
+	reportServiceStopped()
+	return code
+}
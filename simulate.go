@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ainaxiya/Website-server-file-tampering-monitoring/matcher"
+)
+
+// simulate 在监控目录下的临时沙箱目录中新增、修改和删除文件，逐步检查检测、级别、
+// 通知发送和数据库更新是否正常，作为整条处理链路的端到端自检
+
+const (
+	simulatePrefix  = ".webmonitor-simulate-"
+	simulateTimeout = 60 * time.Second // 等待通知发送完成的最长时间
+)
+
+type simCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type simStep struct {
+	Name   string     `json:"name"` // create, modify, delete
+	OK     bool       `json:"ok"`
+	Checks []simCheck `json:"checks"`
+}
+
+type simulateResult struct {
+	Status  string    `json:"status"` // pass, fail
+	Sandbox string    `json:"sandbox"`
+	Steps   []simStep `json:"steps"`
+	Errors  []string  `json:"errors"`
+}
+
+func (st *simStep) check(name string, ok bool, format string, args ...interface{}) {
+	st.Checks = append(st.Checks, simCheck{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+	if !ok {
+		st.OK = false
+	}
+}
+
+// runSimulation 在 root（为空时使用第一个监控目录）下执行一次自检，结束后删除沙箱和相关基线记录
+func runSimulation(root string) (simulateResult, error) {
+	res := simulateResult{Steps: []simStep{}, Errors: []string{}}
+	dbMu.Lock()
+	dirs := monitorDirs
+	dbMu.Unlock()
+	if root == "" && len(dirs) > 0 {
+		root = dirs[0]
+	}
+	root = filepath.Clean(root)
+	if !withinAny(root, dirs) {
+		return res, fmt.Errorf("%s 不在监控目录中", root)
+	}
+	sandbox := filepath.Join(root, simulatePrefix+now().Format("20060102150405"))
+	res.Sandbox = sandbox
+	phpFile := filepath.Join(sandbox, "simulate.php")
+	txtFile := filepath.Join(sandbox, "simulate.txt")
+	top, _ := rootFor(root, dirs)
+	for _, p := range []string{phpFile, txtFile} {
+		if rule, at, ok := matcher.MatchUnder(p, top, excludesFor(p)); ok {
+			return res, fmt.Errorf("沙箱路径 %s 匹配排除规则 %s，无法自检", at, rule)
+		}
+		if !included(p) {
+			return res, fmt.Errorf("沙箱文件 %s 不匹配 include 规则，无法自检", p)
+		}
+		if r, at, ok := ignoredUnder(p, top, false); ok {
+			return res, fmt.Errorf("沙箱路径 %s 匹配忽略文件中的规则 %s，无法自检", at, r)
+		}
+	}
+
+	if err := os.Mkdir(sandbox, 0755); err != nil {
+		return res, fmt.Errorf("创建沙箱目录失败: %v", err)
+	}
+	defer cleanupSimulation(sandbox)
+	log.Printf("开始端到端自检，沙箱目录: %s", sandbox)
+	alert(Notification{Severity: sevInfo, Text: fmt.Sprintf("开始端到端自检，接下来关于 %s 的警报由自检产生，无需处理", sandbox)})
+
+	phpContent := "<?php echo 'webmonitor simulate'; ?>\n"
+	txtContent := "webmonitor simulate\n"
+	txtModified := txtContent + "modified\n"
+	steps := []struct {
+		name   string
+		do     func() error
+		expect map[string]string // 路径 -> 期望的事件类型
+		hashes map[string]string // 路径 -> 期望的基线哈希，空字符串表示应从基线删除
+	}{
+		{"create", func() error {
+			if err := os.WriteFile(phpFile, []byte(phpContent), 0644); err != nil {
+				return err
+			}
+			return os.WriteFile(txtFile, []byte(txtContent), 0644)
+		}, map[string]string{phpFile: "new", txtFile: "new"},
+			map[string]string{phpFile: hashBytes([]byte(phpContent)), txtFile: hashBytes([]byte(txtContent))}},
+		{"modify", func() error {
+			return os.WriteFile(txtFile, []byte(txtModified), 0644)
+		}, map[string]string{txtFile: "modified"},
+			map[string]string{txtFile: hashBytes([]byte(txtModified))}},
+		{"delete", func() error {
+			return os.Remove(phpFile)
+		}, map[string]string{phpFile: "deleted"},
+			map[string]string{phpFile: ""}},
+	}
+
+	res.Status = "pass"
+	for _, s := range steps {
+		st := simStep{Name: s.name, OK: true, Checks: []simCheck{}}
+		started := now()
+		if err := s.do(); err != nil {
+			st.check("filesystem", false, "%v", err)
+			res.Steps = append(res.Steps, st)
+			res.Status = "fail"
+			break
+		}
+		v, err := checkPath(sandbox)
+		if err != nil {
+			st.check("scan", false, "%v", err)
+		} else {
+			st.check("scan", v.Status != "error", "检查了 %d 个文件，%d 个变动", v.Files, len(v.Changes))
+			res.Errors = append(res.Errors, v.Errors...)
+		}
+		simVerifyEvents(&st, started, s.expect)
+		simVerifyDelivery(&st, started, sandbox)
+		simVerifyBaseline(&st, s.hashes)
+		if !st.OK {
+			res.Status = "fail"
+		}
+		res.Steps = append(res.Steps, st)
+	}
+
+	sev := sevInfo
+	if res.Status != "pass" {
+		sev = sevHigh
+	}
+	log.Printf("端到端自检结束: %s", res.Status)
+	alert(Notification{Severity: sev, Text: fmt.Sprintf("端到端自检结束: %s\n%s", res.Status, formatSimulation(res))})
+	return res, nil
+}
+
+// simVerifyEvents 检查每个期望的变动都被记录，且级别不低于该类型的默认级别
+func simVerifyEvents(st *simStep, since time.Time, expect map[string]string) {
+	eventsMu.Lock()
+	events := append([]Event(nil), recentEvents...)
+	eventsMu.Unlock()
+
+	for path, typ := range expect {
+		var found *Event
+		for i := len(events) - 1; i >= 0; i-- {
+			if events[i].Path == path && events[i].Type == typ && !events[i].Time.Before(since) {
+				found = &events[i]
+				break
+			}
+		}
+		name := "detect " + filepath.Base(path)
+		if found == nil {
+			st.check(name, false, "没有检测到 %s 事件", typ)
+			continue
+		}
+		st.check(name, true, "%s", typ)
+		min := defaultSeverity(Event{Type: typ, Path: path})
+		st.check("severity "+filepath.Base(path), found.Severity != "" && severityAtLeast(found.Severity, min),
+			"%s（至少应为 %s，风险 %d）", found.Severity, min, found.Risk)
+	}
+}
+
+// simVerifyDelivery 等待通知发送完成，检查警报已产生且各默认渠道发送成功
+func simVerifyDelivery(st *simStep, since time.Time, sandbox string) {
+	done := make(chan struct{})
+	go func() {
+		sendWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(simulateTimeout):
+		st.check("delivery", false, "等待通知发送超时")
+		return
+	}
+
+	alerted := false
+	for _, a := range snapshotAlerts() {
+		if !a.Time.Before(since) && strings.Contains(a.Message, sandbox) {
+			alerted = true
+		}
+	}
+	dbMu.Lock()
+	silenced := now().Before(silencedUntil)
+	dbMu.Unlock()
+	if silenced {
+		st.check("alert", false, "警报处于静默状态")
+	} else {
+		st.check("alert", alerted, "")
+	}
+
+	states := make(map[string]channelState)
+	for _, c := range snapshotChannels() {
+		states[c.Name] = c
+	}
+	_, defaults := currentNotifiers()
+	for _, name := range defaults {
+		c := states[name]
+		switch {
+		case !c.OK:
+			st.check("deliver "+name, false, "%s", c.LastError)
+		case c.LastSent.Before(since):
+			st.check("deliver "+name, false, "没有发送（可能处于该渠道的静默时段）")
+		default:
+			st.check("deliver "+name, true, "")
+		}
+	}
+}
+
+// simVerifyBaseline 检查数据库已更新；人工确认模式下变动应进入待确认列表
+func simVerifyBaseline(st *simStep, hashes map[string]string) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	for path, want := range hashes {
+		name := "baseline " + filepath.Base(path)
+		if manualAccept {
+			_, ok := pending[path]
+			st.check(name, ok, "人工确认模式：应进入待确认列表")
+			continue
+		}
+		e, ok := hashDB[path]
+		switch {
+		case want == "":
+			st.check(name, !ok, "应已从基线删除")
+		case !ok:
+			st.check(name, false, "基线中没有记录")
+		default:
+			st.check(name, e.Hash == want, "%s", shortHash(e.Hash))
+		}
+	}
+}
+
+// cleanupSimulation 删除沙箱目录以及基线和待确认列表中的相关记录，不产生删除警报
+func cleanupSimulation(sandbox string) {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	if err := os.RemoveAll(sandbox); err != nil {
+		log.Printf("删除自检沙箱目录失败: %v", err)
+	}
+	dbMu.Lock()
+	for path := range hashDB {
+		if underDir(path, sandbox) {
+			delete(hashDB, path)
+		}
+	}
+	for key, ev := range pending {
+		if underDir(ev.Path, sandbox) {
+			delete(pending, key)
+		}
+	}
+	dbMu.Unlock()
+	if err := saveHashDB(); err != nil {
+		log.Printf("保存哈希数据库错误: %v", err)
+	}
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
+
+func formatSimulation(res simulateResult) string {
+	var b strings.Builder
+	for _, st := range res.Steps {
+		mark := "通过"
+		if !st.OK {
+			mark = "失败"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", st.Name, mark)
+		for _, c := range st.Checks {
+			if !c.OK {
+				fmt.Fprintf(&b, "  %s 失败 %s\n", c.Name, c.Detail)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func ctlHandleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res, err := runSimulation(r.FormValue("dir"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctlWriteJSON(w, res)
+}
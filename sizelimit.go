@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 文件大小限制：-max-file-size 或 wenjian.max_file_size 设置默认上限（字节，默认 10 MB，0 表示不限制），
+// wenjian.max_file_sizes 按目录覆盖，例如媒体目录放宽到 1 GB、代码目录收紧到 2 MB。
+// 超过上限的文件按 large_files 跳过或只校验首尾部分
+
+const defaultMaxFileSize = 10 << 20
+
+type sizeLimit struct {
+	dir   string
+	limit int64
+}
+
+var sizeLimits []sizeLimit // 按目录从深到浅排序，先匹配的生效
+
+// applySizeLimitConfig 应用配置中的大小限制，命令行显式指定的 -max-file-size 优先于 max_file_size
+func applySizeLimitConfig(def *int64, dirs map[string]int64) error {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "max-file-size" })
+	if def != nil && !explicit {
+		MaxFileSize = *def
+	}
+	if MaxFileSize < 0 {
+		return fmt.Errorf("max_file_size 不能为负数")
+	}
+	sizeLimits = nil
+	for dir, limit := range dirs {
+		if limit < 0 {
+			return fmt.Errorf("max_file_sizes 中 %s 的大小限制不能为负数", dir)
+		}
+		sizeLimits = append(sizeLimits, sizeLimit{dir: filepath.Clean(dir), limit: limit})
+	}
+	sort.Slice(sizeLimits, func(i, j int) bool { return len(sizeLimits[i].dir) > len(sizeLimits[j].dir) })
+	return nil
+}
+
+// maxFileSizeFor 返回文件适用的大小限制，0 表示不限制；max_file_sizes 与监控目录自己的 max_file_size
+// 都适用时以目录更深的为准
+func maxFileSizeFor(path string) int64 {
+	dir, limit := "", MaxFileSize
+	for _, l := range sizeLimits {
+		if path == l.dir || underDir(path, l.dir) {
+			dir, limit = l.dir, l.limit
+			break
+		}
+	}
+	if root, ok := rootFor(path, monitorDirs); ok && len(filepath.Clean(root)) > len(dir) {
+		if p := rootProfiles[root]; p != nil && p.MaxFileSize != nil {
+			limit = *p.MaxFileSize
+		}
+	}
+	return limit
+}
+
+// overSizeLimit 判断文件是否超过所在目录的大小限制
+func overSizeLimit(path string, info os.FileInfo) bool {
+	limit := maxFileSizeFor(path)
+	return limit > 0 && info.Size() > limit
+}
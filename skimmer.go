@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 针对浏览器加载的 .js 文件的信用卡窃取脚本（Magecart 类）启发式检测
+
+// SkimmerConfig 配置 JS 窃取脚本检测
+type SkimmerConfig struct {
+	Enabled        bool     `json:"enabled"`
+	TrustedDomains []string `json:"trusted_domains"` // 不视为新外部域名的域名（含子域名），例如 CDN 和支付网关
+}
+
+const sigJSSkimmer = "js_skimmer"
+
+var (
+	skimmer SkimmerConfig
+
+	jsDomainsMu sync.Mutex
+	jsDomains   map[string][]string // 文件 -> 上次内容中出现的外部域名
+)
+
+var (
+	jsURLPattern = regexp.MustCompile(`(?i)(?:https?:)?//([a-z0-9][a-z0-9.-]*\.[a-z]{2,})(?::\d+)?`)
+
+	jsObfuscation = map[string]*regexp.Regexp{
+		"eval 解码链":          regexp.MustCompile(`(?i)\beval\s*\(\s*(atob|unescape|decodeURIComponent|String\.fromCharCode)\s*\(`),
+		"packer 混淆":         regexp.MustCompile(`eval\s*\(\s*function\s*\(\s*p\s*,\s*a\s*,\s*c\s*,\s*k\s*,\s*e\s*,\s*[dr]\s*\)`),
+		"Function 构造执行":     regexp.MustCompile(`\b(new\s+)?Function\s*\([^)]*\)\s*\(`),
+		"大段 fromCharCode":   regexp.MustCompile(`fromCharCode\s*\(\s*(\d+\s*,\s*){20,}`),
+		"大段十六进制转义":          regexp.MustCompile(`(\\x[0-9a-fA-F]{2}){40,}`),
+		"document.write 解码": regexp.MustCompile(`(?i)document\.write\s*\(\s*(unescape|atob)\s*\(`),
+	}
+
+	jsFormFields = regexp.MustCompile(`(?i)(card[_-]?num|cc[_-]?(number|num|exp|cvv)|\bcvv2?\b|\bcvc\b|credit.?card|billing\[|payment\[cc|expir(y|ation).?(month|year)|\bccnum\b)`)
+	jsExfil      = regexp.MustCompile(`(?i)(new\s+Image\s*\(\s*\)\s*\.src\s*=|navigator\.sendBeacon|new\s+WebSocket\s*\(|XMLHttpRequest|\bfetch\s*\()`)
+)
+
+func applySkimmerConfig(c SkimmerConfig) {
+	for i, d := range c.TrustedDomains {
+		c.TrustedDomains[i] = strings.ToLower(strings.TrimPrefix(d, "."))
+	}
+	skimmer = c
+}
+
+func jsDomainsFile() string {
+	return hashDBFile + ".jsdomains.json"
+}
+
+// seedJSDomains 读取或建立基线中 .js 文件的外部域名列表
+func seedJSDomains() {
+	if !skimmer.Enabled {
+		return
+	}
+	jsDomainsMu.Lock()
+	defer jsDomainsMu.Unlock()
+
+	jsDomains = make(map[string][]string)
+	if data, err := os.ReadFile(jsDomainsFile()); err == nil {
+		if err := json.Unmarshal(data, &jsDomains); err != nil {
+			log.Printf("解析 JS 域名记录错误: %v", err)
+		}
+	}
+
+	dbMu.Lock()
+	var paths []string
+	for path := range hashDB {
+		if _, ok := jsDomains[path]; !ok && isBrowserJS(path) {
+			paths = append(paths, path)
+		}
+	}
+	dbMu.Unlock()
+
+	for _, path := range paths {
+		if sample, err := readSample(path); err == nil {
+			jsDomains[path] = externalDomains(string(sample))
+		}
+	}
+	saveJSDomains()
+}
+
+// 调用方需持有 jsDomainsMu
+func saveJSDomains() {
+	data, err := json.Marshal(jsDomains)
+	if err == nil {
+		err = writeStateFile(jsDomainsFile(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("保存 JS 域名记录错误: %v", err)
+	}
+}
+
+func isBrowserJS(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".js" || ext == ".mjs"
+}
+
+func externalDomains(content string) []string {
+	seen := make(map[string]bool)
+	for _, m := range jsURLPattern.FindAllStringSubmatch(content, -1) {
+		seen[strings.ToLower(strings.TrimSuffix(m[1], "."))] = true
+	}
+	domains := make([]string, 0, len(seen))
+	for d := range seen {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+func trustedDomain(d string) bool {
+	for _, t := range skimmer.TrustedDomains {
+		if d == t || strings.HasSuffix(d, "."+t) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSkimmer 检查新增或修改的 .js 文件，把发现写入事件并提升级别
+func checkSkimmer(ev *Event) {
+	if !skimmer.Enabled || ev.Stream != "" || !isBrowserJS(ev.Path) {
+		return
+	}
+	switch ev.Type {
+	case "deleted":
+		jsDomainsMu.Lock()
+		delete(jsDomains, ev.Path)
+		saveJSDomains()
+		jsDomainsMu.Unlock()
+		return
+	case "new", "modified", "renamed":
+	default:
+		return
+	}
+
+	sample, err := readSample(ev.Path)
+	if err != nil {
+		return
+	}
+	content := string(sample)
+	domains := externalDomains(content)
+
+	jsDomainsMu.Lock()
+	oldPath := ev.Path
+	if ev.Type == "renamed" {
+		oldPath = ev.OldPath
+		delete(jsDomains, oldPath)
+	}
+	previous, known := jsDomains[oldPath]
+	jsDomains[ev.Path] = domains
+	saveJSDomains()
+	jsDomainsMu.Unlock()
+
+	var findings []string
+	var newDomains []string
+	for _, d := range domains {
+		if !trustedDomain(d) && (!known || !containsString(previous, d)) {
+			newDomains = append(newDomains, d)
+		}
+	}
+	// 新文件没有可比较的旧内容，只在同时有其他可疑特征时报告域名
+	if len(newDomains) > 0 && ev.Type != "new" {
+		findings = append(findings, "新增外部域名: "+strings.Join(newDomains, ", "))
+	}
+
+	names := make([]string, 0, len(jsObfuscation))
+	for name, re := range jsObfuscation {
+		if re.MatchString(content) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		findings = append(findings, "混淆代码: "+name)
+	}
+
+	form := jsFormFields.FindString(content)
+	exfil := jsExfil.FindString(content)
+	if form != "" {
+		findings = append(findings, fmt.Sprintf("访问支付表单字段: %s", form))
+	}
+	if form != "" && (exfil != "" || len(newDomains) > 0) {
+		if exfil == "" {
+			exfil = "新增外部域名"
+		}
+		findings = append(findings, "读取表单后向外发送数据: "+exfil)
+		ev.Severity = maxSeverity(ev.Severity, sevCritical)
+	}
+	if len(findings) == 0 {
+		return
+	}
+	if ev.Type == "new" && len(newDomains) > 0 {
+		findings = append(findings, "外部域名: "+strings.Join(newDomains, ", "))
+	}
+
+	ev.Findings = append(ev.Findings, findings...)
+	ev.Severity = maxSeverity(ev.Severity, sevHigh)
+	addSignal(ev, sigJSSkimmer)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SlackConfig 配置 Slack incoming webhook
+type SlackConfig struct {
+	WebhookURL string            `json:"webhook_url" secret:"true"`
+	Channel    string            `json:"channel"`  // 覆盖 webhook 默认的频道
+	Channels   map[string]string `json:"channels"` // 按事件类型覆盖频道，例如 {"modified": "#security"}
+	Username   string            `json:"username"`
+	IconEmoji  string            `json:"icon_emoji"`
+	Timeout    string            `json:"timeout"` // 默认 10s
+}
+
+// 各事件类型附件的颜色
+var slackColors = map[string]string{
+	"new":             "#f2c744", // 黄
+	"modified":        "#d50200", // 红
+	"deleted":         "#ff8c00", // 橙
+	"renamed":         "#439fe0",
+	"attributes":      "#f2c744",
+	"stream_new":      "#d50200",
+	"stream_modified": "#d50200",
+	"stream_deleted":  "#ff8c00",
+
+	"policy_violation": "#7a3e9d",
+}
+
+var slackSeverityColors = map[string]string{
+	sevInfo:     "#36a64f",
+	sevLow:      "#439fe0",
+	sevWarning:  "#f2c744",
+	sevHigh:     "#ff8c00",
+	sevCritical: "#d50200",
+}
+
+type slackAttachment struct {
+	Color    string       `json:"color"`
+	Fallback string       `json:"fallback"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Footer   string       `json:"footer"`
+	Ts       int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	IconEmoji   string            `json:"icon_emoji,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackNotifier struct {
+	cfg    SlackConfig
+	client *http.Client
+}
+
+func newSlackNotifier(cfg SlackConfig) *slackNotifier {
+	timeout := 10 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &slackNotifier{cfg: cfg, client: &http.Client{Timeout: timeout}}
+}
+
+func (sn *slackNotifier) Send(n Notification) error {
+	title := strings.SplitN(n.Text, "\n", 2)[0]
+	footer := hostname() + " · " + n.Severity
+
+	// 没有文件事件的警报（目录不可用、心跳等）按级别着色
+	if len(n.Events) == 0 {
+		return sn.post(sn.cfg.Channel, title, []slackAttachment{{
+			Color:    slackSeverityColors[n.Severity],
+			Fallback: n.Text,
+			Title:    title,
+			Text:     n.Text,
+			Footer:   footer,
+			Ts:       n.Time.Unix(),
+		}})
+	}
+
+	// 按事件类型的频道分组发送
+	byChannel := make(map[string][]slackAttachment)
+	for _, ev := range n.Events {
+		channel := sn.cfg.Channel
+		if c, ok := sn.cfg.Channels[ev.Type]; ok {
+			channel = c
+		}
+		att := slackAttachment{
+			Color:    slackColors[ev.Type],
+			Fallback: describeEvent(ev),
+			Title:    strings.SplitN(describeEvent(ev), "\n", 2)[0],
+			Footer:   footer,
+			Ts:       ev.Time.Unix(),
+		}
+		att.Fields = append(att.Fields, slackField{Title: "类型", Value: ev.Type, Short: true})
+		att.Fields = append(att.Fields, slackField{Title: "级别", Value: ev.Severity, Short: true})
+		if ev.Size > 0 {
+			att.Fields = append(att.Fields, slackField{Title: "大小", Value: fmt.Sprintf("%d bytes", ev.Size), Short: true})
+		}
+		if ev.Risk > 0 {
+			att.Fields = append(att.Fields, slackField{Title: "风险", Value: fmt.Sprintf("%d (%s)", ev.Risk, strings.Join(ev.Signals, ", ")), Short: true})
+		}
+		if ev.NewHash != "" {
+			att.Fields = append(att.Fields, slackField{Title: "新哈希", Value: "`" + ev.NewHash + "`"})
+		}
+		var details []string
+		for _, f := range ev.Findings {
+			details = append(details, "• "+f)
+		}
+		if ev.Diff != "" {
+			details = append(details, "```"+ev.Diff+"```")
+		}
+		att.Text = strings.Join(details, "\n")
+		byChannel[channel] = append(byChannel[channel], att)
+	}
+
+	names := make([]string, 0, len(byChannel))
+	for c := range byChannel {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+	var firstErr error
+	for _, c := range names {
+		if err := sn.post(c, title, byChannel[c]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (sn *slackNotifier) post(channel, text string, atts []slackAttachment) error {
+	body, err := json.Marshal(slackMessage{
+		Channel:     channel,
+		Username:    sn.cfg.Username,
+		IconEmoji:   sn.cfg.IconEmoji,
+		Text:        text,
+		Attachments: atts,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := sn.client.Post(sn.cfg.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("返回 %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 内容快照（snapshots）：把基线中每个文件的内容按哈希保存一份（<dir>/<哈希前两位>/<哈希>），
+// 不依赖外部备份就能查看文件被篡改前的样子，并用 -restore-content 恢复；auto_restore 的 store
+// 来源不写 path 时也使用这里。不再被基线引用的内容保留 keep_days 天后清理
+
+// SnapshotConfig 配置内容快照
+type SnapshotConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Dir         string `json:"dir"`           // 默认为哈希数据库路径加 .content
+	MaxFileSize int64  `json:"max_file_size"` // 只保存不超过该大小的文件（字节），0 表示只受扫描的大小限制
+	KeepDays    int    `json:"keep_days"`     // 不再被基线引用的内容保留的天数，默认 30
+}
+
+const snapshotGCInterval = 24 * time.Hour
+
+var (
+	snapshots      = SnapshotConfig{KeepDays: 30}
+	snapshotMu     sync.Mutex // 保护 lastSnapshotGC
+	lastSnapshotGC time.Time
+
+	showContentPath    string
+	showContentHash    string
+	restoreContentPath string
+)
+
+func applySnapshotConfig(c SnapshotConfig) error {
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("snapshots.max_file_size 不能为负数")
+	}
+	if c.KeepDays < 0 {
+		return fmt.Errorf("snapshots.keep_days 不能为负数")
+	}
+	if c.KeepDays == 0 {
+		c.KeepDays = 30
+	}
+	if c.Dir != "" {
+		c.Dir = filepath.Clean(c.Dir)
+	}
+	snapshots = c
+	return nil
+}
+
+func snapshotDir() string {
+	if snapshots.Dir != "" {
+		return snapshots.Dir
+	}
+	return hashDBFile + ".content"
+}
+
+// snapshotObject 返回哈希对应的快照文件，哈希不是当前算法的完整内容哈希时返回空字符串
+func snapshotObject(dir, hash string) string {
+	if _, _, _, partial := parsePartialHash(hash); partial || specialKind(hash) != "" {
+		return ""
+	}
+	digest := hashDigest(hash)
+	if len(digest) < 2 {
+		return ""
+	}
+	return filepath.Join(dir, digest[:2], digest)
+}
+
+// snapshotContent 保存文件的当前内容，内容已经不是 hash（读取前又被修改）时放弃；已保存过的内容不重复写入
+func snapshotContent(path, hash string) {
+	if !snapshots.Enabled || readOnly || oneShot || hashAlgoOf(hash) != hashAlgorithm {
+		return
+	}
+	obj := snapshotObject(snapshotDir(), hash)
+	if obj == "" {
+		return
+	}
+	if _, err := os.Stat(obj); err == nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	if snapshots.MaxFileSize > 0 && info.Size() > snapshots.MaxFileSize {
+		return
+	}
+	if err := writeSnapshot(path, hash, obj); err != nil {
+		log.Printf("保存 %s 的内容快照失败: %v", path, err)
+	}
+}
+
+func writeSnapshot(path, hash, obj string) error {
+	if err := os.MkdirAll(filepath.Dir(obj), 0700); err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(obj), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, throttled(in)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if h, err := calculateFileHash(tmp.Name()); err != nil || h != hash {
+		// 复制期间文件又被修改，下一次扫描会按新内容处理
+		return nil
+	}
+	os.Chmod(tmp.Name(), 0400)
+	return os.Rename(tmp.Name(), obj)
+}
+
+// releaseSnapshot 在内容不再被基线引用时更新快照的修改时间，从这时开始计算保留期
+func releaseSnapshot(hash string) {
+	if !snapshots.Enabled || hash == "" {
+		return
+	}
+	if obj := snapshotObject(snapshotDir(), hash); obj != "" {
+		t := now()
+		os.Chtimes(obj, t, t)
+	}
+}
+
+// snapshotVerified 为内容未变、但还没有快照的文件补齐快照（刚启用快照或快照被删除时），
+// 并每天清理一次过期的快照。调用方不能持有 dbMu
+func snapshotVerified(paths []string) {
+	if !snapshots.Enabled || readOnly {
+		return
+	}
+	dir := snapshotDir()
+	dbMu.Lock()
+	hashes := make(map[string]string, len(paths))
+	for _, p := range paths {
+		if e, ok := hashDB[p]; ok {
+			hashes[p] = e.Hash
+		}
+	}
+	dbMu.Unlock()
+	for p, h := range hashes {
+		if obj := snapshotObject(dir, h); obj != "" {
+			if _, err := os.Stat(obj); os.IsNotExist(err) {
+				snapshotContent(p, h)
+			}
+		}
+	}
+
+	snapshotMu.Lock()
+	due := now().Sub(lastSnapshotGC) >= snapshotGCInterval
+	if due {
+		lastSnapshotGC = now()
+	}
+	snapshotMu.Unlock()
+	if due {
+		pruneSnapshots()
+	}
+}
+
+// pruneSnapshots 删除不再被基线和待确认变动引用、且超过保留期的快照
+func pruneSnapshots() {
+	dir := snapshotDir()
+	refs := make(map[string]bool)
+	dbMu.Lock()
+	for _, e := range hashDB {
+		refs[snapshotObject(dir, e.Hash)] = true
+	}
+	for _, ev := range pending {
+		refs[snapshotObject(dir, ev.OldHash)] = true
+		refs[snapshotObject(dir, ev.NewHash)] = true
+	}
+	dbMu.Unlock()
+
+	cutoff := now().AddDate(0, 0, -snapshots.KeepDays)
+	removed := 0
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if !refs[path] && info.ModTime().Before(cutoff) {
+			if os.Remove(path) == nil {
+				removed++
+			}
+		}
+		return nil
+	})
+	if removed > 0 {
+		log.Printf("清理了 %d 个过期的内容快照", removed)
+	}
+}
+
+// runContentCommand 输出文件在基线中（或指定哈希）的内容，或用快照恢复文件
+func runContentCommand() int {
+	if err := prepareOneShot(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	target := showContentPath
+	if restoreContentPath != "" {
+		target = restoreContentPath
+	}
+	path, err := filepath.Abs(target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	e := hashDB[path]
+	hash := showContentHash
+	if hash == "" {
+		if e == nil {
+			fmt.Fprintf(os.Stderr, "%s 不在基线中\n", path)
+			return exitError
+		}
+		hash = e.Hash
+	}
+	obj := snapshotObject(snapshotDir(), hash)
+	if obj == "" {
+		fmt.Fprintf(os.Stderr, "哈希 %s 没有内容快照（大文件部分哈希和特殊文件不保存内容）\n", hash)
+		return exitError
+	}
+	if _, err := os.Stat(obj); err != nil {
+		fmt.Fprintf(os.Stderr, "没有 %s 的内容快照: %v\n", hash, err)
+		return exitError
+	}
+
+	if restoreContentPath == "" {
+		f, err := os.Open(obj)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		io.Copy(os.Stdout, f)
+		return exitClean
+	}
+
+	var meta *FileMeta
+	if e != nil && e.Hash == hash {
+		meta = e.Meta
+	}
+	if _, err := restoreFrom(RestoreSource{Type: restoreSourceStore, Path: snapshotDir()}, path, hash, meta); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("已用内容快照恢复 %s（%s）\n", path, hash)
+	return exitClean
+}
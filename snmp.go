@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SNMPConfig 配置 SNMP trap，支持 v2c（community）和 v3（USM 认证与加密）
+type SNMPConfig struct {
+	Targets       []string `json:"targets"`                     // host[:port]，默认端口 162
+	Version       string   `json:"version"`                     // 2c（默认）或 3
+	Community     string   `json:"community"`                   // v2c，默认 public
+	User          string   `json:"user"`                        // v3 用户名
+	AuthProtocol  string   `json:"auth_protocol"`               // v3: MD5、SHA，留空不认证
+	AuthPassword  string   `json:"auth_password" secret:"true"` //
+	PrivProtocol  string   `json:"priv_protocol"`               // v3: DES、AES，留空不加密
+	PrivPassword  string   `json:"priv_password" secret:"true"` //
+	EngineID      string   `json:"engine_id"`                   // v3 本机 engine ID（十六进制），接收方按此配置用户；默认根据主机名生成
+	EnterpriseOID string   `json:"enterprise_oid"`              // 默认 1.3.6.1.4.1.99999.1
+}
+
+// trap 中使用的 OID，均在 enterprise_oid 之下
+const (
+	snmpTrapEvent    = ".0.1"   // 文件篡改事件通知
+	snmpVarType      = ".1.1.0" // 事件类型
+	snmpVarPath      = ".1.2.0" // 文件路径
+	snmpVarOldHash   = ".1.3.0" // 原哈希
+	snmpVarNewHash   = ".1.4.0" // 新哈希
+	snmpVarSeverity  = ".1.5.0" // 级别
+	snmpVarText      = ".1.6.0" // 警报文本
+	snmpVarHost      = ".1.7.0" // 主机名
+	snmpVarRisk      = ".1.8.0" // 风险分数
+	snmpVarOldPath   = ".1.9.0" // 重命名前的路径
+	snmpSysUpTime    = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOID      = "1.3.6.1.6.3.1.1.4.1.0"
+	snmpDefaultOID   = "1.3.6.1.4.1.99999.1"
+	snmpMaxTextBytes = 1024
+)
+
+type snmpNotifier struct {
+	cfg      SNMPConfig
+	started  time.Time
+	engineID []byte
+	authKey  []byte
+	privKey  []byte
+
+	mu    sync.Mutex
+	reqID int32
+	salt  uint64
+}
+
+func newSNMPNotifier(cfg SNMPConfig) (*snmpNotifier, error) {
+	if cfg.Version == "" {
+		cfg.Version = "2c"
+	}
+	if cfg.Community == "" {
+		cfg.Community = "public"
+	}
+	if cfg.EnterpriseOID == "" {
+		cfg.EnterpriseOID = snmpDefaultOID
+	}
+	cfg.EnterpriseOID = strings.TrimPrefix(cfg.EnterpriseOID, ".")
+	if _, err := berOID(cfg.EnterpriseOID); err != nil {
+		return nil, err
+	}
+	cfg.AuthProtocol = strings.ToUpper(cfg.AuthProtocol)
+	cfg.PrivProtocol = strings.ToUpper(cfg.PrivProtocol)
+
+	sn := &snmpNotifier{cfg: cfg, started: time.Now()}
+	binary.Read(rand.Reader, binary.BigEndian, &sn.salt)
+
+	switch cfg.Version {
+	case "2c":
+	case "3":
+		if cfg.User == "" {
+			return nil, fmt.Errorf("SNMPv3 必须配置 user")
+		}
+		if cfg.EngineID != "" {
+			id, err := hex.DecodeString(strings.TrimPrefix(cfg.EngineID, "0x"))
+			if err != nil || len(id) < 5 || len(id) > 32 {
+				return nil, fmt.Errorf("无效的 engine_id: %s", cfg.EngineID)
+			}
+			sn.engineID = id
+		} else {
+			// 格式：企业号（最高位置 1）+ 04（文本）+ 文本
+			sn.engineID = append([]byte{0x80, 0x00, 0x1f, 0x88, 0x04}, []byte("webmon-"+hostname())...)
+			if len(sn.engineID) > 32 {
+				sn.engineID = sn.engineID[:32]
+			}
+		}
+
+		switch cfg.AuthProtocol {
+		case "":
+			if cfg.PrivProtocol != "" {
+				return nil, fmt.Errorf("SNMPv3 使用加密时必须同时配置认证")
+			}
+		case "MD5", "SHA":
+			if len(cfg.AuthPassword) < 8 {
+				return nil, fmt.Errorf("SNMPv3 auth_password 至少 8 个字符")
+			}
+			sn.authKey = snmpLocalizeKey(cfg.AuthProtocol, cfg.AuthPassword, sn.engineID)
+		default:
+			return nil, fmt.Errorf("不支持的 auth_protocol: %s", cfg.AuthProtocol)
+		}
+		switch cfg.PrivProtocol {
+		case "":
+		case "DES", "AES":
+			if len(cfg.PrivPassword) < 8 {
+				return nil, fmt.Errorf("SNMPv3 priv_password 至少 8 个字符")
+			}
+			sn.privKey = snmpLocalizeKey(cfg.AuthProtocol, cfg.PrivPassword, sn.engineID)
+		default:
+			return nil, fmt.Errorf("不支持的 priv_protocol: %s", cfg.PrivProtocol)
+		}
+		log.Printf("SNMPv3 trap engine ID: %s", hex.EncodeToString(sn.engineID))
+	default:
+		return nil, fmt.Errorf("不支持的 SNMP 版本: %s", cfg.Version)
+	}
+	return sn, nil
+}
+
+func (sn *snmpNotifier) Send(n Notification) error {
+	// 每个事件一个 trap；没有事件的警报（目录不可用、心跳等）只带文本
+	events := n.Events
+	if len(events) == 0 {
+		events = []Event{{}}
+	}
+
+	var firstErr error
+	for _, ev := range events {
+		pdu, err := sn.trapPDU(n, ev)
+		if err != nil {
+			return err
+		}
+		for _, target := range sn.cfg.Targets {
+			msg, err := sn.message(pdu)
+			if err == nil {
+				err = snmpSend(target, msg)
+			}
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", target, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+func (sn *snmpNotifier) nextRequestID() int32 {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	sn.reqID++
+	return sn.reqID & 0x7fffffff
+}
+
+func (sn *snmpNotifier) trapPDU(n Notification, ev Event) ([]byte, error) {
+	base := sn.cfg.EnterpriseOID
+	uptime := uint32(time.Since(sn.started) / (10 * time.Millisecond))
+
+	text := n.Text
+	if len(text) > snmpMaxTextBytes {
+		text = text[:snmpMaxTextBytes]
+	}
+	severity := n.Severity
+	if ev.Severity != "" {
+		severity = ev.Severity
+	}
+
+	binds := [][]byte{}
+	add := func(oid string, value []byte) error {
+		o, err := berOID(oid)
+		if err != nil {
+			return err
+		}
+		binds = append(binds, berSeq(0x30, o, value))
+		return nil
+	}
+	trapOID, _ := berOID(base + snmpTrapEvent)
+	add(snmpSysUpTime, berUint(0x43, uint64(uptime)))
+	add(snmpTrapOID, trapOID)
+	add(base+snmpVarHost, berOctets([]byte(hostname())))
+	add(base+snmpVarSeverity, berOctets([]byte(severity)))
+	add(base+snmpVarText, berOctets([]byte(text)))
+	if ev.Type != "" {
+		add(base+snmpVarType, berOctets([]byte(ev.Type)))
+		add(base+snmpVarPath, berOctets([]byte(ev.Path)))
+		add(base+snmpVarOldHash, berOctets([]byte(ev.OldHash)))
+		add(base+snmpVarNewHash, berOctets([]byte(ev.NewHash)))
+		add(base+snmpVarRisk, berInt(int64(ev.Risk)))
+		if ev.OldPath != "" {
+			add(base+snmpVarOldPath, berOctets([]byte(ev.OldPath)))
+		}
+	}
+
+	return berSeq(0xa7,
+		berInt(int64(sn.nextRequestID())),
+		berInt(0),
+		berInt(0),
+		berSeq(0x30, binds...),
+	), nil
+}
+
+func (sn *snmpNotifier) message(pdu []byte) ([]byte, error) {
+	if sn.cfg.Version == "2c" {
+		return berSeq(0x30, berInt(1), berOctets([]byte(sn.cfg.Community)), pdu), nil
+	}
+
+	boots := int64(1)
+	engineTime := int64(time.Since(sn.started) / time.Second)
+	scoped := berSeq(0x30, berOctets(sn.engineID), berOctets(nil), pdu)
+
+	var flags byte
+	authParams := []byte{}
+	privParams := []byte{}
+	if sn.authKey != nil {
+		flags |= 0x01
+		authParams = make([]byte, 12)
+	}
+	msgData := scoped
+	if sn.privKey != nil {
+		flags |= 0x02
+		encrypted, salt, err := sn.encrypt(scoped, boots, engineTime)
+		if err != nil {
+			return nil, err
+		}
+		privParams = salt
+		msgData = berOctets(encrypted)
+	}
+
+	// 先用全 0 的认证参数组装报文，计算 HMAC 后再填回
+	secPrefix := bytes.Join([][]byte{
+		berOctets(sn.engineID), berInt(boots), berInt(engineTime), berOctets([]byte(sn.cfg.User)),
+	}, nil)
+	secParams := berSeq(0x30, secPrefix, berOctets(authParams), berOctets(privParams))
+	authOffsetInSec := len(secParams) - len(berOctets(privParams)) - len(authParams)
+
+	head := bytes.Join([][]byte{
+		berInt(3),
+		berSeq(0x30, berInt(int64(sn.nextRequestID())), berInt(65507), berOctets([]byte{flags}), berInt(3)),
+	}, nil)
+	secOctets := berOctets(secParams)
+	body := bytes.Join([][]byte{head, secOctets, msgData}, nil)
+	msg := berSeq(0x30, body)
+
+	if sn.authKey != nil {
+		offset := len(msg) - len(body) + len(head) + (len(secOctets) - len(secParams)) + authOffsetInSec
+		mac := hmac.New(snmpHash(sn.cfg.AuthProtocol), sn.authKey)
+		mac.Write(msg)
+		copy(msg[offset:offset+12], mac.Sum(nil)[:12])
+	}
+	return msg, nil
+}
+
+// encrypt 按 RFC 3414（DES-CBC）或 RFC 3826（AES-128-CFB）加密 scopedPDU，返回密文和 privParameters
+func (sn *snmpNotifier) encrypt(data []byte, boots, engineTime int64) ([]byte, []byte, error) {
+	sn.mu.Lock()
+	sn.salt++
+	salt := sn.salt
+	sn.mu.Unlock()
+
+	if sn.cfg.PrivProtocol == "AES" {
+		privParams := make([]byte, 8)
+		binary.BigEndian.PutUint64(privParams, salt)
+		iv := make([]byte, 16)
+		binary.BigEndian.PutUint32(iv[0:], uint32(boots))
+		binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+		copy(iv[8:], privParams)
+		block, err := aes.NewCipher(sn.privKey[:16])
+		if err != nil {
+			return nil, nil, err
+		}
+		out := make([]byte, len(data))
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(out, data)
+		return out, privParams, nil
+	}
+
+	privParams := make([]byte, 8)
+	binary.BigEndian.PutUint32(privParams[0:], uint32(boots))
+	binary.BigEndian.PutUint32(privParams[4:], uint32(salt))
+	iv := make([]byte, 8)
+	for i := range iv {
+		iv[i] = sn.privKey[8+i] ^ privParams[i]
+	}
+	block, err := des.NewCipher(sn.privKey[:8])
+	if err != nil {
+		return nil, nil, err
+	}
+	if pad := len(data) % 8; pad != 0 {
+		data = append(data, make([]byte, 8-pad)...)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out, privParams, nil
+}
+
+func snmpHash(proto string) func() hash.Hash {
+	if proto == "SHA" {
+		return sha1.New
+	}
+	return md5.New
+}
+
+// snmpLocalizeKey 按 RFC 3414 A.2 由密码生成本地化密钥
+func snmpLocalizeKey(proto, password string, engineID []byte) []byte {
+	h := snmpHash(proto)()
+	pw := []byte(password)
+	buf := make([]byte, 64)
+	for count, i := 0, 0; count < 1048576; count += 64 {
+		for j := range buf {
+			buf[j] = pw[i%len(pw)]
+			i++
+		}
+		h.Write(buf)
+	}
+	key := h.Sum(nil)
+
+	h = snmpHash(proto)()
+	h.Write(key)
+	h.Write(engineID)
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+func snmpSend(target string, msg []byte) error {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "162")
+	}
+	conn, err := net.DialTimeout("udp", target, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(msg)
+	return err
+}
+
+// 以下为 trap 所需的最小 BER 编码
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berTLV(tag byte, value []byte) []byte {
+	out := append([]byte{tag}, berLength(len(value))...)
+	return append(out, value...)
+}
+
+func berSeq(tag byte, parts ...[]byte) []byte {
+	return berTLV(tag, bytes.Join(parts, nil))
+}
+
+func berOctets(b []byte) []byte {
+	return berTLV(0x04, b)
+}
+
+func berInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return berTLV(0x02, b)
+}
+
+// berUint 编码 TimeTicks、Counter32 等无符号类型
+func berUint(tag byte, v uint64) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return berTLV(tag, b)
+}
+
+func berOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("无效的 OID: %s", oid)
+	}
+	nums := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 OID: %s", oid)
+		}
+		nums[i] = v
+	}
+	if nums[0] > 2 || (nums[0] < 2 && nums[1] >= 40) {
+		return nil, fmt.Errorf("无效的 OID: %s", oid)
+	}
+
+	var out []byte
+	encode := func(v uint64) {
+		b := []byte{byte(v & 0x7f)}
+		for v >>= 7; v > 0; v >>= 7 {
+			b = append([]byte{byte(v&0x7f) | 0x80}, b...)
+		}
+		out = append(out, b...)
+	}
+	encode(nums[0]*40 + nums[1])
+	for _, v := range nums[2:] {
+		encode(v)
+	}
+	return berTLV(0x06, out), nil
+}
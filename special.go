@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 套接字、命名管道和设备文件没有可哈希的内容，以类型（设备文件附带设备号）作为“哈希”记入基线，
+// 出现、类型改变或消失都会像普通文件一样产生事件
+const (
+	specialPrefix  = "special:"
+	sigSpecialFile = "special_file"
+)
+
+var specialKinds = map[string]string{
+	"socket":       "套接字",
+	"fifo":         "命名管道",
+	"char_device":  "字符设备",
+	"block_device": "块设备",
+}
+
+// specialHash 返回非普通文件在基线中的记录值，普通文件、目录和符号链接返回 false
+func specialHash(info os.FileInfo) (string, bool) {
+	m := info.Mode()
+	var h string
+	switch {
+	case m&os.ModeSocket != 0:
+		h = specialPrefix + "socket"
+	case m&os.ModeNamedPipe != 0:
+		h = specialPrefix + "fifo"
+	case m&os.ModeCharDevice != 0:
+		h = specialPrefix + "char_device"
+	case m&os.ModeDevice != 0:
+		h = specialPrefix + "block_device"
+	default:
+		return "", false
+	}
+	if m&os.ModeDevice != 0 {
+		if major, minor, ok := deviceNumbers(info); ok {
+			h += fmt.Sprintf(":%d,%d", major, minor)
+		}
+	}
+	return h, true
+}
+
+// specialKind 从基线记录值中取出非普通文件的类型名称，不是非普通文件时返回空字符串
+func specialKind(hash string) string {
+	if !strings.HasPrefix(hash, specialPrefix) {
+		return ""
+	}
+	kind, dev, _ := strings.Cut(strings.TrimPrefix(hash, specialPrefix), ":")
+	name := specialKinds[kind]
+	if name == "" {
+		name = kind
+	}
+	if dev != "" {
+		name += " " + dev
+	}
+	return name
+}
+
+func isSpecialEvent(ev Event) bool {
+	return ev.Type != "deleted" && strings.HasPrefix(ev.NewHash, specialPrefix)
+}
+
+func describeSpecial(ev Event) string {
+	kind := specialKind(ev.NewHash)
+	switch {
+	case ev.Type == "renamed":
+		return fmt.Sprintf("特殊文件被移动或重命名: %s -> %s\n类型: %s", ev.OldPath, ev.Path, kind)
+	case ev.Type == "modified" && specialKind(ev.OldHash) != "":
+		return fmt.Sprintf("特殊文件发生变化: %s\n原类型: %s\n新类型: %s", ev.Path, specialKind(ev.OldHash), kind)
+	case ev.Type == "modified":
+		return fmt.Sprintf("普通文件被替换为特殊文件: %s\n类型: %s\n原哈希: %s", ev.Path, kind, ev.OldHash)
+	}
+	return fmt.Sprintf("发现特殊文件: %s\n类型: %s\n网站目录中不应出现套接字、命名管道或设备文件", ev.Path, kind)
+}
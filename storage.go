@@ -0,0 +1,506 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Storage 是基线的持久化后端。运行时仍在内存中的 hashDB 上比较和修改，
+// saveHashDB 只把上次保存之后有变化的记录写入后端，再调用 Flush
+type Storage interface {
+	Get(path string) (*Entry, bool, error)
+	Put(path string, e *Entry) error
+	Delete(path string) error
+	Iterate(fn func(path string, e *Entry) error) error
+	Flush() error
+	Close() error
+}
+
+// StorageConfig 选择基线的存储后端
+type StorageConfig struct {
+	Type  string      `json:"type"` // json（默认）、bbolt、redis、s3
+	Path  string      `json:"path"` // json 默认使用 hash_db_file，bbolt 默认为 hash_db_file 加上类型后缀
+	Redis RedisConfig `json:"redis"`
+	S3    S3Config    `json:"s3"`
+}
+
+// sharedStorage 由可被多台主机同时使用的后端实现，每次扫描前合并其他主机保存的变化
+type sharedStorage interface {
+	Storage
+	shared()
+}
+
+// storageBackends 按类型名称登记可用的后端
+var storageBackends = map[string]func(c StorageConfig) (Storage, error){
+	"json": openJSONStorage,
+}
+
+// storageBuildTags 列出依赖第三方库、需要额外编译标签才会登记的后端
+var storageBuildTags = map[string]string{
+	"bbolt": "bbolt",
+}
+
+var (
+	storageCfg StorageConfig
+
+	storeMu sync.Mutex
+	store   Storage
+	// storeSynced 记录每条基线上次写入后端时的指纹，用于只写入有变化的记录
+	storeSynced map[string]uint64
+)
+
+func applyStorageConfig(c StorageConfig) error {
+	if c.Type == "" {
+		c.Type = "json"
+	}
+	if _, ok := storageBackends[c.Type]; !ok {
+		if tag, found := storageBuildTags[c.Type]; found {
+			return fmt.Errorf("存储类型 %s 需要使用 go build -tags %s 重新编译", c.Type, tag)
+		}
+		return fmt.Errorf("不支持的存储类型: %s", c.Type)
+	}
+	storageCfg = c
+	return nil
+}
+
+// openStore 在第一次使用时打开存储后端，调用方需持有 storeMu
+func openStore() error {
+	if store != nil {
+		return nil
+	}
+	c := storageCfg
+	if c.Type == "" {
+		c.Type = "json"
+	}
+	if c.Path == "" {
+		c.Path = hashDBFile
+		if c.Type != "json" {
+			c.Path = hashDBFile + "." + c.Type
+		}
+	}
+	s, err := storageBackends[c.Type](c)
+	if err != nil {
+		return err
+	}
+	store = s
+	_, sharedBaseline = s.(sharedStorage)
+	if c.Type != "json" {
+		return importJSONBaseline(s)
+	}
+	return nil
+}
+
+// importJSONBaseline 在切换到其他后端时，如果新后端为空，导入原有的 JSON 基线
+func importJSONBaseline(s Storage) error {
+	empty := true
+	errStop := errors.New("stop")
+	if err := s.Iterate(func(string, *Entry) error {
+		empty = false
+		return errStop
+	}); err != nil && err != errStop {
+		return err
+	}
+	if !empty {
+		return nil
+	}
+	if _, err := os.Stat(hashDBFile); err != nil {
+		return nil
+	}
+	old, err := openJSONStorage(StorageConfig{Path: hashDBFile})
+	if err != nil {
+		return err
+	}
+	n := 0
+	err = old.Iterate(func(path string, e *Entry) error {
+		n++
+		return s.Put(path, e)
+	})
+	if err == nil {
+		err = s.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("导入 JSON 基线失败: %v", err)
+	}
+	log.Printf("已从 %s 导入 %d 条基线记录", hashDBFile, n)
+	return nil
+}
+
+func closeStorage() {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if store != nil {
+		store.Close()
+		store = nil
+	}
+}
+
+// loadHashDB 从存储后端读取全部基线，返回记录数
+func loadHashDB() (int, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if err := openStore(); err != nil {
+		return 0, err
+	}
+
+	db := make(map[string]*Entry)
+	synced := make(map[string]uint64)
+	err := store.Iterate(func(path string, e *Entry) error {
+		db[path] = e
+		synced[path] = entryFingerprint(e)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	dbMu.Lock()
+	hashDB = db
+	dbMu.Unlock()
+	storeSynced = synced
+	return len(db), nil
+}
+
+// refreshHashDB 在使用共享后端时合并其他主机保存的变化：
+// 后端中与上次同步时不同、而本机没有未保存改动的记录以后端为准
+func refreshHashDB() error {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if err := openStore(); err != nil {
+		return err
+	}
+	if _, ok := store.(sharedStorage); !ok {
+		return nil
+	}
+
+	remote := make(map[string]*Entry)
+	if err := store.Iterate(func(path string, e *Entry) error {
+		remote[path] = e
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if storeSynced == nil {
+		storeSynced = make(map[string]uint64)
+	}
+	updated, removed := 0, 0
+	dbMu.Lock()
+	unchanged := func(path string) bool {
+		local, ok := hashDB[path]
+		synced, wasSynced := storeSynced[path]
+		if !ok {
+			return !wasSynced
+		}
+		return wasSynced && entryFingerprint(local) == synced
+	}
+	for path, e := range remote {
+		sum := entryFingerprint(e)
+		if old, ok := storeSynced[path]; ok && old == sum {
+			continue
+		}
+		if unchanged(path) {
+			hashDB[path] = e
+			storeSynced[path] = sum
+			updated++
+		}
+	}
+	for path := range storeSynced {
+		if _, ok := remote[path]; !ok && unchanged(path) {
+			delete(hashDB, path)
+			delete(storeSynced, path)
+			removed++
+		}
+	}
+	dbMu.Unlock()
+	if updated > 0 || removed > 0 {
+		log.Printf("从共享基线合并了 %d 条更新、%d 条删除", updated, removed)
+	}
+	return nil
+}
+
+func saveHashDB() error {
+	if readOnly {
+		return nil
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if err := openStore(); err != nil {
+		return err
+	}
+
+	// 在 dbMu 下找出变化的记录并复制，写入后端时不再持有 dbMu
+	type change struct {
+		path  string
+		entry *Entry
+		sum   uint64
+	}
+	var puts []change
+	var deletes []string
+	dbMu.Lock()
+	for path, e := range hashDB {
+		sum := entryFingerprint(e)
+		if old, ok := storeSynced[path]; !ok || old != sum {
+			puts = append(puts, change{path, copyEntry(e), sum})
+		}
+	}
+	for path := range storeSynced {
+		if _, ok := hashDB[path]; !ok {
+			deletes = append(deletes, path)
+		}
+	}
+	dbMu.Unlock()
+
+	if storeSynced == nil {
+		storeSynced = make(map[string]uint64)
+	}
+	for _, c := range puts {
+		if err := store.Put(c.path, c.entry); err != nil {
+			return fmt.Errorf("写入基线记录错误 %s: %v", c.path, err)
+		}
+		storeSynced[c.path] = c.sum
+	}
+	for _, path := range deletes {
+		if err := store.Delete(path); err != nil {
+			return fmt.Errorf("删除基线记录错误 %s: %v", path, err)
+		}
+		delete(storeSynced, path)
+	}
+	return store.Flush()
+}
+
+func copyEntry(e *Entry) *Entry {
+	cp := *e
+	cp.Streams = copyStringMap(e.Streams)
+	cp.Digests = copyStringMap(e.Digests)
+	cp.Meta = copyMeta(e.Meta)
+	return &cp
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// entryFingerprint 计算基线记录内容的指纹
+func entryFingerprint(e *Entry) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(e.Hash))
+	var buf [8]byte
+	for _, t := range [...]int64{e.FirstSeen.UnixNano(), e.LastVerified.UnixNano(), e.LastChanged.UnixNano()} {
+		binary.LittleEndian.PutUint64(buf[:], uint64(t))
+		h.Write(buf[:])
+	}
+	for i, m := range []map[string]string{e.Streams, e.Digests} {
+		h.Write([]byte{byte(i)})
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			h.Write([]byte{0})
+			h.Write([]byte(name))
+			h.Write([]byte{0})
+			h.Write([]byte(m[name]))
+		}
+	}
+	if m := e.Meta; m != nil {
+		for _, v := range [...]int64{m.Size, int64(m.Mode), int64(m.UID), int64(m.GID), m.MTime.UnixNano(), m.CTime} {
+			binary.LittleEndian.PutUint64(buf[:], uint64(v))
+			h.Write(buf[:])
+		}
+	}
+	return h.Sum64()
+}
+
+// jsonStorage 把整个基线保存为一个 JSON 文件，Flush 时整体重写
+type jsonStorage struct {
+	path string
+	db   map[string]*Entry
+	mac  []byte // 配置 hash_db_key 时最近一次读取或写入的文件签名
+}
+
+func openJSONStorage(c StorageConfig) (Storage, error) {
+	s := &jsonStorage{path: c.Path, db: make(map[string]*Entry)}
+	file, err := os.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取哈希数据库文件: %v", err)
+	}
+	if s.mac, err = verifyBaselineSignature(c.Path, file); err != nil {
+		return nil, err
+	}
+	if s.db, err = parseBaselineJSON(file); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseBaselineJSON 解析 hashdb.json 格式的基线
+func parseBaselineJSON(file []byte) (map[string]*Entry, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(file, &raw); err != nil {
+		return nil, fmt.Errorf("解析哈希数据库错误: %v", err)
+	}
+
+	db := make(map[string]*Entry, len(raw))
+	for path, v := range raw {
+		// 兼容旧版本“路径: 哈希”格式的数据库
+		var hash string
+		if err := json.Unmarshal(v, &hash); err == nil {
+			db[path] = &Entry{Hash: hash}
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return nil, fmt.Errorf("解析哈希数据库错误 %s: %v", path, err)
+		}
+		db[path] = &e
+	}
+	return db, nil
+}
+
+func (s *jsonStorage) Get(path string) (*Entry, bool, error) {
+	e, ok := s.db[path]
+	if !ok {
+		return nil, false, nil
+	}
+	return copyEntry(e), true, nil
+}
+
+func (s *jsonStorage) Put(path string, e *Entry) error {
+	s.db[path] = copyEntry(e)
+	return nil
+}
+
+func (s *jsonStorage) Delete(path string) error {
+	delete(s.db, path)
+	return nil
+}
+
+func (s *jsonStorage) Iterate(fn func(path string, e *Entry) error) error {
+	for path, e := range s.db {
+		if err := fn(path, copyEntry(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush 与原来的 saveHashDB 一致，即使没有变化也重写文件，使文件修改时间反映最近一次保存
+func (s *jsonStorage) Flush() error {
+	// 确保目录存在
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("无法创建哈希数据库目录: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s.db, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化哈希数据库错误: %v", err)
+	}
+
+	// 运行期间文件被其他程序改写时报警，随后以内存中的基线覆盖
+	if s.mac != nil {
+		if cur, err := os.ReadFile(s.path); err == nil && !hmac.Equal(baselineMAC(cur), s.mac) {
+			alert(Notification{Severity: sevCritical, Text: fmt.Sprintf("哈希数据库文件 %s 在运行期间被其他程序修改，已用内存中的基线覆盖", s.path)})
+		}
+	}
+
+	// 签名文件先同时列出新旧两个签名，替换数据库文件后再去掉旧签名，
+	// 任何一步中断（崩溃、断电、磁盘写满）后数据库和签名文件仍然相符，下次启动不会被当作篡改
+	var mac []byte
+	if len(dbKey()) > 0 {
+		mac = baselineMAC(data)
+		if err := writeBaselineSignature(s.path, mac, s.mac); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("写入哈希数据库文件错误: %v", err)
+	}
+	if mac != nil {
+		if err := writeBaselineSignature(s.path, mac); err != nil {
+			return err
+		}
+		s.mac = mac
+	}
+	return nil
+}
+
+// writeFileAtomic 先写入同一目录下的临时文件并同步到磁盘，再改名替换 path，
+// 中断时 path 保持原来的完整内容
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// 同步目录，使改名本身也写入磁盘；Windows 不支持同步目录，忽略错误
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// resign 在更换签名密钥后重新签名数据库文件，old 为原来的密钥，调用方需持有 storeMu。
+// 文件与原签名不符时报警且不签名，下次保存时用内存中的基线覆盖
+func (s *jsonStorage) resign(old []byte) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		s.mac = nil
+		return
+	}
+	if s.mac != nil && !hmac.Equal(baselineMACWith(old, data), s.mac) {
+		alert(Notification{Severity: sevCritical, Text: fmt.Sprintf("哈希数据库文件 %s 在运行期间被其他程序修改，将在下次保存时用内存中的基线覆盖", s.path)})
+		s.mac = nil
+		return
+	}
+	s.mac = nil
+	if len(dbKey()) == 0 {
+		return
+	}
+	mac := baselineMAC(data)
+	if err := writeBaselineSignature(s.path, mac); err != nil {
+		log.Printf("更换密钥后重新签名失败: %v", err)
+		return
+	}
+	s.mac = mac
+}
+
+func (s *jsonStorage) Close() error {
+	return nil
+}
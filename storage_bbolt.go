@@ -0,0 +1,140 @@
+//go:build bbolt
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bbolt 后端：每个文件的基线是一条记录，保存时只写入有变化的记录，不再整体重写文件。
+// 依赖 go.etcd.io/bbolt，使用 go build -tags bbolt 编译
+
+var boltBucket = []byte("baseline")
+
+const boltOpenTimeout = 10 * time.Second
+
+func init() {
+	storageBackends["bbolt"] = openBoltStorage
+	delete(storageBuildTags, "bbolt")
+}
+
+// boltStorage 只在读写时短暂打开数据库文件，守护进程运行时一次性命令也能读取基线
+type boltStorage struct {
+	path    string
+	puts    map[string]*Entry
+	deletes map[string]bool
+}
+
+func openBoltStorage(c StorageConfig) (Storage, error) {
+	s := &boltStorage{path: c.Path, puts: make(map[string]*Entry), deletes: make(map[string]bool)}
+	// 确认文件可以打开并建立 bucket
+	err := s.update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("打开 bbolt 数据库错误: %v", err)
+	}
+	return s, nil
+}
+
+func (s *boltStorage) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (s *boltStorage) view(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: boltOpenTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+func (s *boltStorage) Get(path string) (*Entry, bool, error) {
+	if s.deletes[path] {
+		return nil, false, nil
+	}
+	if e, ok := s.puts[path]; ok {
+		return copyEntry(e), true, nil
+	}
+	var e *Entry
+	err := s.view(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(path))
+		if v == nil {
+			return nil
+		}
+		e = &Entry{}
+		return json.Unmarshal(v, e)
+	})
+	return e, e != nil, err
+}
+
+func (s *boltStorage) Put(path string, e *Entry) error {
+	s.puts[path] = copyEntry(e)
+	delete(s.deletes, path)
+	return nil
+}
+
+func (s *boltStorage) Delete(path string) error {
+	s.deletes[path] = true
+	delete(s.puts, path)
+	return nil
+}
+
+// Iterate 只遍历已写入文件的记录，调用方应在 Flush 之后遍历
+func (s *boltStorage) Iterate(fn func(path string, e *Entry) error) error {
+	return s.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("解析基线记录错误 %s: %v", k, err)
+			}
+			return fn(string(k), &e)
+		})
+	})
+}
+
+// Flush 在一个事务中写入缓存的修改
+func (s *boltStorage) Flush() error {
+	if len(s.puts) == 0 && len(s.deletes) == 0 {
+		return nil
+	}
+	err := s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucket)
+		for path, e := range s.puts {
+			v, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(path), v); err != nil {
+				return err
+			}
+		}
+		for path := range s.deletes {
+			if err := b.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("写入 bbolt 数据库错误: %v", err)
+	}
+	s.puts = make(map[string]*Entry)
+	s.deletes = make(map[string]bool)
+	return nil
+}
+
+func (s *boltStorage) Close() error {
+	return s.Flush()
+}
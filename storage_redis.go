@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redis 后端：基线保存在一个哈希键中，字段为文件路径，值为 JSON 格式的记录。
+// 负载均衡后面文档根目录相同的多台主机可以共用同一个键，本机的数据库文件被篡改也不影响基线。
+// 协议（RESP）直接实现，不依赖第三方库
+
+// RedisConfig 是 redis 后端的连接参数
+type RedisConfig struct {
+	Addr     string `json:"addr"`     // host:port，默认 127.0.0.1:6379
+	Username string `json:"username"` // Redis 6 ACL 用户名，可留空
+	Password string `json:"password" secret:"true"`
+	DB       int    `json:"db"`
+	Key      string `json:"key"` // 默认 webmonitor:baseline
+	TLS      bool   `json:"tls"`
+	CAFile   string `json:"ca_file"`
+	Timeout  string `json:"timeout"` // 默认 10s
+}
+
+const (
+	defaultRedisKey = "webmonitor:baseline"
+	redisBatch      = 500 // 每条 HSET/HDEL 命令携带的字段数
+)
+
+func init() {
+	storageBackends["redis"] = openRedisStorage
+}
+
+type redisStorage struct {
+	cfg     RedisConfig
+	key     string
+	timeout time.Duration
+	tls     *tls.Config
+
+	conn net.Conn
+	rd   *bufio.Reader
+
+	puts    map[string]*Entry
+	deletes map[string]bool
+}
+
+// redisError 是服务器返回的错误回复
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func openRedisStorage(c StorageConfig) (Storage, error) {
+	rc := c.Redis
+	s := &redisStorage{cfg: rc, key: rc.Key, timeout: 10 * time.Second,
+		puts: make(map[string]*Entry), deletes: make(map[string]bool)}
+	if s.cfg.Addr == "" {
+		s.cfg.Addr = "127.0.0.1:6379"
+	}
+	if s.key == "" {
+		s.key = defaultRedisKey
+	}
+	if rc.Timeout != "" {
+		d, err := time.ParseDuration(rc.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 redis timeout: %v", err)
+		}
+		s.timeout = d
+	}
+	if rc.TLS {
+		host, _, _ := net.SplitHostPort(s.cfg.Addr)
+		s.tls = &tls.Config{ServerName: host}
+		if rc.CAFile != "" {
+			pem, err := os.ReadFile(rc.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("读取 redis ca_file 失败: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("redis ca_file 中没有有效的证书: %s", rc.CAFile)
+			}
+			s.tls.RootCAs = pool
+		}
+	}
+	// 启动时确认可以连接，避免运行到第一次保存才发现配置错误
+	if _, err := s.do("PING"); err != nil {
+		return nil, fmt.Errorf("连接 redis %s 失败: %v", s.cfg.Addr, err)
+	}
+	return s, nil
+}
+
+// shared 表示多台主机可以同时使用同一个键
+func (s *redisStorage) shared() {}
+
+func (s *redisStorage) dial() error {
+	var conn net.Conn
+	var err error
+	d := &net.Dialer{Timeout: s.timeout}
+	if s.tls != nil {
+		conn, err = tls.DialWithDialer(d, "tcp", s.cfg.Addr, s.tls)
+	} else {
+		conn, err = d.Dial("tcp", s.cfg.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn, s.rd = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if s.cfg.Password != "" {
+		if s.cfg.Username != "" {
+			setup = append(setup, []string{"AUTH", s.cfg.Username, s.cfg.Password})
+		} else {
+			setup = append(setup, []string{"AUTH", s.cfg.Password})
+		}
+	}
+	if s.cfg.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.cfg.DB)})
+	}
+	if len(setup) > 0 {
+		if _, err := s.roundTrip(setup); err != nil {
+			s.drop()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *redisStorage) drop() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.rd = nil, nil
+	}
+}
+
+// pipeline 一次发送多条命令再依次读取回复，连接断开时重连一次。
+// 任何一条命令返回错误回复时返回该错误
+func (s *redisStorage) pipeline(cmds [][]string) ([]interface{}, error) {
+	for attempt := 0; ; attempt++ {
+		replies, err := s.roundTrip(cmds)
+		var rerr redisError
+		if err == nil || errors.As(err, &rerr) || attempt > 0 {
+			return replies, err
+		}
+		// 网络错误：丢弃连接后重试
+		s.drop()
+	}
+}
+
+func (s *redisStorage) roundTrip(cmds [][]string) ([]interface{}, error) {
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return nil, err
+		}
+	}
+	s.conn.SetDeadline(time.Now().Add(s.timeout))
+	w := bufio.NewWriter(s.conn)
+	for _, args := range cmds {
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		s.drop()
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		v, err := readRESP(s.rd)
+		var rerr redisError
+		if err != nil && !errors.As(err, &rerr) {
+			s.drop()
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = v
+	}
+	return replies, firstErr
+}
+
+func (s *redisStorage) do(args ...string) (interface{}, error) {
+	replies, err := s.pipeline([][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// readRESP 读取一个回复：简单字符串和批量字符串返回 string，空值返回 nil，
+// 整数返回 int64，数组返回 []interface{}，错误回复返回 redisError
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: 无效的回复 %q", line)
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: 无效的长度 %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: 无效的长度 %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		out := make([]interface{}, n)
+		for i := range out {
+			v, err := readRESP(r)
+			var rerr redisError
+			if err != nil && !errors.As(err, &rerr) {
+				return nil, err
+			}
+			if err != nil {
+				v = err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("redis: 无效的回复 %q", line)
+}
+
+func (s *redisStorage) Get(path string) (*Entry, bool, error) {
+	if s.deletes[path] {
+		return nil, false, nil
+	}
+	if e, ok := s.puts[path]; ok {
+		return copyEntry(e), true, nil
+	}
+	v, err := s.do("HGET", s.key, path)
+	if err != nil || v == nil {
+		return nil, false, err
+	}
+	str, _ := v.(string)
+	e := &Entry{}
+	if err := json.Unmarshal([]byte(str), e); err != nil {
+		return nil, false, fmt.Errorf("解析基线记录错误 %s: %v", path, err)
+	}
+	return e, true, nil
+}
+
+func (s *redisStorage) Put(path string, e *Entry) error {
+	delete(s.deletes, path)
+	s.puts[path] = copyEntry(e)
+	return nil
+}
+
+func (s *redisStorage) Delete(path string) error {
+	delete(s.puts, path)
+	s.deletes[path] = true
+	return nil
+}
+
+// Iterate 用 HSCAN 分批读取，避免大基线的 HGETALL 长时间阻塞 redis
+func (s *redisStorage) Iterate(fn func(path string, e *Entry) error) error {
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		v, err := s.do("HSCAN", s.key, cursor, "COUNT", "1000")
+		if err != nil {
+			return err
+		}
+		arr, ok := v.([]interface{})
+		if !ok || len(arr) != 2 {
+			return errors.New("redis: HSCAN 回复格式错误")
+		}
+		cursor, _ = arr[0].(string)
+		items, _ := arr[1].([]interface{})
+		for i := 0; i+1 < len(items); i += 2 {
+			path, _ := items[i].(string)
+			val, _ := items[i+1].(string)
+			// HSCAN 可能重复返回同一字段
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			e := &Entry{}
+			if err := json.Unmarshal([]byte(val), e); err != nil {
+				return fmt.Errorf("解析基线记录错误 %s: %v", path, err)
+			}
+			if err := fn(path, e); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// Flush 在一个 MULTI/EXEC 事务中写入所有变化，其他主机不会读到只写了一半的基线
+func (s *redisStorage) Flush() error {
+	if len(s.puts) == 0 && len(s.deletes) == 0 {
+		return nil
+	}
+	cmds := [][]string{{"MULTI"}}
+	hset := []string{"HSET", s.key}
+	for path, e := range s.puts {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		hset = append(hset, path, string(data))
+		if len(hset) >= 2+2*redisBatch {
+			cmds = append(cmds, hset)
+			hset = []string{"HSET", s.key}
+		}
+	}
+	if len(hset) > 2 {
+		cmds = append(cmds, hset)
+	}
+	hdel := []string{"HDEL", s.key}
+	for path := range s.deletes {
+		hdel = append(hdel, path)
+		if len(hdel) >= 2+redisBatch {
+			cmds = append(cmds, hdel)
+			hdel = []string{"HDEL", s.key}
+		}
+	}
+	if len(hdel) > 2 {
+		cmds = append(cmds, hdel)
+	}
+	cmds = append(cmds, []string{"EXEC"})
+
+	replies, err := s.pipeline(cmds)
+	if err != nil {
+		return fmt.Errorf("写入 redis 错误: %v", err)
+	}
+	// EXEC 返回空值表示事务被放弃，数组中的错误表示某条命令执行失败
+	results, ok := replies[len(replies)-1].([]interface{})
+	if !ok {
+		return errors.New("写入 redis 错误: 事务被放弃")
+	}
+	for _, r := range results {
+		if err, ok := r.(error); ok {
+			return fmt.Errorf("写入 redis 错误: %v", err)
+		}
+	}
+	s.puts = make(map[string]*Entry)
+	s.deletes = make(map[string]bool)
+	return nil
+}
+
+func (s *redisStorage) Close() error {
+	s.drop()
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+type TelegramConfig struct {
+	BotToken     string   `json:"bot_token" secret:"true"`
+	ChatIDs      []string `json:"chat_ids"`
+	APIURL       string   `json:"api_url"`       // 默认 https://api.telegram.org，可指向自建的 Bot API 服务
+	Snippet      bool     `json:"snippet"`       // 新增或修改的文本文件附带文件开头片段
+	SnippetLines int      `json:"snippet_lines"` // 默认 15 行
+	Template     string   `json:"template"`
+	Timeout      string   `json:"timeout"` // 默认 10s
+}
+
+const defaultTelegramTemplate = `文件防篡改警报 [{{.Severity}}]
+主机: {{.Host}}
+时间: {{.Time}}
+
+{{.Text}}`
+
+// Telegram 单条消息最长 4096 个字符
+const telegramMaxText = 4096
+
+type telegramNotifier struct {
+	cfg    TelegramConfig
+	tmpl   *template.Template
+	client *http.Client
+}
+
+func newTelegramNotifier(cfg TelegramConfig) (*telegramNotifier, error) {
+	if len(cfg.ChatIDs) == 0 {
+		return nil, fmt.Errorf("必须配置 chat_ids")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.telegram.org"
+	}
+	if cfg.SnippetLines <= 0 {
+		cfg.SnippetLines = 15
+	}
+	tmpl, err := parseMessageTemplate("telegram", cfg.Template, defaultTelegramTemplate)
+	if err != nil {
+		return nil, err
+	}
+	timeout := 10 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &telegramNotifier{cfg: cfg, tmpl: tmpl, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (tn *telegramNotifier) Send(n Notification) error {
+	text, err := renderMessage(tn.tmpl, n)
+	if err != nil {
+		return err
+	}
+	text = html.EscapeString(text)
+	if tn.cfg.Snippet {
+		for _, ev := range n.Events {
+			if ev.Type != "new" && ev.Type != "modified" {
+				continue
+			}
+			if snippet := textSnippet(ev.Path, tn.cfg.SnippetLines); snippet != "" {
+				text += "\n\n" + html.EscapeString(ev.Path) + ":\n<pre>" + html.EscapeString(snippet) + "</pre>"
+			}
+		}
+	}
+	if utf8.RuneCountInString(text) > telegramMaxText {
+		// 截断后不能保证 HTML 标签完整，改为纯文本发送
+		text = html.UnescapeString(strings.NewReplacer("<pre>", "", "</pre>", "").Replace(text))
+		text = string([]rune(text)[:telegramMaxText-20]) + "\n...(已截断)"
+		return tn.sendAll(text, "")
+	}
+	return tn.sendAll(text, "HTML")
+}
+
+func (tn *telegramNotifier) sendAll(text, parseMode string) error {
+	var firstErr error
+	for _, chat := range tn.cfg.ChatIDs {
+		if err := tn.sendMessage(chat, text, parseMode); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("chat %s: %v", chat, err)
+		}
+	}
+	return firstErr
+}
+
+func (tn *telegramNotifier) sendMessage(chat, text, parseMode string) error {
+	msg := map[string]interface{}{
+		"chat_id":                  chat,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}
+	if parseMode != "" {
+		msg["parse_mode"] = parseMode
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(tn.cfg.APIURL, "/") + "/bot" + tn.cfg.BotToken + "/sendMessage"
+	resp, err := tn.client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// 错误信息中的地址包含 bot token，不能写进日志
+		return fmt.Errorf("请求失败: %v", strings.ReplaceAll(err.Error(), tn.cfg.BotToken, "***"))
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("返回 %s，无法解析响应: %v", resp.Status, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("Telegram 返回错误: %s", result.Description)
+	}
+	return nil
+}
+
+// textSnippet 返回文本文件开头的若干行，二进制文件返回空字符串
+func textSnippet(path string, lines int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 4096), 4096)
+	for i := 0; i < lines && sc.Scan(); i++ {
+		line := sc.Bytes()
+		if bytes.IndexByte(line, 0) >= 0 || !utf8.Valid(line) {
+			return ""
+		}
+		if len(line) > 200 {
+			line = append(line[:200:200], "..."...)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// 扫描限速（throttle）：限制计算哈希时读取文件的速率，并可以降低进程的 CPU 和磁盘 I/O 优先级，
+// 避免业务高峰期的完整扫描占满磁盘带宽、拖慢网站
+
+// ThrottleConfig 配置读取速率上限和进程优先级
+type ThrottleConfig struct {
+	ReadMBPerSec float64  `json:"read_mb_per_sec"` // 读取文件的速率上限（MB/s），0 表示不限制
+	Days         []string `json:"days"`            // 限速只在这些日子的 from-to 时段内生效，都留空表示一直限速
+	From         string   `json:"from"`            // HH:MM
+	To           string   `json:"to"`              // HH:MM
+	Nice         int      `json:"nice"`            // CPU 优先级 1-19，越大越低，0 表示不调整
+	IOClass      string   `json:"io_class"`        // 磁盘 I/O 调度类别：idle（磁盘空闲时才读取）或 best-effort
+	IOLevel      int      `json:"io_level"`        // best-effort 的级别 0-7，越大越低，默认 7
+}
+
+var (
+	readLimiter    *rateLimiter
+	throttleWindow *scheduleWindow
+)
+
+// rateLimiter 按读取的字节数排队等待，所有扫描 goroutine 共用一个限额
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64 // 字节/秒
+	next time.Time
+}
+
+// wait 记录读取了 n 个字节，读得太快时等待到限额允许的时刻；空闲期间不积累额度
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	t := time.Now()
+	if l.next.Before(t) {
+		l.next = t
+	}
+	d := l.next.Sub(t)
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func applyThrottleConfig(c ThrottleConfig) error {
+	readLimiter, throttleWindow = nil, nil
+	if c.ReadMBPerSec < 0 {
+		return fmt.Errorf("throttle.read_mb_per_sec 不能为负数")
+	}
+	if c.ReadMBPerSec > 0 {
+		readLimiter = &rateLimiter{rate: c.ReadMBPerSec * 1024 * 1024}
+	}
+	if len(c.Days) > 0 || c.From != "" || c.To != "" {
+		w, err := parseWindow(c.Days, c.From, c.To)
+		if err != nil {
+			return fmt.Errorf("throttle 时段%v", err)
+		}
+		throttleWindow = &w
+	}
+	if c.Nice < 0 || c.Nice > 19 {
+		return fmt.Errorf("throttle.nice 应为 0-19")
+	}
+	level := 7
+	if c.IOLevel != 0 {
+		level = c.IOLevel
+	}
+	switch c.IOClass {
+	case "", "idle", "best-effort":
+	default:
+		return fmt.Errorf("throttle.io_class 无效: %s（可选 idle、best-effort）", c.IOClass)
+	}
+	if level < 0 || level > 7 {
+		return fmt.Errorf("throttle.io_level 应为 0-7")
+	}
+	if c.Nice == 0 && c.IOClass == "" {
+		return nil
+	}
+	if err := lowerPriority(c.Nice, c.IOClass, level); err != nil {
+		log.Printf("降低进程优先级失败: %v", err)
+	}
+	return nil
+}
+
+// throttled 在配置了读取速率上限时包装 r，限速时段之外不等待
+func throttled(r io.Reader) io.Reader {
+	if readLimiter == nil {
+		return r
+	}
+	return throttledReader{r}
+}
+
+type throttledReader struct {
+	r io.Reader
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 && (throttleWindow == nil || throttleWindow.matches(now())) {
+		readLimiter.wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	// 内嵌时区数据库，Windows 等没有 zoneinfo 的系统也能使用 timezone 配置
+	_ "time/tzdata"
+)
+
+const defaultTimeLayout = "2006-01-02 15:04:05"
+
+var (
+	timeLoc    = time.Local
+	timeLayout = defaultTimeLayout
+)
+
+// applyTimeConfig 设置时区和时间格式，format 可以是 rfc3339 或任意 Go 时间布局
+func applyTimeConfig(zone, format string) error {
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return fmt.Errorf("无效的时区 '%s': %v", zone, err)
+		}
+		timeLoc = loc
+	}
+
+	switch format {
+	case "":
+	case "rfc3339", "RFC3339":
+		timeLayout = time.RFC3339
+	default:
+		timeLayout = format
+	}
+	return nil
+}
+
+// now 返回配置时区下的当前时间，写入事件和接口的时间都应使用它
+func now() time.Time {
+	return time.Now().In(timeLoc)
+}
+
+func formatTime(t time.Time) string {
+	return t.In(timeLoc).Format(timeLayout)
+}
+
+// timestampWriter 替代 log 包自带的时间前缀，使日志时间与警报一致
+type timestampWriter struct {
+	w io.Writer
+}
+
+func (tw timestampWriter) Write(p []byte) (int, error) {
+	line := append([]byte(formatTime(time.Now())+" "), p...)
+	if _, err := tw.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
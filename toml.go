@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TOML 配置：支持 TOML 1.0 中除日期时间以外的全部写法——表、表数组、点分键、内联表、
+// 多行数组、四种字符串、各种进制的整数和浮点数，以及 # 注释。读取后转换为 JSON，
+// 配置项与 JSON 配置完全相同
+
+type tomlParser struct {
+	s    string
+	i    int
+	root map[string]interface{}
+	cur  map[string]interface{}
+	// tables 记录用 [表头] 定义过的表，arrays 记录用 [[表头]] 定义的表数组，按点分路径
+	tables map[string]bool
+	arrays map[string]bool
+}
+
+// tomlToJSON 解析 TOML 并转换为 JSON
+func tomlToJSON(data []byte) ([]byte, error) {
+	p := &tomlParser{
+		s:      strings.TrimPrefix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\ufeff"),
+		root:   make(map[string]interface{}),
+		tables: make(map[string]bool),
+		arrays: make(map[string]bool),
+	}
+	p.cur = p.root
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(p.root)
+}
+
+func (p *tomlParser) errorf(format string, a ...interface{}) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	return fmt.Errorf("第 %d 行: %s", line, fmt.Sprintf(format, a...))
+}
+
+func (p *tomlParser) eof() bool { return p.i >= len(p.s) }
+
+func (p *tomlParser) space() {
+	for !p.eof() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+// spaceLines 跳过空白、换行和注释，用于数组内部
+func (p *tomlParser) spaceLines() {
+	for !p.eof() {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n':
+			p.i++
+		case '#':
+			p.comment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) comment() {
+	for !p.eof() && p.s[p.i] != '\n' {
+		p.i++
+	}
+}
+
+// endOfLine 确认一条语句后只有空白和注释
+func (p *tomlParser) endOfLine() error {
+	p.space()
+	if !p.eof() && p.s[p.i] == '#' {
+		p.comment()
+	}
+	if p.eof() {
+		return nil
+	}
+	if p.s[p.i] != '\n' {
+		return p.errorf("多余的内容 %q", p.rest())
+	}
+	p.i++
+	return nil
+}
+
+// rest 返回当前行剩余的内容，用于错误信息
+func (p *tomlParser) rest() string {
+	s := p.s[p.i:]
+	if n := strings.IndexByte(s, '\n'); n >= 0 {
+		s = s[:n]
+	}
+	return s
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.spaceLines()
+		if p.eof() {
+			return nil
+		}
+		var err error
+		if p.s[p.i] == '[' {
+			err = p.header()
+		} else {
+			err = p.keyValue(p.cur)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// header 解析 [表] 和 [[表数组]]
+func (p *tomlParser) header() error {
+	array := strings.HasPrefix(p.s[p.i:], "[[")
+	if array {
+		p.i += 2
+	} else {
+		p.i++
+	}
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	end := "]"
+	if array {
+		end = "]]"
+	}
+	p.space()
+	if !strings.HasPrefix(p.s[p.i:], end) {
+		return p.errorf("表头缺少 %s", end)
+	}
+	p.i += len(end)
+
+	parent, err := p.descend(p.root, keys[:len(keys)-1], true)
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	path := strings.Join(keys, "\x00")
+	existing, ok := parent[name]
+	if array {
+		if ok && !p.arrays[path] {
+			return p.errorf("%s 已经定义为其他类型，不能用作表数组", strings.Join(keys, "."))
+		}
+		t := make(map[string]interface{})
+		list, _ := existing.([]interface{})
+		parent[name] = append(list, t)
+		p.arrays[path] = true
+		// 表数组的每个元素重新开始记录子表
+		for k := range p.tables {
+			if strings.HasPrefix(k, path+"\x00") {
+				delete(p.tables, k)
+			}
+		}
+		p.cur = t
+		return nil
+	}
+	if p.tables[path] {
+		return p.errorf("重复定义的表 [%s]", strings.Join(keys, "."))
+	}
+	p.tables[path] = true
+	if !ok {
+		t := make(map[string]interface{})
+		parent[name] = t
+		p.cur = t
+		return nil
+	}
+	t, isMap := existing.(map[string]interface{})
+	if !isMap {
+		return p.errorf("%s 已经定义为其他类型，不能用作表", strings.Join(keys, "."))
+	}
+	p.cur = t
+	return nil
+}
+
+// descend 沿点分键找到（必要时创建）上级表；fromHeader 为 true 时表数组取最后一个元素
+func (p *tomlParser) descend(t map[string]interface{}, keys []string, fromHeader bool) (map[string]interface{}, error) {
+	for i, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			t[k] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			var last interface{}
+			if len(v) > 0 {
+				last = v[len(v)-1]
+			}
+			m, isMap := last.(map[string]interface{})
+			if !isMap || !fromHeader {
+				return nil, p.errorf("%s 不是表", strings.Join(keys[:i+1], "."))
+			}
+			t = m
+		default:
+			return nil, p.errorf("%s 不是表", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return t, nil
+}
+
+// keyValue 解析 键 = 值，写入表 t
+func (p *tomlParser) keyValue(t map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.space()
+	if p.eof() || p.s[p.i] != '=' {
+		return p.errorf("键 %s 后应为 =", strings.Join(keys, "."))
+	}
+	p.i++
+	p.space()
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := p.descend(t, keys[:len(keys)-1], false)
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	if _, ok := parent[name]; ok {
+		return p.errorf("重复的键 %s", strings.Join(keys, "."))
+	}
+	parent[name] = v
+	return nil
+}
+
+// key 解析可能带点的键，每一段为裸键或引号字符串
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.space()
+		if p.eof() {
+			return nil, p.errorf("缺少键")
+		}
+		switch c := p.s[p.i]; {
+		case c == '"' || c == '\'':
+			if strings.HasPrefix(p.s[p.i:], `"""`) || strings.HasPrefix(p.s[p.i:], "'''") {
+				return nil, p.errorf("键不能是多行字符串")
+			}
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, s)
+		case isTOMLBareKey(c):
+			start := p.i
+			for !p.eof() && isTOMLBareKey(p.s[p.i]) {
+				p.i++
+			}
+			keys = append(keys, p.s[start:p.i])
+		default:
+			return nil, p.errorf("无效的键 %q", p.rest())
+		}
+		p.space()
+		if p.eof() || p.s[p.i] != '.' {
+			return keys, nil
+		}
+		p.i++
+	}
+}
+
+func isTOMLBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("缺少值")
+	}
+	switch p.s[p.i] {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	}
+	start := p.i
+	for !p.eof() && strings.IndexByte(" \t\n,]}#", p.s[p.i]) < 0 {
+		p.i++
+	}
+	tok := p.s[start:p.i]
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, p.errorf("缺少值")
+	}
+	if num, ok := tomlNumber(tok); ok {
+		return num, nil
+	}
+	p.i = start
+	if len(tok) >= 5 && tok[4] == '-' || len(tok) >= 3 && tok[2] == ':' {
+		return nil, p.errorf("不支持日期时间 %s，请写成字符串", tok)
+	}
+	if strings.HasSuffix(tok, "inf") || strings.HasSuffix(tok, "nan") {
+		return nil, p.errorf("不支持 %s", tok)
+	}
+	return nil, p.errorf("无效的值 %q（字符串需要加引号）", tok)
+}
+
+// tomlNumber 解析整数（支持 0x、0o、0b 和下划线分隔）和浮点数
+func tomlNumber(tok string) (json.Number, bool) {
+	if strings.HasPrefix(tok, "_") || strings.HasSuffix(tok, "_") || strings.Contains(tok, "__") {
+		return "", false
+	}
+	s := strings.ReplaceAll(tok, "_", "")
+	if len(s) > 2 && s[0] == '0' && strings.IndexByte("xob", s[1]) >= 0 {
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[s[1]]
+		v, err := strconv.ParseInt(s[2:], base, 64)
+		if err != nil {
+			return "", false
+		}
+		return json.Number(strconv.FormatInt(v, 10)), true
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(v, 10)), true
+	}
+	if strings.ContainsAny(s, "xXpPnN") || !strings.ContainsAny(s, "0123456789") {
+		return "", false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", false
+	}
+	return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), true
+}
+
+func (p *tomlParser) array() (interface{}, error) {
+	p.i++
+	items := []interface{}{}
+	for {
+		p.spaceLines()
+		if p.eof() {
+			return nil, p.errorf("数组缺少 ]")
+		}
+		if p.s[p.i] == ']' {
+			p.i++
+			return items, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		p.spaceLines()
+		if p.eof() {
+			return nil, p.errorf("数组缺少 ]")
+		}
+		switch p.s[p.i] {
+		case ',':
+			p.i++
+		case ']':
+		default:
+			return nil, p.errorf("数组元素之间应为逗号")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (interface{}, error) {
+	p.i++
+	t := make(map[string]interface{})
+	p.space()
+	if !p.eof() && p.s[p.i] == '}' {
+		p.i++
+		return t, nil
+	}
+	for {
+		if err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		p.space()
+		if p.eof() {
+			return nil, p.errorf("内联表缺少 }")
+		}
+		switch p.s[p.i] {
+		case ',':
+			p.i++
+			p.space()
+			if !p.eof() && p.s[p.i] == '\n' {
+				return nil, p.errorf("内联表必须写在同一行")
+			}
+		case '}':
+			p.i++
+			return t, nil
+		default:
+			return nil, p.errorf("内联表的键值对之间应为逗号，并且必须写在同一行")
+		}
+	}
+}
+
+// str 解析四种字符串：基本 "..."、字面 '...' 和对应的多行形式
+func (p *tomlParser) str() (string, error) {
+	q := p.s[p.i]
+	multi := strings.HasPrefix(p.s[p.i:], strings.Repeat(string(q), 3))
+	if multi {
+		p.i += 3
+		// 紧跟开头引号的换行不属于内容
+		if !p.eof() && p.s[p.i] == '\n' {
+			p.i++
+		}
+	} else {
+		p.i++
+	}
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		switch {
+		case c == q && !multi:
+			p.i++
+			return b.String(), nil
+		case c == q && strings.HasPrefix(p.s[p.i:], strings.Repeat(string(q), 3)):
+			// 结束引号前最多可以再有两个引号属于内容
+			n := 3
+			for n < 5 && p.i+n < len(p.s) && p.s[p.i+n] == q {
+				n++
+			}
+			b.WriteString(strings.Repeat(string(q), n-3))
+			p.i += n
+			return b.String(), nil
+		case c == '\n' && !multi:
+			return "", p.errorf("字符串没有闭合")
+		case c == '\\' && q == '"':
+			if err := p.escape(&b, multi); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return "", p.errorf("字符串没有闭合")
+}
+
+// escape 解析基本字符串中的转义，p.i 指向反斜杠
+func (p *tomlParser) escape(b *strings.Builder, multi bool) error {
+	p.i++
+	if p.eof() {
+		return p.errorf("字符串没有闭合")
+	}
+	c := p.s[p.i]
+	p.i++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.i+size > len(p.s) {
+			return p.errorf("转义 \\%c 不完整", c)
+		}
+		r, err := strconv.ParseUint(p.s[p.i:p.i+size], 16, 32)
+		if err != nil {
+			return p.errorf("转义 \\%c 无效", c)
+		}
+		b.WriteRune(rune(r))
+		p.i += size
+	case ' ', '\t', '\n':
+		// 多行字符串中行尾的反斜杠去掉换行和下一行开头的空白
+		if !multi {
+			return p.errorf("不支持的转义")
+		}
+		j := p.i - 1
+		for j < len(p.s) && (p.s[j] == ' ' || p.s[j] == '\t') {
+			j++
+		}
+		if j == len(p.s) || p.s[j] != '\n' {
+			return p.errorf("反斜杠后只能是换行")
+		}
+		for j < len(p.s) && strings.IndexByte(" \t\n", p.s[j]) >= 0 {
+			j++
+		}
+		p.i = j
+	default:
+		return p.errorf("不支持的转义 \\%c（Windows 路径请使用单引号）", c)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const tuiRefresh = 2 * time.Second
+
+// runTUI 定时轮询守护进程的控制接口并在终端中刷新显示，Ctrl-C 退出
+func runTUI() int {
+	addr := resolveCtlAddr()
+	if addr == "" {
+		fmt.Fprintln(os.Stderr, "错误：未指定控制地址，请使用 -ctl-addr 或在配置文件中设置 control")
+		return 2
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// 隐藏光标，退出时恢复
+	fmt.Print("\033[?25l")
+	defer fmt.Print("\033[?25h\n")
+
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	for {
+		st, err := tuiFetch(addr)
+		tuiDraw(addr, st, err)
+
+		select {
+		case <-stop:
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+func tuiFetch(addr string) (*ctlStatus, error) {
+	resp, err := ctlRequest(addr, http.MethodGet, "/ctl/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("守护进程返回 %s", resp.Status)
+	}
+	var st ctlStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func tuiDraw(addr string, st *ctlStatus, fetchErr error) {
+	var b strings.Builder
+
+	// 光标归位并清屏
+	b.WriteString("\033[H\033[2J")
+	b.WriteString(tuiBold(fmt.Sprintf("文件防篡改监控  %s  %s", addr, formatTime(time.Now()))) + "\n\n")
+
+	if fetchErr != nil {
+		b.WriteString(tuiColor(31, "无法获取状态: "+fetchErr.Error()) + "\n")
+		fmt.Print(b.String())
+		return
+	}
+
+	b.WriteString(fmt.Sprintf("%s\n", st.Version))
+	dirs := make([]string, len(st.Directories))
+	for i, d := range st.Directories {
+		dirs[i] = fmt.Sprintf("%s (%d)", d, st.DirectoryFiles[d])
+	}
+	b.WriteString(fmt.Sprintf("监控目录: %s\n", strings.Join(dirs, ", ")))
+	b.WriteString(fmt.Sprintf("基线文件: %d    待确认: %d    上次扫描: %s\n",
+		st.Files, st.Pending, tuiTime(st.LastScan)))
+	if time.Now().Before(st.SilencedUntil) {
+		b.WriteString(tuiColor(33, "警报静默至 "+formatTime(st.SilencedUntil)) + "\n")
+	}
+	if p := pauseText(*st); p != "" {
+		b.WriteString(tuiColor(33, p) + "\n")
+	}
+
+	if st.Coverage != nil {
+		b.WriteString(st.Coverage.summary() + "\n")
+	}
+	for _, d := range st.Unavailable {
+		b.WriteString(tuiColor(31, "目录不可用: "+d) + "\n")
+	}
+
+	b.WriteString("\n" + tuiBold("扫描进度") + "\n")
+	if st.Progress.Scanning {
+		b.WriteString(fmt.Sprintf("  扫描中 %s  已检查 %d 个文件  耗时 %s\n",
+			st.Progress.Dir, st.Progress.Files, time.Since(st.Progress.StartedAt).Round(time.Second)))
+	} else {
+		b.WriteString("  空闲\n")
+	}
+
+	b.WriteString("\n" + tuiBold("待确认变动") + "\n")
+	if len(st.PendingChanges) == 0 {
+		b.WriteString("  无\n")
+	}
+	for i, ev := range st.PendingChanges {
+		if i == 10 {
+			b.WriteString(fmt.Sprintf("  ... 另有 %d 项\n", len(st.PendingChanges)-i))
+			break
+		}
+		b.WriteString(fmt.Sprintf("  %s  %-8s %s\n", tuiTime(ev.Time), ev.Type, ev.Path))
+	}
+
+	b.WriteString("\n" + tuiBold("最近警报") + "\n")
+	if len(st.RecentAlerts) == 0 {
+		b.WriteString("  无\n")
+	}
+	start := len(st.RecentAlerts) - 10
+	if start < 0 {
+		start = 0
+	}
+	for i := len(st.RecentAlerts) - 1; i >= start; i-- {
+		a := st.RecentAlerts[i]
+		// 多行警报只显示首行
+		line := strings.SplitN(a.Message, "\n", 2)[0]
+		b.WriteString(fmt.Sprintf("  %s  %s\n", tuiTime(a.Time), line))
+	}
+
+	b.WriteString("\n" + tuiBold("通知渠道") + "\n")
+	for _, ch := range st.Channels {
+		state := tuiColor(32, "正常")
+		if !ch.OK {
+			state = tuiColor(31, "异常 "+ch.LastError)
+		}
+		b.WriteString(fmt.Sprintf("  %-12s %s  最近发送: %s\n", ch.Name, state, tuiTime(ch.LastSent)))
+	}
+
+	b.WriteString("\nCtrl-C 退出\n")
+	fmt.Print(b.String())
+}
+
+func tuiTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return formatTime(t)
+}
+
+func tuiBold(s string) string {
+	return "\033[1m" + s + "\033[0m"
+}
+
+func tuiColor(code int, s string) string {
+	return fmt.Sprintf("\033[%dm%s\033[0m", code, s)
+}
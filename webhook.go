@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WebhookConfig 配置 webhook 通知。设置 secret 后每个请求都带 HMAC-SHA256 签名：
+//
+//	X-Webmon-Timestamp: Unix 秒
+//	X-Webmon-Nonce:     随机串
+//	X-Webmon-Signature: sha256=hex(HMAC(secret, timestamp + "." + nonce + "." + body))
+//
+// 接收方应拒绝时间偏差过大或 nonce 重复的请求以防重放
+type WebhookConfig struct {
+	URLs    []string          `json:"urls"`
+	Secret  string            `json:"secret" secret:"true"`
+	Timeout string            `json:"timeout"` // 默认 10s
+	Headers map[string]string `json:"headers"` // 附加请求头，例如事件系统的认证令牌
+}
+
+type webhookPayload struct {
+	ID        string    `json:"id"`
+	Timestamp int64     `json:"timestamp"`
+	Nonce     string    `json:"nonce"`
+	Time      time.Time `json:"time"`
+	Host      string    `json:"host"`
+	Severity  string    `json:"severity"`
+	Text      string    `json:"text"`
+	Events    []Event   `json:"events"`
+
+	// 只有一个事件时平铺到顶层，方便接收方直接取字段
+	Type    string `json:"type,omitempty"`
+	Path    string `json:"path,omitempty"`
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+}
+
+type webhookNotifier struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+func newWebhookNotifier(cfg WebhookConfig) *webhookNotifier {
+	timeout := 10 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &webhookNotifier{cfg: cfg, client: &http.Client{Timeout: timeout}}
+}
+
+func (wn *webhookNotifier) Send(n Notification) error {
+	nonce := randomHex(16)
+	ts := time.Now().Unix()
+	payload := webhookPayload{
+		ID:        randomHex(8),
+		Timestamp: ts,
+		Nonce:     nonce,
+		Time:      n.Time,
+		Host:      hostname(),
+		Severity:  n.Severity,
+		Text:      n.Text,
+		Events:    n.Events,
+	}
+	if payload.Events == nil {
+		payload.Events = []Event{}
+	}
+	if len(n.Events) == 1 {
+		ev := n.Events[0]
+		payload.Type, payload.Path = ev.Type, ev.Path
+		payload.OldHash, payload.NewHash, payload.Size = ev.OldHash, ev.NewHash, ev.Size
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, url := range wn.cfg.URLs {
+		if err := wn.post(url, body, ts, nonce); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %v", url, err)
+		}
+	}
+	return firstErr
+}
+
+func (wn *webhookNotifier) post(url string, body []byte, ts int64, nonce string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "webmonitor")
+	for k, v := range wn.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if wn.cfg.Secret != "" {
+		tsText := strconv.FormatInt(ts, 10)
+		req.Header.Set("X-Webmon-Timestamp", tsText)
+		req.Header.Set("X-Webmon-Nonce", nonce)
+		req.Header.Set("X-Webmon-Signature", "sha256="+signWebhook(wn.cfg.Secret, tsText, nonce, body))
+	}
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("返回 %s", resp.Status)
+	}
+	return nil
+}
+
+func signWebhook(secret, ts, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + nonce + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// WebShell 特征检测：对新增和被修改的文件逐条匹配常见 WebShell 特征（一句话木马、中国菜刀、
+// 冰蝎/哥斯拉加载器、JSP 命令执行、知名大马等），命中时以 critical 级别单独标注报警，
+// 事件中的 webshell 字段列出命中的特征，便于与普通变动分开路由。风险评分始终使用这些特征
+
+// WebshellConfig 配置 WebShell 特征检测
+type WebshellConfig struct {
+	Enabled     bool                `json:"enabled"`
+	Severity    string              `json:"severity"`      // 命中时的级别，默认 critical
+	Channels    []string            `json:"channels"`      // 命中时额外通知的渠道
+	MaxFileSize int64               `json:"max_file_size"` // 读取的最大字节数，默认 1 MB，超出部分不检查
+	Disabled    []string            `json:"disabled"`      // 不使用的内置特征 ID
+	Signatures  []WebshellSignature `json:"signatures"`    // 自定义特征
+}
+
+// WebshellSignature 是一条特征，pattern 为 Go 正则表达式
+type WebshellSignature struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	re      *regexp.Regexp
+}
+
+func builtinSig(id, name, pattern string) WebshellSignature {
+	return WebshellSignature{ID: id, Name: name, Pattern: pattern, re: regexp.MustCompile(pattern)}
+}
+
+var builtinWebshellSignatures = []WebshellSignature{
+	builtinSig("php_eval_decode", "PHP eval/assert 执行解码后的代码", `(?i)\b(eval|assert)\s*\(\s*(base64_decode|gzinflate|str_rot13|gzuncompress|gzdecode)\s*\(`),
+	builtinSig("php_exec_input", "PHP 执行请求参数", `(?i)\b(eval|assert|system|exec|shell_exec|passthru|popen|proc_open|pcntl_exec)\s*\(\s*@?\s*\$_(GET|POST|REQUEST|COOKIE|SERVER|FILES)\b`),
+	builtinSig("php_chopper", "中国菜刀 PHP 一句话", `(?i)<\?php\s+@?eval\s*\(\s*\$_(POST|GET|REQUEST)\s*\[`),
+	builtinSig("php_input_callable", "PHP 把请求参数当作函数调用", `(?i)\$_(GET|POST|REQUEST|COOKIE)\s*\[[^\]]{1,40}\]\s*\(`),
+	builtinSig("php_callback_input", "PHP 回调函数执行请求参数", `(?i)\b(array_map|call_user_func(_array)?|usort|uasort|array_filter|register_shutdown_function|create_function)\s*\(\s*@?\s*\$_(GET|POST|REQUEST|COOKIE)\b`),
+	builtinSig("php_preg_e", "preg_replace /e 代码执行", `(?i)\bpreg_replace\s*\(\s*['"]/.*/[a-z]*e[a-z]*['"]`),
+	builtinSig("php_rot13_assert", "rot13 隐藏的 assert", `(?i)str_rot13\s*\(\s*['"]nffreg['"]`),
+	builtinSig("php_behinder", "冰蝎/哥斯拉 PHP 加载器", `(?is)session_start\s*\(\s*\)\s*;.{0,200}\$key\s*=\s*["'][0-9a-f]{16}["']`),
+	builtinSig("asp_chopper", "中国菜刀 ASP 一句话", `(?i)<%\s*(eval|execute(global)?)\s*\(?\s*request\s*[\(.]`),
+	builtinSig("aspx_chopper", "中国菜刀 ASPX 一句话", `(?i)\beval\s*\(\s*Request(\.Item)?\s*[\[(].{0,80}unsafe`),
+	builtinSig("aspx_eval_request", "ASPX eval 请求参数", `(?i)\beval\s*\(\s*Request(\.Item)?\s*[\[(]`),
+	builtinSig("aspx_assembly_load", ".NET 加载 Base64 程序集", `(?i)Assembly\.Load\s*\(\s*Convert\.FromBase64String`),
+	builtinSig("aspx_process_start", ".NET 执行请求中的命令", `(?i)Process\.Start\s*\([^;]{0,200}Request`),
+	builtinSig("jsp_runtime_exec", "JSP 执行请求参数", `(?i)\bRuntime\.getRuntime\(\)\.exec\s*\(\s*request\.getParameter`),
+	builtinSig("jsp_process_builder", "JSP ProcessBuilder 执行请求参数", `(?i)new\s+ProcessBuilder\s*\([^;]{0,200}request\.getParameter`),
+	builtinSig("jsp_classloader", "冰蝎/哥斯拉 JSP 加载器", `(?s)extends\s+ClassLoader.{0,500}defineClass`),
+	builtinSig("known_shell", "知名 WebShell", `(?i)\b(c99shell|r57shell|b374k|wso\s*shell|FilesMan|phpspy|weevely)\b`),
+}
+
+var (
+	webshell = WebshellConfig{Severity: sevCritical, MaxFileSize: 1 << 20}
+	// webshellSignatures 是当前生效的特征：内置特征去掉 disabled，加上自定义特征
+	webshellSignatures = builtinWebshellSignatures
+)
+
+func applyWebshellConfig(c WebshellConfig) error {
+	if c.Severity == "" {
+		c.Severity = sevCritical
+	}
+	if !validSeverity(c.Severity) {
+		return fmt.Errorf("webshell.severity 无效: %s", c.Severity)
+	}
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("webshell.max_file_size 不能为负数")
+	}
+	if c.MaxFileSize == 0 {
+		c.MaxFileSize = 1 << 20
+	}
+	known := make(map[string]bool)
+	var sigs []WebshellSignature
+	for _, s := range builtinWebshellSignatures {
+		known[s.ID] = true
+		if !containsString(c.Disabled, s.ID) {
+			sigs = append(sigs, s)
+		}
+	}
+	for _, id := range c.Disabled {
+		if !known[id] {
+			return fmt.Errorf("webshell.disabled 中的特征 %q 不存在", id)
+		}
+	}
+	for i, s := range c.Signatures {
+		if s.ID == "" || s.Pattern == "" {
+			return fmt.Errorf("第 %d 条自定义 WebShell 特征需要 id 和 pattern", i+1)
+		}
+		if known[s.ID] {
+			return fmt.Errorf("WebShell 特征 ID %q 重复", s.ID)
+		}
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("WebShell 特征 %s 的正则表达式无效: %v", s.ID, err)
+		}
+		known[s.ID] = true
+		s.re = re
+		if s.Name == "" {
+			s.Name = s.ID
+		}
+		sigs = append(sigs, s)
+	}
+	webshell = c
+	webshellSignatures = sigs
+	return nil
+}
+
+// matchWebshell 返回内容命中的特征
+func matchWebshell(content []byte) []WebshellSignature {
+	var hits []WebshellSignature
+	for _, s := range webshellSignatures {
+		if s.re.Match(content) {
+			hits = append(hits, s)
+		}
+	}
+	return hits
+}
+
+// checkWebshell 检查新增、修改或移动的文件，命中特征时单独标注并提升为 critical
+func checkWebshell(ev *Event) {
+	if !webshell.Enabled {
+		return
+	}
+	switch ev.Type {
+	case "new", "modified", "renamed", "stream_new", "stream_modified":
+	default:
+		return
+	}
+	path := ev.Path
+	if ev.Stream != "" {
+		path = ev.Path + ":" + ev.Stream
+	}
+	content, err := readHead(path, webshell.MaxFileSize)
+	if err != nil {
+		return
+	}
+	hits := matchWebshell(content)
+	if len(hits) == 0 {
+		return
+	}
+	for _, s := range hits {
+		ev.Webshell = append(ev.Webshell, s.ID)
+		ev.Findings = append(ev.Findings, fmt.Sprintf("WebShell 特征: %s（%s）", s.Name, s.ID))
+	}
+	ev.Severity = maxSeverity(ev.Severity, webshell.Severity)
+	if !containsString(ev.Signals, sigWebshell) {
+		addSignal(ev, sigWebshell)
+	}
+	for _, ch := range webshell.Channels {
+		if !containsString(ev.extra, ch) {
+			ev.extra = append(ev.extra, ch)
+		}
+	}
+}
+
+// readHead 读取文件开头最多 n 个字节
+func readHead(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, n))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// WeComConfig 配置企业微信通知，可以使用群机器人（robot_url），也可以使用自建应用（corp_id 等）
+type WeComConfig struct {
+	RobotURL    string       `json:"robot_url" secret:"true"`
+	CorpID      string       `json:"corp_id"`
+	CorpSecret  string       `json:"corp_secret" secret:"true"`
+	AgentID     int          `json:"agent_id"`
+	ToUser      string       `json:"to_user"`  // 成员 ID，多个用 | 分隔，@all 表示全部
+	ToParty     string       `json:"to_party"` // 部门 ID，多个用 | 分隔
+	MinSeverity string       `json:"min_severity"`
+	Routes      []WeComRoute `json:"routes"`   // 按级别发送到不同的群或成员
+	Template    string       `json:"template"` // markdown 消息模板
+	Timeout     string       `json:"timeout"`  // 默认 10s
+}
+
+// WeComRoute 在警报级别不低于 min_severity 时替换接收方，多条匹配时使用级别最高的一条
+type WeComRoute struct {
+	MinSeverity string `json:"min_severity"`
+	RobotURL    string `json:"robot_url" secret:"true"`
+	ToUser      string `json:"to_user"`
+	ToParty     string `json:"to_party"`
+}
+
+const weComAPI = "https://qyapi.weixin.qq.com/cgi-bin"
+
+const defaultWeComTemplate = `**文件防篡改警报** <font color="{{if eq .Severity "critical" "high"}}warning{{else}}comment{{end}}">[{{.Severity}}]</font>
+> 主机: {{.Host}}
+> 时间: {{.Time}}
+
+{{.Text}}`
+
+type weComNotifier struct {
+	cfg    WeComConfig
+	tmpl   *template.Template
+	client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpire time.Time
+}
+
+func newWeComNotifier(cfg WeComConfig) (*weComNotifier, error) {
+	if cfg.RobotURL == "" && cfg.CorpID == "" {
+		return nil, fmt.Errorf("必须配置 robot_url 或 corp_id")
+	}
+	if cfg.CorpID != "" && (cfg.CorpSecret == "" || cfg.AgentID == 0) {
+		return nil, fmt.Errorf("使用自建应用时必须配置 corp_secret 和 agent_id")
+	}
+	if cfg.MinSeverity == "" {
+		cfg.MinSeverity = sevInfo
+	}
+	if !validSeverity(cfg.MinSeverity) {
+		return nil, fmt.Errorf("无效的 min_severity: %s", cfg.MinSeverity)
+	}
+	for _, r := range cfg.Routes {
+		if !validSeverity(r.MinSeverity) {
+			return nil, fmt.Errorf("路由中的 min_severity 无效: %s", r.MinSeverity)
+		}
+	}
+	sort.Slice(cfg.Routes, func(i, j int) bool {
+		return severityRank[cfg.Routes[i].MinSeverity] > severityRank[cfg.Routes[j].MinSeverity]
+	})
+
+	tmpl, err := parseMessageTemplate("wecom", cfg.Template, defaultWeComTemplate)
+	if err != nil {
+		return nil, err
+	}
+	timeout := 10 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &weComNotifier{cfg: cfg, tmpl: tmpl, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (wn *weComNotifier) Send(n Notification) error {
+	if !severityAtLeast(n.Severity, wn.cfg.MinSeverity) {
+		return nil
+	}
+	text, err := renderMessage(wn.tmpl, n)
+	if err != nil {
+		return err
+	}
+
+	robotURL, toUser, toParty := wn.cfg.RobotURL, wn.cfg.ToUser, wn.cfg.ToParty
+	for _, r := range wn.cfg.Routes {
+		if severityAtLeast(n.Severity, r.MinSeverity) {
+			if r.RobotURL != "" {
+				robotURL = r.RobotURL
+			}
+			if r.ToUser != "" || r.ToParty != "" {
+				toUser, toParty = r.ToUser, r.ToParty
+			}
+			break
+		}
+	}
+
+	markdown := map[string]string{"content": text}
+	if wn.cfg.CorpID == "" {
+		return wn.post(robotURL, map[string]interface{}{"msgtype": "markdown", "markdown": markdown})
+	}
+
+	token, err := wn.accessToken()
+	if err != nil {
+		return err
+	}
+	if toUser == "" && toParty == "" {
+		toUser = "@all"
+	}
+	msg := map[string]interface{}{
+		"touser":   toUser,
+		"toparty":  toParty,
+		"agentid":  wn.cfg.AgentID,
+		"msgtype":  "markdown",
+		"markdown": markdown,
+	}
+	err = wn.post(weComAPI+"/message/send?access_token="+url.QueryEscape(token), msg)
+	if err != nil && strings.Contains(err.Error(), "42001") {
+		// access_token 过期，清除缓存，下次发送时重新获取
+		wn.mu.Lock()
+		wn.token = ""
+		wn.mu.Unlock()
+	}
+	return err
+}
+
+// weComResult 是企业微信接口的通用返回
+type weComResult struct {
+	ErrCode     int    `json:"errcode"`
+	ErrMsg      string `json:"errmsg"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (wn *weComNotifier) post(endpoint string, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := wn.client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result weComResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("返回 %s，无法解析响应: %v", resp.Status, err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("企业微信返回错误 %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// accessToken 获取并缓存自建应用的 access_token
+func (wn *weComNotifier) accessToken() (string, error) {
+	wn.mu.Lock()
+	defer wn.mu.Unlock()
+	if wn.token != "" && time.Now().Before(wn.tokenExpire) {
+		return wn.token, nil
+	}
+
+	q := url.Values{"corpid": {wn.cfg.CorpID}, "corpsecret": {wn.cfg.CorpSecret}}
+	resp, err := wn.client.Get(weComAPI + "/gettoken?" + q.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result weComResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("获取 access_token 返回 %s: %v", resp.Status, err)
+	}
+	if result.ErrCode != 0 {
+		return "", fmt.Errorf("获取 access_token 错误 %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	wn.token = result.AccessToken
+	// 提前 5 分钟刷新
+	wn.tokenExpire = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - 5*time.Minute)
+	return wn.token, nil
+}
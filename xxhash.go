@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// XXH64（种子为 0），输出按大端序编码，与 xxhsum 的结果一致。
+// 速度很快但不是密码学哈希，只适合不涉及安全的超大目录
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+type xxh64 struct {
+	v      [4]uint64
+	total  uint64
+	buf    [32]byte
+	bufLen int
+}
+
+func newXXH64() hash.Hash {
+	h := &xxh64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxh64) Reset() {
+	// 常量相加会溢出，在运行时按 uint64 回绕计算
+	p1, p2 := xxhPrime1, xxhPrime2
+	h.v = [4]uint64{p1 + p2, p2, 0, -p1}
+	h.total = 0
+	h.bufLen = 0
+}
+
+func (h *xxh64) Size() int      { return 8 }
+func (h *xxh64) BlockSize() int { return 32 }
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxhPrime1
+}
+
+func xxhMerge(acc, v uint64) uint64 {
+	acc ^= xxhRound(0, v)
+	return acc*xxhPrime1 + xxhPrime4
+}
+
+func (h *xxh64) stripe(b []byte) {
+	for i := range h.v {
+		h.v[i] = xxhRound(h.v[i], binary.LittleEndian.Uint64(b[8*i:]))
+	}
+}
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	n := len(p)
+	h.total += uint64(n)
+	if h.bufLen > 0 {
+		c := copy(h.buf[h.bufLen:], p)
+		h.bufLen += c
+		p = p[c:]
+		if h.bufLen < len(h.buf) {
+			return n, nil
+		}
+		h.stripe(h.buf[:])
+		h.bufLen = 0
+	}
+	for len(p) >= 32 {
+		h.stripe(p)
+		p = p[32:]
+	}
+	h.bufLen = copy(h.buf[:], p)
+	return n, nil
+}
+
+func (h *xxh64) Sum(b []byte) []byte {
+	var acc uint64
+	if h.total >= 32 {
+		acc = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			acc = xxhMerge(acc, v)
+		}
+	} else {
+		acc = h.v[2] + xxhPrime5
+	}
+	acc += h.total
+
+	p := h.buf[:h.bufLen]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxhPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxhPrime2 + xxhPrime3
+		p = p[4:]
+	}
+	for _, c := range p {
+		acc ^= uint64(c) * xxhPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxhPrime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxhPrime2
+	acc ^= acc >> 29
+	acc *= xxhPrime3
+	acc ^= acc >> 32
+	return binary.BigEndian.AppendUint64(b, acc)
+}
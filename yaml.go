@@ -0,0 +1,675 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// YAML 配置：支持配置文件常用的 YAML 子集——块映射、块序列、流式 [a, b] 和 {k: v}、
+// 单双引号字符串、| 和 > 多行字符串、# 注释。读取后按 Config 的字段类型转换为 JSON，
+// 因此未加引号的 0644、123456 写在字符串字段中也按字符串处理。不支持锚点、别名、标签和多文档
+
+const (
+	yamlScalar = iota
+	yamlMap
+	yamlSeq
+)
+
+type yamlNode struct {
+	kind   int
+	line   int
+	value  string
+	plain  bool // 未加引号的标量，按目标字段的类型解析
+	keys   []string
+	values []*yamlNode
+	items  []*yamlNode
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string // 去掉缩进和注释后的内容，空行和纯注释行为空
+	raw    string // 原始内容，多行字符串使用
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// yamlToJSON 解析 YAML 并按 t 的字段类型转换为 JSON
+func yamlToJSON(data []byte, t reflect.Type) ([]byte, error) {
+	p := &yamlParser{}
+	if err := p.split(string(data)); err != nil {
+		return nil, err
+	}
+	node, err := p.parseBlock(0)
+	if err != nil {
+		return nil, err
+	}
+	if l := p.peek(); l != nil {
+		return nil, fmt.Errorf("第 %d 行: 缩进错误", l.num)
+	}
+	v, err := yamlConvert(node, t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (p *yamlParser) split(s string) error {
+	s = strings.TrimPrefix(s, "\ufeff")
+	for i, raw := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		l := yamlLine{num: i + 1, raw: raw}
+		l.indent = len(raw) - len(strings.TrimLeft(raw, " "))
+		l.text = strings.TrimRight(yamlStripComment(raw[l.indent:]), " \t")
+		if l.text != "" && l.text[0] == '\t' {
+			return fmt.Errorf("第 %d 行: 不能用 Tab 缩进", l.num)
+		}
+		p.lines = append(p.lines, l)
+	}
+	// 文档开头的 --- 和结尾的 ... 可以省略
+	if l := p.peek(); l != nil && l.indent == 0 && (l.text == "---" || strings.HasPrefix(l.text, "--- ")) {
+		if rest := strings.TrimSpace(l.text[3:]); rest != "" {
+			return fmt.Errorf("第 %d 行: --- 后不能有内容", l.num)
+		}
+		p.pos++
+	}
+	for i := len(p.lines) - 1; i >= p.pos; i-- {
+		if p.lines[i].text == "" {
+			continue
+		}
+		if p.lines[i].indent == 0 && p.lines[i].text == "..." {
+			p.lines = p.lines[:i]
+		}
+		break
+	}
+	for _, l := range p.lines[p.pos:] {
+		if l.indent == 0 && (l.text == "---" || strings.HasPrefix(l.text, "--- ")) {
+			return fmt.Errorf("第 %d 行: 不支持多文档 YAML", l.num)
+		}
+	}
+	return nil
+}
+
+// yamlStripComment 去掉行尾注释，引号内的 # 不算注释
+func yamlStripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,:-", s[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return s
+}
+
+// peek 返回下一个非空行
+func (p *yamlParser) peek() *yamlLine {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+	if p.pos == len(p.lines) {
+		return nil
+	}
+	return &p.lines[p.pos]
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock 解析缩进不小于 indent 的块节点，没有内容时为空值
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	l := p.peek()
+	if l == nil || l.indent < indent {
+		line := len(p.lines)
+		if l != nil {
+			line = l.num
+		}
+		return &yamlNode{kind: yamlScalar, line: line, plain: true}, nil
+	}
+	if isYAMLSeqItem(l.text) {
+		return p.parseSeq(l.indent)
+	}
+	if _, _, ok, err := yamlSplitKey(l.text); err != nil {
+		return nil, fmt.Errorf("第 %d 行: %v", l.num, err)
+	} else if ok {
+		return p.parseMap(l.indent)
+	}
+	p.pos++
+	return p.parseValue(l, l.text, indent-1)
+}
+
+func (p *yamlParser) parseMap(indent int) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlMap, line: p.peek().num}
+	for l := p.peek(); l != nil && l.indent >= indent; l = p.peek() {
+		if l.indent > indent {
+			return nil, fmt.Errorf("第 %d 行: 缩进错误", l.num)
+		}
+		if isYAMLSeqItem(l.text) {
+			return nil, fmt.Errorf("第 %d 行: 此处应为 键: 值", l.num)
+		}
+		key, rest, ok, err := yamlSplitKey(l.text)
+		if err == nil && !ok {
+			err = fmt.Errorf("此处应为 键: 值")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %v", l.num, err)
+		}
+		for _, k := range n.keys {
+			if k == key {
+				return nil, fmt.Errorf("第 %d 行: 重复的键 %s", l.num, key)
+			}
+		}
+		p.pos++
+
+		var v *yamlNode
+		if rest == "" {
+			// 值在下面的行中；序列可以与键对齐
+			next := p.peek()
+			if next != nil && next.indent == indent && isYAMLSeqItem(next.text) {
+				v, err = p.parseSeq(indent)
+			} else {
+				v, err = p.parseBlock(indent + 1)
+			}
+		} else {
+			v, err = p.parseValue(l, rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.keys = append(n.keys, key)
+		n.values = append(n.values, v)
+	}
+	return n, nil
+}
+
+func (p *yamlParser) parseSeq(indent int) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlSeq, line: p.peek().num}
+	for l := p.peek(); l != nil && l.indent >= indent; l = p.peek() {
+		if l.indent > indent {
+			return nil, fmt.Errorf("第 %d 行: 缩进错误", l.num)
+		}
+		if !isYAMLSeqItem(l.text) {
+			// 与键对齐的序列在下一个键处结束
+			break
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		var item *yamlNode
+		var err error
+		_, _, isKey, _ := yamlSplitKey(rest)
+		switch {
+		case rest == "":
+			p.pos++
+			item, err = p.parseBlock(indent + 1)
+		case isYAMLSeqItem(rest) || isKey:
+			// "- key: v" 和 "- - a"：把这一行的剩余部分当作缩进更深的一行重新解析
+			l.indent += len(l.text) - len(rest)
+			l.text = rest
+			item, err = p.parseBlock(l.indent)
+		default:
+			p.pos++
+			item, err = p.parseValue(l, rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+	}
+	return n, nil
+}
+
+// parseValue 解析与键或 - 写在同一行的值，indent 为所属的键或序列的缩进
+func (p *yamlParser) parseValue(l *yamlLine, s string, indent int) (*yamlNode, error) {
+	switch s[0] {
+	case '|', '>':
+		return p.parseBlockScalar(l, s, indent)
+	case '&', '*', '!':
+		return nil, fmt.Errorf("第 %d 行: 不支持锚点、别名和标签（以 * 开头的通配符需要加引号）", l.num)
+	case '[', '{':
+		// 流式集合可以跨多行
+		for yamlFlowDepth(s) > 0 && p.pos < len(p.lines) {
+			s += " " + strings.TrimSpace(p.lines[p.pos].text)
+			p.pos++
+		}
+		f := &yamlFlow{s: s, line: l.num}
+		n, err := f.value()
+		if err == nil {
+			f.space()
+			if f.i < len(f.s) {
+				err = f.errorf("多余的内容 %q", f.s[f.i:])
+			}
+		}
+		return n, err
+	case '"', '\'':
+		f := &yamlFlow{s: s, line: l.num}
+		n, err := f.quoted()
+		if err == nil && f.i < len(s) {
+			err = f.errorf("引号后有多余的内容 %q", s[f.i:])
+		}
+		return n, err
+	}
+	if next := p.peek(); next != nil && next.indent > indent && !isYAMLSeqItem(next.text) {
+		if _, _, ok, _ := yamlSplitKey(next.text); !ok {
+			return nil, fmt.Errorf("第 %d 行: 不支持跨行的无引号字符串，请使用 | 或 >", next.num)
+		}
+	}
+	return &yamlNode{kind: yamlScalar, line: l.num, value: s, plain: true}, nil
+}
+
+// parseBlockScalar 解析 | （保留换行）和 > （折叠换行）多行字符串
+func (p *yamlParser) parseBlockScalar(l *yamlLine, header string, indent int) (*yamlNode, error) {
+	style, chomp := header[0], header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, fmt.Errorf("第 %d 行: 不支持的多行字符串标记 %s", l.num, header)
+	}
+	var lines []string
+	contentIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos].raw
+		ind := len(raw) - len(strings.TrimLeft(raw, " "))
+		if strings.TrimSpace(raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if contentIndent < 0 {
+			contentIndent = ind
+		}
+		if ind <= indent || ind < contentIndent {
+			break
+		}
+		lines = append(lines, strings.TrimRight(raw[contentIndent:], "\r"))
+	}
+	// 末尾的空行可能属于后面的内容，留给 peek 跳过
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var b strings.Builder
+	for i, s := range lines {
+		if i > 0 {
+			if style == '>' && s != "" && lines[i-1] != "" && s[0] != ' ' && lines[i-1][0] != ' ' {
+				b.WriteByte(' ')
+			} else if style == '|' || s != "" || lines[i-1] == "" {
+				b.WriteByte('\n')
+			}
+		}
+		b.WriteString(s)
+	}
+	switch {
+	case len(lines) == 0:
+	case chomp == "-":
+	case chomp == "+":
+		b.WriteString(strings.Repeat("\n", trailing+1))
+	default:
+		b.WriteByte('\n')
+	}
+	return &yamlNode{kind: yamlScalar, line: l.num, value: b.String()}, nil
+}
+
+// yamlSplitKey 拆分 "键: 值"，ok 为 false 表示这一行不是映射
+func yamlSplitKey(s string) (key, rest string, ok bool, err error) {
+	if s == "" || strings.IndexByte("[{|>", s[0]) >= 0 {
+		return "", "", false, nil
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		f := &yamlFlow{s: s}
+		n, err := f.quoted()
+		if err != nil {
+			return "", "", false, nil
+		}
+		after := s[f.i:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		return n.value, strings.TrimSpace(after[1:]), true, nil
+	}
+	i := strings.Index(s, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(s, ":") {
+			return "", "", false, nil
+		}
+		i = len(s) - 1
+	}
+	key = strings.TrimRight(s[:i], " ")
+	if key == "?" || strings.HasPrefix(key, "? ") {
+		return "", "", false, fmt.Errorf("不支持复杂键")
+	}
+	return key, strings.TrimSpace(s[i+1:]), true, nil
+}
+
+// yamlFlowDepth 返回流式集合未闭合的括号层数
+func yamlFlowDepth(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// yamlFlow 解析一行内的流式集合和引号字符串
+type yamlFlow struct {
+	s    string
+	i    int
+	line int
+}
+
+func (f *yamlFlow) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("第 %d 行: %s", f.line, fmt.Sprintf(format, a...))
+}
+
+func (f *yamlFlow) space() {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (*yamlNode, error) {
+	f.space()
+	if f.i == len(f.s) {
+		return nil, f.errorf("缺少值")
+	}
+	switch f.s[f.i] {
+	case '[':
+		n := &yamlNode{kind: yamlSeq, line: f.line}
+		f.i++
+		for {
+			f.space()
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return n, nil
+			}
+			item, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		n := &yamlNode{kind: yamlMap, line: f.line}
+		f.i++
+		for {
+			f.space()
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return n, nil
+			}
+			k, err := f.scalar(true)
+			if err != nil {
+				return nil, err
+			}
+			f.space()
+			if f.i == len(f.s) || f.s[f.i] != ':' {
+				return nil, f.errorf("键 %s 后缺少冒号", k.value)
+			}
+			f.i++
+			f.space()
+			v := &yamlNode{kind: yamlScalar, line: f.line, plain: true}
+			if f.i < len(f.s) && f.s[f.i] != ',' && f.s[f.i] != '}' {
+				if v, err = f.value(); err != nil {
+					return nil, err
+				}
+			}
+			n.keys = append(n.keys, k.value)
+			n.values = append(n.values, v)
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '&', '*', '!':
+		return nil, f.errorf("不支持锚点、别名和标签（以 * 开头的通配符需要加引号）")
+	}
+	return f.scalar(false)
+}
+
+// separator 跳过元素之间的逗号，遇到结束括号时不消耗
+func (f *yamlFlow) separator(end byte) error {
+	f.space()
+	if f.i == len(f.s) {
+		return f.errorf("缺少 %c", end)
+	}
+	switch f.s[f.i] {
+	case ',':
+		f.i++
+		return nil
+	case end:
+		return nil
+	}
+	return f.errorf("此处应为 , 或 %c", end)
+}
+
+// scalar 解析流式集合中的标量，key 为 true 时遇到 ": " 结束
+func (f *yamlFlow) scalar(key bool) (*yamlNode, error) {
+	f.space()
+	if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+		return f.quoted()
+	}
+	start := f.i
+	for f.i < len(f.s) {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' || c == '[' || c == '{' {
+			break
+		}
+		if key && c == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.i+1]) >= 0) {
+			break
+		}
+		f.i++
+	}
+	return &yamlNode{kind: yamlScalar, line: f.line, value: strings.TrimSpace(f.s[start:f.i]), plain: true}, nil
+}
+
+func (f *yamlFlow) quoted() (*yamlNode, error) {
+	q := f.s[f.i]
+	var b strings.Builder
+	for f.i++; f.i < len(f.s); f.i++ {
+		c := f.s[f.i]
+		switch {
+		case c == q && q == '\'' && f.i+1 < len(f.s) && f.s[f.i+1] == '\'':
+			b.WriteByte('\'')
+			f.i++
+		case c == q:
+			f.i++
+			return &yamlNode{kind: yamlScalar, line: f.line, value: b.String()}, nil
+		case c == '\\' && q == '"':
+			n, err := f.escape()
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(n)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, f.errorf("引号没有闭合")
+}
+
+// escape 解析双引号字符串中的转义，f.i 指向反斜杠
+func (f *yamlFlow) escape() (string, error) {
+	if f.i+1 == len(f.s) {
+		return "", f.errorf("引号没有闭合")
+	}
+	f.i++
+	switch c := f.s[f.i]; c {
+	case 'n':
+		return "\n", nil
+	case 't':
+		return "\t", nil
+	case 'r':
+		return "\r", nil
+	case '0':
+		return "\x00", nil
+	case '"', '\\', '/', ' ':
+		return string(c), nil
+	case 'x', 'u', 'U':
+		size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+		if f.i+size >= len(f.s) {
+			return "", f.errorf("转义 \\%c 不完整", c)
+		}
+		r, err := strconv.ParseUint(f.s[f.i+1:f.i+1+size], 16, 32)
+		if err != nil {
+			return "", f.errorf("转义 \\%c 无效", c)
+		}
+		f.i += size
+		return string(rune(r)), nil
+	}
+	return "", f.errorf("不支持的转义 \\%c（Windows 路径请使用单引号）", f.s[f.i])
+}
+
+// yamlConvert 把节点转换为可以编码为 JSON 的值，t 为目标字段的类型，未知时按 YAML 的规则推断
+func yamlConvert(n *yamlNode, t reflect.Type) (interface{}, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch n.kind {
+	case yamlMap:
+		m := make(map[string]interface{}, len(n.keys))
+		for i, k := range n.keys {
+			var ft reflect.Type
+			if t != nil && t.Kind() == reflect.Struct {
+				ft = yamlFieldType(t, k)
+			} else if t != nil && t.Kind() == reflect.Map {
+				ft = t.Elem()
+			}
+			v, err := yamlConvert(n.values[i], ft)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case yamlSeq:
+		var et reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			et = t.Elem()
+		}
+		items := make([]interface{}, 0, len(n.items))
+		for _, item := range n.items {
+			v, err := yamlConvert(item, et)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+
+	if !n.plain {
+		return n.value, nil
+	}
+	switch n.value {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	}
+	if t != nil && t.Kind() == reflect.String {
+		return n.value, nil
+	}
+	switch n.value {
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if t != nil && t.Kind() == reflect.Bool {
+		// 布尔字段也接受 YAML 1.1 的 yes/no、on/off
+		switch strings.ToLower(n.value) {
+		case "yes", "on":
+			return true, nil
+		case "no", "off":
+			return false, nil
+		}
+	}
+	if num, ok := yamlNumber(n.value); ok {
+		return num, nil
+	}
+	return n.value, nil
+}
+
+// yamlNumber 识别十进制、0x 十六进制、0o 八进制整数和浮点数
+func yamlNumber(s string) (json.Number, bool) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(v, 10)), true
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		if v, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return json.Number(strconv.FormatInt(v, 10)), true
+		}
+		return "", false
+	}
+	if strings.ContainsAny(s, "_xXpP") || !strings.ContainsAny(s, "0123456789") {
+		return "", false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return "", false
+	}
+	return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), true
+}
+
+// yamlFieldType 按 JSON 标签查找结构体字段的类型，与 encoding/json 一样先精确匹配再忽略大小写
+func yamlFieldType(t reflect.Type, key string) reflect.Type {
+	var fold reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" || f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if r := yamlFieldType(ft, key); r != nil {
+					return r
+				}
+				continue
+			}
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			return f.Type
+		}
+		if fold == nil && strings.EqualFold(name, key) {
+			fold = f.Type
+		}
+	}
+	return fold
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// YARA 规则：对新增和被修改的文件运行 rules_dir 中的 YARA 规则（*.yar、*.yara），安全团队可以接入
+// 自己的 WebShell 和恶意代码规则。调用系统中安装的 yara 命令，每个规则文件使用以文件名命名的
+// 命名空间，不同文件中的同名规则不会冲突
+
+// YaraConfig 配置 YARA 规则扫描
+type YaraConfig struct {
+	RulesDir    string   `json:"rules_dir"`     // 规则目录，留空表示不使用 YARA
+	Yara        string   `json:"yara"`          // yara 命令，默认 yara
+	Severity    string   `json:"severity"`      // 命中时的级别，默认 high
+	Channels    []string `json:"channels"`      // 命中时额外通知的渠道
+	Timeout     int      `json:"timeout"`       // 单个文件的扫描超时（秒），默认 30
+	MaxFileSize int64    `json:"max_file_size"` // 超过该大小的文件不扫描，默认 10 MB
+}
+
+const sigYara = "yara"
+
+var (
+	yaraConfig YaraConfig
+	yaraRules  []string // 规则文件，按文件名排序
+)
+
+func applyYaraConfig(c YaraConfig) error {
+	yaraRules = nil
+	if c.Yara == "" {
+		c.Yara = "yara"
+	}
+	if c.Severity == "" {
+		c.Severity = sevHigh
+	}
+	if !validSeverity(c.Severity) {
+		return fmt.Errorf("yara.severity 无效: %s", c.Severity)
+	}
+	if c.Timeout < 0 || c.MaxFileSize < 0 {
+		return fmt.Errorf("yara.timeout 和 max_file_size 不能为负数")
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 30
+	}
+	if c.MaxFileSize == 0 {
+		c.MaxFileSize = 10 << 20
+	}
+	yaraConfig = c
+	if c.RulesDir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.RulesDir)
+	if err != nil {
+		return fmt.Errorf("读取 YARA 规则目录错误: %v", err)
+	}
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !e.IsDir() && (ext == ".yar" || ext == ".yara") {
+			yaraRules = append(yaraRules, filepath.Join(c.RulesDir, e.Name()))
+		}
+	}
+	if len(yaraRules) == 0 {
+		return fmt.Errorf("YARA 规则目录 %s 中没有 .yar 或 .yara 文件", c.RulesDir)
+	}
+	sort.Strings(yaraRules)
+	if _, err := exec.LookPath(c.Yara); err != nil {
+		log.Printf("找不到 yara 命令 %s，YARA 规则不会生效: %v", c.Yara, err)
+	}
+	return nil
+}
+
+// yaraArgs 返回 yara 的命令行参数：每个规则文件一个命名空间，输出中带上命名空间
+func yaraArgs(target string) []string {
+	args := []string{"-w", "-e", "-a", strconv.Itoa(yaraConfig.Timeout)}
+	for _, r := range yaraRules {
+		ns := strings.TrimSuffix(filepath.Base(r), filepath.Ext(r))
+		args = append(args, ns+":"+r)
+	}
+	return append(args, target)
+}
+
+// runYara 返回文件命中的规则，形如 命名空间:规则名
+func runYara(path string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(yaraConfig.Timeout+5)*time.Second)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, yaraConfig.Yara, yaraArgs(path)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var rules []string
+	sc := bufio.NewScanner(&stdout)
+	for sc.Scan() {
+		// 每行为 “命名空间:规则名 文件路径”
+		if rule, _, ok := strings.Cut(sc.Text(), " "); ok && rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// checkYara 对新增、修改或移动的文件运行 YARA 规则
+func checkYara(ev *Event) {
+	if len(yaraRules) == 0 || ev.Stream != "" {
+		return
+	}
+	switch ev.Type {
+	case "new", "modified", "renamed":
+	default:
+		return
+	}
+	info, err := os.Stat(ev.Path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > yaraConfig.MaxFileSize {
+		return
+	}
+	rules, err := runYara(ev.Path)
+	if err != nil {
+		log.Printf("YARA 扫描 %s 失败: %v", ev.Path, err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	ev.Yara = rules
+	for _, r := range rules {
+		ev.Findings = append(ev.Findings, "YARA 规则命中: "+r)
+	}
+	ev.Severity = maxSeverity(ev.Severity, yaraConfig.Severity)
+	addSignal(ev, sigYara)
+	for _, ch := range yaraConfig.Channels {
+		if !containsString(ev.extra, ch) {
+			ev.extra = append(ev.extra, ch)
+		}
+	}
+}